@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"gopod/podutils"
@@ -18,10 +19,72 @@ type ExportType int
 const (
 	ExportJson ExportType = iota
 	ExportDB
+	ExportOpml
+	ExportCsv
+	ExportMarkdown
+	ExportHtml
+	ExportRss
 )
 
 func (e ExportType) String() string {
-	return [...]string{"json", "sqlite"}[e]
+	return [...]string{"json", "sqlite", "opml", "csv", "markdown", "html", "rss"}[e]
+}
+
+// how import handles episodes (and feeds, images) already in the database
+type ImportStrategy int
+
+const (
+	ImportSkip      ImportStrategy = iota // keep what's in the database
+	ImportOverwrite                       // replace with the imported
+	ImportNewest                          // keep whichever was updated last
+)
+
+func (i ImportStrategy) String() string {
+	return [...]string{"skip", "overwrite", "keep-newest"}[i]
+}
+
+// how checkdownloads resolves filename collisions
+type CollisionPolicy int
+
+const (
+	CollisionPrompt         CollisionPolicy = iota // ask which to keep
+	CollisionKeepNewest                            // keep the most recently published
+	CollisionKeepOldest                            // keep the first published
+	CollisionKeepDownloaded                        // keep the one downloaded (the file on disk)
+	CollisionKeepLarger                            // keep the larger episode
+	CollisionRename                                // keep both, giving one a unique filename
+)
+
+func (c CollisionPolicy) String() string {
+	return [...]string{"prompt", "keep-newest", "keep-oldest", "keep-downloaded", "keep-larger", "rename"}[c]
+}
+
+// what checkdownloads does with files in a feed's directory that no episode references
+type OrphanAction int
+
+const (
+	OrphanNone  OrphanAction = iota // not checked
+	OrphanList                      // report only
+	OrphanAdopt                     // match to episodes not downloaded, and mark them downloaded
+	OrphanTrash                     // move to the feed's .trash directory
+)
+
+func (o OrphanAction) String() string {
+	return [...]string{"none", "list", "adopt", "trash"}[o]
+}
+
+// output format for commands that report on the library (status, etc)
+type OutputFormat int
+
+const (
+	OutputAuto OutputFormat = iota // table if on a terminal, json otherwise
+	OutputTable
+	OutputJson
+	OutputCsv
+)
+
+func (o OutputFormat) String() string {
+	return [...]string{"auto", "table", "json", "csv"}[o]
 }
 
 type CommandType int
@@ -35,10 +98,24 @@ const ( // commands
 	Preview
 	Archive
 	Hack
+	Add
+	ImportOpml
+	Status
+	Search
+	Stats
+	Serve
+	Undelete
+	Purge
+	DbMigrate
+	History
+	DbRestore
+	Unarchive
+	ArchiveVerify
+	Import
 )
 
 func (c CommandType) String() string {
-	return [...]string{"unknown", "update", "checkDownloaded", "delete", "export", "preview", "archive", "hack"}[c]
+	return [...]string{"unknown", "update", "checkDownloaded", "delete", "export", "preview", "archive", "hack", "add", "importOpml", "status", "search", "stats", "serve", "undelete", "purge", "dbMigrate", "history", "dbRestore", "unarchive", "archiveVerify", "import"}[c]
 }
 
 // for testing purposes
@@ -63,6 +140,17 @@ type CommandLineOptions struct {
 	CheckDownloadOpt
 	ExportOpt
 	HackOpt
+	AddOpt
+	ImportOpmlOpt
+	SearchOpt
+	OutputOpt
+	ServeOpt
+	PurgeOpt
+	HistoryOpt
+	DbRestoreOpt
+	UnarchiveOpt
+	ArchiveOpt
+	ImportOpt
 }
 
 // global options
@@ -83,10 +171,17 @@ type UpdateOpt struct {
 
 // check downloads specific
 type CheckDownloadOpt struct {
-	DoArchive     bool
-	DoRename      bool
-	SaveCollision bool
-	DoCollision   bool
+	DoArchive       bool
+	DoRename        bool
+	SaveCollision   bool
+	DoCollision     bool
+	CollisionPolicy CollisionPolicy // prompt unless set; any other policy implies collision handling
+	policyStr       string
+	OrphanAction    OrphanAction
+	orphansStr      string
+	DoRepair        bool // reset corrupted downloads, so they're downloaded again
+	RepairNow       bool // download them again now, rather than on the next update
+	DoRehash        bool // recalculate item hashes with the current config (i.e. changed urlParse)
 }
 
 // export specific
@@ -95,12 +190,84 @@ type ExportOpt struct {
 	ExportFormat   ExportType
 	formatStr      string
 	ExportPath     string
+	// episode filters; nil for either downloaded or not (archived or not)
+	ExportAfter      string
+	ExportBefore     string
+	ExportDownloaded *bool
+	ExportArchived   *bool
+	downloadedStr    string
+	archivedStr      string
 }
 
 type HackOpt struct {
 	GuidHackXml string
 }
 
+// add specific
+type AddOpt struct {
+	AddUrl string
+}
+
+// import opml specific
+type ImportOpmlOpt struct {
+	OpmlFile string
+}
+
+// search specific
+type SearchOpt struct {
+	SearchQuery  string
+	SearchAfter  string
+	SearchBefore string
+	SearchLimit  int
+}
+
+// serve specific
+type ServeOpt struct {
+	ServeListen string
+}
+
+// purge specific (dry run also used by db migrate and import)
+type PurgeOpt struct {
+	DryRun      bool
+	RemoveFiles bool
+}
+
+// history specific
+type HistoryOpt struct {
+	HistoryItem string // hash or filename
+}
+
+// db restore specific
+type DbRestoreOpt struct {
+	RestoreFile string
+}
+
+// unarchive specific; all archived items if neither is set
+type UnarchiveOpt struct {
+	UnarchiveYear int
+	UnarchiveItem string // hash or filename
+}
+
+// archive specific
+type ArchiveOpt struct {
+	ArchiveBundle    string // bundle format; tar.zst or zip
+	RemoveOriginals  bool   // remove archive directories once bundled and verified
+	RebuildArchiveDb bool   // recreate archive dbs from the main db
+}
+
+// import specific
+type ImportOpt struct {
+	ImportFrom     string // json or db export
+	ImportStrategy ImportStrategy
+	strategyStr    string
+}
+
+// output format, for reporting commands
+type OutputOpt struct {
+	OutputFormat OutputFormat
+	outputStr    string
+}
+
 func (c CommandLine) String() string {
 	ret := fmt.Sprintf("{config:%s command:%s", c.ConfigFile, c.Command)
 	if c.FeedShortname != "" {
@@ -152,8 +319,28 @@ func InitCommandLine(args []string) (*CommandLine, error) {
 		return nil, errors.New("command not recognized")
 	} else if c.Command == Delete && c.FeedShortname == "" {
 		return nil, errors.New("delete command requires feed specified (use --feed=<shortname>)")
+	} else if c.Command == Undelete && c.FeedShortname == "" {
+		return nil, errors.New("undelete command requires feed specified (use --feed=<shortname>)")
+	} else if c.Command == History && (c.FeedShortname == "" || c.HistoryItem == "") {
+		return nil, errors.New("history command requires feed and item specified (use --feed=<shortname> --item=<hash|filename>)")
+	} else if c.Command == Unarchive && c.FeedShortname == "" {
+		return nil, errors.New("unarchive command requires feed specified (use --feed=<shortname>)")
+	} else if c.Command == Unarchive && c.UnarchiveYear != 0 && c.UnarchiveItem != "" {
+		return nil, errors.New("unarchive command takes either year or item, not both")
+	} else if c.Command == Archive && c.RemoveOriginals && c.ArchiveBundle == "" {
+		return nil, errors.New("archive --remove-originals requires --bundle")
 	} else if c.Command == Preview && c.FeedShortname == "" {
 		return nil, errors.New("preview command requires feed specified (use --feed=<shortname>)")
+	} else if c.Command == Add && c.AddUrl == "" {
+		return nil, errors.New("add command requires feed url (use add <url>)")
+	} else if c.Command == ImportOpml && c.OpmlFile == "" {
+		return nil, errors.New("import-opml command requires opml file (use import-opml <file.opml>)")
+	} else if c.Command == Search && c.SearchQuery == "" {
+		return nil, errors.New("search command requires query (use search <query>)")
+	} else if c.Command == Import && c.ImportFrom == "" {
+		return nil, errors.New("import command requires export file (use import --from <file.json|file.db>)")
+	} else if c.Command == DbRestore && c.RestoreFile == "" {
+		return nil, errors.New("db restore command requires backup file (use db restore <backup>)")
 	}
 
 	if c.ConfigFile == "" {
@@ -203,7 +390,7 @@ func (c *CommandLine) buildOptions() *getoptions.GetOpt {
 		opt.Description("use proxy url for network requests"),
 		opt.Alias("p", " proxy"))
 	opt.BoolVar(&c.BackupDb, "backup-db", false,
-		opt.Description("Backup database before opening"),
+		opt.Description("Backup database before the first write (older backups rotated; see dbbackupsretained)"),
 		opt.Alias("bak"))
 	opt.StringVar(&c.LogLevelStr, "log", "info",
 		opt.Description("level for log outputs (console and log files)."),
@@ -234,20 +421,54 @@ func (c *CommandLine) buildOptions() *getoptions.GetOpt {
 		opt.Description("Collision handling; will prompt for which item to keep"))
 	checkcommand.BoolVar(&c.SaveCollision, "savecollision", false, opt.Alias("savecoll"),
 		opt.Description("Save collision differences to <workingdir>\\.collisions\\"))
-	checkcommand.SetCommandFn(c.generateCmdFunc(CheckDownloaded))
+	checkcommand.StringVar(&c.policyStr, "collision-policy", "",
+		opt.Description("resolve collisions without prompting; decisions are written to a report in <workingdir>\\.collision\\"),
+		opt.ArgName("keep-newest|keep-oldest|keep-downloaded|keep-larger|rename"))
+	checkcommand.StringVar(&c.orphansStr, "orphans", "",
+		opt.Description("check for files in the feed directory no episode references; adopt matches them to episodes not downloaded, trash moves them to <shortname>\\.trash\\"),
+		opt.ArgName("list|adopt|trash"))
+	checkcommand.BoolVar(&c.DoRepair, "repair", false,
+		opt.Description("reset corrupted or truncated downloads (moved to <shortname>\\.trash\\), so the next update downloads them again"))
+	checkcommand.BoolVar(&c.RepairNow, "repair-now", false,
+		opt.Description("reset corrupted or truncated downloads, and download them again now"))
+	checkcommand.BoolVar(&c.DoRehash, "rehash", false,
+		opt.Description("recalculate item hashes from the stored item xml (useful when urlParse changes)"))
+	checkcommand.BoolVar(&c.Simulate, "simulate", false, opt.Alias("sim"),
+		opt.Description("Simulate; preview rehash without saving database"))
+	checkcommand.StringVar(&c.outputStr, "format", "auto",
+		opt.Description("report output format - table, json, csv (findings only) or auto (default; table on terminal, otherwise json)"))
+	checkcommand.SetCommandFn(c.OnCheckDownloadsFunc)
 
 	exportCommand := opt.NewCommand("export", "export feed from database (either all or specific feed)")
 	exportCommand.BoolVar(&c.IncludeDeleted, "include-deleted", false,
 		opt.Description("include deleted feeds in archive"))
 	exportCommand.StringVar(&c.formatStr, "format", "db",
-		opt.Description("format for export - json or db (default) "))
+		opt.Description("format for export - json, opml, csv, md (markdown catalog), html (catalog), rss (feed as stored) or db (default) "))
 	exportCommand.StringVar(&c.ExportPath, "export-path", "",
 		opt.Description("path for export (default to '#configDir#\\#shortname#\\')"))
+	exportCommand.StringVar(&c.ExportAfter, "after", "",
+		opt.Description("only episodes published on or after date"))
+	exportCommand.StringVar(&c.ExportBefore, "before", "",
+		opt.Description("only episodes published before date"))
+	exportCommand.StringVar(&c.downloadedStr, "is-downloaded", "",
+		opt.Description("only episodes downloaded (true) or not (false)"), opt.ArgName("true|false"))
+	exportCommand.StringVar(&c.archivedStr, "is-archived", "",
+		opt.Description("only episodes archived (true) or not (false)"), opt.ArgName("true|false"))
 	exportCommand.SetCommandFn(c.OnExportFunc)
 
 	deletecommand := opt.NewCommand("deletefeed", "delete feed and all items from database (performs a soft delete)")
 	deletecommand.SetCommandFn(c.generateCmdFunc(Delete))
 
+	undeleteCommand := opt.NewCommand("undelete", "restore a deleted feed, along with its items and images")
+	undeleteCommand.SetCommandFn(c.generateCmdFunc(Undelete))
+
+	purgeCommand := opt.NewCommand("purge", "permanently remove deleted feeds (or specific feed) and their items from database")
+	purgeCommand.BoolVar(&c.DryRun, "dry-run", false,
+		opt.Description("show what would be removed; does not change database or files"))
+	purgeCommand.BoolVar(&c.RemoveFiles, "remove-files", false,
+		opt.Description("also remove the feed directory (and all downloaded/archived files) from disk"))
+	purgeCommand.SetCommandFn(c.generateCmdFunc(Purge))
+
 	previewCommand := opt.NewCommand("preview", "preview feed file naming, based solely on feed xml.  Does not require feed existing")
 	previewCommand.BoolVar(&c.UseMostRecentXml, "use-recent", false, opt.Alias("use-recent-xml", "userecent"),
 		opt.Description("Use the most recent feed xml file fetched rather than checking for new"))
@@ -257,7 +478,24 @@ func (c *CommandLine) buildOptions() *getoptions.GetOpt {
 	archiveCommand := opt.NewCommand("archive", "archive podcasts not in current year")
 	archiveCommand.BoolVar(&c.Simulate, "simulate", false, opt.Alias("sim"),
 		opt.Description("Simulate; will not move items or save database"))
-	archiveCommand.SetCommandFn(c.generateCmdFunc(Archive))
+	archiveCommand.StringVar(&c.ArchiveBundle, "bundle", "",
+		opt.Description("also pack each archive directory (episodes, images and db) into a single bundle, with a manifest of checksums"), opt.ArgName("tar.zst|zip"))
+	archiveCommand.BoolVar(&c.RemoveOriginals, "remove-originals", false,
+		opt.Description("remove archive directories once their bundle is verified"))
+	archiveCommand.BoolVar(&c.RebuildArchiveDb, "rebuild-db", false,
+		opt.Description("recreate each archive directory's database from the main database; the previous one is kept as a backup"))
+	archiveCommand.SetCommandFn(c.OnArchiveFunc)
+	archiveVerifyCommand := archiveCommand.NewCommand("verify", "check archive bundles against their manifests")
+	archiveVerifyCommand.SetCommandFn(c.generateCmdFunc(ArchiveVerify))
+
+	unarchiveCommand := opt.NewCommand("unarchive", "move archived episodes (and their images) back to the download directory")
+	unarchiveCommand.IntVar(&c.UnarchiveYear, "year", 0,
+		opt.Description("only episodes published in year"))
+	unarchiveCommand.StringVar(&c.UnarchiveItem, "item", "",
+		opt.Description("single episode hash or filename"), opt.ArgName("hash|filename"))
+	unarchiveCommand.BoolVar(&c.Simulate, "simulate", false, opt.Alias("sim"),
+		opt.Description("Simulate; will not move items or save database"))
+	unarchiveCommand.SetCommandFn(c.generateCmdFunc(Unarchive))
 
 	hackCommand := opt.NewCommand("hack", "don't do this")
 	hackCommand.StringVar(&c.GuidHackXml, "guidhack", ""/*, opt.Required("xml file required for hack")*/)
@@ -265,6 +503,62 @@ func (c *CommandLine) buildOptions() *getoptions.GetOpt {
 	/*opt.Description("Simulate; will not download items or save database")*/)
 	hackCommand.SetCommandFn(c.generateCmdFunc(Hack))
 
+	addCommand := opt.NewCommand("add", "subscribe to a new feed from url; prompts for shortname and filename parsing, then appends the feed to config")
+	addCommand.SetCommandFn(c.OnAddFunc)
+
+	importOpmlCommand := opt.NewCommand("import-opml", "import feed subscriptions from opml file, appending new feeds to config (existing feeds are skipped)")
+	importOpmlCommand.SetCommandFn(c.OnImportOpmlFunc)
+
+	importCommand := opt.NewCommand("import", "merge feeds from a json or db export (see export) into the database")
+	importCommand.StringVar(&c.ImportFrom, "from", "",
+		opt.Description("export file to import"), opt.ArgName("file.json|file.db"))
+	importCommand.StringVar(&c.strategyStr, "strategy", "skip",
+		opt.Description("for episodes already in the database - skip (default), overwrite, or keep-newest"))
+	importCommand.BoolVar(&c.DryRun, "dry-run", false,
+		opt.Description("show what would be imported; does not change database"))
+	importCommand.SetCommandFn(c.OnImportFunc)
+
+	statusCommand := opt.NewCommand("status", "summarize feeds in database (or specific feed); episode counts, last update, disk usage and errors")
+	statusCommand.StringVar(&c.outputStr, "format", "auto",
+		opt.Description("output format - table, json, csv or auto (default; table on terminal, otherwise json)"))
+	statusCommand.SetCommandFn(c.generateOutputCmdFunc(Status))
+
+	searchCommand := opt.NewCommand("search", "full text search of episode titles, descriptions and show notes (query uses sqlite fts5 syntax)")
+	searchCommand.StringVar(&c.SearchAfter, "after", "",
+		opt.Description("only episodes published on or after date"))
+	searchCommand.StringVar(&c.SearchBefore, "before", "",
+		opt.Description("only episodes published before date"))
+	searchCommand.IntVar(&c.SearchLimit, "limit", 0,
+		opt.Description("max number of results (default 50); -1 for all"))
+	searchCommand.StringVar(&c.outputStr, "format", "auto",
+		opt.Description("output format - table, json, csv or auto (default; table on terminal, otherwise json)"))
+	searchCommand.SetCommandFn(c.OnSearchFunc)
+
+	statsCommand := opt.NewCommand("stats", "library statistics; downloads per month, size and length per feed, publishing cadence and gaps (includes archives)")
+	statsCommand.StringVar(&c.outputStr, "format", "auto",
+		opt.Description("output format - table, json, csv (feed stats only) or auto (default; table on terminal, otherwise json)"))
+	statsCommand.SetCommandFn(c.generateOutputCmdFunc(Stats))
+
+	serveCommand := opt.NewCommand("serve", "serve downloaded episodes (including archived) as private rss feeds; one feed per shortname, plus all feeds new episodes")
+	serveCommand.StringVar(&c.ServeListen, "listen", "",
+		opt.Description("address to listen on (default ':8080')"), opt.ArgName("[host]:port"))
+	serveCommand.SetCommandFn(c.generateCmdFunc(Serve))
+
+	historyCommand := opt.NewCommand("history", "show revisions of an episode's feed xml, and the changes between each")
+	historyCommand.StringVar(&c.HistoryItem, "item", "",
+		opt.Description("episode hash or filename"), opt.ArgName("hash|filename"))
+	historyCommand.StringVar(&c.outputStr, "format", "auto",
+		opt.Description("output format - table, json, csv or auto (default; table on terminal, otherwise json)"))
+	historyCommand.SetCommandFn(c.generateOutputCmdFunc(History))
+
+	dbCommand := opt.NewCommand("db", "database maintenance")
+	dbMigrateCommand := dbCommand.NewCommand("migrate", "apply pending schema migrations to database (and archive databases); backs up each database first")
+	dbMigrateCommand.BoolVar(&c.DryRun, "dry-run", false,
+		opt.Description("show pending migrations; does not change database"))
+	dbMigrateCommand.SetCommandFn(c.generateCmdFunc(DbMigrate))
+	dbRestoreCommand := dbCommand.NewCommand("restore", "replace database with a backup, after an integrity check; the current database is backed up first")
+	dbRestoreCommand.SetCommandFn(c.OnDbRestoreFunc)
+
 	opt.HelpCommand("help", opt.Alias("h", "?"))
 	return opt
 }
@@ -279,6 +573,65 @@ func (c *CommandLine) generateCmdFunc(t CommandType) getoptions.CommandFn {
 	return fn
 }
 
+// for commands using output format; parses the format after options are read
+func (c *CommandLine) generateOutputCmdFunc(t CommandType) getoptions.CommandFn {
+	fn := func(context.Context, *getoptions.GetOpt, []string) error {
+		c.Command = t
+
+		if format, err := parseOutputFormat(c.outputStr); err != nil {
+			return err
+		} else {
+			c.OutputFormat = format
+		}
+		return nil
+	}
+	return fn
+}
+
+func parseOutputFormat(str string) (OutputFormat, error) {
+	for _, format := range []OutputFormat{OutputAuto, OutputTable, OutputJson, OutputCsv} {
+		if strings.EqualFold(str, format.String()) {
+			return format, nil
+		}
+	}
+	return OutputAuto, fmt.Errorf("unrecognized output format '%v'", str)
+}
+
+func (c *CommandLine) OnCheckDownloadsFunc(ctx context.Context, opt *getoptions.GetOpt, list []string) error {
+	c.Command = CheckDownloaded
+	c.DoRepair = c.DoRepair || c.RepairNow
+
+	if format, err := parseOutputFormat(c.outputStr); err != nil {
+		return err
+	} else {
+		c.OutputFormat = format
+	}
+
+	if c.orphansStr != "" {
+		var found bool
+		for _, action := range []OrphanAction{OrphanList, OrphanAdopt, OrphanTrash} {
+			if strings.EqualFold(c.orphansStr, action.String()) {
+				c.OrphanAction, found = action, true
+			}
+		}
+		if found == false {
+			return fmt.Errorf("unrecognized orphans action '%v' (use list, adopt or trash)", c.orphansStr)
+		}
+	}
+
+	if c.policyStr == "" {
+		return nil
+	}
+	for _, policy := range []CollisionPolicy{CollisionKeepNewest, CollisionKeepOldest, CollisionKeepDownloaded, CollisionKeepLarger, CollisionRename} {
+		if strings.EqualFold(c.policyStr, policy.String()) {
+			c.CollisionPolicy = policy
+			c.DoCollision = true
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognized collision policy '%v' (use keep-newest, keep-oldest, keep-downloaded, keep-larger or rename)", c.policyStr)
+}
+
 func (c *CommandLine) OnExportFunc(ctx context.Context, opt *getoptions.GetOpt, list []string) error {
 	c.Command = Export
 	fmt.Printf("command export")
@@ -287,9 +640,106 @@ func (c *CommandLine) OnExportFunc(ctx context.Context, opt *getoptions.GetOpt,
 		c.ExportFormat = ExportJson
 	} else if strings.EqualFold(c.formatStr, "db") {
 		c.ExportFormat = ExportDB
+	} else if strings.EqualFold(c.formatStr, "opml") {
+		c.ExportFormat = ExportOpml
+	} else if strings.EqualFold(c.formatStr, "csv") {
+		c.ExportFormat = ExportCsv
+	} else if strings.EqualFold(c.formatStr, "md") || strings.EqualFold(c.formatStr, "markdown") {
+		c.ExportFormat = ExportMarkdown
+	} else if strings.EqualFold(c.formatStr, "html") {
+		c.ExportFormat = ExportHtml
+	} else if strings.EqualFold(c.formatStr, "rss") {
+		c.ExportFormat = ExportRss
 	} else {
 		return fmt.Errorf("unrecognized export format '%v'", c.formatStr)
 	}
 
+	var err error
+	if c.ExportDownloaded, err = parseBoolFilter(c.downloadedStr); err != nil {
+		return fmt.Errorf("export downloaded filter: %w", err)
+	} else if c.ExportArchived, err = parseBoolFilter(c.archivedStr); err != nil {
+		return fmt.Errorf("export archived filter: %w", err)
+	}
+	if c.ExportFormat == ExportOpml &&
+		(c.ExportAfter != "" || c.ExportBefore != "" || c.ExportDownloaded != nil || c.ExportArchived != nil) {
+		return errors.New("episode filters don't apply to opml export")
+	}
+
+	return nil
+}
+
+func (c *CommandLine) OnAddFunc(ctx context.Context, opt *getoptions.GetOpt, list []string) error {
+	c.Command = Add
+	c.AddUrl = firstPositional(list)
+	return nil
+}
+
+func (c *CommandLine) OnImportOpmlFunc(ctx context.Context, opt *getoptions.GetOpt, list []string) error {
+	c.Command = ImportOpml
+	c.OpmlFile = firstPositional(list)
 	return nil
 }
+
+func (c *CommandLine) OnArchiveFunc(ctx context.Context, opt *getoptions.GetOpt, list []string) error {
+	c.Command = Archive
+
+	if c.ArchiveBundle != "" && c.ArchiveBundle != "tar.zst" && c.ArchiveBundle != "zip" {
+		return fmt.Errorf("unrecognized bundle format '%v' (use tar.zst or zip)", c.ArchiveBundle)
+	}
+	return nil
+}
+
+func (c *CommandLine) OnImportFunc(ctx context.Context, opt *getoptions.GetOpt, list []string) error {
+	c.Command = Import
+
+	for _, strategy := range []ImportStrategy{ImportSkip, ImportOverwrite, ImportNewest} {
+		if strings.EqualFold(c.strategyStr, strategy.String()) {
+			c.ImportStrategy = strategy
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognized import strategy '%v' (use skip, overwrite or keep-newest)", c.strategyStr)
+}
+
+func (c *CommandLine) OnDbRestoreFunc(ctx context.Context, opt *getoptions.GetOpt, list []string) error {
+	c.Command = DbRestore
+	c.RestoreFile = firstPositional(list)
+	return nil
+}
+
+func (c *CommandLine) OnSearchFunc(ctx context.Context, opt *getoptions.GetOpt, list []string) error {
+	if err := c.generateOutputCmdFunc(Search)(ctx, opt, list); err != nil {
+		return err
+	}
+
+	// query is all positional arguments, so quoting the query is optional
+	var terms = make([]string, 0, len(list))
+	for _, arg := range list {
+		if strings.HasPrefix(arg, "-") == false {
+			terms = append(terms, arg)
+		}
+	}
+	c.SearchQuery = strings.Join(terms, " ")
+	return nil
+}
+
+// empty is no filter (nil)
+func parseBoolFilter(str string) (*bool, error) {
+	if str == "" {
+		return nil, nil
+	} else if b, err := strconv.ParseBool(str); err != nil {
+		return nil, fmt.Errorf("'%v' not recognized (use true or false)", str)
+	} else {
+		return &b, nil
+	}
+}
+
+// returns the first positional argument (not an option) in the list; anything else is ignored
+func firstPositional(list []string) string {
+	for _, arg := range list {
+		if strings.HasPrefix(arg, "-") == false {
+			return arg
+		}
+	}
+	return ""
+}
@@ -46,9 +46,12 @@ func TestInitCommandLine(t *testing.T) {
 		updateTrue = UpdateOpt{Simulate: true, ForceUpdate: true, UseMostRecentXml: true,
 			MarkDownloaded: true, DownloadAfter: "2023-04-01"}
 		checkdlTrue   = CheckDownloadOpt{DoArchive: true, DoRename: true, SaveCollision: true, DoCollision: true}
+		checkOutput   = OutputOpt{outputStr: "auto"}
 		exportDefTrue = ExportOpt{IncludeDeleted: true, ExportFormat: ExportDB, ExportPath: "foo"}
 		exportJson    = ExportOpt{IncludeDeleted: true, ExportFormat: ExportJson, ExportPath: "foo"}
 		exportDB      = exportDefTrue
+		exportOpml    = ExportOpt{IncludeDeleted: true, ExportFormat: ExportOpml, ExportPath: "foo"}
+		boolPtr       = func(b bool) *bool { return &b }
 	)
 
 	ex, _ := os.Executable()
@@ -101,7 +104,59 @@ func TestInitCommandLine(t *testing.T) {
 		{"check downloads dependant",
 			args{args: CopyAndAppend([]string{"checkdownloads"}, allFlags...)},
 			exp{cmdline: CommandLine{barFooConfig, CheckDownloaded, "foo", "barfoo",
-				CommandLineOptions{GlobalOpt: globalTrue, CheckDownloadOpt: checkdlTrue}}},
+				CommandLineOptions{GlobalOpt: globalTrue, OutputOpt: checkOutput, UpdateOpt: UpdateOpt{Simulate: true},
+					CheckDownloadOpt: checkdlTrue}}},
+		},
+		{"check downloads collision policy",
+			args{args: []string{"checkdownloads", "--collision-policy=keep-newest", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, CheckDownloaded, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"}, OutputOpt: checkOutput,
+					CheckDownloadOpt: CheckDownloadOpt{DoCollision: true, CollisionPolicy: CollisionKeepNewest, policyStr: "keep-newest"}}}},
+		},
+		{"check downloads collision policy dependant",
+			args{args: CopyAndAppend([]string{"checkdownloads", "--collision-policy", "rename"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, CheckDownloaded, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, OutputOpt: checkOutput, UpdateOpt: UpdateOpt{Simulate: true},
+					CheckDownloadOpt: CheckDownloadOpt{DoArchive: true, DoRename: true, SaveCollision: true,
+						DoCollision: true, CollisionPolicy: CollisionRename, policyStr: "rename"}}}},
+		},
+		{"check downloads orphans",
+			args{args: []string{"checkdownloads", "--orphans", "adopt", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, CheckDownloaded, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"}, OutputOpt: checkOutput,
+					CheckDownloadOpt: CheckDownloadOpt{OrphanAction: OrphanAdopt, orphansStr: "adopt"}}}},
+		},
+		{"check downloads repair",
+			args{args: []string{"checkdownloads", "--repair", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, CheckDownloaded, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"}, OutputOpt: checkOutput,
+					CheckDownloadOpt: CheckDownloadOpt{DoRepair: true}}}},
+		},
+		{"check downloads repair now",
+			args{args: []string{"checkdownloads", "--repair-now", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, CheckDownloaded, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"}, OutputOpt: checkOutput,
+					CheckDownloadOpt: CheckDownloadOpt{DoRepair: true, RepairNow: true}}}},
+		},
+		{"check downloads rehash simulate",
+			args{args: []string{"checkdownloads", "--rehash", "--sim", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, CheckDownloaded, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"}, OutputOpt: checkOutput,
+					UpdateOpt: UpdateOpt{Simulate: true}, CheckDownloadOpt: CheckDownloadOpt{DoRehash: true}}}},
+		},
+		{"check downloads bad orphans action",
+			args{args: []string{"checkdownloads", "--orphans=delete", "--config", "barfoo.toml"}},
+			exp{errStr: "unrecognized orphans action 'delete'"},
+		},
+		{"check downloads json report",
+			args{args: []string{"checkdownloads", "--format", "json", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, CheckDownloaded, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"},
+					OutputOpt: OutputOpt{OutputFormat: OutputJson, outputStr: "json"}}}},
+		},
+		{"check downloads bad collision policy",
+			args{args: []string{"checkdownloads", "--collision-policy=keep-both", "--config", "barfoo.toml"}},
+			exp{errStr: "unrecognized collision policy 'keep-both'"},
 		},
 		{"preview dependant", args{args: CopyAndAppend([]string{"preview"}, allFlags...)},
 			exp{cmdline: CommandLine{barFooConfig, Preview, "foo", "barfoo",
@@ -124,6 +179,144 @@ func TestInitCommandLine(t *testing.T) {
 			exp{cmdline: CommandLine{barFooConfig, Export, "foo", "barfoo",
 				CommandLineOptions{GlobalOpt: globalTrue, ExportOpt: exportDB}}},
 		},
+		{"export opml", args{args: CopyAndAppend([]string{"export", "--format=opml"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Export, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, ExportOpt: exportOpml}}},
+		},
+		{"export csv filtered", args{args: CopyAndAppend([]string{"export", "--format=csv", "--after=2023-01-01",
+			"--before=2024-01-01", "--is-downloaded=true", "--is-archived=false"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Export, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, ExportOpt: ExportOpt{IncludeDeleted: true, ExportFormat: ExportCsv,
+					ExportPath: "foo", ExportAfter: "2023-01-01", ExportBefore: "2024-01-01",
+					ExportDownloaded: boolPtr(true), ExportArchived: boolPtr(false)}}}},
+		},
+		{"export markdown", args{args: CopyAndAppend([]string{"export", "--format=md"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Export, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, ExportOpt: ExportOpt{IncludeDeleted: true, ExportFormat: ExportMarkdown, ExportPath: "foo"}}}},
+		},
+		{"export html", args{args: CopyAndAppend([]string{"export", "--format=html"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Export, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, ExportOpt: ExportOpt{IncludeDeleted: true, ExportFormat: ExportHtml, ExportPath: "foo"}}}},
+		},
+		{"export rss", args{args: CopyAndAppend([]string{"export", "--format=rss", "--is-archived=1"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Export, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, ExportOpt: ExportOpt{IncludeDeleted: true, ExportFormat: ExportRss,
+					ExportPath: "foo", ExportArchived: boolPtr(true)}}}},
+		},
+		{"export bad filter", args{args: CopyAndAppend([]string{"export", "--format=csv", "--is-downloaded=maybe"}, allFlags...)},
+			exp{errStr: "'maybe' not recognized"},
+		},
+		{"export opml filtered", args{args: CopyAndAppend([]string{"export", "--format=opml", "--after=2023-01-01"}, allFlags...)},
+			exp{errStr: "episode filters don't apply to opml"},
+		},
+		// add specific
+		{"add missing url", args{args: []string{"add", "--config", "barfoo.toml"}},
+			exp{errStr: "add command requires feed url"},
+		},
+		{"add url", args{args: CopyAndAppend([]string{"add", "https://foo.bar/feed.xml"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Add, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, AddOpt: AddOpt{AddUrl: "https://foo.bar/feed.xml"}}}},
+		},
+		// serve specific
+		{"serve default", args{args: CopyAndAppend([]string{"serve"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Serve, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue}}},
+		},
+		{"serve listen", args{args: CopyAndAppend([]string{"serve", "--listen", "localhost:9090"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Serve, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, ServeOpt: ServeOpt{ServeListen: "localhost:9090"}}}},
+		},
+		// undelete/purge specific
+		{"undelete missing feed", args{args: []string{"undelete", "--config", "barfoo.toml"}},
+			exp{errStr: "undelete command requires feed specified"},
+		},
+		{"undelete feed", args{args: CopyAndAppend([]string{"undelete"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Undelete, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue}}},
+		},
+		{"purge default", args{args: []string{"purge", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, Purge, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"}}}},
+		},
+		{"purge dependant", args{args: CopyAndAppend([]string{"purge", "--dry-run", "--remove-files"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Purge, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, PurgeOpt: PurgeOpt{DryRun: true, RemoveFiles: true}}}},
+		},
+		{"history missing item", args{args: CopyAndAppend([]string{"history"}, allFlags...)},
+			exp{errStr: "history command requires feed and item specified"},
+		},
+		{"history", args{args: CopyAndAppend([]string{"history", "--item", "foo.mp3", "--format", "csv"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, History, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, HistoryOpt: HistoryOpt{HistoryItem: "foo.mp3"},
+					OutputOpt: OutputOpt{OutputFormat: OutputCsv, outputStr: "csv"}}}},
+		},
+		{"unarchive missing feed", args{args: []string{"unarchive", "--config", "barfoo.toml"}},
+			exp{errStr: "unarchive command requires feed specified"},
+		},
+		{"unarchive year and item", args{args: CopyAndAppend([]string{"unarchive", "--year", "2021", "--item", "foo.mp3"}, allFlags...)},
+			exp{errStr: "unarchive command takes either year or item"},
+		},
+		{"unarchive year", args{args: CopyAndAppend([]string{"unarchive", "--year", "2021"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Unarchive, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, UpdateOpt: UpdateOpt{Simulate: true},
+					UnarchiveOpt: UnarchiveOpt{UnarchiveYear: 2021}}}},
+		},
+		{"unarchive item", args{args: CopyAndAppend([]string{"unarchive", "--item", "foo.mp3"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Unarchive, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, UpdateOpt: UpdateOpt{Simulate: true},
+					UnarchiveOpt: UnarchiveOpt{UnarchiveItem: "foo.mp3"}}}},
+		},
+		{"archive bundle", args{args: CopyAndAppend([]string{"archive", "--bundle", "tar.zst", "--remove-originals"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Archive, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, UpdateOpt: UpdateOpt{Simulate: true},
+					ArchiveOpt: ArchiveOpt{ArchiveBundle: "tar.zst", RemoveOriginals: true}}}},
+		},
+		{"archive rebuild db", args{args: CopyAndAppend([]string{"archive", "--rebuild-db"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Archive, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, UpdateOpt: UpdateOpt{Simulate: true},
+					ArchiveOpt: ArchiveOpt{RebuildArchiveDb: true}}}},
+		},
+		{"archive bad bundle format", args{args: CopyAndAppend([]string{"archive", "--bundle", "rar"}, allFlags...)},
+			exp{errStr: "unrecognized bundle format 'rar'"},
+		},
+		{"archive remove without bundle", args{args: CopyAndAppend([]string{"archive", "--remove-originals"}, allFlags...)},
+			exp{errStr: "--remove-originals requires --bundle"},
+		},
+		{"archive verify", args{args: []string{"archive", "verify", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, ArchiveVerify, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"}}}},
+		},
+		{"import missing file", args{args: []string{"import", "--config", "barfoo.toml"}},
+			exp{errStr: "import command requires export file"},
+		},
+		{"import default", args{args: []string{"import", "--from", "foo.json", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, Import, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"},
+					ImportOpt: ImportOpt{ImportFrom: "foo.json", ImportStrategy: ImportSkip, strategyStr: "skip"}}}},
+		},
+		{"import dependant", args{args: CopyAndAppend([]string{"import", "--from", "foo.db", "--strategy", "keep-newest", "--dry-run"}, allFlags...)},
+			exp{cmdline: CommandLine{barFooConfig, Import, "foo", "barfoo",
+				CommandLineOptions{GlobalOpt: globalTrue, PurgeOpt: PurgeOpt{DryRun: true},
+					ImportOpt: ImportOpt{ImportFrom: "foo.db", ImportStrategy: ImportNewest, strategyStr: "keep-newest"}}}},
+		},
+		{"import bad strategy", args{args: []string{"import", "--from", "foo.db", "--strategy", "merge", "--config", "barfoo.toml"}},
+			exp{errStr: "unrecognized import strategy 'merge'"},
+		},
+		{"db migrate default", args{args: []string{"db", "migrate", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, DbMigrate, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"}}}},
+		},
+		{"db migrate dry run", args{args: []string{"db", "migrate", "--dry-run", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, DbMigrate, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"}, PurgeOpt: PurgeOpt{DryRun: true}}}},
+		},
+		{"db restore missing file", args{args: []string{"db", "restore", "--config", "barfoo.toml"}},
+			exp{errStr: "db restore command requires backup file"},
+		},
+		{"db restore", args{args: []string{"db", "restore", "gopod.bak.20230401.db", "--config", "barfoo.toml"}},
+			exp{cmdline: CommandLine{barFooConfig, DbRestore, "", "",
+				CommandLineOptions{GlobalOpt: GlobalOpt{LogLevelStr: "info"}, DbRestoreOpt: DbRestoreOpt{RestoreFile: "gopod.bak.20230401.db"}}}},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
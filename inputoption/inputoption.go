@@ -162,3 +162,28 @@ func (cfg Config) getSelectedOption(r rune, opts []*InputOption) (*InputOption,
 		return defOpt, nil
 	}
 }
+
+// perform free text input with the default configuration
+func RunTextInput(description string, def string) (string, error) {
+	return defaultconfig.RunTextInput(description, def)
+}
+
+// perform free text input; empty input returns the default given
+func (cfg Config) RunTextInput(description string, def string) (string, error) {
+	var prompt = description
+	if def != "" {
+		prompt += fmt.Sprintf(" [%v]", def)
+	}
+	prompt += ": "
+
+	scanner := bufio.NewScanner(cfg.input) // defaults to stdin
+	fmt.Print(prompt)
+	if scanner.Scan(); scanner.Err() != nil {
+		return def, scanner.Err()
+	}
+
+	if text := strings.TrimSpace(scanner.Text()); text != "" {
+		return text, nil
+	}
+	return def, nil
+}
@@ -223,3 +223,34 @@ func TestConfig_getSelectedOption(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_RunTextInput(t *testing.T) {
+
+	type args struct {
+		input string
+		def   string
+	}
+	tests := []struct {
+		name string
+		p    args
+		exp  string
+	}{
+		{"empty input, no default", args{input: ""}, ""},
+		{"empty input, default", args{input: "", def: "foo"}, "foo"},
+		{"whitespace input, default", args{input: "   \n", def: "foo"}, "foo"},
+		{"input given, default", args{input: "bar", def: "foo"}, "bar"},
+		{"input trimmed", args{input: "  bar baz  \nmeh", def: "foo"}, "bar baz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var testCfg = Config{
+				input: strings.NewReader(tt.p.input),
+			}
+
+			ret, err := testCfg.RunTextInput("testing", tt.p.def)
+			fmt.Print("\n")
+			testutils.Assert(t, err == nil, fmt.Sprintf("expecting error nil, got %v", err))
+			testutils.AssertEquals(t, tt.exp, ret)
+		})
+	}
+}
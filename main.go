@@ -2,11 +2,13 @@ package main
 
 //--------------------------------------------------------------------------
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"time"
 
@@ -75,23 +77,25 @@ func main() {
 
 	log.Infof("using config: %+v", config)
 
-	// todo: official poddb migration methods
-	if poddb, err = setupDB(config); err != nil {
-		log.Errorf("Failed setting up db: %v", err)
-		return
+	// migrate opens (and backs up) each database itself; the main db won't open while migrations are pending.
+	// restore replaces the db file, so it can't be open
+	if cmdline.Command != commandline.DbMigrate && cmdline.Command != commandline.DbRestore {
+		if poddb, err = setupDB(config); err != nil {
+			log.Errorf("Failed setting up db: %v", err)
+			return
+		}
 	}
+	defer func() {
+		if err := poddb.Close(); err != nil {
+			log.Warnf("failed closing db: %v", err)
+		}
+	}()
 	pod.Init(config, poddb)
 
 	if len(cmdline.Proxy) > 0 {
 		setProxy(cmdline.Proxy)
 	}
 
-	//------------------------------------- DEBUG -------------------------------------
-	if config.Debug {
-		runTest(*config, cmdline.FeedShortname, tomlList)
-	}
-	//------------------------------------- DEBUG -------------------------------------
-
 	var cmdFunc commandFunc
 	if cmdFunc = parseCommand(cmdline.Command); cmdFunc == nil {
 		log.Error("command not recognized (this should not happen)")
@@ -108,53 +112,24 @@ func main() {
 	}
 }
 
-// --------------------------------------------------------------------------
-func runTest(config podconfig.Config, shortname string, tomlList []podconfig.FeedToml) {
-	if config.Debug && false {
-
-		if feedList, err := genFeedList(shortname, tomlList); err != nil {
-			log.Error(err)
-			return
-		} else if len(feedList) == 0 {
-			log.Error("no feeds found to check downloads (check config or passed-in shortname)")
-			return
-		} else {
-			for _, f := range feedList {
-				if err := f.RunTest(); err != nil {
-					log.Errorf("Error in checking downloads for feed '%v': %v", f.Shortname, err)
-				}
-			}
-		}
-		os.Exit(0)
-	}
-}
-
 // --------------------------------------------------------------------------
 func setupDB(cfg *podconfig.Config) (*pod.PodDB, error) {
 	// dbpath := filepath.Join(cfg.WorkspaceDir, ".db", "gopod_test.db")
-	dbpath := filepath.Join(cfg.WorkspaceDir, ".db", "gopod.db")
+	dbpath := pod.DBPath(cfg.WorkspaceDir)
 
-	// todo: don't do backup until a write actually happens to the db; then do it just before..
+	db, err := pod.NewDB(dbpath)
+	if err != nil {
+		return nil, err
+	}
+
+	// backup is done just before the first write, so runs that only read don't leave one behind
 	if cfg.BackupDb && (cfg.Simulate == false) {
-		// todo: do a rotate??
-		var backupFile = filepath.Join(cfg.WorkspaceDir, ".db", fmt.Sprintf("gopod.bak.%s.db", cfg.TimestampStr))
-		if _, err := podutils.CopyFile(dbpath, backupFile); err != nil {
+		if err := db.EnableBackup(cfg.TimestampStr, cfg.DbBackupsRetained); err != nil {
+			db.Close()
 			return nil, err
-		} else {
-			// make sure the modified/created time stay the same
-			if dbStat, err := os.Stat(dbpath); err != nil {
-				log.Warnf("Error getting db stats for backup: %v", err)
-			} else {
-				podutils.Chtimes(backupFile, dbStat.ModTime(), dbStat.ModTime())
-			}
 		}
 	}
-
-	if db, err := pod.NewDB(dbpath); err != nil {
-		return nil, err
-	} else {
-		return db, nil
-	}
+	return db, nil
 }
 
 // --------------------------------------------------------------------------
@@ -178,14 +153,42 @@ func parseCommand(cmd commandline.CommandType) commandFunc {
 		return runCheckDownloads
 	case commandline.Delete:
 		return runDelete
+	case commandline.Undelete:
+		return runUndelete
+	case commandline.Purge:
+		return runPurge
 	case commandline.Preview:
 		return runPreview
 	case commandline.Export:
 		return runExport
 	case commandline.Archive:
 		return runArchive
+	case commandline.Unarchive:
+		return runUnarchive
+	case commandline.ArchiveVerify:
+		return runArchiveVerify
 	case commandline.Hack:
 		return runHack
+	case commandline.Add:
+		return runAdd
+	case commandline.ImportOpml:
+		return runImportOpml
+	case commandline.Import:
+		return runImport
+	case commandline.Status:
+		return runStatus
+	case commandline.Search:
+		return runSearch
+	case commandline.Stats:
+		return runStats
+	case commandline.Serve:
+		return runServe
+	case commandline.DbMigrate:
+		return runDbMigrate
+	case commandline.DbRestore:
+		return runDbRestore
+	case commandline.History:
+		return runHistory
 	default:
 		return nil
 	}
@@ -255,6 +258,14 @@ func runUpdate(shortname string, tomlList []podconfig.FeedToml) {
 		}
 	}
 
+	// output feed changes
+	for feedShortname, changes := range res.Changes {
+		fmt.Printf("%v changes:\n", feedShortname)
+		for _, change := range changes {
+			fmt.Printf("\t%v\n", change)
+		}
+	}
+
 	// output totals
 	fmt.Printf("Downloaded %v files, %v\n", res.TotalDownloaded, podutils.FormatBytes(res.TotalDownloadedBytes))
 
@@ -277,10 +288,19 @@ func runCheckDownloads(shortname string, tomlList []podconfig.FeedToml) {
 		log.Error("no feeds found to check downloads (check config or passed-in shortname)")
 		return
 	} else {
+		// one report for all feeds; a feed with failed checks still reports what the others found
+		var rpt = pod.CheckReport{Feeds: make([]*pod.FeedCheckReport, 0, len(feedList))}
 		for _, f := range feedList {
-			if err := f.CheckDownloads(); err != nil {
+			feedRpt, err := f.CheckDownloads()
+			if err != nil {
 				log.Errorf("Error in checking downloads for feed '%v': %v", f.Shortname, err)
 			}
+			if feedRpt != nil {
+				rpt.Feeds = append(rpt.Feeds, feedRpt)
+			}
+		}
+		if err := pod.WriteCheckReport(os.Stdout, &rpt); err != nil {
+			log.Errorf("Error in writing check report: %v", err)
 		}
 	}
 }
@@ -303,6 +323,56 @@ func runDelete(shortname string, tomlList []podconfig.FeedToml) {
 	}
 }
 
+// --------------------------------------------------------------------------
+func runUndelete(shortname string, tomlList []podconfig.FeedToml) {
+
+	if shortname == "" {
+		log.Error("cannot only run undelete on one feed at a time")
+		return
+	} else if f, err := genFeed(shortname, tomlList); err != nil {
+		log.Error(err)
+		return
+	} else {
+		log.With("feed", f.Shortname).Info("running undelete")
+		if err := f.RunUndelete(); err != nil {
+			log.With("feed", f.Shortname, "error", err).Error("failed running undelete")
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+func runPurge(shortname string, tomlList []podconfig.FeedToml) {
+	// deleted feeds may no longer be in config; purge works from the database
+	if err := pod.Purge(shortname, tomlList); err != nil {
+		log.With("error", err).Error("failed running purge")
+	}
+}
+
+// --------------------------------------------------------------------------
+func runHistory(shortname string, tomlList []podconfig.FeedToml) {
+	if f, err := genFeed(shortname, tomlList); err != nil {
+		log.Error(err)
+	} else if hist, err := f.History(); err != nil {
+		log.Errorf("Error getting item history: %v", err)
+	} else if err := pod.WriteHistory(os.Stdout, hist); err != nil {
+		log.Errorf("Error in writing item history: %v", err)
+	}
+}
+
+// --------------------------------------------------------------------------
+func runDbMigrate(_ string, tomlList []podconfig.FeedToml) {
+	if err := pod.Migrate(tomlList); err != nil {
+		log.With("error", err).Error("failed running db migrate")
+	}
+}
+
+// --------------------------------------------------------------------------
+func runDbRestore(string, []podconfig.FeedToml) {
+	if err := pod.Restore(); err != nil {
+		log.With("error", err).Error("failed running db restore")
+	}
+}
+
 // --------------------------------------------------------------------------
 func runPreview(shortname string, tomlList []podconfig.FeedToml) {
 	if shortname == "" {
@@ -345,6 +415,24 @@ func runArchive(shortname string, tomlist []podconfig.FeedToml) {
 	}
 }
 
+// --------------------------------------------------------------------------
+func runUnarchive(shortname string, tomlList []podconfig.FeedToml) {
+	if f, err := genFeed(shortname, tomlList); err != nil {
+		log.Error(err)
+	} else if err := pod.Unarchive(f); err != nil {
+		log.Errorf("Error in unarchiving feed: %v", err)
+	}
+}
+
+// --------------------------------------------------------------------------
+func runArchiveVerify(shortname string, tomlList []podconfig.FeedToml) {
+	if feedlist, err := genFeedList(shortname, tomlList); err != nil {
+		log.Error(err)
+	} else if err := pod.VerifyBundles(feedlist...); err != nil {
+		log.Errorf("Error verifying bundles: %v", err)
+	}
+}
+
 // --------------------------------------------------------------------------
 func runHack(shortname string, tomlList []podconfig.FeedToml) {
 	if shortname == "" {
@@ -360,4 +448,101 @@ func runHack(shortname string, tomlList []podconfig.FeedToml) {
 		}
 		// todo: run hack
 	}
-}
\ No newline at end of file
+}
+// --------------------------------------------------------------------------
+func runAdd(_ string, tomlList []podconfig.FeedToml) {
+	if feed, err := pod.AddFeed(tomlList); err != nil {
+		log.Errorf("Error in adding feed: %v", err)
+	} else if feed != nil {
+		fmt.Printf("added feed '%v' (%v); run update to download episodes\n", feed.Shortname, feed.Url)
+	}
+}
+
+// --------------------------------------------------------------------------
+func runImportOpml(_ string, tomlList []podconfig.FeedToml) {
+	if added, err := pod.ImportOpml(tomlList); err != nil {
+		log.Errorf("Error in importing opml: %v", err)
+	} else if len(added) > 0 {
+		fmt.Printf("imported %v feeds; run update to download episodes\n", len(added))
+	}
+}
+
+// --------------------------------------------------------------------------
+func runImport(shortname string, tomlList []podconfig.FeedToml) {
+	// imported feeds may not be in config yet; import works from the export
+	if err := pod.Import(shortname, tomlList); err != nil {
+		log.Errorf("Error in importing feeds: %v", err)
+	}
+}
+
+// --------------------------------------------------------------------------
+func runStatus(shortname string, tomlList []podconfig.FeedToml) {
+	if feedList, err := genFeedList(shortname, tomlList); err != nil {
+		log.Error(err)
+		return
+	} else if len(feedList) == 0 {
+		log.Error("no feeds found for status (check config or passed-in shortname)")
+	} else {
+		// partial results are still output, along with any errors
+		statusList, err := pod.Status(feedList)
+		if err != nil {
+			log.Errorf("Error in getting feed status: %v", err)
+		}
+		if err := pod.WriteStatus(os.Stdout, statusList); err != nil {
+			log.Errorf("Error in writing feed status: %v", err)
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+func runSearch(shortname string, tomlList []podconfig.FeedToml) {
+	if feedList, err := genFeedList(shortname, tomlList); err != nil {
+		log.Error(err)
+		return
+	} else if len(feedList) == 0 {
+		log.Error("no feeds found to search (check config or passed-in shortname)")
+	} else if results, err := pod.Search(feedList); err != nil {
+		log.Errorf("Error in searching feeds: %v", err)
+	} else if err := pod.WriteSearch(os.Stdout, results); err != nil {
+		log.Errorf("Error in writing search results: %v", err)
+	}
+}
+
+// --------------------------------------------------------------------------
+func runStats(shortname string, tomlList []podconfig.FeedToml) {
+	if feedList, err := genFeedList(shortname, tomlList); err != nil {
+		log.Error(err)
+		return
+	} else if len(feedList) == 0 {
+		log.Error("no feeds found for stats (check config or passed-in shortname)")
+	} else {
+		// partial results are still output, along with any errors
+		stats, err := pod.Stats(feedList)
+		if err != nil {
+			log.Errorf("Error in getting stats: %v", err)
+		}
+		if stats != nil {
+			if err := pod.WriteStats(os.Stdout, stats); err != nil {
+				log.Errorf("Error in writing stats: %v", err)
+			}
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+func runServe(shortname string, tomlList []podconfig.FeedToml) {
+	if feedList, err := genFeedList(shortname, tomlList); err != nil {
+		log.Error(err)
+		return
+	} else if len(feedList) == 0 {
+		log.Error("no feeds found to serve (check config or passed-in shortname)")
+	} else {
+		// serve until interrupted
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		if err := pod.Serve(ctx, feedList); err != nil {
+			log.Errorf("Error in serving feeds: %v", err)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package pod
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopod/podutils"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// bundle formats
+const (
+	bundleTarZst = "tar.zst"
+	bundleZip    = "zip"
+)
+
+// first entry in every bundle
+const manifestName = "manifest.json"
+
+var bundleFormats = []string{bundleTarZst, bundleZip}
+
+// everything packed in a bundle, with checksums; paths are relative to the archive directory, with
+// forward slashes
+type bundleManifest struct {
+	Shortname string
+	Dir       string
+	Created   time.Time
+	Files     []bundleFile
+}
+
+type bundleFile struct {
+	Path   string
+	Size   int64
+	Sha256 string
+}
+
+// --------------------------------------------------------------------------
+// bundle file for an archive directory, in the given format
+func bundlePath(dir, format string) string {
+	return dir + "." + format
+}
+
+// --------------------------------------------------------------------------
+// format of a bundle file, from its extension; empty if not a bundle
+func bundleFormat(path string) string {
+	for _, format := range bundleFormats {
+		if strings.HasSuffix(path, "."+format) {
+			return format
+		}
+	}
+	return ""
+}
+
+// --------------------------------------------------------------------------
+// bundles (in either format) in the feed's archive directory
+func (f Feed) archiveBundles() ([]string, error) {
+	var ret = make([]string, 0)
+	for _, format := range bundleFormats {
+		if matches, err := filepath.Glob(filepath.Join(f.archivePath, "*."+format)); err != nil {
+			return nil, err
+		} else {
+			ret = append(ret, matches...)
+		}
+	}
+	slices.Sort(ret)
+	return ret, nil
+}
+
+// --------------------------------------------------------------------------
+// packs each archive directory into a bundle, verifying it after; with remove originals set, the
+// directory is removed once the bundle is verified.  Bundles already matching their directory are
+// left alone
+func (f *Feed) bundleArchives(format string, removeOriginals bool) error {
+	var (
+		log    = f.log
+		reterr error
+	)
+
+	entries, err := os.ReadDir(f.archivePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Info("no archives to bundle")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() == false {
+			continue
+		}
+		var (
+			dir    = filepath.Join(f.archivePath, entry.Name())
+			bundle = bundlePath(dir, format)
+			lg     = log.With("dir", entry.Name())
+		)
+
+		manifest, err := genManifest(dir, f.Shortname)
+		if err != nil {
+			lg.Error(err)
+			reterr = errors.Join(reterr, err)
+			continue
+		}
+
+		existing, err := readBundleManifest(bundle)
+		if err == nil && slices.Equal(existing.Files, manifest.Files) {
+			lg.Info("bundle up to date", "bundle", filepath.Base(bundle))
+		} else if missing := missingFiles(existing, manifest); len(missing) > 0 {
+			// directory removed after bundling and recreated (or files unarchived since); rewriting the
+			// bundle would lose what's only in it
+			err := fmt.Errorf("bundle %v has %v files not in the directory (%v); extract the bundle into the directory, "+
+				"or remove the bundle, before bundling again", filepath.Base(bundle), len(missing), strings.Join(missing, ", "))
+			lg.Error(err)
+			reterr = errors.Join(reterr, err)
+			continue
+		} else if config.Simulate {
+			lg.Infof("not bundling due to simulate flag; %v files", len(manifest.Files))
+			continue
+		} else {
+			lg.Infof("bundling %v files to %v", len(manifest.Files), filepath.Base(bundle))
+			if err := writeBundle(bundle, format, dir, manifest); err != nil {
+				lg.Error(err)
+				reterr = errors.Join(reterr, err)
+				continue
+			}
+		}
+
+		if _, err := verifyBundle(bundle); err != nil {
+			err = fmt.Errorf("bundle %v failed verification; originals kept: %w", filepath.Base(bundle), err)
+			lg.Error(err)
+			reterr = errors.Join(reterr, err)
+		} else if removeOriginals && config.Simulate == false {
+			lg.Info("bundle verified; removing originals")
+			if err := os.RemoveAll(dir); err != nil {
+				lg.Error(err)
+				reterr = errors.Join(reterr, err)
+			}
+		}
+	}
+	return reterr
+}
+
+// --------------------------------------------------------------------------
+// files in the existing bundle's manifest that aren't in the directory's
+func missingFiles(existing, manifest *bundleManifest) []string {
+	var ret = make([]string, 0)
+	if existing == nil {
+		return ret
+	}
+	for _, bf := range existing.Files {
+		if slices.ContainsFunc(manifest.Files, func(f bundleFile) bool { return f.Path == bf.Path }) == false {
+			ret = append(ret, bf.Path)
+		}
+	}
+	return ret
+}
+
+// --------------------------------------------------------------------------
+// bundles whose archive directory has been removed; the archive db inside isn't read until extracted
+func (f Feed) bundledOnlyArchives() ([]string, error) {
+	bundles, err := f.archiveBundles()
+	if err != nil {
+		return nil, err
+	}
+	var ret = make([]string, 0)
+	for _, bundle := range bundles {
+		var dir = strings.TrimSuffix(bundle, "."+bundleFormat(bundle))
+		if exists, err := podutils.FileExists(dir); err != nil {
+			return nil, err
+		} else if exists == false {
+			ret = append(ret, bundle)
+		}
+	}
+	return ret, nil
+}
+
+// --------------------------------------------------------------------------
+// lists every file in the directory, with size and checksum
+func genManifest(dir, shortname string) (*bundleManifest, error) {
+	var manifest = bundleManifest{
+		Shortname: shortname,
+		Dir:       filepath.Base(dir),
+		Created:   time.Now(),
+		Files:     make([]bundleFile, 0),
+	}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		} else if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		size, sum, err := hashReader(file)
+		if err != nil {
+			return fmt.Errorf("error reading %v: %w", rel, err)
+		}
+		manifest.Files = append(manifest.Files, bundleFile{Path: filepath.ToSlash(rel), Size: size, Sha256: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error generating manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// --------------------------------------------------------------------------
+func hashReader(r io.Reader) (int64, string, error) {
+	var hash = sha256.New()
+	size, err := io.Copy(hash, r)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// --------------------------------------------------------------------------
+// writes the manifest and every file in it to the bundle; written to a temp file first, so an
+// existing bundle is only replaced by a complete one
+func writeBundle(bundle, format, dir string, manifest *bundleManifest) (reterr error) {
+	var tmpfile = bundle + ".tmp"
+	out, err := os.Create(tmpfile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		out.Close()
+		if reterr != nil {
+			os.Remove(tmpfile)
+		}
+	}()
+
+	manifestBuf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var (
+		add   func(name string, size int64, modtime time.Time, r io.Reader) error
+		close func() error
+	)
+	switch format {
+	case bundleTarZst:
+		zw, err := zstd.NewWriter(out)
+		if err != nil {
+			return err
+		}
+		var tw = tar.NewWriter(zw)
+		add = func(name string, size int64, modtime time.Time, r io.Reader) error {
+			var hdr = tar.Header{Name: name, Mode: 0644, Size: size, ModTime: modtime, Typeflag: tar.TypeReg}
+			if err := tw.WriteHeader(&hdr); err != nil {
+				return err
+			}
+			_, err := io.Copy(tw, r)
+			return err
+		}
+		close = func() error { return errors.Join(tw.Close(), zw.Close()) }
+	case bundleZip:
+		var zw = zip.NewWriter(out)
+		add = func(name string, size int64, modtime time.Time, r io.Reader) error {
+			// episodes are already compressed
+			var hdr = zip.FileHeader{Name: name, Method: zip.Store, Modified: modtime}
+			w, err := zw.CreateHeader(&hdr)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, r)
+			return err
+		}
+		close = zw.Close
+	default:
+		return fmt.Errorf("unrecognized bundle format '%v'", format)
+	}
+
+	if err := add(manifestName, int64(len(manifestBuf)), manifest.Created, strings.NewReader(string(manifestBuf))); err != nil {
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+	for _, bf := range manifest.Files {
+		var path = filepath.Join(dir, filepath.FromSlash(bf.Path))
+		if err := addBundleFile(path, bf, add); err != nil {
+			return fmt.Errorf("error writing %v: %w", bf.Path, err)
+		}
+	}
+	if err := close(); err != nil {
+		return err
+	} else if err := out.Close(); err != nil {
+		return err
+	}
+	return podutils.Rename(tmpfile, bundle)
+}
+
+// --------------------------------------------------------------------------
+func addBundleFile(path string, bf bundleFile, add func(string, int64, time.Time, io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	} else if stat.Size() != bf.Size {
+		return errors.New("file changed since manifest was generated")
+	}
+	return add(bf.Path, bf.Size, stat.ModTime(), file)
+}
+
+// --------------------------------------------------------------------------
+// calls fn for each entry in the bundle, in order; stops when fn returns errStopReading
+func readBundle(bundle string, fn func(name string, r io.Reader) error) error {
+	file, err := os.Open(bundle)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var stopped = func(err error) error { return podutils.Tern(errors.Is(err, errStopReading), nil, err) }
+
+	switch bundleFormat(bundle) {
+	case bundleTarZst:
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		var tr = tar.NewReader(zr)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			} else if hdr.Typeflag != tar.TypeReg {
+				continue
+			} else if err := fn(hdr.Name, tr); err != nil {
+				return stopped(err)
+			}
+		}
+	case bundleZip:
+		stat, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(file, stat.Size())
+		if err != nil {
+			return err
+		}
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = fn(zf.Name, rc)
+			rc.Close()
+			if err != nil {
+				return stopped(err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unrecognized bundle format '%v'", filepath.Base(bundle))
+	}
+}
+
+var errStopReading = errors.New("stop reading")
+
+// --------------------------------------------------------------------------
+// manifest from the bundle; always the first entry
+func readBundleManifest(bundle string) (*bundleManifest, error) {
+	var manifest *bundleManifest
+	err := readBundle(bundle, func(name string, r io.Reader) error {
+		if name != manifestName {
+			return errors.New("manifest is not the first entry")
+		}
+		var m bundleManifest
+		if err := json.NewDecoder(r).Decode(&m); err != nil {
+			return fmt.Errorf("error reading manifest: %w", err)
+		}
+		manifest = &m
+		return errStopReading
+	})
+	if err != nil {
+		return nil, err
+	} else if manifest == nil {
+		return nil, errors.New("manifest not found")
+	}
+	return manifest, nil
+}
+
+// --------------------------------------------------------------------------
+// checks every file in the bundle against the manifest; sizes and checksums must match, with nothing
+// missing or extra
+func verifyBundle(bundle string) (*bundleManifest, error) {
+	var (
+		manifest *bundleManifest
+		found    = make(map[string]bundleFile)
+	)
+	err := readBundle(bundle, func(name string, r io.Reader) error {
+		if manifest == nil {
+			if name != manifestName {
+				return errors.New("manifest is not the first entry")
+			}
+			var m bundleManifest
+			if err := json.NewDecoder(r).Decode(&m); err != nil {
+				return fmt.Errorf("error reading manifest: %w", err)
+			}
+			manifest = &m
+			return nil
+		}
+		size, sum, err := hashReader(r)
+		if err != nil {
+			return fmt.Errorf("error reading %v: %w", name, err)
+		}
+		found[name] = bundleFile{Path: name, Size: size, Sha256: sum}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if manifest == nil {
+		return nil, errors.New("manifest not found")
+	}
+
+	var (
+		reterr error
+		listed = make(map[string]bool, len(manifest.Files))
+	)
+	for _, bf := range manifest.Files {
+		listed[bf.Path] = true
+		if f, exists := found[bf.Path]; exists == false {
+			reterr = errors.Join(reterr, fmt.Errorf("%v: missing", bf.Path))
+		} else if f != bf {
+			reterr = errors.Join(reterr, fmt.Errorf("%v: checksum or size mismatch", bf.Path))
+		}
+	}
+	for name := range found {
+		if listed[name] == false {
+			reterr = errors.Join(reterr, fmt.Errorf("%v: not in manifest", name))
+		}
+	}
+	return manifest, reterr
+}
+
+// --------------------------------------------------------------------------
+// verifies every bundle in the feeds' archive directories against their manifests
+func VerifyBundles(feeds ...*Feed) error {
+	var (
+		reterr error
+		count  int
+	)
+	for _, f := range feeds {
+		bundles, err := f.archiveBundles()
+		if err != nil {
+			reterr = errors.Join(reterr, err)
+			continue
+		}
+		for _, bundle := range bundles {
+			count++
+			var rel = podutils.Tern(config != nil, relPath(config.WorkspaceDir, bundle), bundle)
+			if manifest, err := verifyBundle(bundle); err != nil {
+				fmt.Printf("%v: FAILED\n  %v\n", rel, strings.ReplaceAll(err.Error(), "\n", "\n  "))
+				reterr = errors.Join(reterr, fmt.Errorf("%v failed verification", rel))
+			} else {
+				fmt.Printf("%v: ok (%v files)\n", rel, len(manifest.Files))
+			}
+		}
+	}
+	if count == 0 {
+		fmt.Println("no bundles found")
+	}
+	return reterr
+}
+
+// --------------------------------------------------------------------------
+func relPath(base, path string) string {
+	if rel, err := filepath.Rel(base, path); err == nil {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,267 @@
+package pod
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopod/podconfig"
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+// archive directory with an episode, image and db
+func setupArchiveDir(t *testing.T, path string) {
+	t.Helper()
+	for name, contents := range map[string]string{
+		"ep1.mp3":        "0123456789",
+		".img/img.jpg":   "image",
+		".db/foo.db":     "database",
+		"sub/nested.txt": "",
+	} {
+		var file = filepath.Join(path, filepath.FromSlash(name))
+		testutils.AssertErr(t, false, os.MkdirAll(filepath.Dir(file), 0755))
+		testutils.AssertErr(t, false, os.WriteFile(file, []byte(contents), 0644))
+	}
+}
+
+func TestBundle_writeVerify(t *testing.T) {
+
+	var (
+		dir     = t.TempDir()
+		archive = filepath.Join(dir, "foo.2020")
+	)
+	setupArchiveDir(t, archive)
+
+	manifest, err := genManifest(archive, "foo")
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, 4, len(manifest.Files))
+	testutils.AssertEquals(t, "foo.2020", manifest.Dir)
+
+	type args struct {
+		format string
+		modify func(m bundleManifest) *bundleManifest
+	}
+	tests := []struct {
+		name      string
+		p         args
+		writeErr  string
+		verifyErr string
+	}{
+		{"tar.zst", args{format: bundleTarZst}, "", ""},
+		{"zip", args{format: bundleZip}, "", ""},
+		{"unknown format", args{format: "rar"}, "unrecognized bundle format", ""},
+		{"checksum mismatch", args{format: bundleTarZst, modify: func(m bundleManifest) *bundleManifest {
+			m.Files = append([]bundleFile{}, m.Files...)
+			m.Files[0].Sha256 = "foo"
+			return &m
+		}}, "", "checksum or size mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				bundle = bundlePath(archive, tt.p.format)
+				m      = manifest
+			)
+			if tt.p.modify != nil {
+				m = tt.p.modify(*manifest)
+			}
+
+			err := writeBundle(bundle, tt.p.format, archive, m)
+			testutils.AssertErrContains(t, tt.writeErr, err)
+			if err != nil {
+				exists, _ := podutils.FileExists(bundle + ".tmp")
+				testutils.Assert(t, exists == false, "temp file not removed")
+				return
+			}
+
+			read, err := verifyBundle(bundle)
+			testutils.AssertErrContains(t, tt.verifyErr, err)
+			if err == nil {
+				testutils.AssertEquals(t, manifest.Files, read.Files)
+				testutils.AssertEquals(t, "foo", read.Shortname)
+			}
+		})
+	}
+
+	// bundle contents not matching the manifest
+	var (
+		zipfile = filepath.Join(dir, "bad.zip")
+		entries = []struct{ name, contents string }{
+			{manifestName, `{"Files":[{"Path":"a","Size":1,"Sha256":"ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"},{"Path":"b","Size":1}]}`},
+			{"a", "a"},
+			{"c", "c"},
+		}
+	)
+	out, err := os.Create(zipfile)
+	testutils.AssertErr(t, false, err)
+	var zw = zip.NewWriter(out)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		testutils.AssertErr(t, false, err)
+		_, err = w.Write([]byte(e.contents))
+		testutils.AssertErr(t, false, err)
+	}
+	testutils.AssertErr(t, false, zw.Close())
+	testutils.AssertErr(t, false, out.Close())
+
+	_, err = verifyBundle(zipfile)
+	testutils.AssertErrContains(t, "b: missing", err)
+	testutils.AssertErrContains(t, "c: not in manifest", err)
+	testutils.Assert(t, strings.Contains(err.Error(), "a:") == false, "a reported as failed")
+}
+
+func TestBundleArchives(t *testing.T) {
+
+	var (
+		dir       = t.TempDir()
+		oldConfig = config
+		oldDB     = db
+	)
+	defer func() {
+		db.Close()
+		config, db = oldConfig, oldDB
+	}()
+
+	config = &podconfig.Config{WorkspaceDir: dir, TimestampStr: "test"}
+	if pdb, err := NewDB(DBPath(dir)); err != nil {
+		t.Fatalf("error creating db: %v", err)
+	} else {
+		db = pdb
+	}
+
+	f, err := NewFeed(podconfig.FeedToml{Name: "foo cast", Shortname: "foo", Url: "https://foo.bar/foo"})
+	testutils.AssertErr(t, false, err)
+
+	// no archives yet
+	testutils.AssertErr(t, false, f.bundleArchives(bundleZip, true))
+
+	var (
+		arc2020 = f.archiveYearPath(2020)
+		arc2021 = f.archiveYearPath(2021)
+		exists  = func(path string) bool {
+			e, _ := podutils.FileExists(path)
+			return e
+		}
+	)
+	setupArchiveDir(t, arc2020)
+	setupArchiveDir(t, arc2021)
+
+	// simulate writes nothing
+	config.Simulate = true
+	testutils.AssertErr(t, false, f.bundleArchives(bundleTarZst, true))
+	testutils.Assert(t, exists(bundlePath(arc2020, bundleTarZst)) == false, "simulate created bundle")
+	config.Simulate = false
+
+	// originals kept
+	testutils.AssertErr(t, false, f.bundleArchives(bundleTarZst, false))
+	testutils.Assert(t, exists(bundlePath(arc2020, bundleTarZst)), "2020 not bundled")
+	testutils.Assert(t, exists(arc2020), "originals removed")
+
+	// up to date bundles aren't rewritten, but originals are removed once verified
+	stat, err := os.Stat(bundlePath(arc2020, bundleTarZst))
+	testutils.AssertErr(t, false, err)
+	testutils.AssertErr(t, false, f.bundleArchives(bundleTarZst, true))
+	restat, err := os.Stat(bundlePath(arc2020, bundleTarZst))
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, stat.ModTime(), restat.ModTime())
+	testutils.Assert(t, exists(arc2020) == false && exists(arc2021) == false, "originals not removed")
+
+	bundles, err := f.archiveBundles()
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, []string{bundlePath(arc2020, bundleTarZst), bundlePath(arc2021, bundleTarZst)}, bundles)
+	testutils.AssertErr(t, false, VerifyBundles(f))
+
+	// corrupt bundle fails verification
+	testutils.AssertErr(t, false, os.WriteFile(bundlePath(arc2021, bundleTarZst), []byte("foobar"), 0644))
+	testutils.AssertErr(t, true, VerifyBundles(f))
+}
+
+func TestBundleArchives_removedDir(t *testing.T) {
+
+	var (
+		dir       = t.TempDir()
+		oldConfig = config
+		oldDB     = db
+	)
+	defer func() {
+		db.Close()
+		config, db = oldConfig, oldDB
+	}()
+
+	config = &podconfig.Config{WorkspaceDir: dir, TimestampStr: "test"}
+	config.ArchiveBundle, config.RemoveOriginals = bundleTarZst, true
+	if pdb, err := NewDB(DBPath(dir)); err != nil {
+		t.Fatalf("error creating db: %v", err)
+	} else {
+		db = pdb
+	}
+
+	var loadFeed = func() *Feed {
+		f, err := NewFeed(podconfig.FeedToml{Name: "foo cast", Shortname: "foo", Url: "https://foo.bar/foo"})
+		if err != nil {
+			t.Fatalf("error creating feed: %v", err)
+		} else if err := f.LoadDBFeed(loadOptions{}); err != nil {
+			t.Fatalf("error loading feed: %v", err)
+		}
+		return f
+	}
+	var f = loadFeed()
+	f.XmlFeedData = &FeedXmlDBEntry{}
+	testutils.AssertErr(t, false, db.saveFeed(&f.FeedDBEntry))
+
+	var (
+		arc2020 = f.archiveYearPath(2020)
+		bundle  = bundlePath(arc2020, bundleTarZst)
+		addItem = func(name string) {
+			var item = generateItem(f.ID, true)
+			item.Filename, item.PubTimeStamp, item.Downloaded = name, time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), true
+			testutils.AssertErr(t, false, os.MkdirAll(f.mp3Path, 0755))
+			testutils.AssertErr(t, false, os.WriteFile(filepath.Join(f.mp3Path, name), []byte("0123456789"), 0644))
+			testutils.AssertErr(t, false, db.saveItems(&item))
+		}
+		bundled = func() []string {
+			manifest, err := verifyBundle(bundle)
+			testutils.AssertErr(t, false, err)
+			var ret = make([]string, 0)
+			for _, bf := range manifest.Files {
+				ret = append(ret, bf.Path)
+			}
+			return ret
+		}
+	)
+
+	// bundled, and the directory removed
+	addItem("ep1.mp3")
+	testutils.AssertErr(t, false, Archive(loadFeed()))
+	exists, _ := podutils.FileExists(arc2020)
+	testutils.Assert(t, exists == false, "originals not removed")
+	var files = bundled()
+	testutils.AssertEquals(t, []string{".db/foo.db", "ep1.mp3"}, files)
+
+	// archiving again into the same year; refused, leaving the item and bundle as they were
+	addItem("ep2.mp3")
+	testutils.AssertErrContains(t, "only exists as bundle", Archive(loadFeed()))
+	exists, _ = podutils.FileExists(arc2020)
+	testutils.Assert(t, exists == false, "archive directory recreated")
+	exists, _ = podutils.FileExists(filepath.Join(f.mp3Path, "ep2.mp3"))
+	testutils.Assert(t, exists, "item archived")
+	testutils.AssertEquals(t, files, bundled())
+
+	// directory recreated some other way; the bundle isn't replaced by one holding only the new files
+	testutils.AssertErr(t, false, os.MkdirAll(arc2020, 0755))
+	testutils.AssertErr(t, false, os.WriteFile(filepath.Join(arc2020, "ep2.mp3"), []byte("0123456789"), 0644))
+	testutils.AssertErrContains(t, "has 2 files not in the directory", f.bundleArchives(bundleTarZst, true))
+	testutils.AssertEquals(t, files, bundled())
+	exists, _ = podutils.FileExists(arc2020)
+	testutils.Assert(t, exists, "directory removed")
+
+	// bundled only archives listed
+	testutils.AssertErr(t, false, os.RemoveAll(arc2020))
+	bundles, err := f.bundledOnlyArchives()
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, []string{bundle}, bundles)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopod/commandline"
 	"gopod/podconfig"
@@ -25,12 +26,31 @@ func Export(feedlist []*Feed) error {
 		return errors.New("cannot export feeds; db is nil")
 	}
 
+	filter, err := newExportFilter()
+	if err != nil {
+		return err
+	}
+
+	// opml and csv are single files covering all feeds
+	switch config.ExportFormat {
+	case commandline.ExportOpml:
+		if config.ExportPath != "" {
+			podutils.MkdirAll(config.ExportPath)
+		}
+		return exportToOpml(feedlist, opmlExportPath())
+	case commandline.ExportCsv:
+		if config.ExportPath != "" {
+			podutils.MkdirAll(config.ExportPath)
+		}
+		return exportToCsv(feedlist, filter, csvExportPath())
+	}
+
 	for _, feed := range feedlist {
 		var expPath = config.ExportPath
 		if expPath == "" {
 			expPath = filepath.Join(config.WorkspaceDir, feed.Shortname)
 		}
-		if err := feed.export(expPath); err != nil {
+		if err := feed.export(expPath, filter); err != nil {
 			reterr = errors.Join(reterr, err)
 		}
 	}
@@ -38,7 +58,42 @@ func Export(feedlist []*Feed) error {
 	return reterr
 }
 
-func (f *Feed) export(path string) error {
+// episode filters from the commandline
+type exportFilter struct {
+	after      time.Time
+	before     time.Time
+	downloaded *bool
+	archived   *bool
+}
+
+func newExportFilter() (exportFilter, error) {
+	var (
+		ef  = exportFilter{downloaded: config.ExportDownloaded, archived: config.ExportArchived}
+		err error
+	)
+	if ef.after, err = parseSearchDate(config.ExportAfter); err != nil {
+		return ef, fmt.Errorf("export after not recognized: %w", err)
+	} else if ef.before, err = parseSearchDate(config.ExportBefore); err != nil {
+		return ef, fmt.Errorf("export before not recognized: %w", err)
+	}
+	return ef, nil
+}
+
+func (ef exportFilter) matches(item *ItemDBEntry) bool {
+	switch {
+	case ef.after.IsZero() == false && item.PubTimeStamp.Before(ef.after):
+		return false
+	case ef.before.IsZero() == false && item.PubTimeStamp.Before(ef.before) == false:
+		return false
+	case ef.downloaded != nil && item.Downloaded != *ef.downloaded:
+		return false
+	case ef.archived != nil && item.Archived != *ef.archived:
+		return false
+	}
+	return true
+}
+
+func (f *Feed) export(path string, filter exportFilter) error {
 
 	f.log.Debug("running export")
 
@@ -50,7 +105,7 @@ func (f *Feed) export(path string) error {
 
 	if err := f.exportConfig(path); err != nil {
 		reterr = errors.Join(reterr, err)
-	} else if err := f.exportData(path); err != nil {
+	} else if err := f.exportData(path, filter); err != nil {
 		reterr = errors.Join(reterr, err)
 	}
 
@@ -68,33 +123,66 @@ func (f Feed) exportConfig(path string) error {
 	}
 }
 
-func (f Feed) exportData(path string) error {
+func (f Feed) exportData(path string, filter exportFilter) error {
+
+	if err := f.loadExportItems(filter); err != nil {
+		return err
+	}
+
+	switch config.ExportFormat {
+	case commandline.ExportJson:
+		var filename = filepath.Join(path, fmt.Sprintf("%v.json", f.Shortname))
+		return exportToJson(&f.FeedDBEntry, filename)
+	case commandline.ExportDB:
+		var filename = filepath.Join(path, fmt.Sprintf("%v.db", f.Shortname))
+		return exportToDb(&f.FeedDBEntry, filename)
+	case commandline.ExportMarkdown:
+		var filename = filepath.Join(path, fmt.Sprintf("%v.md", f.Shortname))
+		return exportToCatalog(&f, markdownCatalogTemplate, filename)
+	case commandline.ExportHtml:
+		var filename = filepath.Join(path, fmt.Sprintf("%v.html", f.Shortname))
+		return exportToCatalog(&f, htmlCatalogTemplate, filename)
+	case commandline.ExportRss:
+		var filename = filepath.Join(path, fmt.Sprintf("%v.rss.xml", f.Shortname))
+		return exportToRss(&f, filename)
+	}
 
+	return fmt.Errorf("export format not handled: %v", config.ExportFormat)
+}
+
+// loads the feed, with its items (and xml) that match the filter into ItemList
+func (f *Feed) loadExportItems(filter exportFilter) error {
 	var (
 		opt = loadOptions{
 			dontCreate:     true,
 			includeXml:     true,
 			direction:      cASC,
 			includeDeleted: config.IncludeDeleted,
+			// episodes only in archive dbs are exported as well
+			includeArchives: true,
 		}
 	)
 	if err := f.LoadDBFeed(opt); err != nil {
 		return err
-	} else if itemlist, err := f.loadDBFeedItems(AllItems, opt); err != nil {
-		return err
-	} else if f.ItemList, err = f.genItemDBEntryList(itemlist); err != nil {
+	}
+	itemlist, err := f.loadDBFeedItems(AllItems, opt)
+	if err != nil {
 		return err
 	}
 
-	if config.ExportFormat == commandline.ExportJson {
-		var filename = filepath.Join(path, fmt.Sprintf("%v.json", f.Shortname))
-		return exportToJson(&f.FeedDBEntry, filename)
-	} else if config.ExportFormat == commandline.ExportDB {
-		var filename = filepath.Join(path, fmt.Sprintf("%v.db", f.Shortname))
-		return exportToDb(&f.FeedDBEntry, filename)
+	var filtered = make([]*Item, 0, len(itemlist))
+	for _, item := range itemlist {
+		if filter.matches(&item.ItemDBEntry) {
+			filtered = append(filtered, item)
+		}
 	}
-
-	return fmt.Errorf("export format not handled: %v", config.ExportFormat)
+	if len(filtered) == 0 {
+		f.log.Info("no episodes match export filters")
+		f.ItemList = make([]*ItemDBEntry, 0)
+		return nil
+	}
+	f.ItemList, err = f.genItemDBEntryList(filtered)
+	return err
 }
 
 func exportToJson(feed *FeedDBEntry, file string) error {
@@ -131,6 +219,7 @@ func exportToDb(feed *FeedDBEntry, file string) error {
 	if export, err := NewDB(file); err != nil {
 		return err
 	} else {
+		defer export.Close()
 		// export with the already given IDs from the master db
 		if err := export.saveFeed(feed); err != nil {
 			return err
@@ -0,0 +1,354 @@
+package pod
+
+import (
+	"encoding/csv"
+	"errors"
+	"html"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"gopod/podutils"
+
+	log "gopod/multilogger"
+
+	"gorm.io/gorm"
+)
+
+const csvExportFilename = "gopod.csv"
+
+var csvExportHeaders = []string{"feed", "title", "pubdate", "filename", "size", "status"}
+
+// episode in a markdown/html catalog
+type catalogEntry struct {
+	Title    string
+	Date     string
+	Duration string
+	Link     string
+	Filename string
+	Status   string
+	Size     string
+	// show notes as plain text; the feed's html isn't trusted, so is never passed thru
+	Notes string
+}
+
+type catalogDoc struct {
+	Title       string
+	Link        string
+	Author      string
+	Description string
+	Image       string
+	Generated   string
+	Items       []catalogEntry
+}
+
+// shared by markdown and html, so either can execute it
+type catalogTemplate interface {
+	Execute(io.Writer, any) error
+}
+
+var (
+	markdownCatalogTemplate = texttemplate.Must(texttemplate.New("markdown").Funcs(texttemplate.FuncMap{
+		// markdown renders inline html; notes stay text
+		"escapeMarkdownHtml": markdownHtmlReplacer.Replace,
+	}).Parse(
+		`# {{.Title}}
+{{if .Image}}
+![{{.Title}}]({{.Image}})
+{{end}}{{if .Author}}
+by {{.Author}}
+{{end}}{{if .Link}}
+<{{.Link}}>
+{{end}}{{if .Description}}
+{{.Description}}
+{{end}}
+_{{len .Items}} episodes; exported {{.Generated}}_
+{{range .Items}}
+## {{.Title}}
+
+* Published: {{.Date}}{{if .Duration}}
+* Duration: {{.Duration}}{{end}}{{if .Link}}
+* Link: <{{.Link}}>{{end}}
+* File: {{if .Filename}}{{.Filename}} {{end}}({{.Status}}{{if .Size}}, {{.Size}}{{end}})
+{{if .Notes}}
+{{escapeMarkdownHtml .Notes}}
+{{end}}{{end}}`))
+
+	htmlCatalogTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head><body>
+<h1>{{.Title}}</h1>
+{{if .Image}}<img src="{{.Image}}" alt="{{.Title}}" width="200">
+{{end}}{{if .Author}}<p>by {{.Author}}</p>
+{{end}}{{if .Link}}<p><a href="{{.Link}}">{{.Link}}</a></p>
+{{end}}{{if .Description}}<p>{{.Description}}</p>
+{{end}}<p><em>{{len .Items}} episodes; exported {{.Generated}}</em></p>
+{{range .Items}}<h2>{{if .Link}}<a href="{{.Link}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</h2>
+<ul>
+<li>Published: {{.Date}}</li>
+{{if .Duration}}<li>Duration: {{.Duration}}</li>
+{{end}}<li>File: {{if .Filename}}{{.Filename}} {{end}}({{.Status}}{{if .Size}}, {{.Size}}{{end}})</li>
+</ul>
+{{if .Notes}}<div style="white-space: pre-line">{{.Notes}}</div>
+{{end}}{{end}}</body></html>
+`))
+)
+
+var (
+	// contents of elements that aren't text; removed with the element
+	notesNonTextRegex = regexp.MustCompile(`(?is)<(script|style|head|title|template)\b.*?(</(script|style|head|title|template)\s*>|$)`)
+	// elements that end a line of text
+	notesBreakRegex = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/h[1-6]|/tr|/blockquote|/pre)\b[^>]*>`)
+	// any other tag, including one left unclosed at the end
+	notesTagRegex        = regexp.MustCompile(`<[a-zA-Z/!?][^>]*(>|$)`)
+	notesBlankLinesRegex = regexp.MustCompile(`\n{3,}`)
+	markdownHtmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+)
+
+// --------------------------------------------------------------------------
+// one row per episode, for all feeds; deleted feeds (and feeds not in the db) are skipped
+func exportToCsv(feedlist []*Feed, filter exportFilter, file string) error {
+
+	log.Debugf("exporting feeds to %v", file)
+
+	var records = make([][]string, 0)
+	for _, f := range feedlist {
+		if err := f.loadExportItems(filter); err != nil {
+			var errDeleted *ErrorFeedDeleted
+			if errors.Is(err, gorm.ErrRecordNotFound) || errors.As(err, &errDeleted) {
+				f.log.Debug("feed not in db, or deleted; skipping csv export")
+				continue
+			}
+			return err
+		}
+		for _, item := range f.sortedExportItems() {
+			var (
+				size, _ = f.exportItemSize(item)
+				title   = item.Filename
+			)
+			if item.XmlData != nil && item.XmlData.Title != "" {
+				title = item.XmlData.Title
+			}
+			records = append(records, []string{f.Shortname, title, item.PubTimeStamp.Format(time.RFC3339),
+				item.Filename, podutils.Tern(size > 0, strconv.FormatInt(size, 10), ""), exportItemStatus(item)})
+		}
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var cw = csv.NewWriter(out)
+	if err := cw.Write(csvExportHeaders); err != nil {
+		return err
+	} else if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+
+	log.Infof("%v episodes exported to '%v'", len(records), file)
+	return nil
+}
+
+// --------------------------------------------------------------------------
+func csvExportPath() string {
+	var expPath = podutils.Tern(config.ExportPath != "", config.ExportPath, config.WorkspaceDir)
+	return filepath.Join(expPath, csvExportFilename)
+}
+
+// --------------------------------------------------------------------------
+// markdown or html catalog of the feed's episodes, newest first, with show notes
+func exportToCatalog(f *Feed, tmpl catalogTemplate, file string) error {
+
+	f.log.Debugf("exporting catalog to %v", file)
+
+	var doc = catalogDoc{
+		Title:     podutils.Tern(f.Name != "", f.Name, f.Shortname),
+		Generated: config.Timestamp.Format(time.DateTime),
+	}
+	if xml := f.XmlFeedData; xml != nil {
+		doc.Title = podutils.Tern(xml.Title != "", xml.Title, doc.Title)
+		doc.Link = xml.Link
+		doc.Author = xml.Author
+		doc.Description = podutils.Tern(xml.Description != "", xml.Description, xml.Subtitle)
+		doc.Image = podutils.Tern(xml.ItunesImageUrl != "", xml.ItunesImageUrl, xml.Image.Url)
+	}
+
+	for _, item := range f.sortedExportItems() {
+		var entry = catalogEntry{
+			Title:    item.Filename,
+			Date:     item.PubTimeStamp.Format(time.DateOnly),
+			Filename: item.Filename,
+			Status:   exportItemStatus(item),
+		}
+		if size, onDisk := f.exportItemSize(item); size > 0 && onDisk {
+			entry.Size = podutils.FormatBytes(uint64(size))
+		}
+		if xml := item.XmlData; xml != nil {
+			entry.Title = podutils.Tern(xml.Title != "", xml.Title, item.Filename)
+			entry.Duration = xml.DurationStr
+			entry.Link = xml.Link
+			entry.Notes = notesText(showNotes(&xml.XItemData))
+		}
+		doc.Items = append(doc.Items, entry)
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := tmpl.Execute(out, doc); err != nil {
+		return err
+	}
+
+	f.log.Infof("catalog exported to '%v'", file)
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// rss regenerated from the stored channel and episode xml, as last fetched; enclosures point at
+// the original urls
+func exportToRss(f *Feed, file string) error {
+
+	f.log.Debugf("exporting rss to %v", file)
+
+	var channel = podutils.RssChannel{
+		Title:       podutils.Tern(f.Name != "", f.Name, f.Shortname),
+		Description: f.Name,
+	}
+	if xml := f.XmlFeedData; xml != nil {
+		channel.Title = podutils.Tern(xml.Title != "", xml.Title, channel.Title)
+		channel.Link = xml.Link
+		channel.Description = xml.Description
+		channel.Copyright = xml.Copyright
+		channel.PubDate = podutils.RssDate(xml.PubDate)
+		channel.LastBuildDate = podutils.RssDate(xml.LastBuildDate)
+		channel.ItunesAuthor = xml.Author
+		channel.ItunesSubtitle = xml.Subtitle
+		channel.NewFeedUrl = xml.NewFeedUrl
+		if xml.ItunesImageUrl != "" {
+			channel.ItunesImage = &podutils.RssHref{Href: xml.ItunesImageUrl}
+		}
+		if xml.Image.Url != "" {
+			channel.Image = &podutils.RssImage{Url: xml.Image.Url, Title: xml.Image.Title, Link: xml.Image.Link}
+		}
+		if xml.ItunesOwner.Name != "" || xml.ItunesOwner.Email != "" {
+			channel.ItunesOwner = &podutils.RssOwner{Name: xml.ItunesOwner.Name, Email: xml.ItunesOwner.Email}
+		}
+	}
+
+	for _, item := range f.sortedExportItems() {
+		var rssItem = podutils.RssItem{
+			Title:     item.Filename,
+			Guid:      &podutils.RssGuid{Value: item.Guid},
+			PubDate:   podutils.RssDate(item.PubTimeStamp),
+			Enclosure: podutils.RssEnclosure{Url: item.Url},
+		}
+		if xml := item.XmlData; xml != nil {
+			rssItem.Title = podutils.Tern(xml.Title != "", xml.Title, item.Filename)
+			rssItem.Link = xml.Link
+			rssItem.Description = xml.Description
+			rssItem.ContentEncoded = xml.ContentEncoded
+			rssItem.Author = xml.Author
+			rssItem.ItunesAuthor = xml.ItunesAuthor
+			rssItem.ItunesSummary = xml.ItunesSummary
+			rssItem.ItunesDuration = xml.DurationStr
+			rssItem.ItunesEpisode = xml.EpisodeStr
+			rssItem.ItunesSeason = xml.SeasonStr
+			rssItem.Enclosure = podutils.RssEnclosure{
+				Url:    podutils.Tern(xml.Enclosure.Url != "", xml.Enclosure.Url, item.Url),
+				Length: int64(xml.Enclosure.Length),
+				Type:   xml.Enclosure.TypeStr,
+			}
+			if xml.Imageurl != "" {
+				rssItem.ItunesImage = &podutils.RssHref{Href: xml.Imageurl}
+			}
+		}
+		channel.Items = append(channel.Items, rssItem)
+	}
+
+	buf, err := podutils.GenerateRss(channel)
+	if err != nil {
+		return err
+	} else if err := os.WriteFile(file, buf, 0644); err != nil {
+		return err
+	}
+
+	f.log.Infof("rss exported to '%v'", file)
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// items newest first
+func (f Feed) sortedExportItems() []*ItemDBEntry {
+	var list = slices.Clone(f.ItemList)
+	slices.SortStableFunc(list, func(l, r *ItemDBEntry) int {
+		return r.PubTimeStamp.Compare(l.PubTimeStamp)
+	})
+	return list
+}
+
+// --------------------------------------------------------------------------
+// size of the file on disk if downloaded (or archived), otherwise the enclosure length from the feed
+func (f Feed) exportItemSize(item *ItemDBEntry) (size int64, onDisk bool) {
+	if item.Downloaded || item.Archived {
+		var path = filepath.Join(f.mp3Path, item.Filename)
+		if item.Archived {
+			path = filepath.Join(f.itemArchivePath(item.ArchiveDir, item.PubTimeStamp), item.Filename)
+		}
+		if stat, err := os.Stat(path); err == nil {
+			return stat.Size(), true
+		}
+	}
+	if item.XmlData != nil {
+		return int64(item.XmlData.Enclosure.Length), false
+	}
+	return 0, false
+}
+
+// --------------------------------------------------------------------------
+func exportItemStatus(item *ItemDBEntry) string {
+	switch {
+	case item.Archived:
+		return "archived"
+	case item.Downloaded:
+		return "downloaded"
+	default:
+		return "not downloaded"
+	}
+}
+
+// --------------------------------------------------------------------------
+// most complete of the episode's notes
+func showNotes(xml *podutils.XItemData) string {
+	for _, notes := range []string{xml.ContentEncoded, xml.Description, xml.ItunesSummary} {
+		if notes != "" {
+			return notes
+		}
+	}
+	return ""
+}
+
+// --------------------------------------------------------------------------
+// show notes are html from the feed; reduced to text (line breaks kept) so nothing in them is rendered.
+// The templates escape the result
+func notesText(notes string) string {
+	notes = notesNonTextRegex.ReplaceAllString(notes, "")
+	notes = notesBreakRegex.ReplaceAllString(notes, "\n")
+	notes = html.UnescapeString(notesTagRegex.ReplaceAllString(notes, ""))
+
+	var lines = strings.Split(strings.ReplaceAll(notes, "\r", ""), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(notesBlankLinesRegex.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
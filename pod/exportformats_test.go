@@ -0,0 +1,254 @@
+package pod
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopod/podconfig"
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+func TestExportFilter_matches(t *testing.T) {
+
+	var (
+		yes  = true
+		no   = false
+		date = func(year int) time.Time { return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC) }
+		item = &ItemDBEntry{}
+	)
+	item.PubTimeStamp, item.Downloaded = date(2020), true
+
+	tests := []struct {
+		name   string
+		filter exportFilter
+		want   bool
+	}{
+		{"no filter", exportFilter{}, true},
+		{"after", exportFilter{after: date(2019)}, true},
+		{"after, excluded", exportFilter{after: date(2021)}, false},
+		{"before", exportFilter{before: date(2021)}, true},
+		{"before is exclusive", exportFilter{before: date(2020)}, false},
+		{"downloaded", exportFilter{downloaded: &yes}, true},
+		{"not downloaded", exportFilter{downloaded: &no}, false},
+		{"not archived", exportFilter{archived: &no}, true},
+		{"archived", exportFilter{archived: &yes}, false},
+		{"all", exportFilter{after: date(2019), before: date(2021), downloaded: &yes, archived: &no}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.AssertEquals(t, tt.want, tt.filter.matches(item))
+		})
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+
+	var (
+		dir       = t.TempDir()
+		oldConfig = config
+		oldDB     = db
+		date      = func(year int) time.Time { return time.Date(year, 4, 1, 0, 0, 0, 0, time.UTC) }
+	)
+	defer func() {
+		db.Close()
+		config, db = oldConfig, oldDB
+	}()
+
+	config = &podconfig.Config{WorkspaceDir: dir, TimestampStr: "test"}
+	if pdb, err := NewDB(DBPath(dir)); err != nil {
+		t.Fatalf("error creating db: %v", err)
+	} else {
+		db = pdb
+	}
+
+	var loadFeed = func() *Feed {
+		f, err := NewFeed(podconfig.FeedToml{Name: "foo cast", Shortname: "foo", Url: "https://foo.bar/foo"})
+		if err != nil {
+			t.Fatalf("error creating feed: %v", err)
+		}
+		return f
+	}
+	var f = loadFeed()
+	testutils.AssertErr(t, false, f.LoadDBFeed(loadOptions{}))
+	f.XmlFeedData = &FeedXmlDBEntry{}
+	f.XmlFeedData.Title = "Foo Cast"
+	f.XmlFeedData.Link = "https://foo.bar"
+	f.XmlFeedData.Description = "foo & bar"
+	f.XmlFeedData.ItunesOwner.Email = "foo@foo.bar"
+	testutils.AssertErr(t, false, db.saveFeed(&f.FeedDBEntry))
+
+	// ep1 downloaded (file on disk), ep2 not, ep3 archived
+	var list = make([]*ItemDBEntry, 0)
+	for _, ti := range []struct {
+		name       string
+		year       int
+		downloaded bool
+		archived   bool
+	}{{"ep1", 2020, true, false}, {"ep2", 2021, false, false}, {"ep3", 2019, false, true}} {
+		var item = generateItem(f.ID, true)
+		item.Guid, item.XmlData.Guid = ti.name, ti.name
+		item.Filename, item.PubTimeStamp, item.Downloaded, item.Archived = ti.name+".mp3", date(ti.year), ti.downloaded, ti.archived
+		item.XmlData.Title, item.XmlData.Pubdate = "episode "+ti.name, item.PubTimeStamp
+		item.XmlData.Enclosure.Url, item.XmlData.Enclosure.Length = "https://foo.bar/"+item.Filename, 1000
+		item.XmlData.ContentEncoded = `<p onclick="alert(1)">notes for ` + ti.name + `</p><script>alert(1)</script>`
+		list = append(list, &item)
+	}
+	testutils.AssertErr(t, false, db.saveItems(list...))
+	testutils.AssertErr(t, false, os.MkdirAll(f.mp3Path, 0755))
+	testutils.AssertErr(t, false, os.WriteFile(filepath.Join(f.mp3Path, "ep1.mp3"), []byte("0123456789"), 0644))
+
+	t.Run("csv", func(t *testing.T) {
+		var (
+			file = filepath.Join(dir, "gopod.csv")
+			yes  = true
+		)
+		testutils.AssertErr(t, false, exportToCsv([]*Feed{loadFeed()}, exportFilter{}, file))
+		records := readCsv(t, file)
+		testutils.AssertEquals(t, [][]string{
+			csvExportHeaders,
+			{"foo", "episode ep2", date(2021).Format(time.RFC3339), "ep2.mp3", "1000", "not downloaded"},
+			{"foo", "episode ep1", date(2020).Format(time.RFC3339), "ep1.mp3", "10", "downloaded"},
+			{"foo", "episode ep3", date(2019).Format(time.RFC3339), "ep3.mp3", "1000", "archived"},
+		}, records)
+
+		// filtered
+		testutils.AssertErr(t, false, exportToCsv([]*Feed{loadFeed()}, exportFilter{downloaded: &yes}, file))
+		records = readCsv(t, file)
+		testutils.AssertEquals(t, 2, len(records))
+		testutils.AssertEquals(t, "ep1.mp3", records[1][3])
+
+		// feeds not in the db are skipped
+		bar, err := NewFeed(podconfig.FeedToml{Name: "bar cast", Shortname: "bar", Url: "https://foo.bar/bar"})
+		testutils.AssertErr(t, false, err)
+		testutils.AssertErr(t, false, exportToCsv([]*Feed{bar}, exportFilter{}, file))
+		testutils.AssertEquals(t, 1, len(readCsv(t, file)))
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		var (
+			ef   = loadFeed()
+			file = filepath.Join(dir, "foo.md")
+		)
+		testutils.AssertErr(t, false, ef.loadExportItems(exportFilter{after: date(2020)}))
+		testutils.AssertErr(t, false, exportToCatalog(ef, markdownCatalogTemplate, file))
+		buf, err := os.ReadFile(file)
+		testutils.AssertErr(t, false, err)
+		var md = string(buf)
+		testutils.Assert(t, strings.HasPrefix(md, "# Foo Cast\n"), "catalog title missing")
+		testutils.Assert(t, strings.Index(md, "## episode ep2") < strings.Index(md, "## episode ep1"), "episodes not newest first")
+		testutils.Assert(t, strings.Contains(md, "## episode ep3") == false, "filtered episode exported")
+		testutils.Assert(t, strings.Contains(md, "notes for ep1"), "show notes missing")
+	})
+
+	t.Run("html", func(t *testing.T) {
+		var (
+			ef   = loadFeed()
+			file = filepath.Join(dir, "foo.html")
+		)
+		testutils.AssertErr(t, false, ef.loadExportItems(exportFilter{}))
+		testutils.AssertErr(t, false, exportToCatalog(ef, htmlCatalogTemplate, file))
+		buf, err := os.ReadFile(file)
+		testutils.AssertErr(t, false, err)
+		var html = string(buf)
+		testutils.Assert(t, strings.Contains(html, "<h1>Foo Cast</h1>"), "catalog title missing")
+		testutils.Assert(t, strings.Contains(html, "foo &amp; bar"), "description not escaped")
+		testutils.Assert(t, strings.Contains(html, `<div style="white-space: pre-line">notes for ep3</div>`), "show notes missing")
+		testutils.Assert(t, strings.Contains(html, "<script>") == false, "script not removed from notes")
+		testutils.Assert(t, strings.Contains(html, "onclick") == false, "event handler not removed from notes")
+	})
+
+	t.Run("rss", func(t *testing.T) {
+		var (
+			ef   = loadFeed()
+			file = filepath.Join(dir, "foo.rss.xml")
+		)
+		testutils.AssertErr(t, false, ef.loadExportItems(exportFilter{}))
+		testutils.AssertErr(t, false, exportToRss(ef, file))
+		buf, err := os.ReadFile(file)
+		testutils.AssertErr(t, false, err)
+
+		// round trip thru the feed parser
+		feedData, items, err := podutils.ParseXml(buf, hackFeedProcess{})
+		if testutils.AssertErr(t, false, err) {
+			testutils.AssertEquals(t, "Foo Cast", feedData.Title)
+			testutils.AssertEquals(t, "foo@foo.bar", feedData.ItunesOwner.Email)
+			testutils.AssertEquals(t, 3, len(items))
+			testutils.AssertEquals(t, "ep2", items[0].Hash)
+			testutils.AssertEquals(t, "https://foo.bar/ep2.mp3", items[0].ItemData.Enclosure.Url)
+			testutils.AssertEquals(t, uint(1000), items[0].ItemData.Enclosure.Length)
+			testutils.Assert(t, strings.Contains(items[0].ItemData.ContentEncoded, "notes for ep2"), "show notes missing")
+			testutils.Assert(t, items[0].ItemData.Pubdate.Equal(date(2021)), "pubdate not kept")
+		}
+	})
+}
+
+func readCsv(t *testing.T, file string) [][]string {
+	t.Helper()
+	in, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("error opening csv: %v", err)
+	}
+	defer in.Close()
+	records, err := csv.NewReader(in).ReadAll()
+	if err != nil {
+		t.Fatalf("error reading csv: %v", err)
+	}
+	return records
+}
+
+func TestNotesText(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		notes string
+		exp   string
+	}{
+		{"text", "notes", "notes"},
+		{"paragraphs", "<p>one</p><p>two<br/>three</p>", "one\ntwo\nthree"},
+		{"blank lines collapsed", "<p>one</p><br><br><br><p>two</p>", "one\n\ntwo"},
+		{"whitespace", "  one \r\n  two  ", "one\ntwo"},
+		{"entities", "foo &amp; bar &lt;b&gt;", "foo & bar <b>"},
+		{"not a tag", "1 < 2 and 3 > 2", "1 < 2 and 3 > 2"},
+		{"script", "a<script>alert(1)</script>b", "ab"},
+		{"script unclosed", `a<script src=//x.y/z.js>`, "a"},
+		{"script unclosed tag", `a<script src=//x.y/z.js`, "a"},
+		{"style", "a<style>p { color: red }</style>b", "ab"},
+		{"event handler", `<img/onerror=alert(1) src=x>a`, "a"},
+		{"link", `<a href="javascript:alert(1)">a</a>`, "a"},
+		{"entity encoded url", `<a href="&#106;avascript:alert(1)">a</a>`, "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.AssertEquals(t, tt.exp, notesText(tt.notes))
+		})
+	}
+}
+
+// whatever survives as text, the catalogs don't render it as markup
+func TestCatalogTemplates_notes(t *testing.T) {
+
+	var bypasses = []string{
+		`<script src=//x.y/z.js>`,
+		`<img/onerror=alert(1) src=x>`,
+		`<a href="&#106;avascript:alert(1)">a</a>`,
+		`&lt;script&gt;alert(1)&lt;/script&gt;`,
+		`&lt;img src=x onerror=alert(1)&gt;`,
+	}
+	for _, notes := range bypasses {
+		var doc = catalogDoc{Title: "foo", Items: []catalogEntry{{Title: "ep", Notes: notesText(notes)}}}
+		for name, tmpl := range map[string]catalogTemplate{"md": markdownCatalogTemplate, "html": htmlCatalogTemplate} {
+			var sb strings.Builder
+			testutils.AssertErr(t, false, tmpl.Execute(&sb, doc))
+			for _, bad := range []string{"<script", "<img", "<a ", "javascript:alert"} {
+				testutils.Assert(t, strings.Contains(strings.ToLower(sb.String()), bad) == false,
+					fmt.Sprintf("%v: '%v' rendered from notes %v", name, bad, notes))
+			}
+		}
+	}
+}
@@ -56,11 +56,17 @@ type FeedDBEntry struct {
 	imageMap  map[string]*ImageDBEntry
 	etagMap   map[string]*ImageDBEntry
 	ImageKey  string
+
+	// results of the most recent update run
+	LastUpdated time.Time // last update without errors
+	LastError   string
 }
 
 type FeedXmlDBEntry struct {
 	PodDBModel
 	podutils.XChannelData `gorm:"embedded"`
+	// items in the feed xml when last fetched, for tracking changes
+	ItemList []feedItemSnapshot `gorm:"serializer:json"`
 }
 
 type LastMod struct {
@@ -144,7 +150,7 @@ func (f *Feed) initFeed() error {
 		return err
 	}
 
-	f.archivePath = filepath.Join(config.WorkspaceDir, f.Shortname, ".arc")
+	f.archivePath = feedArchivePath(f.Shortname)
 	// don't create the path; assume it will be created when archive is run
 
 	// make sure last modifed cache is created
@@ -157,6 +163,11 @@ func (f *Feed) initFeed() error {
 	return nil
 }
 
+// --------------------------------------------------------------------------
+func feedArchivePath(shortname string) string {
+	return filepath.Join(config.WorkspaceDir, shortname, ".arc")
+}
+
 // --------------------------------------------------------------------------
 func (f *Feed) LoadDBFeed(opt loadOptions) error {
 
@@ -245,9 +256,18 @@ func (f *Feed) loadDBFeedItems(numItems int, opt loadOptions) ([]*Item, error) {
 		return nil, errors.New("feed id is zero")
 	}
 
+	var pdb = db
+	if opt.includeArchives {
+		if pdb, err = openFeedCatalog(f); err != nil {
+			f.log.Errorf("Failed to open archive catalog: %v", err)
+			return nil, err
+		}
+		defer pdb.Close()
+	}
+
 	// load itemlist.. if numitems is negative, load everything..
 	// otherwise limit to numLatest
-	entryList, err = db.loadFeedItems(f.ID, numItems, opt)
+	entryList, err = pdb.loadFeedItems(f.ID, numItems, opt)
 	if err != nil {
 		f.log.Errorf("Failed to get item data from db: %v", err)
 		return nil, err
@@ -273,7 +293,8 @@ func (f *Feed) loadDBFeedItems(numItems int, opt loadOptions) ([]*Item, error) {
 }
 
 // --------------------------------------------------------------------------
-func (f *Feed) saveDBFeed(newxml *podutils.XChannelData, newitems []*Item) error {
+// saves feed, xml, items and images through pdb (either db, or a transaction from WithTx)
+func (f *Feed) saveDBFeed(pdb *PodDB, newxml *podutils.XChannelData, newitems []*Item) error {
 
 	// make sure we have an ID.. in loading, if this is a new feed, we're creating via FirstOrCreate
 	if f.ID == 0 {
@@ -315,7 +336,7 @@ func (f *Feed) saveDBFeed(newxml *podutils.XChannelData, newitems []*Item) error
 		}
 	}
 
-	if err := db.saveFeed(&f.FeedDBEntry); err != nil {
+	if err := pdb.saveFeed(&f.FeedDBEntry); err != nil {
 		f.log.Errorf("error saving feed db: %v", err)
 		return err
 	}
@@ -339,7 +360,7 @@ func (f *Feed) saveDBFeed(newxml *podutils.XChannelData, newitems []*Item) error
 }
 
 // --------------------------------------------------------------------------
-func (f *Feed) saveDBFeedItems(itemlist ...*Item) error {
+func (f *Feed) saveDBFeedItems(pdb *PodDB, itemlist ...*Item) error {
 	// make sure we have an ID.. in loading, if this is a new feed, we're creating via FirstOrCreate
 	if f.ID == 0 {
 		return errors.New("unable to save to db; feed id is zero")
@@ -356,7 +377,7 @@ func (f *Feed) saveDBFeedItems(itemlist ...*Item) error {
 
 	if commitList, err := f.genItemDBEntryList(itemlist); err != nil {
 		return err
-	} else if err := db.saveItems(commitList...); err != nil {
+	} else if err := pdb.saveItems(commitList...); err != nil {
 		return err
 	}
 	return nil
@@ -450,7 +471,7 @@ func (f *Feed) addImage(imgData *ImageDBEntry) error {
 }
 
 // save images, not using any map data
-func (f *Feed) saveDBFeedImages(imgData map[string]*ImageDBEntry) error {
+func (f *Feed) saveDBFeedImages(pdb *PodDB, imgData map[string]*ImageDBEntry) error {
 	if f.ID == 0 {
 		return errors.New("unable to save to db; feed id is zero")
 	} else if len(imgData) == 0 {
@@ -470,7 +491,7 @@ func (f *Feed) saveDBFeedImages(imgData map[string]*ImageDBEntry) error {
 		imglist = append(imglist, img)
 	}
 
-	if err := db.saveImages(imglist...); err != nil {
+	if err := pdb.saveImages(imglist...); err != nil {
 		return err
 	}
 	return nil
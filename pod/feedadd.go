@@ -0,0 +1,236 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"gopod/inputoption"
+	log "gopod/multilogger"
+	"gopod/podconfig"
+	"gopod/podutils"
+)
+
+const (
+	// number of the most recent filenames shown per preview, when adding a feed
+	addPreviewCount = 10
+	// max length of suggested shortnames
+	shortnameMaxLength = 16
+)
+
+// filename parse suggestions when adding a new feed; blank uses the url filename
+var addParseTemplates = []string{
+	"",
+	"#shortname#.ep#count##ext#",
+	"#shortname#.#date#.#title##ext#",
+	"#shortname#.ep#episode##ext#",
+}
+
+// --------------------------------------------------------------------------
+// subscribe to a new feed from the url given on the commandline; fetches the feed, suggests a
+// shortname from the channel title, previews the generated filenames, and lets the user pick or
+// edit filenameParse before appending the new feed to the config file.  Returns nil on cancel
+func AddFeed(existing []podconfig.FeedToml) (*podconfig.FeedToml, error) {
+
+	if config == nil {
+		return nil, errors.New("cannot add feed; config is nil")
+	} else if config.AddUrl == "" {
+		return nil, errors.New("feed url cannot be empty")
+	}
+
+	var (
+		url       = config.AddUrl
+		toml      = podconfig.FeedToml{Url: url}
+		fprev     = previewFeedProcess{feedUpdate: feedUpdate{feed: &Feed{FeedToml: toml}}}
+		body      []byte
+		chanData  *podutils.XChannelData
+		itemPairs []podutils.ItemPair
+		err       error
+	)
+
+	for _, ex := range existing {
+		if ex.Url == url {
+			return nil, fmt.Errorf("feed url already exists in config (shortname '%v')", podutils.Tern(ex.Shortname != "", ex.Shortname, ex.Name))
+		}
+	}
+
+	log.With("url", url).Info("fetching feed for add")
+	if body, err = podutils.Download(url); err != nil {
+		return nil, fmt.Errorf("failed to download feed: %w", err)
+	} else if chanData, itemPairs, err = podutils.ParseXml(body, fprev); err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	} else if len(itemPairs) == 0 {
+		log.Warn("feed has no items; filename preview will be empty")
+	}
+
+	toml.Name = strings.TrimSpace(chanData.Title)
+	if toml.Name == "" {
+		toml.Name = url
+	}
+	fmt.Printf("Feed found: '%v' (%v items)\n", toml.Name, len(itemPairs))
+
+	if toml.Name, err = inputoption.RunTextInput("feed name", toml.Name); err != nil {
+		return nil, err
+	}
+	if toml.Shortname, err = inputoption.RunTextInput("feed shortname", suggestShortname(toml.Name, existing)); err != nil {
+		return nil, err
+	}
+	// make sure shortname is valid before previewing with it
+	if err := podconfig.ValidateFeedToml(toml, existing); err != nil {
+		return nil, err
+	}
+
+	// previews only need the toml; the feed directories aren't created until the user accepts
+	var f = &Feed{FeedToml: toml}
+	f.log = log.With("feed", toml.Shortname)
+	if accepted, err := f.selectFilenameParse(itemPairs); err != nil {
+		return nil, err
+	} else if accepted == false {
+		f.log.Info("add cancelled; config not modified")
+		return nil, nil
+	}
+
+	if err := podconfig.ValidateFeedToml(f.FeedToml, existing); err != nil {
+		return nil, err
+	}
+
+	// creates the feed directories; saving the xml so a following update can use --use-recent
+	if fprev.feed, err = NewFeed(f.FeedToml); err != nil {
+		return nil, err
+	}
+	fprev.saveAndRotateXml(body, true)
+
+	if err := podconfig.AppendFeedToml(config.ConfigFile, f.FeedToml); err != nil {
+		return nil, fmt.Errorf("failed appending feed to config: %w", err)
+	}
+
+	f.log.Infof("feed added to config '%v'", config.ConfigFile)
+	return &f.FeedToml, nil
+}
+
+// --------------------------------------------------------------------------
+// loops on previewing filenames for the feed, until the user accepts or cancels
+func (f *Feed) selectFilenameParse(itemPairs []podutils.ItemPair) (bool, error) {
+
+	var (
+		inpAccept = inputoption.GenOption("accept", 'a', true)
+		inpEdit   = inputoption.GenOption("edit filenameParse", 'e', false)
+		inpRegex  = inputoption.GenOption("edit title regex (for #titleregex:X#)", 'r', false)
+		inpCancel = inputoption.GenOption("cancel", 'q', false)
+		templates = make([]*inputoption.InputOption, 0, len(addParseTemplates))
+	)
+
+	for idx, tmpl := range addParseTemplates {
+		var desc = podutils.Tern(tmpl == "", "use url filename", fmt.Sprintf("use %v", tmpl))
+		templates = append(templates, inputoption.GenOption(desc, rune('1'+idx), false))
+	}
+
+	for {
+		if itemList, err := f.genPreviewItems(itemPairs); err != nil {
+			return false, err
+		} else {
+			f.printAddPreview(itemList)
+		}
+
+		var opts = append(slices.Clone(templates), inpEdit, inpRegex, inpAccept, inpCancel)
+		opt, err := inputoption.RunSelection("filenameParse", opts...)
+		if err != nil {
+			return false, err
+		}
+
+		switch opt {
+		case inpAccept:
+			if err := f.verifyFilenameParse(itemPairs); err != nil {
+				fmt.Printf("filenameParse not valid: %v\n", err)
+				continue
+			}
+			return true, nil
+		case inpCancel:
+			return false, nil
+		case inpEdit:
+			if f.FilenameParse, err = inputoption.RunTextInput("filenameParse", f.FilenameParse); err != nil {
+				return false, err
+			}
+		case inpRegex:
+			if f.Regex, err = inputoption.RunTextInput("regex", f.Regex); err != nil {
+				return false, err
+			}
+		default:
+			if idx := slices.Index(templates, opt); idx >= 0 {
+				f.FilenameParse = addParseTemplates[idx]
+			}
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+// outputs the most recent generated filenames
+func (f Feed) printAddPreview(itemList []*Item) {
+	var start = max(len(itemList)-addPreviewCount, 0)
+
+	fmt.Printf("\nfilenameParse: '%v'", f.FilenameParse)
+	if f.Regex != "" {
+		fmt.Printf(" regex: '%v'", f.Regex)
+	}
+	fmt.Printf("\nshowing %v most recent of %v items:\n", len(itemList)-start, len(itemList))
+
+	for idx := len(itemList) - 1; idx >= start; idx-- {
+		fmt.Printf("%3d: %v\n", idx+1, itemList[idx].Filename)
+	}
+	fmt.Print("\n")
+}
+
+// --------------------------------------------------------------------------
+// makes sure filename generation succeeds for every item, with the current filenameParse
+func (f *Feed) verifyFilenameParse(itemPairs []podutils.ItemPair) error {
+	if itemList, err := f.genPreviewItems(itemPairs); err != nil {
+		return err
+	} else {
+		for _, item := range itemList {
+			if _, _, err := item.generateFilename(f.FeedToml, nil); err != nil {
+				return fmt.Errorf("'%v': %w", item.XmlData.Title, err)
+			}
+		}
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// suggests a file friendly shortname from the feed title; acronym of the title words if the
+// title is long enough, otherwise the words joined.  Appends a number if the shortname exists
+func suggestShortname(title string, existing []podconfig.FeedToml) string {
+
+	var words = strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return (unicode.IsLetter(r) || unicode.IsDigit(r)) == false
+	})
+
+	var shortname string
+	if len(words) >= 3 {
+		for _, w := range words {
+			shortname += string([]rune(w)[0])
+		}
+	} else {
+		shortname = strings.Join(words, "")
+	}
+
+	if r := []rune(shortname); len(r) > shortnameMaxLength {
+		shortname = string(r[:shortnameMaxLength])
+	}
+	if shortname == "" {
+		shortname = "feed"
+	}
+
+	var exists = func(sn string) bool {
+		return slices.ContainsFunc(existing, func(ft podconfig.FeedToml) bool {
+			return strings.EqualFold(sn, podutils.Tern(ft.Shortname != "", ft.Shortname, ft.Name))
+		})
+	}
+
+	var ret = shortname
+	for num := 2; exists(ret); num++ {
+		ret = fmt.Sprintf("%v%v", shortname, num)
+	}
+	return ret
+}
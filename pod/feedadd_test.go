@@ -0,0 +1,44 @@
+package pod
+
+import (
+	"gopod/podconfig"
+	"gopod/testutils"
+	"testing"
+)
+
+func Test_suggestShortname(t *testing.T) {
+
+	var existing = []podconfig.FeedToml{
+		{Name: "This Week in Tech", Shortname: "twit"},
+		{Name: "darknet"},
+		{Name: "foo", Shortname: "foobar"},
+		{Name: "foo2", Shortname: "foobar2"},
+	}
+
+	type args struct {
+		title    string
+		existing []podconfig.FeedToml
+	}
+	tests := []struct {
+		name string
+		p    args
+		exp  string
+	}{
+		{"empty title", args{title: ""}, "feed"},
+		{"symbols only", args{title: "+ = !"}, "feed"},
+		{"single word", args{title: "Darknet"}, "darknet"},
+		{"two words", args{title: "Darknet Diaries"}, "darknetdiaries"},
+		{"acronym", args{title: "Algorithms + Data Structures = Programs"}, "adsp"},
+		{"acronym with numbers", args{title: "The 404 Show"}, "t4s"},
+		{"max length", args{title: "Supercalifragilistic Expialidocious"}, "supercalifragili"},
+		{"exists", args{title: "This Week in Tech", existing: existing}, "twit2"},
+		{"exists on name", args{title: "darknet", existing: existing}, "darknet2"},
+		{"exists multiple", args{title: "foo bar", existing: existing}, "foobar3"},
+		{"exists case insensitive", args{title: "TWIT", existing: existing}, "twit2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.AssertEquals(t, tt.exp, suggestShortname(tt.p.title, tt.p.existing))
+		})
+	}
+}
@@ -3,8 +3,13 @@ package pod
 import (
 	"errors"
 	"fmt"
+	"gopod/podconfig"
 	"gopod/podutils"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	log "gopod/multilogger"
@@ -14,12 +19,15 @@ type archType struct {
 	feed *Feed
 	log  log.Logger
 
-	year   int
+	dir    string // directory name under the feed's archive path
 	path   string
 	items  []*Item
 	images map[string]*ImageDBEntry
 }
 
+// meteorological seasons, in order from december
+var seasonNames = [...]string{"winter", "spring", "summer", "fall"}
+
 // --------------------------------------------------------------------------
 func Archive(feeds ...*Feed) error {
 
@@ -29,7 +37,11 @@ func Archive(feeds ...*Feed) error {
 		feed.log.Info("running archive")
 		if e := archive(feed); e != nil {
 			feed.log.Error("error archiving feed", "err", e)
-			errors.Join(err, e)
+			err = errors.Join(err, e)
+		} else if config.ArchiveBundle != "" {
+			if e := feed.bundleArchives(config.ArchiveBundle, config.RemoveOriginals); e != nil {
+				err = errors.Join(err, e)
+			}
 		}
 		feed.log.Info("archive complete")
 	}
@@ -37,6 +49,116 @@ func Archive(feeds ...*Feed) error {
 	return err
 }
 
+// --------------------------------------------------------------------------
+// directory items published in the given year are archived to, by default
+func (f Feed) archiveYearPath(year int) string {
+	return filepath.Join(f.archivePath, fmt.Sprintf("%s.%d", f.Shortname, year))
+}
+
+// --------------------------------------------------------------------------
+// directory an item is archived in; items archived before the directory was kept with the item
+// are in the year directory
+func (f Feed) itemArchivePath(dir string, pubdate time.Time) string {
+	if dir == "" {
+		return f.archiveYearPath(pubdate.Year())
+	}
+	return filepath.Join(f.archivePath, dir)
+}
+
+// --------------------------------------------------------------------------
+// global archive policy, with any of the feed's settings applied
+func (f Feed) archivePolicy() podconfig.ArchivePolicy {
+	return config.Archive.Merge(f.Archive)
+}
+
+// --------------------------------------------------------------------------
+// season the time is in, along with the year of the season; december is in the following
+// year's winter
+func itemSeason(t time.Time) (int, string) {
+	var year, month = t.Year(), t.Month()
+	if month == time.December {
+		year++
+	}
+	return year, seasonNames[int(month)%12/3]
+}
+
+// --------------------------------------------------------------------------
+// start of the period (year, month or season) the time is in
+func archivePeriodStart(by string, t time.Time) time.Time {
+	var year, month = t.Year(), t.Month()
+	switch by {
+	case podconfig.ArchiveByMonth:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	case podconfig.ArchiveBySeason:
+		// winter starts the december before; other seasons start on march, june and september
+		if month == time.December {
+			return time.Date(year, time.December, 1, 0, 0, 0, 0, t.Location())
+		} else if month < time.March {
+			return time.Date(year-1, time.December, 1, 0, 0, 0, 0, t.Location())
+		}
+		return time.Date(year, month-month%3, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// --------------------------------------------------------------------------
+// archive directory name for an item, from the policy's path template
+func archiveDirName(policy podconfig.ArchivePolicy, shortname string, pubdate time.Time) string {
+	var seasonYear, season = itemSeason(pubdate)
+	var r = strings.NewReplacer(
+		"{shortname}", shortname,
+		"{year}", fmt.Sprintf("%d", pubdate.Year()),
+		"{month}", fmt.Sprintf("%02d", int(pubdate.Month())),
+		"{season}", fmt.Sprintf("%d-%v", seasonYear, season),
+	)
+	return r.Replace(policy.PathOrDefault())
+}
+
+// --------------------------------------------------------------------------
+// items to be archived under the policy, in the order given; items already archived are skipped
+func selectArchiveItems(itemlist []*Item, policy podconfig.ArchivePolicy, now time.Time) []*Item {
+	var (
+		by     = policy.ByOrDefault()
+		recent = make(map[*Item]bool)
+		ret    = make([]*Item, 0)
+	)
+
+	if by == podconfig.ArchiveByEpisodes {
+		// most recent episodes are kept, archived or not
+		var sorted = slices.Clone(itemlist)
+		slices.SortStableFunc(sorted, func(a, b *Item) int { return b.PubTimeStamp.Compare(a.PubTimeStamp) })
+		for _, item := range sorted[:min(policy.Age, len(sorted))] {
+			recent[item] = true
+		}
+	}
+
+	for _, item := range itemlist {
+		if item.Archived {
+			continue
+		} else if strings.EqualFold(policy.Only, podconfig.ArchiveOnlyDownloaded) && item.Downloaded == false {
+			continue
+		} else if strings.EqualFold(policy.Only, podconfig.ArchiveOnlyListened) && item.Listened == false {
+			continue
+		}
+
+		var old bool
+		switch by {
+		case podconfig.ArchiveByDays:
+			old = item.PubTimeStamp.Before(now.AddDate(0, 0, -policy.Age))
+		case podconfig.ArchiveByEpisodes:
+			old = recent[item] == false
+		default:
+			// published before the current period
+			old = archivePeriodStart(by, item.PubTimeStamp).Before(archivePeriodStart(by, now))
+		}
+		if old {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
 // --------------------------------------------------------------------------
 func archive(f *Feed) error {
 	var (
@@ -48,11 +170,9 @@ func archive(f *Feed) error {
 			direction:      cASC,
 		}
 		itemlist   []*Item
-		archiveMap = make(map[int]*archType, 0)
+		archiveMap = make(map[string]*archType, 0)
 		reterr     error
-
-		// by default, archive every item not in current year
-		currentYear, _, _ = time.Now().Date()
+		policy     = f.archivePolicy()
 	)
 
 	if err := f.LoadDBFeed(options); err != nil {
@@ -66,70 +186,91 @@ func archive(f *Feed) error {
 		itemlist = il
 	}
 
-	for _, item := range itemlist {
-		// skip if already arhived
-		if item.Archived {
-			continue
-		}
+	log.Debugf("archive policy: %+v", policy)
+	// listened is only ever set thru the serve api; without it, nothing is archived
+	if strings.EqualFold(policy.Only, podconfig.ArchiveOnlyListened) &&
+		slices.ContainsFunc(itemlist, func(item *Item) bool { return item.Listened }) == false {
+		log.Warn("archive policy only archives listened episodes, but no episode in the feed is marked listened " +
+			"(episodes are marked listened thru the serve api, /api/v1)")
+	}
 
-		var itemYear, _, _ = item.PubTimeStamp.Date()
-		if itemYear < currentYear {
-			// mark for archive
-			arc, exists := archiveMap[itemYear]
-			if exists == false {
-				arc = &archType{
-					feed:   f,
-					log:    f.log.With("year", itemYear),
-					year:   itemYear,
-					path:   filepath.Join(f.archivePath, fmt.Sprintf("%s.%d", f.Shortname, itemYear)),
-					items:  make([]*Item, 0),
-					images: make(map[string]*ImageDBEntry, 0),
-				}
-				archiveMap[itemYear] = arc
+	for _, item := range selectArchiveItems(itemlist, policy, time.Now()) {
+		// mark for archive; grouped by directory, as the path template may put more than one period
+		// in the same directory
+		var dir = archiveDirName(policy, f.Shortname, item.PubTimeStamp)
+		arc, exists := archiveMap[dir]
+		if exists == false {
+			arc = &archType{
+				feed:   f,
+				log:    f.log.With("dir", dir),
+				dir:    dir,
+				path:   filepath.Join(f.archivePath, dir),
+				items:  make([]*Item, 0),
+				images: make(map[string]*ImageDBEntry, 0),
 			}
-			arc.items = append(arc.items, item)
-			if item.ImageKey != "" && item.ImageKey != f.ImageKey { // don't back up feed's image
-				if img, exists := f.imageMap[item.ImageKey]; exists == false {
-					arc.log.Error("image with key doesn't exist in db", "key", item.ImageKey)
-					// skip any image processing
-				} else {
-					arc.images[item.ImageKey] = img
-				}
+			archiveMap[dir] = arc
+		}
+		arc.items = append(arc.items, item)
+		if item.ImageKey != "" && item.ImageKey != f.ImageKey { // don't back up feed's image
+			if img, exists := f.imageMap[item.ImageKey]; exists == false {
+				arc.log.Error("image with key doesn't exist in db", "key", item.ImageKey)
+				// skip any image processing
+			} else {
+				arc.images[item.ImageKey] = img
 			}
 		}
 	}
 
 	if len(archiveMap) <= 0 {
 		f.log.Info("nothing found to archive")
-		return nil
 	}
 
 	for _, arc := range archiveMap {
 		log.Debug("archive step", "path", arc.path, "items", len(arc.items), "images", len(arc.images))
-		if err := arc.archiveYear(); err != nil {
+		// a new directory (and db) next to the bundle would hide what's in it
+		if bundled, err := arc.bundledOnly(); err != nil {
+			reterr = errors.Join(reterr, err)
+		} else if bundled != "" {
+			err := fmt.Errorf("archive '%v' only exists as bundle '%v'; extract it before archiving into it", arc.dir, filepath.Base(bundled))
+			arc.log.Error(err)
+			reterr = errors.Join(reterr, err)
+		} else if err := arc.archiveDir(); err != nil {
 			arc.log.Error(err)
 			reterr = errors.Join(reterr, err)
 		} else {
-			// saving archive status in base database
-			arc.log.Debug("saving items")
-			if err := f.saveDBFeedItems(arc.items...); err != nil {
-				arc.log.Error("error saving items: %w", err)
-				reterr = errors.Join(reterr, err)
-			}
-			if len(arc.images) > 0 {
-				arc.log.Debug("saving images")
-				if err := f.saveDBFeedImages(arc.images); err != nil {
-					arc.log.Error(err)
-					reterr = errors.Join(reterr, err)
+			// saving archive status in base database; items and images together
+			err := db.WithTx(func(tx *PodDB) error {
+				arc.log.Debug("saving items")
+				if err := f.saveDBFeedItems(tx, arc.items...); err != nil {
+					return fmt.Errorf("error saving items: %w", err)
+				}
+				if len(arc.images) > 0 {
+					arc.log.Debug("saving images")
+					if err := f.saveDBFeedImages(tx, arc.images); err != nil {
+						return fmt.Errorf("error saving images: %w", err)
+					}
 				}
+				return nil
+			})
+			if err != nil {
+				arc.log.Error(err)
+				reterr = errors.Join(reterr, err)
+			} else if config.Simulate == false && config.RebuildArchiveDb == false {
+				arc.checkArchiveDb(itemlist)
 			}
 		}
 	}
 
+	if config.RebuildArchiveDb {
+		if err := f.rebuildArchiveDbs(itemlist); err != nil {
+			reterr = errors.Join(reterr, err)
+		}
+	}
+
 	return reterr
 }
 
-func (arc archType) archiveYear() error {
+func (arc archType) archiveDir() error {
 
 	var (
 		reterr  error
@@ -202,6 +343,8 @@ func (arc archType) archiveItem(item *Item) error {
 	} else {
 		// item is archived; mark it as such
 		item.Archived = true
+		item.ArchiveDir = arc.dir
+		item.ArchiveRun = config.TimestampStr
 		return nil
 	}
 }
@@ -244,15 +387,14 @@ func (arc archType) archiveImage(img *ImageDBEntry) error {
 }
 
 // --------------------------------------------------------------------------
-func (arc archType) createArchiveDb() error {
-	// save archive db with feed, archived items, archived images
+func (arc archType) dbPath() string {
+	return filepath.Join(arc.path, ".db", fmt.Sprintf("%s.db", arc.feed.Shortname))
+}
 
-	var (
-		log    = arc.log
-		dbfile = filepath.Join(arc.path, ".db", fmt.Sprintf("%s.db", arc.feed.Shortname))
-		// create a separate copy of the feed
-		arcFeed = *arc.feed
-	)
+// --------------------------------------------------------------------------
+// merges the archived items and images into the archive db; items archived in earlier runs are kept
+func (arc archType) createArchiveDb() error {
+	var log = arc.log
 
 	if config.Simulate {
 		log.Info("not saving db due to simulate flag")
@@ -261,20 +403,187 @@ func (arc archType) createArchiveDb() error {
 		log.Info("saving archive db")
 	}
 
-	if dbarc, err := NewDB(dbfile); err != nil {
+	return arc.mergeArchiveDb(arc.dbPath())
+}
+
+// --------------------------------------------------------------------------
+func (arc archType) mergeArchiveDb(dbfile string) error {
+	var (
+		log = arc.log
+		// create a separate copy of the feed
+		arcFeed = *arc.feed
+	)
+
+	dbarc, err := NewDB(dbfile)
+	if err != nil {
 		log.Error(err)
 		return err
-	} else if entrylist, err := arc.feed.genItemDBEntryList(arc.items); err != nil { // set the new feed items
+	}
+	// closing checkpoints the wal, leaving a single db file in the archive
+	defer dbarc.Close()
+
+	if entrylist, err := arc.feed.genItemDBEntryList(arc.items); err != nil { // set the new feed items
 		log.Error(err)
 		return err
 	} else {
 		arcFeed.ItemList = entrylist
 		arcFeed.imageMap = arc.images
-		if err := dbarc.saveFeed(&arcFeed.FeedDBEntry); err != nil {
+		if counts, err := dbarc.mergeArchiveFeed(&arcFeed.FeedDBEntry); err != nil {
 			log.Errorf("error saving feed db: %v", err)
 			return err
+		} else {
+			log.Infof("archive db merged; added: %v, updated: %v, replaced: %v, total: %v",
+				counts.Added, counts.Updated, counts.Replaced, counts.Total)
 		}
 	}
 
 	return nil
 }
+
+// --------------------------------------------------------------------------
+// compares the archive db against the items the main db has archived in the directory; hashes missing
+// from the archive db, and those in it no longer archived there
+func (arc archType) archiveDbDiff(itemlist []*Item) ([]string, []string, error) {
+	var expected = make(map[string]bool)
+	for _, item := range itemlist {
+		if item.Archived && arc.feed.itemArchivePath(item.ArchiveDir, item.PubTimeStamp) == arc.path {
+			expected[item.Hash] = true
+		}
+	}
+
+	dbarc, err := NewDB(arc.dbPath())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dbarc.Close()
+
+	hashes, err := dbarc.loadArchivedHashes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		missing, extra = make([]string, 0), make([]string, 0)
+		found          = make(map[string]bool, len(hashes))
+	)
+	for _, hash := range hashes {
+		found[hash] = true
+		if expected[hash] == false {
+			extra = append(extra, hash)
+		}
+	}
+	for hash := range expected {
+		if found[hash] == false {
+			missing = append(missing, hash)
+		}
+	}
+	slices.Sort(missing)
+	return missing, extra, nil
+}
+
+// --------------------------------------------------------------------------
+// warns when the archive db doesn't match the main db
+func (arc archType) checkArchiveDb(itemlist []*Item) {
+	if missing, extra, err := arc.archiveDbDiff(itemlist); err != nil {
+		arc.log.Error("error checking archive db", "err", err)
+	} else if len(missing) > 0 || len(extra) > 0 {
+		arc.log.Warnf("archive db incomplete; %v items missing, %v not archived here (use archive --rebuild-db)",
+			len(missing), len(extra))
+		arc.log.Debug("archive db differences", "missing", missing, "extra", extra)
+	}
+}
+
+// --------------------------------------------------------------------------
+// recreates each archive directory's db from the items the main db has archived there; the previous
+// db is kept alongside as a backup
+func (f *Feed) rebuildArchiveDbs(itemlist []*Item) error {
+	var (
+		log        = f.log
+		archiveMap = make(map[string]*archType, 0)
+		reterr     error
+	)
+
+	for _, item := range itemlist {
+		if item.Archived == false {
+			continue
+		}
+		var path = f.itemArchivePath(item.ArchiveDir, item.PubTimeStamp)
+		arc, exists := archiveMap[path]
+		if exists == false {
+			var dir = filepath.Base(path)
+			arc = &archType{
+				feed:   f,
+				log:    f.log.With("dir", dir),
+				dir:    dir,
+				path:   path,
+				items:  make([]*Item, 0),
+				images: make(map[string]*ImageDBEntry, 0),
+			}
+			archiveMap[path] = arc
+		}
+		arc.items = append(arc.items, item)
+		if item.ImageKey != "" && item.ImageKey != f.ImageKey {
+			if img, exists := f.imageMap[item.ImageKey]; exists {
+				arc.images[item.ImageKey] = img
+			}
+		}
+	}
+
+	if len(archiveMap) == 0 {
+		log.Info("no archived items; nothing to rebuild")
+		return nil
+	}
+
+	for _, arc := range archiveMap {
+		if err := arc.rebuildArchiveDb(); err != nil {
+			arc.log.Error(err)
+			reterr = errors.Join(reterr, err)
+		}
+	}
+	return reterr
+}
+
+// --------------------------------------------------------------------------
+func (arc archType) rebuildArchiveDb() error {
+	var (
+		log     = arc.log
+		dbfile  = arc.dbPath()
+		tmpfile = dbfile + ".rebuild"
+	)
+
+	if exists, err := podutils.FileExists(arc.path); err != nil {
+		return err
+	} else if exists == false {
+		log.Warn("archive directory not found; not rebuilding db")
+		return nil
+	} else if config.Simulate {
+		log.Infof("not rebuilding archive db due to simulate flag; %v items", len(arc.items))
+		return nil
+	}
+
+	log.Infof("rebuilding archive db; %v items", len(arc.items))
+	if err := podutils.MkdirAll(filepath.Dir(dbfile)); err != nil {
+		return err
+	}
+	for _, file := range []string{tmpfile, tmpfile + "-wal", tmpfile + "-shm"} {
+		if err := os.Remove(file); err != nil && errors.Is(err, fs.ErrNotExist) == false {
+			return err
+		}
+	}
+
+	if err := arc.mergeArchiveDb(tmpfile); err != nil {
+		os.Remove(tmpfile)
+		return fmt.Errorf("error rebuilding archive db: %w", err)
+	}
+
+	if exists, err := podutils.FileExists(dbfile); err != nil {
+		return err
+	} else if exists {
+		var backup = backupFilename(dbfile, config.TimestampStr)
+		if err := podutils.Rename(dbfile, backup); err != nil {
+			return fmt.Errorf("error backing up archive db: %w", err)
+		}
+		log.Info("previous archive db backed up", "backup", filepath.Base(backup))
+	}
+	return podutils.Rename(tmpfile, dbfile)
+}
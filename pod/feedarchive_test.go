@@ -0,0 +1,207 @@
+package pod
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopod/podconfig"
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+func Test_archivePeriodStart(t *testing.T) {
+
+	var date = func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 12, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name string
+		by   string
+		t    time.Time
+		exp  time.Time
+	}{
+		{"year", podconfig.ArchiveByYear, date(2023, time.June, 15), date(2023, time.January, 1).Truncate(24 * time.Hour)},
+		{"month", podconfig.ArchiveByMonth, date(2023, time.June, 15), date(2023, time.June, 1).Truncate(24 * time.Hour)},
+		{"spring", podconfig.ArchiveBySeason, date(2023, time.May, 31), date(2023, time.March, 1).Truncate(24 * time.Hour)},
+		{"fall", podconfig.ArchiveBySeason, date(2023, time.September, 1), date(2023, time.September, 1).Truncate(24 * time.Hour)},
+		{"winter december", podconfig.ArchiveBySeason, date(2022, time.December, 20), date(2022, time.December, 1).Truncate(24 * time.Hour)},
+		{"winter february", podconfig.ArchiveBySeason, date(2023, time.February, 2), date(2022, time.December, 1).Truncate(24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.AssertEquals(t, tt.exp, archivePeriodStart(tt.by, tt.t))
+		})
+	}
+}
+
+func Test_archiveDirName(t *testing.T) {
+
+	var pubdate = time.Date(2022, time.December, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		policy podconfig.ArchivePolicy
+		exp    string
+	}{
+		{"default", podconfig.ArchivePolicy{}, "foo.2022"},
+		{"month", podconfig.ArchivePolicy{By: podconfig.ArchiveByMonth}, "foo.2022-12"},
+		{"season", podconfig.ArchivePolicy{By: podconfig.ArchiveBySeason}, "foo.2023-winter"},
+		{"days", podconfig.ArchivePolicy{By: podconfig.ArchiveByDays, Age: 30}, "foo.2022"},
+		{"template", podconfig.ArchivePolicy{Path: "old-{shortname}"}, "old-foo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.AssertEquals(t, tt.exp, archiveDirName(tt.policy, "foo", pubdate))
+		})
+	}
+}
+
+func Test_selectArchiveItems(t *testing.T) {
+
+	var (
+		now  = time.Date(2023, time.April, 15, 0, 0, 0, 0, time.UTC)
+		item = func(name string, pubdate time.Time, dl, listened, archived bool) *Item {
+			var i = &Item{}
+			i.Filename = name
+			i.PubTimeStamp = pubdate
+			i.Downloaded, i.Listened, i.Archived = dl, listened, archived
+			return i
+		}
+		itemlist = []*Item{
+			item("a", time.Date(2021, time.July, 1, 0, 0, 0, 0, time.UTC), true, true, true),
+			item("b", time.Date(2022, time.November, 1, 0, 0, 0, 0, time.UTC), true, true, false),
+			item("c", time.Date(2022, time.December, 10, 0, 0, 0, 0, time.UTC), false, false, false),
+			item("d", time.Date(2023, time.January, 10, 0, 0, 0, 0, time.UTC), true, false, false),
+			item("e", time.Date(2023, time.March, 20, 0, 0, 0, 0, time.UTC), true, true, false),
+			item("f", time.Date(2023, time.April, 10, 0, 0, 0, 0, time.UTC), true, false, false),
+		}
+	)
+
+	tests := []struct {
+		name   string
+		policy podconfig.ArchivePolicy
+		exp    []string
+	}{
+		{"year (default)", podconfig.ArchivePolicy{}, []string{"b", "c"}},
+		{"month", podconfig.ArchivePolicy{By: podconfig.ArchiveByMonth}, []string{"b", "c", "d", "e"}},
+		{"season", podconfig.ArchivePolicy{By: podconfig.ArchiveBySeason}, []string{"b", "c", "d"}},
+		{"days", podconfig.ArchivePolicy{By: podconfig.ArchiveByDays, Age: 30}, []string{"b", "c", "d"}},
+		// archived items count towards the most recent
+		{"episodes", podconfig.ArchivePolicy{By: podconfig.ArchiveByEpisodes, Age: 3}, []string{"b", "c"}},
+		{"episodes more than list", podconfig.ArchivePolicy{By: podconfig.ArchiveByEpisodes, Age: 10}, []string{}},
+		{"only downloaded", podconfig.ArchivePolicy{By: podconfig.ArchiveByMonth, Only: "downloaded"}, []string{"b", "d", "e"}},
+		{"only listened", podconfig.ArchivePolicy{By: podconfig.ArchiveByMonth, Only: "Listened"}, []string{"b", "e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names = make([]string, 0)
+			for _, i := range selectArchiveItems(itemlist, tt.policy, now) {
+				names = append(names, i.Filename)
+			}
+			testutils.AssertEquals(t, tt.exp, names)
+		})
+	}
+}
+
+func TestArchive_mergeRebuild(t *testing.T) {
+
+	var (
+		dir       = t.TempDir()
+		oldConfig = config
+		oldDB     = db
+	)
+	defer func() {
+		db.Close()
+		config, db = oldConfig, oldDB
+	}()
+
+	config = &podconfig.Config{WorkspaceDir: dir, TimestampStr: "run1"}
+	if pdb, err := NewDB(DBPath(dir)); err != nil {
+		t.Fatalf("error creating db: %v", err)
+	} else {
+		db = pdb
+	}
+
+	// feed as loaded by a command
+	var loadFeed = func() *Feed {
+		f, err := NewFeed(podconfig.FeedToml{Name: "foo cast", Shortname: "foo", Url: "https://foo.bar/foo"})
+		if err != nil {
+			t.Fatalf("error creating feed: %v", err)
+		} else if err := f.LoadDBFeed(loadOptions{}); err != nil {
+			t.Fatalf("error loading feed: %v", err)
+		}
+		return f
+	}
+	var f = loadFeed()
+	f.XmlFeedData = &FeedXmlDBEntry{}
+	testutils.AssertErr(t, false, db.saveFeed(&f.FeedDBEntry))
+
+	var (
+		arc2020 = f.archiveYearPath(2020)
+		dbfile  = filepath.Join(arc2020, ".db", "foo.db")
+		addItem = func(name string) {
+			var item = generateItem(f.ID, true)
+			item.Filename, item.PubTimeStamp, item.Downloaded = name, time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), true
+			testutils.AssertErr(t, false, os.MkdirAll(f.mp3Path, 0755))
+			testutils.AssertErr(t, false, os.WriteFile(filepath.Join(f.mp3Path, name), []byte("0123456789"), 0644))
+			testutils.AssertErr(t, false, db.saveItems(&item))
+		}
+		// filename to archive run, from the archive db
+		archiveRuns = func() map[string]string {
+			pdb, err := NewDB(dbfile)
+			testutils.AssertErr(t, false, err)
+			defer pdb.Close()
+			var (
+				ret     = make(map[string]string)
+				entries = make([]*ItemDBEntry, 0)
+			)
+			testutils.AssertErr(t, false, pdb.db.Find(&entries).Error)
+			for _, e := range entries {
+				ret[e.Filename] = e.ArchiveRun
+			}
+			return ret
+		}
+		diff = func() ([]string, []string) {
+			var f = loadFeed()
+			items, err := f.loadDBFeedItems(AllItems, loadOptions{})
+			testutils.AssertErr(t, false, err)
+			var arc = archType{feed: f, log: f.log, dir: filepath.Base(arc2020), path: arc2020}
+			missing, extra, err := arc.archiveDbDiff(items)
+			testutils.AssertErr(t, false, err)
+			return missing, extra
+		}
+		none = make([]string, 0)
+	)
+
+	// archived across two runs; merged into the same db
+	addItem("ep1.mp3")
+	testutils.AssertErr(t, false, Archive(loadFeed()))
+	addItem("ep2.mp3")
+	config.TimestampStr = "run2"
+	testutils.AssertErr(t, false, Archive(loadFeed()))
+	testutils.AssertEquals(t, map[string]string{"ep1.mp3": "run1", "ep2.mp3": "run2"}, archiveRuns())
+
+	missing, extra := diff()
+	testutils.AssertEquals(t, none, missing)
+	testutils.AssertEquals(t, none, extra)
+
+	// lost archive db; missing items found, then rebuilt with their runs
+	testutils.AssertErr(t, false, os.Remove(dbfile))
+	missing, _ = diff()
+	testutils.AssertEquals(t, 2, len(missing))
+
+	config.TimestampStr, config.RebuildArchiveDb = "run3", true
+	testutils.AssertErr(t, false, Archive(loadFeed()))
+	testutils.AssertEquals(t, map[string]string{"ep1.mp3": "run1", "ep2.mp3": "run2"}, archiveRuns())
+	missing, extra = diff()
+	testutils.AssertEquals(t, none, missing)
+	testutils.AssertEquals(t, none, extra)
+
+	// rebuilding again keeps the previous db
+	config.TimestampStr = "run4"
+	testutils.AssertErr(t, false, Archive(loadFeed()))
+	exists, err := podutils.FileExists(backupFilename(dbfile, "run4"))
+	testutils.AssertErr(t, false, err)
+	testutils.Assert(t, exists, "previous archive db not kept")
+}
@@ -0,0 +1,318 @@
+package pod
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"gopod/podutils"
+)
+
+// kinds of change found between fetches of the feed xml
+const (
+	changeChannel   = "channel"   // channel metadata field changed
+	changeItem      = "item"      // item title or enclosure changed
+	changeRemoved   = "removed"   // item no longer in the feed
+	changeReturned  = "returned"  // item previously removed is back in the feed
+	changeReordered = "reordered" // items still in the feed are in a different order
+)
+
+type FeedChange struct {
+	Kind     string
+	Field    string // changed field, for channel and item changes
+	ItemHash string
+	Title    string // item title, for item changes
+	Old      string
+	New      string
+}
+
+// change log; each change found when the feed xml was fetched, grouped by fetch time
+type FeedChangeDBEntry struct {
+	PodDBModel
+	FeedId     uint `gorm:"index"`
+	FetchedAt  time.Time
+	FeedChange `gorm:"embedded"`
+}
+
+// an item as last seen in the feed xml; kept with the feed xml for comparing against the next fetch
+type feedItemSnapshot struct {
+	Hash   string
+	Guid   string
+	Title  string
+	Url    string
+	Length uint
+	// after the point the update stopped parsing; only hash and guid are known
+	Partial bool `json:",omitempty"`
+}
+
+// --------------------------------------------------------------------------
+func (c FeedChange) String() string {
+	var title = podutils.Tern(c.Title != "", c.Title, c.ItemHash)
+	switch c.Kind {
+	case changeChannel:
+		return fmt.Sprintf("channel %v: '%v' -> '%v'", c.Field,
+			truncateValue(c.Old, historyValueWidth), truncateValue(c.New, historyValueWidth))
+	case changeItem:
+		return fmt.Sprintf("item '%v' %v: '%v' -> '%v'", title, c.Field,
+			truncateValue(c.Old, historyValueWidth), truncateValue(c.New, historyValueWidth))
+	case changeReordered:
+		return fmt.Sprintf("reordered: %v", c.New)
+	default:
+		return fmt.Sprintf("%v: '%v'", c.Kind, title)
+	}
+}
+
+// --------------------------------------------------------------------------
+// key matching an item between fetches; guid, as the hash changes with the url
+func (s feedItemSnapshot) key() string {
+	return podutils.Tern(s.Guid != "", s.Guid, s.Hash)
+}
+
+// --------------------------------------------------------------------------
+// changes between the previous fetch of the feed and this one; prev nil for a new feed, in which
+// case there is nothing to compare against
+func diffFeed(prev *FeedXmlDBEntry, cur *podutils.XChannelData, seen []feedItemSnapshot) []FeedChange {
+	var changes = make([]FeedChange, 0)
+	if prev == nil || cur == nil {
+		return changes
+	}
+
+	for _, ch := range diffFields(channelXmlFields(&prev.XChannelData), channelXmlFields(cur)) {
+		changes = append(changes, FeedChange{Kind: changeChannel, Field: ch.Field, Old: ch.Old, New: ch.New})
+	}
+
+	// item list only compared once there is a previous list; feeds fetched before change tracking
+	// have none
+	if len(prev.ItemList) == 0 {
+		return changes
+	}
+
+	var (
+		prevMap = make(map[string]feedItemSnapshot, len(prev.ItemList))
+		curMap  = make(map[string]feedItemSnapshot, len(seen))
+	)
+	for _, s := range prev.ItemList {
+		prevMap[s.key()] = s
+	}
+	for _, s := range seen {
+		curMap[s.key()] = s
+	}
+
+	for _, s := range prev.ItemList {
+		if _, exists := curMap[s.key()]; exists == false {
+			changes = append(changes, FeedChange{Kind: changeRemoved, ItemHash: s.Hash, Title: s.Title})
+		}
+	}
+
+	for _, s := range seen {
+		p, exists := prevMap[s.key()]
+		if exists == false || p.Partial || s.Partial {
+			continue
+		}
+		for _, ch := range diffFields(snapshotFields(&p), snapshotFields(&s)) {
+			changes = append(changes, FeedChange{Kind: changeItem, Field: ch.Field, ItemHash: s.Hash, Title: s.Title,
+				Old: ch.Old, New: ch.New})
+		}
+	}
+
+	// order of the items in both lists; new and removed items don't count as reordering
+	var (
+		prevOrder = make([]string, 0, len(prev.ItemList))
+		curOrder  = make([]string, 0, len(seen))
+	)
+	for _, s := range prev.ItemList {
+		if _, exists := curMap[s.key()]; exists {
+			prevOrder = append(prevOrder, s.key())
+		}
+	}
+	for _, s := range seen {
+		if _, exists := prevMap[s.key()]; exists {
+			curOrder = append(curOrder, s.key())
+		}
+	}
+	if slices.Equal(prevOrder, curOrder) == false {
+		var moved int
+		for idx := range curOrder {
+			if idx < len(prevOrder) && curOrder[idx] != prevOrder[idx] {
+				moved++
+			}
+		}
+		changes = append(changes, FeedChange{Kind: changeReordered,
+			New: fmt.Sprintf("%v of %v items moved", moved, len(curOrder))})
+	}
+
+	return changes
+}
+
+// --------------------------------------------------------------------------
+// name/value of the channel fields tracked for changes, in a fixed order
+func channelXmlFields(x *podutils.XChannelData) [][2]string {
+	var persons string
+	if len(x.PersonList) > 0 {
+		if b, err := json.Marshal(x.PersonList); err == nil {
+			persons = string(b)
+		}
+	}
+	return [][2]string{
+		{"Title", x.Title},
+		{"Subtitle", x.Subtitle},
+		{"Link", x.Link},
+		{"NewFeedUrl", x.NewFeedUrl},
+		{"Author", x.Author},
+		{"OwnerName", x.ItunesOwner.Name},
+		{"OwnerEmail", x.ItunesOwner.Email},
+		{"ImageUrl", x.Image.Url},
+		{"ItunesImageUrl", x.ItunesImageUrl},
+		{"FundingUrl", x.PodcastFunding.Url},
+		{"FundingText", x.PodcastFunding.Text},
+		{"Persons", persons},
+	}
+}
+
+// --------------------------------------------------------------------------
+// name/value of the item fields tracked for changes; names match the item xml history fields
+func snapshotFields(s *feedItemSnapshot) [][2]string {
+	return [][2]string{
+		{"Title", s.Title},
+		{"EnclosureLength", strconv.FormatUint(uint64(s.Length), 10)},
+		{"EnclosureUrl", s.Url},
+	}
+}
+
+// --------------------------------------------------------------------------
+// fields whose values differ; both lists must have the same fields in the same order
+func diffFields(prev, cur [][2]string) []ItemChange {
+	var changes = make([]ItemChange, 0)
+	for idx := range cur {
+		if prev[idx][1] != cur[idx][1] {
+			changes = append(changes, ItemChange{Field: cur[idx][0], Old: prev[idx][1], New: cur[idx][1]})
+		}
+	}
+	return changes
+}
+
+// --------------------------------------------------------------------------
+// TrackItem implements podutils.FeedItemTracker; records every item in the new feed xml
+func (fup *feedUpdate) TrackItem(hash string, guid string, xmldata *podutils.XItemData) {
+	if xmldata == nil {
+		fup.seen = append(fup.seen, feedItemSnapshot{Hash: hash, Guid: guid, Partial: true})
+		return
+	}
+	fup.seen = append(fup.seen, feedItemSnapshot{
+		Hash:   hash,
+		Guid:   guid,
+		Title:  xmldata.Title,
+		Url:    xmldata.Enclosure.Url,
+		Length: xmldata.Enclosure.Length,
+	})
+}
+
+// --------------------------------------------------------------------------
+// fills in partial snapshots from the previous fetch, where the item was in it, so the item list
+// kept for the next fetch still has the item's fields
+func completeSnapshots(prev, seen []feedItemSnapshot) []feedItemSnapshot {
+	var prevMap = make(map[string]feedItemSnapshot, len(prev))
+	for _, s := range prev {
+		prevMap[s.key()] = s
+	}
+	for idx, s := range seen {
+		if p, exists := prevMap[s.key()]; s.Partial && exists {
+			p.Hash = s.Hash
+			seen[idx] = p
+		}
+	}
+	return seen
+}
+
+// --------------------------------------------------------------------------
+// compares the new feed xml against the previous fetch, recording changes, and flags items no longer
+// in the feed as removed upstream (clearing the flag on items back in the feed).  Called after new
+// items are processed, before the new xml replaces the previous
+func (fup *feedUpdate) trackChanges() {
+	var (
+		f    = fup.feed
+		prev = f.XmlFeedData
+	)
+
+	if prev != nil {
+		fup.seen = completeSnapshots(prev.ItemList, fup.seen)
+	}
+	fup.changes = diffFeed(prev, fup.newXmlData, fup.seen)
+
+	if len(fup.seen) == 0 {
+		// an empty feed is more likely broken than every item removed; leave flags as they are
+		f.log.Warn("no items found in feed; not checking for items removed upstream")
+	} else {
+		var inFeed = make(map[string]feedItemSnapshot, len(fup.seen))
+		for _, s := range fup.seen {
+			inFeed[s.Hash] = s
+		}
+
+		// collision lists can have more than one key for the same item; ordered by id so changes are
+		// recorded consistently
+		var itemlist = make([]*Item, 0, len(fup.hashCollList))
+		for _, item := range fup.hashCollList {
+			if item.ID != 0 && slices.Contains(itemlist, item) == false {
+				itemlist = append(itemlist, item)
+			}
+		}
+		slices.SortFunc(itemlist, func(a, b *Item) int { return cmp.Compare(a.ID, b.ID) })
+
+		for _, item := range itemlist {
+			var s, found = inFeed[item.Hash]
+			if found != item.RemovedUpstream {
+				continue
+			} else if found && prev != nil && len(prev.ItemList) > 0 {
+				fup.changes = append(fup.changes, FeedChange{Kind: changeReturned, ItemHash: item.Hash, Title: s.Title})
+			}
+			var removed = found == false
+			f.log.Infof("item '%v' %v upstream", item.Filename, podutils.Tern(removed, "removed", "returned"))
+			item.RemovedUpstream = removed
+			fup.addModified(item)
+		}
+	}
+
+	// item list is saved with the new xml, keeping the previous list for an empty feed; a new feed
+	// gets its xml entry on save
+	if f.XmlFeedData == nil && f.XmlId == 0 {
+		f.XmlFeedData = &FeedXmlDBEntry{}
+	}
+	if f.XmlFeedData != nil && len(fup.seen) > 0 {
+		f.XmlFeedData.ItemList = fup.seen
+	}
+
+	for _, ch := range fup.changes {
+		f.log.Infof("feed changed: %v", ch)
+	}
+}
+
+// --------------------------------------------------------------------------
+// adds an existing item to be saved with new items, if not already being saved
+func (fup *feedUpdate) addModified(item *Item) {
+	if slices.Contains(fup.newItems, item) == false && slices.Contains(fup.modified, item) == false {
+		fup.modified = append(fup.modified, item)
+	}
+}
+
+// --------------------------------------------------------------------------
+// saves changes found in this update to the change log
+func (f *Feed) saveChanges(pdb *PodDB, changes []FeedChange) error {
+	if len(changes) == 0 {
+		return nil
+	} else if config.Simulate {
+		f.log.Debug("skipping saving feed changes due to sim flag")
+		return nil
+	}
+
+	var (
+		now     = time.Now()
+		entries = make([]*FeedChangeDBEntry, 0, len(changes))
+	)
+	for _, ch := range changes {
+		entries = append(entries, &FeedChangeDBEntry{FeedId: f.ID, FetchedAt: now, FeedChange: ch})
+	}
+	return pdb.saveFeedChanges(entries)
+}
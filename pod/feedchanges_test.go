@@ -0,0 +1,127 @@
+package pod
+
+import (
+	"testing"
+
+	log "gopod/multilogger"
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+func Test_diffFeed(t *testing.T) {
+
+	var (
+		channel = podutils.XChannelData{Title: "foo cast", Author: "foo"}
+		items   = []feedItemSnapshot{
+			{Hash: "h1", Guid: "g1", Title: "ep1", Url: "https://foo.bar/ep1.mp3", Length: 100},
+			{Hash: "h2", Guid: "g2", Title: "ep2", Url: "https://foo.bar/ep2.mp3", Length: 200},
+			{Hash: "h3", Guid: "g3", Title: "ep3", Url: "https://foo.bar/ep3.mp3", Length: 300},
+		}
+	)
+
+	type args struct {
+		nilPrev bool
+		noList  bool // previous fetch before change tracking
+		channel func(x *podutils.XChannelData)
+		seen    []feedItemSnapshot
+	}
+	type exp struct {
+		changes []FeedChange
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"new feed", args{nilPrev: true, seen: items}, exp{changes: []FeedChange{}}},
+		{"no changes", args{seen: items}, exp{changes: []FeedChange{}}},
+		{"channel changes", args{seen: items, channel: func(x *podutils.XChannelData) {
+			x.Title = "bar cast"
+			x.PodcastFunding.Url = "https://foo.bar/donate"
+		}}, exp{changes: []FeedChange{
+			{Kind: changeChannel, Field: "Title", Old: "foo cast", New: "bar cast"},
+			{Kind: changeChannel, Field: "FundingUrl", New: "https://foo.bar/donate"},
+		}}},
+		{"no previous item list", args{noList: true, seen: items[:1]}, exp{changes: []FeedChange{}}},
+		{"removed and added", args{seen: []feedItemSnapshot{{Hash: "h4", Guid: "g4"}, items[0], items[1]}},
+			exp{changes: []FeedChange{{Kind: changeRemoved, ItemHash: "h3", Title: "ep3"}}}},
+		{"item changed", args{seen: []feedItemSnapshot{items[0],
+			{Hash: "h2x", Guid: "g2", Title: "ep2 (ad free)", Url: "https://foo.bar/ep2b.mp3", Length: 200}, items[2]}},
+			exp{changes: []FeedChange{
+				{Kind: changeItem, Field: "Title", ItemHash: "h2x", Title: "ep2 (ad free)", Old: "ep2", New: "ep2 (ad free)"},
+				{Kind: changeItem, Field: "EnclosureUrl", ItemHash: "h2x", Title: "ep2 (ad free)",
+					Old: "https://foo.bar/ep2.mp3", New: "https://foo.bar/ep2b.mp3"},
+			}}},
+		{"partial not compared", args{seen: []feedItemSnapshot{items[0],
+			{Hash: "h2x", Guid: "g2", Partial: true}, items[2]}}, exp{changes: []FeedChange{}}},
+		{"reordered", args{seen: []feedItemSnapshot{items[2], items[1], items[0]}},
+			exp{changes: []FeedChange{{Kind: changeReordered, New: "2 of 3 items moved"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prev = &FeedXmlDBEntry{XChannelData: channel, ItemList: items}
+			if tt.p.noList {
+				prev.ItemList = nil
+			}
+			var cur = channel
+			if tt.p.channel != nil {
+				tt.p.channel(&cur)
+			}
+
+			got := diffFeed(podutils.Tern(tt.p.nilPrev, nil, prev), &cur, tt.p.seen)
+			testutils.AssertEquals(t, tt.e.changes, got)
+		})
+	}
+}
+
+func TestFeedUpdate_trackChanges(t *testing.T) {
+
+	var (
+		prevList = []feedItemSnapshot{{Hash: "a", Guid: "a", Title: "ep a"}, {Hash: "b", Guid: "b", Title: "ep b"}}
+		itemA    = &Item{ItemDBEntry: ItemDBEntry{PodDBModel: PodDBModel{ID: 1}, Hash: "a"}}
+		itemB    = &Item{ItemDBEntry: ItemDBEntry{PodDBModel: PodDBModel{ID: 2}, Hash: "b"}}
+		itemC    = &Item{ItemDBEntry: ItemDBEntry{PodDBModel: PodDBModel{ID: 3}, Hash: "c"}}
+		itemNew  = &Item{ItemDBEntry: ItemDBEntry{Hash: "d"}}
+	)
+	itemC.RemovedUpstream = true
+
+	var f = &Feed{}
+	f.log = log.With("feed", "foo")
+	f.XmlId = 1
+	f.XmlFeedData = &FeedXmlDBEntry{ItemList: prevList}
+
+	var fup = feedUpdate{
+		feed:       f,
+		newXmlData: &podutils.XChannelData{},
+		newItems:   []*Item{itemNew},
+		// c is keyed twice, as after a url change
+		hashCollList: map[string]*Item{"a": itemA, "b": itemB, "c": itemC, "c-old": itemC, "d": itemNew},
+	}
+	for _, hash := range []string{"d", "c"} {
+		fup.TrackItem(hash, hash, &podutils.XItemData{Guid: hash, Title: "ep " + hash})
+	}
+	// after the update stopped parsing; filled in from the previous list
+	fup.TrackItem("a", "a", nil)
+
+	fup.trackChanges()
+
+	testutils.AssertEquals(t, false, itemA.RemovedUpstream)
+	testutils.AssertEquals(t, true, itemB.RemovedUpstream)
+	testutils.AssertEquals(t, false, itemC.RemovedUpstream)
+	testutils.AssertEquals(t, false, itemNew.RemovedUpstream)
+	testutils.AssertEquals(t, []*Item{itemB, itemC}, fup.modified)
+	testutils.AssertEquals(t, []FeedChange{
+		{Kind: changeRemoved, ItemHash: "b", Title: "ep b"},
+		{Kind: changeReturned, ItemHash: "c", Title: "ep c"},
+	}, fup.changes)
+	testutils.AssertEquals(t, fup.seen, f.XmlFeedData.ItemList)
+	testutils.AssertEquals(t, prevList[0], f.XmlFeedData.ItemList[2])
+
+	// empty feed leaves flags and the previous item list alone
+	var seen = fup.seen
+	fup = feedUpdate{feed: f, newXmlData: &podutils.XChannelData{}, hashCollList: fup.hashCollList}
+	fup.trackChanges()
+	testutils.AssertEquals(t, true, itemB.RemovedUpstream)
+	testutils.AssertEquals(t, 0, len(fup.modified))
+	testutils.AssertEquals(t, seen, f.XmlFeedData.ItemList)
+}
@@ -4,32 +4,51 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"gopod/commandline"
 	"gopod/inputoption"
 	"gopod/podutils"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/go-test/deep"
 )
 
-type ActionTakenError struct{ actionTaken string }
-
-func (r ActionTakenError) Error() string        { return r.actionTaken }
-func (r ActionTakenError) Is(target error) bool { return target == ActionTakenError{} }
-
 type fileCheckStatus struct {
 	feed          *Feed
 	fileExistsMap map[string]bool
 
 	itemList []*Item
+	report   *FeedCheckReport
+}
+
+// checks in the order they run; all run, each on the results of the fixes before it.  Hashes are
+// settled before anything is matched by them, items removed on collision aren't seen by later
+// checks, orphans are adopted and corrupted downloads reset before missing files are set archived,
+// and files are renamed last
+var checkPipeline = []struct {
+	name string
+	run  func(*fileCheckStatus) error
+}{
+	{"hashes", (*fileCheckStatus).checkHashes},
+	{"guids", (*fileCheckStatus).checkGuids},
+	{"collisions", (*fileCheckStatus).checkCollisions},
+	{"orphans", (*fileCheckStatus).checkOrphans},
+	{"corrupted", (*fileCheckStatus).checkCorrupted},
+	{"archive", (*fileCheckStatus).checkArchiveStatus},
+	{"filenames", (*fileCheckStatus).checkGenFilename},
 }
 
 // --------------------------------------------------------------------------
-func (f *Feed) CheckDownloads() error {
+// runs every check on the feed, applying the fixes enabled on the commandline; a failed check is
+// recorded in the report, and the rest still run
+func (f *Feed) CheckDownloads() (*FeedCheckReport, error) {
 
 	var (
 		fcs = fileCheckStatus{
 			fileExistsMap: make(map[string]bool),
+			report:        &FeedCheckReport{Shortname: f.Shortname, Findings: make([]*CheckFinding, 0), Errors: make([]string, 0)},
 		}
 		err error
 	)
@@ -41,55 +60,41 @@ func (f *Feed) CheckDownloads() error {
 			// future: for now, this works.. eventually put this message in main based on error
 			f.log.Warn("Feed deleted; make sure to remove from config file")
 		}
-		return err
+		return nil, err
 	} else {
 		// load all items (will be sorted desc); we do want item xml
 		if fcs.itemList, err = f.loadDBFeedItems(AllItems, loadOptions{includeXml: true, direction: cASC}); err != nil {
 			f.log.Errorf("failed to load item entries: %v", err)
-			return err
+			return nil, err
 		}
 	}
 	f.log.Debug("Feed loaded from db for check download")
 
 	fcs.feed = f
 
-	if err := fcs.checkHashes(); err != nil {
-		f.log.Errorf("error in checking hashes: %v", err)
-		return err
-	}
-	if err := fcs.checkGuids(); err != nil {
-		f.log.Errorf("error in checking guids: %v", err)
-		return err
-	}
-	if err := fcs.checkCollisions(); err != nil {
-		if errors.Is(err, ActionTakenError{}) {
-			return nil
-		}
-		f.log.Errorf("error in checking collisions: %v", err)
-		return err
-	}
-	if err := fcs.checkArchiveStatus(); err != nil {
-		if errors.Is(err, ActionTakenError{}) {
-			return nil
+	for _, check := range checkPipeline {
+		if err := check.run(&fcs); err != nil {
+			f.log.Errorf("error in checking %v: %v", check.name, err)
+			fcs.report.Errors = append(fcs.report.Errors, fmt.Sprintf("%v: %v", check.name, err))
 		}
-		f.log.Errorf("error in checking archive: %v", err)
-		return err
-	}
-	if err := fcs.checkGenFilename(); err != nil {
-		if errors.Is(err, ActionTakenError{}) {
-			return nil
-		}
-		f.log.Errorf("error in checking filename generation: %v", err)
-		return err
 	}
+	fcs.report.total()
+	f.log.Infof("%v findings, %v fixed", len(fcs.report.Findings), fcs.report.Fixed)
 
-	return nil
+	if len(fcs.report.Errors) > 0 {
+		return fcs.report, fmt.Errorf("checks failed: %v", strings.Join(fcs.report.Errors, "; "))
+	}
+	return fcs.report, nil
 }
 
 // --------------------------------------------------------------------------
 func (fcs *fileCheckStatus) checkHashes() error {
 
-	var log = fcs.feed.log
+	var (
+		log        = fcs.feed.log
+		mismatched = make([]*rehashItem, 0)
+	)
+	// rehash is the only fix; mismatched hashes are otherwise treated as new episodes on update
 	for _, item := range fcs.itemList {
 		var verifyHash, err = calcHash(item.XmlData.Guid, item.XmlData.Enclosure.Url, fcs.feed.UrlParse)
 		if err != nil {
@@ -97,21 +102,25 @@ func (fcs *fileCheckStatus) checkHashes() error {
 			return err
 		}
 		if verifyHash != item.Hash {
-			log.Warnf("hash mismatch: calc:'%v', stored:'%v'", verifyHash, item.Hash)
+			var finding = fcs.addFinding("hashes", FindingHashMismatch, item.Filename,
+				fmt.Sprintf("calc:'%v', stored:'%v'%v", verifyHash, item.Hash, podutils.Tern(config.DoRehash, "", " (use --rehash)")))
+			mismatched = append(mismatched, &rehashItem{item: item, newHash: verifyHash, finding: finding})
 		}
 	}
+
+	if config.DoRehash {
+		return fcs.rehashItems(mismatched)
+	}
 	return nil
 }
 
 // --------------------------------------------------------------------------
 func (fcs *fileCheckStatus) checkGuids() error {
-	var (
-		log     = fcs.feed.log
-		guidmap = make(map[string]*Item, len(fcs.itemList))
-	)
+	var guidmap = make(map[string]*Item, len(fcs.itemList))
 	for _, item := range fcs.itemList {
 		if existItem, exists := guidmap[item.XmlData.Guid]; exists {
-			log.Warnf("guid collision found (%v); existing: %v, current: %v", item.XmlData.Guid, existItem.ID, item.ID)
+			fcs.addFinding("guids", FindingGuidCollision, item.Filename,
+				fmt.Sprintf("guid '%v' also used by '%v' (ids %v, %v)", item.XmlData.Guid, existItem.Filename, existItem.ID, item.ID))
 		} else {
 			guidmap[item.XmlData.Guid] = item
 		}
@@ -126,20 +135,44 @@ func (fcs *fileCheckStatus) checkCollisions() error {
 		filelist   = make(map[string]*Item, len(fcs.itemList))
 		log        = fcs.feed.log
 		deleteList = make([]*Item, 0)
+		renameList = make([]*Item, 0)
+		decisions  = make([]collisionDecision, 0)
+		usePolicy  = config.DoCollision && config.CollisionPolicy != commandline.CollisionPrompt
+		// collision findings, by the item removed or renamed to fix them
+		fixes = make(map[*Item]*CheckFinding)
 	)
 
 	for _, item := range fcs.itemList {
 		// check filename collision
 		if existItem, exists := filelist[item.Filename]; exists {
-			log.Warnf("filename collision found: '%v':'%v' ", item, existItem)
-
-			// display comparision on collision
-			for _, diff := range deep.Equal(item, existItem) {
-				fmt.Printf("\t%v\n", diff)
+			var finding = fcs.addFinding("collisions", FindingFilenameCollision, item.Filename,
+				fmt.Sprintf("ids %v, %v", existItem.ID, item.ID))
+
+			// display comparision when prompting
+			if config.DoCollision && usePolicy == false {
+				fmt.Printf("filename collision found: '%v':'%v'\n", item, existItem)
+				for _, diff := range deep.Equal(item, existItem) {
+					fmt.Printf("\t%v\n", diff)
+				}
 			}
 
 			// input choice
-			if config.DoCollision {
+			if usePolicy {
+				var dec = fcs.resolveCollision(existItem, item)
+				decisions = append(decisions, dec)
+				switch {
+				case dec.removed != nil:
+					deleteList = append(deleteList, dec.removed)
+					fixes[dec.removed] = finding
+					filelist[item.Filename] = dec.kept
+				case dec.renamed != nil:
+					renameList = append(renameList, dec.renamed)
+					fixes[dec.renamed] = finding
+					filelist[dec.kept.Filename] = dec.kept
+					filelist[dec.renamed.Filename] = dec.renamed
+				}
+
+			} else if config.DoCollision {
 
 				var (
 					inpExisting = inputoption.GenOption(fmt.Sprintf("%v", existItem.ID), '1', false)
@@ -154,9 +187,11 @@ func (fcs *fileCheckStatus) checkCollisions() error {
 					case inpExisting:
 						log.Debugf("deleting current item: '%v'", item.ID)
 						deleteList = append(deleteList, item)
+						fixes[item] = finding
 					case inpCurrent:
 						log.Debugf("deleting existing item: '%v'", existItem.ID)
 						deleteList = append(deleteList, existItem)
+						fixes[existItem] = finding
 					case inpSkip:
 						fallthrough
 					default:
@@ -194,19 +229,41 @@ func (fcs *fileCheckStatus) checkCollisions() error {
 		}
 	}
 
-	if config.DoCollision {
-		if len(deleteList) > 0 {
-			if err := fcs.feed.deleteFeedItems(deleteList); err != nil {
-				log.Error(err)
-			} else {
-				log.Debugf("successfully deleted items, len: %v", len(deleteList))
+	if config.DoCollision == false {
+		return nil
+	}
+
+	var errs []error
+	if len(deleteList) > 0 {
+		if err := fcs.feed.deleteFeedItems(deleteList); err != nil {
+			errs = append(errs, err)
+		} else {
+			log.Debugf("successfully deleted items, len: %v", len(deleteList))
+			for _, item := range deleteList {
+				fixes[item].Fixed = true
 			}
+			// deleted items aren't seen by the checks after
+			fcs.itemList = slices.DeleteFunc(fcs.itemList, func(item *Item) bool { return slices.Contains(deleteList, item) })
+		}
+	} else if len(renameList) == 0 {
+		log.Info("No collisions found, nothing to delete")
+	}
+	if len(renameList) > 0 {
+		if err := fcs.feed.saveDBFeed(db, nil, renameList); err != nil {
+			errs = append(errs, err)
 		} else {
-			log.Info("No collisions found, nothing to delete")
+			log.Debugf("successfully renamed items, len: %v", len(renameList))
+			for _, item := range renameList {
+				fixes[item].Fixed = true
+			}
 		}
-		return ActionTakenError{actionTaken: "filename collision handling"}
 	}
-	return nil
+	if len(decisions) > 0 {
+		if err := fcs.writeCollisionReport(decisions); err != nil {
+			log.Errorf("failed writing collision report: %v", err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // --------------------------------------------------------------------------
@@ -215,42 +272,40 @@ func (fcs *fileCheckStatus) checkArchiveStatus() error {
 	var (
 		log       = fcs.feed.log
 		dirtyList = make([]*Item, 0)
+		findings  = make([]*CheckFinding, 0)
 	)
 
 	for _, item := range fcs.itemList {
 
 		var fileExists = fcs.fileExists(item)
 
-		// don't need to do this for stuff already archived
-		if (config.DoArchive) && (item.Archived == false) && (fileExists == false) {
-			log.Infof("setting '%v' as archived", item.Filename)
-			item.Archived = true
-			dirtyList = append(dirtyList, item)
-		}
-
-		// logging mismatched file, in case mismatch still exists
-		if fileExists == item.Archived {
-			log.Warnf("%v, archive: %v, exists:%v", item.Filename, item.Archived, fileExists)
-		}
-
-		if item.Archived == false {
-			if item.Downloaded == false {
-				log.Warnf("File not downloaded: '%v'", item.Filename)
-			} else if fileExists == false {
-				log.Warnf("file downloaded, but not found: '%v'", item.Filename)
+		switch {
+		case item.Archived && fileExists:
+			fcs.addFinding("archive", FindingArchivedExists, item.Filename, "set archived, but file exists")
+		case item.Archived:
+			// nothing to do
+		case item.Downloaded == false:
+			fcs.addFinding("archive", FindingNotDownloaded, item.Filename, "not downloaded")
+		case fileExists == false:
+			var finding = fcs.addFinding("archive", FindingMissingFile, item.Filename,
+				"downloaded, but file not found"+podutils.Tern(config.DoArchive, "", " (use --archive)"))
+			if config.DoArchive {
+				log.Infof("setting '%v' as archived", item.Filename)
+				item.Archived = true
+				dirtyList = append(dirtyList, item)
+				findings = append(findings, finding)
 			}
 		}
 	}
 
-	if config.DoArchive {
-		if len(dirtyList) > 0 {
-			if err := fcs.feed.saveDBFeed(nil, dirtyList); err != nil {
-				return err
-			}
+	if len(dirtyList) > 0 {
+		if err := fcs.feed.saveDBFeed(db, nil, dirtyList); err != nil {
+			return err
+		}
+		for _, finding := range findings {
+			finding.Fixed = true
 		}
-		return ActionTakenError{actionTaken: "set archive"}
 	}
-
 	return nil
 }
 
@@ -260,6 +315,7 @@ func (fcs *fileCheckStatus) checkGenFilename() error {
 	var (
 		log       = fcs.feed.log
 		dirtyList = make([]*Item, 0)
+		findings  = make([]*CheckFinding, 0)
 	)
 	for _, item := range fcs.itemList {
 		if item.Archived == false {
@@ -274,6 +330,8 @@ func (fcs *fileCheckStatus) checkGenFilename() error {
 				continue
 			}
 			if genFilename != item.Filename {
+				var finding = fcs.addFinding("filenames", FindingFilenameMismatch, item.Filename,
+					fmt.Sprintf("generated filename '%v'%v", genFilename, podutils.Tern(config.DoRename, "", " (use --rename)")))
 				if config.DoRename {
 					if fcs.fileExists(item) == false {
 						log.Warnf("cannot rename file '%v'; file does not exist.. skipping rename", item.Filename)
@@ -285,24 +343,22 @@ func (fcs *fileCheckStatus) checkGenFilename() error {
 						// rename successful, commit the change
 						item.Filename = genFilename
 						dirtyList = append(dirtyList, item)
+						findings = append(findings, finding)
 					}
-
-				} else {
-					log.Warnf("filename mismatch; item.Filename: '%v', genFilename: '%v'", item.Filename, genFilename)
 				}
 			}
 		}
 	}
 
-	if config.DoRename {
-		if len(dirtyList) > 0 {
-			fcs.feed.saveDBFeed(nil, dirtyList)
+	if len(dirtyList) > 0 {
+		if err := fcs.feed.saveDBFeed(db, nil, dirtyList); err != nil {
+			return err
+		}
+		for _, finding := range findings {
+			finding.Fixed = true
 		}
-
-		return ActionTakenError{"generate filename rename"}
 	}
 	return nil
-
 }
 
 // --------------------------------------------------------------------------
@@ -0,0 +1,110 @@
+package pod
+
+import (
+	"io"
+	"slices"
+	"strconv"
+)
+
+// kind of problem found by checkdownloads
+type FindingKind string
+
+const (
+	FindingHashMismatch      FindingKind = "hash mismatch"
+	FindingGuidCollision     FindingKind = "guid collision"
+	FindingFilenameCollision FindingKind = "filename collision"
+	FindingOrphanFile        FindingKind = "orphan file"
+	FindingStaleTemp         FindingKind = "stale temp download"
+	FindingCorrupted         FindingKind = "corrupted download"
+	FindingMissingFile       FindingKind = "missing file"
+	FindingArchivedExists    FindingKind = "archived file exists"
+	FindingNotDownloaded     FindingKind = "not downloaded"
+	FindingFilenameMismatch  FindingKind = "filename mismatch"
+)
+
+// findings of checkdownloads across feeds
+type CheckReport struct {
+	Feeds []*FeedCheckReport
+}
+
+type FeedCheckReport struct {
+	Shortname string
+	Findings  []*CheckFinding
+	Totals    map[FindingKind]int
+	Fixed     int
+	Errors    []string // checks that failed; the rest still ran
+}
+
+type CheckFinding struct {
+	Check  string // check that found it
+	Kind   FindingKind
+	File   string
+	Detail string
+	Fixed  bool
+}
+
+// --------------------------------------------------------------------------
+// records a finding; fixed is set by the check once its fix is saved
+func (fcs *fileCheckStatus) addFinding(check string, kind FindingKind, file, detail string) *CheckFinding {
+	var finding = &CheckFinding{Check: check, Kind: kind, File: file, Detail: detail}
+	fcs.report.Findings = append(fcs.report.Findings, finding)
+	fcs.feed.log.With("file", file).Debugf("%v: %v", kind, detail)
+	return finding
+}
+
+// --------------------------------------------------------------------------
+// per kind totals, and fixed count
+func (r *FeedCheckReport) total() {
+	r.Totals, r.Fixed = make(map[FindingKind]int), 0
+	for _, finding := range r.Findings {
+		r.Totals[finding.Kind]++
+		if finding.Fixed {
+			r.Fixed++
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+// outputs the report, in the format from the commandline; findings, then per feed totals
+func WriteCheckReport(w io.Writer, rpt *CheckReport) error {
+
+	var (
+		findingRpt = report{
+			title:   "Findings",
+			headers: []string{"feed", "check", "finding", "file", "detail", "fixed"},
+		}
+		totalRpt = report{
+			title:   "Totals",
+			headers: []string{"feed", "finding", "count", "fixed"},
+		}
+	)
+
+	for _, fr := range rpt.Feeds {
+		var fixed = make(map[FindingKind]int)
+		for _, finding := range fr.Findings {
+			var row = []string{fr.Shortname, finding.Check, string(finding.Kind), finding.File, finding.Detail,
+				strconv.FormatBool(finding.Fixed)}
+			findingRpt.rows = append(findingRpt.rows, row)
+			findingRpt.records = append(findingRpt.records, row)
+			if finding.Fixed {
+				fixed[finding.Kind]++
+			}
+		}
+
+		var kinds = make([]FindingKind, 0, len(fr.Totals))
+		for kind := range fr.Totals {
+			kinds = append(kinds, kind)
+		}
+		slices.Sort(kinds)
+		for _, kind := range kinds {
+			totalRpt.rows = append(totalRpt.rows, []string{fr.Shortname, string(kind),
+				strconv.Itoa(fr.Totals[kind]), strconv.Itoa(fixed[kind])})
+		}
+		for _, err := range fr.Errors {
+			totalRpt.rows = append(totalRpt.rows, []string{fr.Shortname, "check failed: " + err, "-", "-"})
+		}
+		totalRpt.rows = append(totalRpt.rows, []string{fr.Shortname, "total",
+			strconv.Itoa(len(fr.Findings)), strconv.Itoa(fr.Fixed)})
+	}
+	return writeReports(w, config.OutputFormat, rpt, findingRpt, totalRpt)
+}
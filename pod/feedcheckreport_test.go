@@ -0,0 +1,111 @@
+package pod
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopod/commandline"
+	"gopod/podconfig"
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+func TestCheckDownloads_report(t *testing.T) {
+
+	var (
+		oldConfig = config
+		oldDB     = db
+	)
+	defer func() {
+		db.Close()
+		config, db = oldConfig, oldDB
+	}()
+
+	// ep1 is downloaded, but its file is missing; ep2's file doesn't match the generated filename;
+	// ep3 isn't downloaded, and its hash is stale
+	var setup = func(t *testing.T, archive, rename bool) *Feed {
+		config = &podconfig.Config{WorkspaceDir: t.TempDir(), TimestampStr: "test"}
+		config.DoArchive, config.DoRename = archive, rename
+		if db != nil && db != oldDB {
+			db.Close()
+		}
+		if pdb, err := NewDB(DBPath(config.WorkspaceDir)); err != nil {
+			t.Fatalf("error creating db: %v", err)
+		} else {
+			db = pdb
+		}
+
+		f, err := NewFeed(podconfig.FeedToml{Name: "foo cast", Shortname: "foo", Url: "https://foo.bar/foo"})
+		if err != nil {
+			t.Fatalf("error creating feed: %v", err)
+		}
+		testutils.AssertErr(t, false, f.LoadDBFeed(loadOptions{}))
+		f.XmlFeedData = &FeedXmlDBEntry{}
+		testutils.AssertErr(t, false, db.saveFeed(&f.FeedDBEntry))
+
+		var list = make([]*ItemDBEntry, 0)
+		for n := 1; n <= 3; n++ {
+			var item = generateItem(f.ID, true)
+			item.Url = fmt.Sprintf("https://foo.bar/ep%v.mp3", n)
+			item.Filename, item.Downloaded = podutils.Tern(n == 2, "old2.mp3", fmt.Sprintf("ep%v.mp3", n)), n != 3
+			item.XmlData.Enclosure.Url = item.Url
+			if item.Hash, err = calcHash(item.XmlData.Guid, item.Url, ""); err != nil {
+				t.Fatalf("error calculating hash: %v", err)
+			} else if n == 3 {
+				item.Hash = "stale3"
+			}
+			list = append(list, &item)
+		}
+		testutils.AssertErr(t, false, db.saveItems(list...))
+		testutils.AssertErr(t, false, os.WriteFile(filepath.Join(f.mp3Path, "old2.mp3"), []byte("ID3 episode two"), 0644))
+		return f
+	}
+
+	t.Run("check only", func(t *testing.T) {
+		var f = setup(t, false, false)
+		rpt, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+		testutils.AssertEquals(t, map[FindingKind]int{FindingHashMismatch: 1, FindingMissingFile: 1,
+			FindingNotDownloaded: 1, FindingFilenameMismatch: 1}, rpt.Totals)
+		testutils.AssertEquals(t, 0, rpt.Fixed)
+	})
+
+	// both fixes are applied in the one run
+	t.Run("archive and rename", func(t *testing.T) {
+		var f = setup(t, true, true)
+		rpt, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+		testutils.AssertEquals(t, 4, len(rpt.Findings))
+		testutils.AssertEquals(t, 2, rpt.Fixed)
+		testutils.AssertEquals(t, 0, len(rpt.Errors))
+
+		items, err := f.loadDBFeedItems(AllItems, loadOptions{direction: cASC})
+		testutils.AssertErr(t, false, err)
+		testutils.AssertEquals(t, true, items[0].Archived)
+		testutils.AssertEquals(t, "ep2.mp3", items[1].Filename)
+		_, err = os.Stat(filepath.Join(f.mp3Path, "ep2.mp3"))
+		testutils.AssertErr(t, false, err)
+
+		// json and csv output
+		var buf bytes.Buffer
+		config.OutputFormat = commandline.OutputJson
+		testutils.AssertErr(t, false, WriteCheckReport(&buf, &CheckReport{Feeds: []*FeedCheckReport{rpt}}))
+		var decoded CheckReport
+		testutils.AssertErr(t, false, json.Unmarshal(buf.Bytes(), &decoded))
+		testutils.AssertEquals(t, rpt.Totals, decoded.Feeds[0].Totals)
+
+		buf.Reset()
+		config.OutputFormat = commandline.OutputCsv
+		testutils.AssertErr(t, false, WriteCheckReport(&buf, &CheckReport{Feeds: []*FeedCheckReport{rpt}}))
+		records, err := csv.NewReader(&buf).ReadAll()
+		testutils.AssertErr(t, false, err)
+		testutils.AssertEquals(t, 5, len(records))
+		testutils.AssertEquals(t, []string{"foo", "archive", string(FindingMissingFile), "ep1.mp3",
+			"downloaded, but file not found", "true"}, records[2])
+	})
+}
@@ -0,0 +1,211 @@
+package pod
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopod/commandline"
+	"gopod/podutils"
+)
+
+var collisionReportHeaders = []string{"feed", "filename", "policy", "kept", "removed", "renamed", "reason"}
+
+// outcome of a filename collision resolved by policy; removed and renamed are both nil when the
+// policy couldn't decide (collision left as is)
+type collisionDecision struct {
+	filename string
+	kept     *Item
+	removed  *Item
+	renamed  *Item // with its new filename
+	reason   string
+}
+
+// --------------------------------------------------------------------------
+// resolves a filename collision using the configured policy.  Rename keeps the item owning the file
+// on disk under the filename, and gives the other a unique filename (with the same suffix used on
+// update); it's set as not downloaded, so it's downloaded on the next update
+func (fcs *fileCheckStatus) resolveCollision(existing, current *Item) collisionDecision {
+
+	var (
+		log      = fcs.feed.log.With("filename", current.Filename)
+		dec      = collisionDecision{filename: current.Filename}
+		diskSize = fcs.diskSize(current.Filename)
+	)
+
+	keep, other, reason := chooseCollisionKeeper(config.CollisionPolicy, existing, current, diskSize)
+	if keep == nil {
+		dec.reason = reason + "; skipped"
+		log.Warnf("collision not resolved (%v): %v", config.CollisionPolicy, dec.reason)
+		return dec
+	}
+	dec.kept, dec.reason = keep, reason
+
+	if config.CollisionPolicy != commandline.CollisionRename {
+		dec.removed = other
+		log.Infof("collision resolved (%v): keeping %v, removing %v; %v", config.CollisionPolicy, keep.ID, other.ID, reason)
+		return dec
+	}
+
+	// start from the filename without any previous suffix; it may now be free
+	var filename = other.Filename
+	if xta := other.FilenameXta; xta != "" {
+		ext := filepath.Ext(filename)
+		filename = strings.TrimSuffix(strings.TrimSuffix(filename, ext), xta) + ext
+	}
+	newFilename, extra, err := other.checkFilenameCollisions(filename, fcs.filenameTaken)
+	if err != nil {
+		dec.kept, dec.reason = nil, fmt.Sprintf("no unique filename: %v; skipped", err)
+		log.Warnf("collision not resolved (%v): %v", config.CollisionPolicy, dec.reason)
+		return dec
+	}
+	other.Filename, other.FilenameXta, other.Downloaded = newFilename, extra, false
+	dec.renamed = other
+	log.Infof("collision resolved (%v): keeping %v, %v renamed to '%v'; %v", config.CollisionPolicy, keep.ID, other.ID, newFilename, reason)
+	return dec
+}
+
+// --------------------------------------------------------------------------
+// picks the item to keep; keep is nil if the policy can't decide between them, or would remove the
+// item owning the file.  Disk size is the size of the (shared) file on disk, or -1 if it doesn't exist
+func chooseCollisionKeeper(policy commandline.CollisionPolicy, existing, current *Item, diskSize int64) (keep, other *Item, reason string) {
+
+	var pick = func(keepCurrent bool, reason string) (*Item, *Item, string) {
+		if keepCurrent {
+			return current, existing, reason
+		}
+		return existing, current, reason
+	}
+	// policies not deciding on the file itself; the item owning the file on disk can't be the one removed
+	var pickOwner = func(keepCurrent bool, reason string) (*Item, *Item, string) {
+		keep, other, reason := pick(keepCurrent, reason)
+		if ownsFile(other, diskSize) && ownsFile(keep, diskSize) == false {
+			return nil, nil, fmt.Sprintf("%v, but item %v owns the file on disk", reason, other.ID)
+		}
+		return keep, other, reason
+	}
+
+	switch policy {
+	case commandline.CollisionKeepNewest, commandline.CollisionKeepOldest:
+		if existing.PubTimeStamp.Equal(current.PubTimeStamp) {
+			return nil, nil, "same publish date"
+		}
+		var currentNewer = current.PubTimeStamp.After(existing.PubTimeStamp)
+		if policy == commandline.CollisionKeepNewest {
+			return pickOwner(currentNewer, "newer publish date")
+		}
+		return pickOwner(currentNewer == false, "older publish date")
+
+	case commandline.CollisionKeepLarger:
+		var existSize, curSize = collisionItemSize(existing, diskSize), collisionItemSize(current, diskSize)
+		if existSize == curSize {
+			return nil, nil, "same size"
+		}
+		return pickOwner(curSize > existSize, "larger")
+
+	case commandline.CollisionKeepDownloaded, commandline.CollisionRename:
+		if existing.Downloaded != current.Downloaded {
+			return pick(current.Downloaded, "downloaded")
+		}
+		var existMatch, curMatch = ownsFile(existing, diskSize), ownsFile(current, diskSize)
+		if existMatch != curMatch {
+			return pick(curMatch, "size matches file on disk")
+		}
+		if policy == commandline.CollisionRename {
+			// either can keep the filename; the first found does
+			return pick(false, "found first")
+		}
+		return nil, nil, podutils.Tern(existing.Downloaded, "both downloaded", "neither downloaded")
+	}
+
+	return nil, nil, fmt.Sprintf("policy not handled: %v", policy)
+}
+
+// --------------------------------------------------------------------------
+// enclosure length from the feed; the file on disk if the feed doesn't give one and the item's downloaded
+func collisionItemSize(item *Item, diskSize int64) int64 {
+	if item.XmlData != nil && item.XmlData.Enclosure.Length > 0 {
+		return int64(item.XmlData.Enclosure.Length)
+	} else if item.Downloaded && diskSize > 0 {
+		return diskSize
+	}
+	return 0
+}
+
+// --------------------------------------------------------------------------
+func ownsFile(item *Item, diskSize int64) bool {
+	return diskSize >= 0 && item.XmlData != nil && int64(item.XmlData.Enclosure.Length) == diskSize
+}
+
+// --------------------------------------------------------------------------
+// size of a file in the download directory, or -1 if it doesn't exist
+func (fcs *fileCheckStatus) diskSize(filename string) int64 {
+	if stat, err := os.Stat(filepath.Join(fcs.feed.mp3Path, filename)); err == nil {
+		return stat.Size()
+	}
+	return -1
+}
+
+// --------------------------------------------------------------------------
+// whether the filename is used by any item in the feed, or a file on disk
+func (fcs *fileCheckStatus) filenameTaken(filename string) bool {
+	for _, item := range fcs.itemList {
+		if item.Filename == filename {
+			return true
+		}
+	}
+	return fcs.diskSize(filename) >= 0
+}
+
+// --------------------------------------------------------------------------
+// appends decisions to the run's collision report, in <workspace>/.collision
+func (fcs *fileCheckStatus) writeCollisionReport(decisions []collisionDecision) error {
+
+	var collisionPath = filepath.Join(config.WorkspaceDir, ".collision")
+	if err := podutils.MkdirAll(collisionPath); err != nil {
+		return err
+	}
+
+	var (
+		file      = filepath.Join(collisionPath, fmt.Sprintf("collisions.%v.csv", config.TimestampStr))
+		exists, _ = podutils.FileExists(file)
+		id        = func(item *Item) string {
+			if item == nil {
+				return ""
+			}
+			return strconv.FormatUint(uint64(item.ID), 10)
+		}
+	)
+	out, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var cw = csv.NewWriter(out)
+	if exists == false {
+		if err := cw.Write(collisionReportHeaders); err != nil {
+			return err
+		}
+	}
+	for _, dec := range decisions {
+		var renamed string
+		if dec.renamed != nil {
+			renamed = fmt.Sprintf("%v:%v", dec.renamed.ID, dec.renamed.Filename)
+		}
+		if err := cw.Write([]string{fcs.feed.Shortname, dec.filename, config.CollisionPolicy.String(),
+			id(dec.kept), id(dec.removed), renamed, dec.reason}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	fcs.feed.log.Infof("collision decisions written to '%v'", file)
+	return nil
+}
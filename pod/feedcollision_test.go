@@ -0,0 +1,190 @@
+package pod
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopod/commandline"
+	"gopod/podconfig"
+	"gopod/testutils"
+)
+
+func TestChooseCollisionKeeper(t *testing.T) {
+
+	var newItem = func(id uint, year int, downloaded bool, length uint) *Item {
+		var item = Item{}
+		item.ID, item.PubTimeStamp, item.Downloaded = id, time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC), downloaded
+		item.XmlData = &ItemXmlDBEntry{}
+		item.XmlData.Enclosure.Length = length
+		return &item
+	}
+
+	type exp struct {
+		keep   uint // 0 if undecided
+		reason string
+	}
+	tests := []struct {
+		name     string
+		policy   commandline.CollisionPolicy
+		existing *Item
+		current  *Item
+		diskSize int64
+		e        exp
+	}{
+		{"newest", commandline.CollisionKeepNewest, newItem(1, 2020, false, 0), newItem(2, 2021, false, 0), -1, exp{2, "newer publish date"}},
+		{"newest, existing", commandline.CollisionKeepNewest, newItem(1, 2022, false, 0), newItem(2, 2021, false, 0), -1, exp{1, "newer publish date"}},
+		{"newest, same date", commandline.CollisionKeepNewest, newItem(1, 2020, false, 0), newItem(2, 2020, false, 0), -1, exp{0, "same publish date"}},
+		{"oldest", commandline.CollisionKeepOldest, newItem(1, 2020, false, 0), newItem(2, 2021, false, 0), -1, exp{1, "older publish date"}},
+		{"newest, removed owns file", commandline.CollisionKeepNewest, newItem(1, 2020, true, 10), newItem(2, 2021, false, 20), 10, exp{0, "newer publish date, but item 1 owns the file on disk"}},
+		{"oldest, removed owns file", commandline.CollisionKeepOldest, newItem(1, 2020, false, 20), newItem(2, 2021, true, 10), 10, exp{0, "older publish date, but item 2 owns the file on disk"}},
+		{"newest, kept owns file", commandline.CollisionKeepNewest, newItem(1, 2020, false, 10), newItem(2, 2021, true, 20), 20, exp{2, "newer publish date"}},
+		{"downloaded", commandline.CollisionKeepDownloaded, newItem(1, 2020, false, 0), newItem(2, 2021, true, 0), 10, exp{2, "downloaded"}},
+		{"downloaded, both; matches disk", commandline.CollisionKeepDownloaded, newItem(1, 2020, true, 10), newItem(2, 2021, true, 20), 10, exp{1, "size matches file on disk"}},
+		{"downloaded, neither", commandline.CollisionKeepDownloaded, newItem(1, 2020, false, 10), newItem(2, 2021, false, 10), -1, exp{0, "neither downloaded"}},
+		{"larger", commandline.CollisionKeepLarger, newItem(1, 2020, false, 10), newItem(2, 2021, false, 20), -1, exp{2, "larger"}},
+		{"larger, disk size", commandline.CollisionKeepLarger, newItem(1, 2020, true, 0), newItem(2, 2021, false, 20), 30, exp{1, "larger"}},
+		{"larger, removed owns file", commandline.CollisionKeepLarger, newItem(1, 2020, true, 10), newItem(2, 2021, false, 20), 10, exp{0, "larger, but item 1 owns the file on disk"}},
+		{"larger, same", commandline.CollisionKeepLarger, newItem(1, 2020, false, 10), newItem(2, 2021, false, 10), -1, exp{0, "same size"}},
+		{"rename, downloaded keeps", commandline.CollisionRename, newItem(1, 2020, false, 0), newItem(2, 2021, true, 0), 10, exp{2, "downloaded"}},
+		{"rename, first found keeps", commandline.CollisionRename, newItem(1, 2020, false, 0), newItem(2, 2021, false, 0), -1, exp{1, "found first"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, other, reason := chooseCollisionKeeper(tt.policy, tt.existing, tt.current, tt.diskSize)
+			testutils.AssertEquals(t, tt.e.reason, reason)
+			if tt.e.keep == 0 {
+				testutils.Assert(t, keep == nil && other == nil, "expected undecided")
+				return
+			}
+			testutils.AssertEquals(t, tt.e.keep, keep.ID)
+			testutils.Assert(t, other != nil && other.ID != keep.ID, "other should be the item not kept")
+		})
+	}
+}
+
+func TestCheckDownloads_collisionPolicy(t *testing.T) {
+
+	var (
+		oldConfig = config
+		oldDB     = db
+	)
+	defer func() {
+		db.Close()
+		config, db = oldConfig, oldDB
+	}()
+
+	var setup = func(t *testing.T, policy commandline.CollisionPolicy, newerLength uint) *Feed {
+		config = &podconfig.Config{WorkspaceDir: t.TempDir(), TimestampStr: "test"}
+		config.DoCollision, config.CollisionPolicy = true, policy
+		if db != nil && db != oldDB {
+			db.Close()
+		}
+		if pdb, err := NewDB(DBPath(config.WorkspaceDir)); err != nil {
+			t.Fatalf("error creating db: %v", err)
+		} else {
+			db = pdb
+		}
+
+		f, err := NewFeed(podconfig.FeedToml{Name: "foo cast", Shortname: "foo", Url: "https://foo.bar/foo"})
+		if err != nil {
+			t.Fatalf("error creating feed: %v", err)
+		}
+		testutils.AssertErr(t, false, f.LoadDBFeed(loadOptions{}))
+		f.XmlFeedData = &FeedXmlDBEntry{}
+		testutils.AssertErr(t, false, db.saveFeed(&f.FeedDBEntry))
+
+		// ep1 (downloaded) and ep2 collide on the same filename; the file on disk is ep1's size
+		var list = make([]*ItemDBEntry, 0)
+		for i, year := range []int{2020, 2021} {
+			var item = generateItem(f.ID, true)
+			item.Filename, item.Downloaded = "ep.mp3", i == 0
+			item.PubTimeStamp = time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+			item.XmlData.Enclosure.Url, item.XmlData.Enclosure.Length = fmt.Sprintf("https://foo.bar/ep%v.mp3", year), 10
+			if i == 1 {
+				item.XmlData.Enclosure.Length = newerLength
+			}
+			list = append(list, &item)
+		}
+		testutils.AssertErr(t, false, db.saveItems(list...))
+		testutils.AssertErr(t, false, os.MkdirAll(f.mp3Path, 0755))
+		testutils.AssertErr(t, false, os.WriteFile(filepath.Join(f.mp3Path, "ep.mp3"), []byte("0123456789"), 0644))
+		return f
+	}
+	var loadItems = func(t *testing.T, f *Feed) map[int]*Item {
+		items, err := f.loadDBFeedItems(AllItems, loadOptions{includeXml: true})
+		testutils.AssertErr(t, false, err)
+		var byYear = make(map[int]*Item)
+		for _, item := range items {
+			byYear[item.PubTimeStamp.Year()] = item
+		}
+		return byYear
+	}
+	var readReport = func(t *testing.T) [][]string {
+		in, err := os.Open(filepath.Join(config.WorkspaceDir, ".collision", "collisions.test.csv"))
+		if err != nil {
+			t.Fatalf("error opening report: %v", err)
+		}
+		defer in.Close()
+		records, err := csv.NewReader(in).ReadAll()
+		testutils.AssertErr(t, false, err)
+		return records
+	}
+
+	t.Run("keep newest", func(t *testing.T) {
+		var f = setup(t, commandline.CollisionKeepNewest, 10)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+
+		var items = loadItems(t, f)
+		testutils.AssertEquals(t, 1, len(items))
+		testutils.Assert(t, items[2021] != nil, "newest item not kept")
+
+		var report = readReport(t)
+		testutils.AssertEquals(t, 2, len(report))
+		testutils.AssertEquals(t, collisionReportHeaders, report[0])
+		testutils.AssertEquals(t, []string{"foo", "ep.mp3", "keep-newest", "2", "1", "", "newer publish date"}, report[1])
+	})
+
+	// ep1's the one removed, but the file on disk is its; left as is
+	t.Run("keep newest, removed owns file", func(t *testing.T) {
+		var f = setup(t, commandline.CollisionKeepNewest, 20)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+
+		var items = loadItems(t, f)
+		testutils.AssertEquals(t, 2, len(items))
+		testutils.AssertEquals(t, true, items[2020].Downloaded)
+		testutils.AssertEquals(t, []string{"foo", "ep.mp3", "keep-newest", "", "", "",
+			"newer publish date, but item 1 owns the file on disk; skipped"}, readReport(t)[1])
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		var f = setup(t, commandline.CollisionRename, 10)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+
+		var items = loadItems(t, f)
+		testutils.AssertEquals(t, 2, len(items))
+		testutils.AssertEquals(t, "ep.mp3", items[2020].Filename)
+		testutils.AssertEquals(t, true, items[2020].Downloaded)
+		testutils.AssertEquals(t, "ep.A.mp3", items[2021].Filename)
+		testutils.AssertEquals(t, ".A", items[2021].FilenameXta)
+		testutils.AssertEquals(t, false, items[2021].Downloaded)
+
+		var report = readReport(t)
+		testutils.AssertEquals(t, []string{"foo", "ep.mp3", "rename", "1", "", "2:ep.A.mp3", "downloaded"}, report[1])
+	})
+
+	t.Run("undecided", func(t *testing.T) {
+		var f = setup(t, commandline.CollisionKeepLarger, 10)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+
+		testutils.AssertEquals(t, 2, len(loadItems(t, f)))
+		testutils.AssertEquals(t, []string{"foo", "ep.mp3", "keep-larger", "", "", "", "same size; skipped"}, readReport(t)[1])
+	})
+}
@@ -0,0 +1,133 @@
+package pod
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopod/podutils"
+)
+
+// on disk size below this fraction of the enclosure length is truncated.  Enclosure lengths are
+// often inexact (i.e. dynamically inserted ads), so only a file well short of it is flagged; the
+// size recorded on download has to match exactly
+const truncatedRatio = 0.5
+
+// --------------------------------------------------------------------------
+// checks downloaded (not archived) episodes for files that are truncated, or not audio (i.e. an
+// html error page saved as the episode).  Repair moves the file to <shortname>/.trash and resets
+// the episode as not downloaded, so update downloads it again; repair now downloads it right away
+func (fcs *fileCheckStatus) checkCorrupted() error {
+
+	var (
+		log       = fcs.feed.log
+		dirtyList = make([]*Item, 0)
+		repaired  = make([]*CheckFinding, 0)
+		corrupted int
+	)
+
+	for _, item := range fcs.itemList {
+		if item.Downloaded == false || item.Archived || fcs.fileExists(item) == false {
+			continue
+		}
+
+		var (
+			lg          = log.With("file", item.Filename)
+			reason, err = fcs.corruptReason(item)
+		)
+		if err != nil {
+			lg.Errorf("failed checking file: %v", err)
+			continue
+		} else if reason == "" {
+			continue
+		}
+		corrupted++
+
+		var finding = fcs.addFinding("corrupted", FindingCorrupted, item.Filename, reason)
+		if config.DoRepair == false {
+			finding.Detail += " (use --repair)"
+			continue
+		}
+		if err := fcs.trashFile(item.Filename); err != nil {
+			lg.Errorf("failed moving corrupted download to trash: %v", err)
+			continue
+		}
+		item.Downloaded, item.DownloadSize, item.DownloadedAt = false, 0, time.Time{}
+		fcs.fileExistsMap[item.Filename] = false
+		dirtyList, repaired = append(dirtyList, item), append(repaired, finding)
+		lg.Infof("corrupted download (%v) moved to trash; reset as not downloaded", reason)
+
+		if config.RepairNow {
+			if _, err := item.Download(fcs.feed.mp3Path); err != nil {
+				lg.Errorf("download failed; will be downloaded on next update: %v", err)
+				continue
+			}
+			fcs.fileExistsMap[item.Filename] = true
+			if reason, err := fcs.corruptReason(item); err == nil && reason != "" {
+				lg.Warnf("downloaded again, but still looks corrupted: %v", reason)
+			} else {
+				lg.Info("downloaded again")
+			}
+		}
+	}
+
+	if corrupted > 0 {
+		log.Infof("%v corrupted downloads found", corrupted)
+	}
+
+	if len(dirtyList) > 0 {
+		if err := fcs.feed.saveDBFeed(db, nil, dirtyList); err != nil {
+			return err
+		}
+		for _, finding := range repaired {
+			finding.Fixed = true
+		}
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// why a downloaded file looks corrupted; empty if it doesn't
+func (fcs *fileCheckStatus) corruptReason(item *Item) (string, error) {
+
+	in, err := os.Open(filepath.Join(fcs.feed.mp3Path, item.Filename))
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	stat, err := in.Stat()
+	if err != nil {
+		return "", err
+	}
+	var size = stat.Size()
+
+	switch {
+	case size == 0:
+		return "empty file", nil
+	case item.DownloadSize > 0 && size != item.DownloadSize:
+		return fmt.Sprintf("size %v doesn't match %v downloaded", size, item.DownloadSize), nil
+	case item.DownloadSize == 0 && item.XmlData != nil && item.XmlData.Enclosure.Length > 0 &&
+		float64(size) < float64(item.XmlData.Enclosure.Length)*truncatedRatio:
+		return fmt.Sprintf("truncated; size %v of %v in feed", size, item.XmlData.Enclosure.Length), nil
+	}
+
+	// content sniffing uses at most the first 512 bytes
+	var head = make([]byte, 512)
+	n, err := io.ReadFull(in, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head = head[:n]
+
+	if contentType := http.DetectContentType(head); strings.HasPrefix(contentType, "text/") {
+		return fmt.Sprintf("not audio (%v)", contentType), nil
+	} else if podutils.IsAudioHeader(head) == false {
+		return "unrecognized audio header", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,143 @@
+package pod
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopod/podconfig"
+	"gopod/testutils"
+)
+
+func TestCheckDownloads_corrupted(t *testing.T) {
+
+	var (
+		oldConfig = config
+		oldDB     = db
+		audio     = append(testutils.GenerateId3(map[string]string{"TIT2": "episode"}), 0xff, 0xfb, 0x90, 0x64, 0, 0, 0, 0)
+	)
+	defer func() {
+		db.Close()
+		config, db = oldConfig, oldDB
+	}()
+
+	// serves the episodes again, for repair now
+	var ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(audio)
+	}))
+	defer ts.Close()
+
+	var files = []struct {
+		name         string
+		data         []byte
+		downloadSize int64
+		length       uint
+		corrupted    bool
+	}{
+		{"good.mp3", audio, int64(len(audio)), 0, false},
+		{"good-enclosure.mp3", audio, 0, uint(len(audio)) + 4, false},
+		{"truncated.mp3", audio[:20], int64(len(audio)), 0, true},
+		{"truncated-enclosure.mp3", audio, 0, 1000, true},
+		{"html.mp3", []byte("<!DOCTYPE html><html><body>404 not found</body></html>"), 0, 0, true},
+		{"binary.mp3", make([]byte, 64), 0, 0, true},
+		{"empty.mp3", []byte{}, 0, 0, true},
+	}
+
+	var setup = func(t *testing.T, repair, now bool) *Feed {
+		config = &podconfig.Config{WorkspaceDir: t.TempDir(), TimestampStr: "test"}
+		config.DoRepair, config.RepairNow = repair, now
+		if db != nil && db != oldDB {
+			db.Close()
+		}
+		if pdb, err := NewDB(DBPath(config.WorkspaceDir)); err != nil {
+			t.Fatalf("error creating db: %v", err)
+		} else {
+			db = pdb
+		}
+
+		f, err := NewFeed(podconfig.FeedToml{Name: "foo cast", Shortname: "foo", Url: "https://foo.bar/foo"})
+		if err != nil {
+			t.Fatalf("error creating feed: %v", err)
+		}
+		testutils.AssertErr(t, false, f.LoadDBFeed(loadOptions{}))
+		f.XmlFeedData = &FeedXmlDBEntry{}
+		testutils.AssertErr(t, false, db.saveFeed(&f.FeedDBEntry))
+
+		var list = make([]*ItemDBEntry, 0)
+		for _, file := range files {
+			var item = generateItem(f.ID, true)
+			item.Filename, item.Downloaded, item.DownloadSize = file.name, true, file.downloadSize
+			item.Url = fmt.Sprintf("%v/%v", ts.URL, file.name)
+			item.XmlData.Enclosure.Url, item.XmlData.Enclosure.Length = item.Url, file.length
+			list = append(list, &item)
+			testutils.AssertErr(t, false, os.WriteFile(filepath.Join(f.mp3Path, file.name), file.data, 0644))
+		}
+		testutils.AssertErr(t, false, db.saveItems(list...))
+		return f
+	}
+
+	var loadItems = func(t *testing.T, f *Feed) map[string]*Item {
+		items, err := f.loadDBFeedItems(AllItems, loadOptions{})
+		testutils.AssertErr(t, false, err)
+		var byName = make(map[string]*Item)
+		for _, item := range items {
+			byName[item.Filename] = item
+		}
+		return byName
+	}
+	var exists = func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	t.Run("check only", func(t *testing.T) {
+		var f = setup(t, false, false)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+		for name, item := range loadItems(t, f) {
+			testutils.Assert(t, item.Downloaded, name+" reset without repair")
+			testutils.Assert(t, exists(filepath.Join(f.mp3Path, name)), name+" moved without repair")
+		}
+	})
+
+	t.Run("repair", func(t *testing.T) {
+		var (
+			f     = setup(t, true, false)
+			items map[string]*Item
+		)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+		items = loadItems(t, f)
+		for _, file := range files {
+			var item = items[file.name]
+			testutils.AssertEquals(t, file.corrupted == false, item.Downloaded)
+			testutils.AssertEquals(t, file.corrupted, exists(filepath.Join(f.mp3Path, ".trash", file.name)))
+			testutils.AssertEquals(t, file.corrupted == false, exists(filepath.Join(f.mp3Path, file.name)))
+			if file.corrupted {
+				testutils.AssertEquals(t, int64(0), item.DownloadSize)
+				testutils.Assert(t, item.DownloadedAt.IsZero(), file.name+" download time not reset")
+			}
+		}
+	})
+
+	t.Run("repair now", func(t *testing.T) {
+		var f = setup(t, true, true)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+		var items = loadItems(t, f)
+		for _, file := range files {
+			var item = items[file.name]
+			testutils.Assert(t, item.Downloaded, file.name+" not downloaded")
+			if file.corrupted {
+				testutils.AssertEquals(t, int64(len(audio)), item.DownloadSize)
+				testutils.Assert(t, item.DownloadedAt.IsZero() == false, file.name+" download time not set")
+				data, err := os.ReadFile(filepath.Join(f.mp3Path, file.name))
+				testutils.AssertErr(t, false, err)
+				testutils.AssertEquals(t, audio, data)
+			}
+		}
+	})
+}
@@ -1,8 +1,19 @@
 package pod
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
 	"gopod/inputoption"
+	log "gopod/multilogger"
+	"gopod/podconfig"
+	"gopod/podutils"
+
+	"gorm.io/gorm"
 )
 
 func (f *Feed) RunDelete() error {
@@ -37,3 +48,146 @@ func (f *Feed) RunDelete() error {
 
 	return nil
 }
+
+// --------------------------------------------------------------------------
+// restores a feed removed with deletefeed, along with the items, xml and images deleted with it
+func (f *Feed) RunUndelete() error {
+
+	if err := f.LoadDBFeed(loadOptions{dontCreate: true, includeDeleted: true}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("feed '%v' not found in database", f.Shortname)
+		}
+		return err
+	} else if f.DeletedAt.Valid == false {
+		return fmt.Errorf("feed '%v' is not deleted", f.Shortname)
+	}
+
+	// verify input
+	var desc = fmt.Sprintf("Restoring feed '%v' (deleted %v); please confirm",
+		f.Shortname, f.DeletedAt.Time.Format(time.DateTime))
+	if yn, err := inputoption.RunYesNoSelection(desc, inputoption.NO); err != nil {
+		f.log.Errorf("error in input selection; exiting: %v", err)
+		return err
+	} else if yn != inputoption.YES {
+		f.log.Info("not confirmed, exiting...")
+		return nil
+	}
+
+	counts, err := db.undeleteFeed(&f.FeedDBEntry)
+	if err != nil {
+		f.log.Errorf("failure to undelete feed: %v", err)
+		return err
+	}
+	f.log.With("items", counts.Items, "images", counts.Images).Info("feed restored")
+
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// permanently removes deleted feeds (all, or a specific shortname) from the database, optionally
+// removing the feed directory as well.  Deleted feeds may no longer be in config, so these are
+// found by the shortname saved in the database
+func Purge(shortname string, tomlList []podconfig.FeedToml) error {
+	if config == nil {
+		return errors.New("config is nil")
+	} else if db == nil {
+		return errors.New("db is nil")
+	}
+
+	feedlist, err := db.loadDeletedFeeds()
+	if err != nil {
+		return fmt.Errorf("error loading deleted feeds: %w", err)
+	}
+
+	var (
+		feedIds []uint // nil for all deleted
+		dirs    = make([]string, 0)
+		inUse   = make(map[string]bool)
+	)
+	for _, toml := range tomlList {
+		inUse[podutils.Tern(toml.Shortname != "", toml.Shortname, toml.Name)] = true
+	}
+	if shortname != "" {
+		var filtered = make([]*FeedDBEntry, 0, 1)
+		for _, fe := range feedlist {
+			if fe.DBShortname == shortname {
+				filtered = append(filtered, fe)
+				feedIds = append(feedIds, fe.ID)
+			}
+		}
+		if len(filtered) == 0 {
+			return fmt.Errorf("no deleted feed found with shortname '%v'", shortname)
+		}
+		feedlist = filtered
+	}
+
+	if len(feedlist) > 0 {
+		fmt.Println("Deleted feeds:")
+	}
+	for _, fe := range feedlist {
+		fmt.Printf("  %v (id %v, deleted %v)\n", podutils.Tern(fe.DBShortname != "", fe.DBShortname, "<unknown>"),
+			fe.ID, fe.DeletedAt.Time.Format(time.DateTime))
+
+		if config.RemoveFiles == false {
+			continue
+		}
+		// never remove anything outside the workspace, or a directory still used by a configured feed
+		var sn = fe.DBShortname
+		if podconfig.ValidShortname(sn) == false {
+			log.With("id", fe.ID, "shortname", sn).Warn("shortname not usable as directory; files not removed")
+			continue
+		} else if inUse[sn] {
+			log.With("shortname", sn).Warn("shortname still in config; files not removed")
+			continue
+		}
+		var dir = filepath.Join(config.WorkspaceDir, sn)
+		if exists, _ := podutils.FileExists(dir); exists && slices.Contains(dirs, dir) == false {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	counts, err := db.purgeDeleted(feedIds, true)
+	if err != nil {
+		return err
+	}
+	if counts.total() == 0 && len(dirs) == 0 {
+		fmt.Println("Nothing to purge")
+		return nil
+	}
+
+	fmt.Printf("Rows to remove: feeds %v, feed xml %v, items %v, item xml %v, images %v, runs %v, changes %v\n",
+		counts.Feeds, counts.FeedXml, counts.Items, counts.ItemXml, counts.Images, counts.Runs, counts.Changes)
+	for _, dir := range dirs {
+		size, _ := dirSize(dir)
+		fmt.Printf("Directory to remove: %v (%v)\n", dir, podutils.FormatBytes(size))
+	}
+
+	if config.DryRun {
+		fmt.Println("Dry run; nothing purged")
+		return nil
+	}
+
+	// verify input
+	if yn, err := inputoption.RunYesNoSelection("Purging is permanent; please confirm", inputoption.NO); err != nil {
+		log.Errorf("error in input selection; exiting: %v", err)
+		return err
+	} else if yn != inputoption.YES {
+		log.Info("not confirmed, exiting...")
+		return nil
+	}
+
+	if counts, err = db.purgeDeleted(feedIds, false); err != nil {
+		return fmt.Errorf("failed purging database: %w", err)
+	}
+	log.With("feeds", counts.Feeds, "items", counts.Items, "images", counts.Images).Info("database purged")
+
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			log.With("dir", dir, "error", err).Error("failed removing directory")
+		} else {
+			log.With("dir", dir).Info("directory removed")
+		}
+	}
+
+	return nil
+}
@@ -84,7 +84,7 @@ func (f *Feed) HackDB() error {
 	}
 
 	if len(modified) > 0 {
-		f.saveDBFeedItems(modified...)
+		f.saveDBFeedItems(db, modified...)
 	}
 
 	return nil
@@ -0,0 +1,175 @@
+package pod
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopod/podutils"
+
+	"gorm.io/gorm"
+)
+
+const historyValueWidth = 60 // max length of values shown in table output
+
+type ItemChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+type ItemRevision struct {
+	Revision int
+	Seen     time.Time // when the revision was first seen in the feed
+	Current  bool
+	Changes  []ItemChange // from the previous revision; empty for the first
+}
+
+type ItemHistory struct {
+	Shortname string
+	Hash      string
+	Filename  string
+	Title     string
+	Revisions []ItemRevision
+}
+
+// --------------------------------------------------------------------------
+// xml revisions for the item from the commandline (hash or filename), with the changes between each
+func (f *Feed) History() (*ItemHistory, error) {
+
+	if config == nil {
+		return nil, errors.New("cannot get history; config is nil")
+	} else if db == nil {
+		return nil, errors.New("cannot get history; db is nil")
+	}
+
+	var key = config.HistoryItem
+	if key == "" {
+		return nil, errors.New("item hash or filename cannot be empty")
+	}
+
+	if err := f.LoadDBFeed(loadOptions{dontCreate: true}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("feed '%v' not found in database", f.Shortname)
+		}
+		return nil, err
+	}
+
+	item, err := db.loadItemByKey(f.ID, key)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("item '%v' not found in feed '%v'", key, f.Shortname)
+	} else if err != nil {
+		return nil, err
+	}
+
+	revisions, err := db.loadItemXmlRevisions(item.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading xml revisions: %w", err)
+	}
+
+	var hist = ItemHistory{
+		Shortname: f.Shortname,
+		Hash:      item.Hash,
+		Filename:  item.Filename,
+		Revisions: make([]ItemRevision, 0, len(revisions)),
+	}
+	for idx, xml := range revisions {
+		var rev = ItemRevision{
+			Revision: idx + 1,
+			Seen:     xml.CreatedAt,
+			Current:  xml.ID == item.XmlId,
+			Changes:  []ItemChange{},
+		}
+		if idx > 0 {
+			rev.Changes = diffItemXml(&revisions[idx-1].XItemData, &xml.XItemData)
+		}
+		if rev.Current {
+			hist.Title = xml.Title
+		}
+		hist.Revisions = append(hist.Revisions, rev)
+	}
+
+	return &hist, nil
+}
+
+// --------------------------------------------------------------------------
+// outputs item history, in the format from the commandline; table output truncates long values
+func WriteHistory(w io.Writer, hist *ItemHistory) error {
+
+	var rpt = report{
+		title:   fmt.Sprintf("%v: %v (%v)", hist.Shortname, hist.Title, hist.Filename),
+		headers: []string{"revision", "seen", "field", "previous", "new"},
+		rows:    make([][]string, 0, len(hist.Revisions)),
+		records: make([][]string, 0, len(hist.Revisions)),
+		data:    hist,
+	}
+
+	for _, rev := range hist.Revisions {
+		var (
+			revStr = strconv.Itoa(rev.Revision)
+			revCol = revStr + podutils.Tern(rev.Current, " (current)", "")
+			seen   = rev.Seen.Local().Format("2006-01-02 15:04")
+		)
+		if len(rev.Changes) == 0 {
+			rpt.rows = append(rpt.rows, []string{revCol, seen, "(first seen)", "", ""})
+			rpt.records = append(rpt.records, []string{revStr, seen, "", "", ""})
+		}
+		for _, ch := range rev.Changes {
+			rpt.rows = append(rpt.rows, []string{revCol, seen, ch.Field,
+				truncateValue(ch.Old, historyValueWidth), truncateValue(ch.New, historyValueWidth)})
+			rpt.records = append(rpt.records, []string{revStr, seen, ch.Field, ch.Old, ch.New})
+		}
+	}
+
+	return rpt.write(w, config.OutputFormat)
+}
+
+// --------------------------------------------------------------------------
+// fields that differ between two revisions of item xml; empty if the same
+func diffItemXml(prev, cur *podutils.XItemData) []ItemChange {
+	return diffFields(itemXmlFields(prev), itemXmlFields(cur))
+}
+
+// --------------------------------------------------------------------------
+// name/value of each xml field, in a fixed order
+func itemXmlFields(x *podutils.XItemData) [][2]string {
+	var persons string
+	if len(x.PersonList) > 0 {
+		if b, err := json.Marshal(x.PersonList); err == nil {
+			persons = string(b)
+		}
+	}
+	return [][2]string{
+		{"Title", x.Title},
+		{"Pubdate", podutils.Tern(x.Pubdate.IsZero(), "", x.Pubdate.UTC().Format(time.RFC3339))},
+		{"Season", x.SeasonStr},
+		{"Episode", x.EpisodeStr},
+		{"Duration", x.DurationStr},
+		{"Guid", x.Guid},
+		{"Link", x.Link},
+		{"Author", x.Author},
+		{"ItunesAuthor", x.ItunesAuthor},
+		{"Imageurl", x.Imageurl},
+		{"Description", x.Description},
+		{"ItunesSummary", x.ItunesSummary},
+		{"ContentEncoded", x.ContentEncoded},
+		{"EnclosureLength", strconv.FormatUint(uint64(x.Enclosure.Length), 10)},
+		{"EnclosureType", x.Enclosure.TypeStr},
+		{"EnclosureUrl", x.Enclosure.Url},
+		{"Persons", persons},
+	}
+}
+
+// --------------------------------------------------------------------------
+// collapses whitespace, and cuts to max runes
+func truncateValue(str string, max int) string {
+	str = strings.Join(strings.Fields(str), " ")
+	if runes := []rune(str); len(runes) > max {
+		return string(runes[:max-3]) + "..."
+	}
+	return str
+}
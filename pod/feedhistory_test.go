@@ -0,0 +1,160 @@
+package pod
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopod/commandline"
+	"gopod/podconfig"
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+func Test_diffItemXml(t *testing.T) {
+
+	var (
+		date = time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+		base = podutils.XItemData{Title: "foo", Pubdate: date, Guid: "guid", Description: "desc"}
+	)
+	base.Enclosure.Url = "https://foo.bar/foo.mp3"
+
+	type exp struct {
+		fields []string
+	}
+	tests := []struct {
+		name   string
+		change func(x *podutils.XItemData)
+		e      exp
+	}{
+		{"same", func(x *podutils.XItemData) {}, exp{fields: []string{}}},
+		// same time, different zone
+		{"same pubdate", func(x *podutils.XItemData) { x.Pubdate = date.In(time.FixedZone("foo", -7*3600)) },
+			exp{fields: []string{}}},
+		{"nil vs empty persons", func(x *podutils.XItemData) { x.PersonList = []podutils.XPodcastPersonData{} },
+			exp{fields: []string{}}},
+		{"title", func(x *podutils.XItemData) { x.Title = "bar" }, exp{fields: []string{"Title"}}},
+		{"enclosure and description", func(x *podutils.XItemData) {
+			x.Enclosure.Url = "https://foo.bar/ad.mp3"
+			x.Description = "desc, with ad"
+		}, exp{fields: []string{"Description", "EnclosureUrl"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cur = base
+			tt.change(&cur)
+
+			var fields = make([]string, 0)
+			for _, ch := range diffItemXml(&base, &cur) {
+				fields = append(fields, ch.Field)
+			}
+			testutils.AssertEquals(t, tt.e.fields, fields)
+		})
+	}
+}
+
+func TestFeed_History(t *testing.T) {
+
+	var (
+		dir       = t.TempDir()
+		oldConfig = config
+		oldDB     = db
+	)
+	defer func() { config, db = oldConfig, oldDB }()
+
+	config = &podconfig.Config{WorkspaceDir: dir, TimestampStr: "test"}
+	if pdb, err := NewDB(filepath.Join(dir, ".db", "gopod.db")); err != nil {
+		t.Fatalf("error creating db: %v", err)
+	} else {
+		db = pdb
+		defer pdb.Close()
+	}
+
+	f, err := NewFeed(podconfig.FeedToml{Name: "foo cast", Shortname: "foo", Url: "https://foo.bar/foo"})
+	if err != nil {
+		t.Fatalf("error creating feed: %v", err)
+	} else if err := f.LoadDBFeed(loadOptions{}); err != nil {
+		t.Fatalf("error loading feed: %v", err)
+	}
+
+	var item = Item{ItemDBEntry: generateItem(f.ID, true)}
+	item.Filename = "foo1.mp3"
+	item.XmlData.Title = "first title"
+	if err := db.saveItems(&item.ItemDBEntry); err != nil {
+		t.Fatalf("error saving item: %v", err)
+	}
+	testutils.AssertEquals(t, item.ID, item.XmlData.ItemId)
+
+	// same xml; no new revision
+	var same = item.XmlData.XItemData
+	testutils.Assert(t, item.setXmlRevision(&same) == false, "expected no new revision")
+
+	// two changes, saved separately
+	var prevXmlId = item.XmlId
+	for _, title := range []string{"second title", "third title"} {
+		var changed = item.XmlData.XItemData
+		changed.Title = title
+		testutils.AssertErr(t, false, item.updateXmlData(item.Hash, &changed))
+		testutils.AssertEquals(t, uint(0), item.XmlData.ID)
+		if err := db.saveItems(&item.ItemDBEntry); err != nil {
+			t.Fatalf("error saving item: %v", err)
+		}
+		testutils.Assert(t, item.XmlId != prevXmlId, "xml id not updated to new revision")
+		prevXmlId = item.XmlId
+	}
+
+	type args struct {
+		key       string
+		shortname string
+	}
+	type exp struct {
+		errStr    string
+		revisions int
+		title     string
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty key", args{shortname: "foo"}, exp{errStr: "item hash or filename cannot be empty"}},
+		{"feed not in db", args{key: "foo1.mp3", shortname: "bar"}, exp{errStr: "feed 'bar' not found in database"}},
+		{"item not found", args{key: "foo2.mp3", shortname: "foo"}, exp{errStr: "item 'foo2.mp3' not found in feed 'foo'"}},
+		{"by filename", args{key: "foo1.mp3", shortname: "foo"}, exp{revisions: 3, title: "third title"}},
+		{"by hash", args{key: item.Hash, shortname: "foo"}, exp{revisions: 3, title: "third title"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hf, err := NewFeed(podconfig.FeedToml{Shortname: tt.p.shortname, Url: "https://foo.bar/" + tt.p.shortname})
+			if err != nil {
+				t.Fatalf("error creating feed: %v", err)
+			}
+			config.HistoryItem = tt.p.key
+
+			hist, err := hf.History()
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			if err != nil {
+				return
+			}
+
+			testutils.AssertEquals(t, tt.e.revisions, len(hist.Revisions))
+			testutils.AssertEquals(t, tt.e.title, hist.Title)
+			testutils.AssertEquals(t, 0, len(hist.Revisions[0].Changes))
+			for idx, rev := range hist.Revisions {
+				testutils.AssertEquals(t, idx == len(hist.Revisions)-1, rev.Current)
+			}
+			testutils.AssertEquals(t, []ItemChange{{Field: "Title", Old: "second title", New: "third title"}},
+				hist.Revisions[2].Changes)
+
+			// json output
+			var buf bytes.Buffer
+			config.OutputFormat = commandline.OutputJson
+			testutils.AssertErr(t, false, WriteHistory(&buf, hist))
+			var decoded ItemHistory
+			testutils.AssertErr(t, false, json.Unmarshal(buf.Bytes(), &decoded))
+			testutils.AssertEquals(t, len(hist.Revisions), len(decoded.Revisions))
+		})
+	}
+}
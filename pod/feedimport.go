@@ -0,0 +1,119 @@
+package pod
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopod/podconfig"
+	"gopod/podutils"
+
+	log "gopod/multilogger"
+)
+
+// --------------------------------------------------------------------------
+// merges feeds from a json or db export into the db, using the configured strategy for episodes
+// already there.  If shortname is given, only that feed is imported from the export
+func Import(shortname string, tomlList []podconfig.FeedToml) error {
+	if config == nil {
+		return errors.New("config is nil")
+	} else if db == nil {
+		return errors.New("db is nil")
+	}
+
+	feedlist, err := readExport(config.ImportFrom)
+	if err != nil {
+		return fmt.Errorf("error reading export '%v': %w", config.ImportFrom, err)
+	}
+	if shortname != "" {
+		var filtered = make([]*FeedDBEntry, 0, 1)
+		for _, fe := range feedlist {
+			if fe.DBShortname == shortname {
+				filtered = append(filtered, fe)
+			}
+		}
+		if len(filtered) == 0 {
+			return fmt.Errorf("no feed found in export with shortname '%v'", shortname)
+		}
+		feedlist = filtered
+	}
+
+	// feed hashes are generated from the shortname
+	var inConfig = make(map[string]bool)
+	for _, toml := range tomlList {
+		inConfig[podutils.GenerateHash(podutils.Tern(toml.Shortname != "", toml.Shortname, toml.Name))] = true
+	}
+
+	var reterr error
+	for _, fe := range feedlist {
+		var lg = log.With("feed", fe.DBShortname)
+
+		counts, err := db.importFeed(fe, config.ImportStrategy, config.DryRun)
+		if err != nil {
+			lg.Errorf("import failed: %v", err)
+			reterr = errors.Join(reterr, fmt.Errorf("%v: %w", fe.DBShortname, err))
+			continue
+		}
+
+		fmt.Printf("%v: %v%v episodes added, %v updated, %v skipped; %v images added, %v updated, %v skipped\n",
+			fe.DBShortname, podutils.Tern(counts.NewFeed, "new feed; ", ""),
+			counts.Added, counts.Updated, counts.Skipped, counts.ImagesAdded, counts.ImagesUpdated, counts.ImagesSkipped)
+		if inConfig[fe.Hash] == false {
+			lg.Warn("feed not in config; add it (export also writes <shortname>.toml) to update it")
+		}
+	}
+
+	if config.DryRun {
+		fmt.Println("Dry run; nothing imported")
+	}
+	return reterr
+}
+
+// --------------------------------------------------------------------------
+// feeds in an export; json exports hold a single feed
+func readExport(file string) ([]*FeedDBEntry, error) {
+	if exists, err := podutils.FileExists(file); err != nil {
+		return nil, err
+	} else if exists == false {
+		return nil, errors.New("file does not exist")
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var feed FeedDBEntry
+		if err := json.Unmarshal(data, &feed); err != nil {
+			return nil, err
+		} else if feed.Hash == "" {
+			return nil, errors.New("no feed found (hash is empty)")
+		}
+		return []*FeedDBEntry{&feed}, nil
+
+	case ".db":
+		// read only; the export is the user's file, and isn't changed by reading it
+		pdb, err := openImmutableDB(file)
+		if err != nil {
+			return nil, err
+		}
+		defer pdb.Close()
+		// older exports are read as is; newer can't be
+		if _, err := loadSchemaState(pdb.db); err != nil {
+			return nil, err
+		}
+		feedlist, err := pdb.loadExportFeeds()
+		if err != nil {
+			return nil, err
+		} else if len(feedlist) == 0 {
+			return nil, errors.New("no feeds found")
+		}
+		return feedlist, nil
+	}
+
+	return nil, fmt.Errorf("unrecognized export file type '%v' (use .json or .db)", filepath.Ext(file))
+}
@@ -0,0 +1,263 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopod/commandline"
+	"gopod/podutils"
+)
+
+// temp downloads not modified for this long aren't in progress
+const staleTempAge = time.Hour
+
+var (
+	audioExtensions = []string{".mp3", ".m4a", ".m4b", ".aac", ".mp4", ".ogg", ".oga", ".opus", ".flac", ".wav"}
+	// temp files from Item.Download; <filename>_temp<random>
+	tempDownloadRegex = regexp.MustCompile(`_temp\d+$`)
+)
+
+// audio file in a feed's directory that no downloaded episode references
+type orphanFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+	match   *Item  // episode not downloaded the file is matched to, if any
+	matchBy string // filename, size, id3 title or date
+	tags    *podutils.Id3Tags
+}
+
+// --------------------------------------------------------------------------
+// finds orphaned audio files and stale temp downloads in the feed's directory.  List only reports
+// them; adopt marks the episodes orphans are matched to as downloaded (renaming the file to the
+// episode's filename), and trash moves orphans without a match to <shortname>/.trash.  Stale temp
+// downloads are removed on adopt or trash
+func (fcs *fileCheckStatus) checkOrphans() error {
+	if config.OrphanAction == commandline.OrphanNone {
+		return nil
+	}
+
+	var log = fcs.feed.log
+	orphans, temps, err := fcs.findOrphans()
+	if err != nil {
+		return err
+	}
+
+	var (
+		dirtyList  = make([]*Item, 0)
+		adopted    = make([]*CheckFinding, 0)
+		candidates = make([]*Item, 0)
+		matched    int
+	)
+	for _, item := range fcs.itemList {
+		if item.Downloaded == false && item.Archived == false {
+			candidates = append(candidates, item)
+		}
+	}
+
+	for _, orphan := range orphans {
+		if orphan.match, orphan.matchBy = fcs.matchOrphan(orphan, candidates); orphan.match != nil {
+			matched++
+			// an episode is only adopted once
+			candidates = slices.DeleteFunc(candidates, func(item *Item) bool { return item == orphan.match })
+		}
+		var (
+			lg      = log.With("file", orphan.name, "size", podutils.FormatBytes(uint64(orphan.size)))
+			finding = fcs.addFinding("orphans", FindingOrphanFile, orphan.name, "no matching episode")
+		)
+		if orphan.match != nil {
+			finding.Detail = fmt.Sprintf("matches episode '%v' by %v", orphan.match.Filename, orphan.matchBy)
+		}
+
+		switch {
+		case orphan.match == nil && config.OrphanAction == commandline.OrphanTrash:
+			if err := fcs.trashFile(orphan.name); err != nil {
+				lg.Errorf("failed moving orphan to trash: %v", err)
+			} else {
+				lg.Info("orphan moved to trash")
+				finding.Detail, finding.Fixed = finding.Detail+"; moved to trash", true
+			}
+		case orphan.match != nil && config.OrphanAction == commandline.OrphanAdopt:
+			if err := fcs.adoptOrphan(orphan); err != nil {
+				lg.Errorf("failed adopting orphan: %v", err)
+				continue
+			}
+			lg.Infof("orphan adopted by '%v' (matched by %v)", orphan.match.Filename, orphan.matchBy)
+			dirtyList, adopted = append(dirtyList, orphan.match), append(adopted, finding)
+		case orphan.match != nil:
+			finding.Detail += " (use --orphans=adopt)"
+		}
+	}
+
+	for _, temp := range temps {
+		var finding = fcs.addFinding("orphans", FindingStaleTemp, temp, "not modified in "+staleTempAge.String())
+		if config.OrphanAction == commandline.OrphanList {
+			continue
+		} else if err := os.Remove(filepath.Join(fcs.feed.mp3Path, temp)); err != nil {
+			log.Errorf("failed removing stale temp download '%v': %v", temp, err)
+		} else {
+			log.Infof("removed stale temp download '%v'", temp)
+			finding.Detail, finding.Fixed = finding.Detail+"; removed", true
+		}
+	}
+
+	log.Infof("%v orphan files (%v matched to episodes), %v stale temp downloads", len(orphans), matched, len(temps))
+
+	if len(dirtyList) > 0 {
+		if err := fcs.feed.saveDBFeed(db, nil, dirtyList); err != nil {
+			return err
+		}
+		for _, finding := range adopted {
+			finding.Fixed = true
+		}
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// audio files not referenced by a downloaded (or archived) episode, and temp downloads old enough
+// not to be in progress; sub directories (.xml, .img, etc) aren't checked
+func (fcs *fileCheckStatus) findOrphans() ([]*orphanFile, []string, error) {
+
+	entries, err := os.ReadDir(fcs.feed.mp3Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var referenced = make(map[string]bool, len(fcs.itemList))
+	for _, item := range fcs.itemList {
+		if item.Downloaded || item.Archived {
+			referenced[item.Filename] = true
+		}
+	}
+
+	var (
+		orphans = make([]*orphanFile, 0)
+		temps   = make([]string, 0)
+	)
+	for _, entry := range entries {
+		var name = entry.Name()
+		if entry.Type().IsRegular() == false || strings.HasPrefix(name, ".") || referenced[name] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case tempDownloadRegex.MatchString(name):
+			if time.Since(info.ModTime()) < staleTempAge {
+				fcs.feed.log.Debugf("temp download '%v' recently modified; download in progress?", name)
+			} else {
+				temps = append(temps, name)
+			}
+		case slices.Contains(audioExtensions, strings.ToLower(filepath.Ext(name))):
+			orphans = append(orphans, &orphanFile{name: name, size: info.Size(), modTime: info.ModTime()})
+		}
+	}
+	return orphans, temps, nil
+}
+
+// --------------------------------------------------------------------------
+// episode (not downloaded) matching an orphan; tried by filename, enclosure length, id3 title and
+// date, in that order.  A criterion matching more than one episode is skipped
+func (fcs *fileCheckStatus) matchOrphan(orphan *orphanFile, candidates []*Item) (*Item, string) {
+
+	var matchers = []struct {
+		by    string
+		match func(*Item) bool
+	}{
+		{"filename", func(item *Item) bool {
+			var urlFilename, _, _ = strings.Cut(path.Base(item.Url), "?")
+			return strings.EqualFold(orphan.name, item.Filename) ||
+				(item.CDFilename != "" && orphan.name == item.CDFilename) || orphan.name == urlFilename
+		}},
+		{"size", func(item *Item) bool {
+			return item.XmlData != nil && item.XmlData.Enclosure.Length > 0 && int64(item.XmlData.Enclosure.Length) == orphan.size
+		}},
+		{"id3 title", func(item *Item) bool {
+			var tags = fcs.orphanTags(orphan)
+			return tags.Title != "" && item.XmlData != nil && strings.EqualFold(tags.Title, strings.TrimSpace(item.XmlData.Title))
+		}},
+		{"date", func(item *Item) bool {
+			// downloads are given the episode's pubdate as modified time
+			if orphan.modTime.Equal(item.PubTimeStamp) {
+				return true
+			}
+			var tags = fcs.orphanTags(orphan)
+			return tags.Date.IsZero() == false && tags.Date.Format(time.DateOnly) == item.PubTimeStamp.Format(time.DateOnly)
+		}},
+	}
+
+	for _, m := range matchers {
+		var found []*Item
+		for _, item := range candidates {
+			if m.match(item) {
+				found = append(found, item)
+			}
+		}
+		if len(found) == 1 {
+			return found[0], m.by
+		} else if len(found) > 1 {
+			fcs.feed.log.Debugf("orphan '%v' matches %v episodes by %v; skipping %v", orphan.name, len(found), m.by, m.by)
+		}
+	}
+	return nil, ""
+}
+
+// --------------------------------------------------------------------------
+// id3 tags, read once; empty if the file has none
+func (fcs *fileCheckStatus) orphanTags(orphan *orphanFile) podutils.Id3Tags {
+	if orphan.tags == nil {
+		tags, err := podutils.ReadId3(filepath.Join(fcs.feed.mp3Path, orphan.name))
+		if err != nil && errors.Is(err, podutils.ErrNoId3) == false {
+			fcs.feed.log.Debugf("failed reading id3 from '%v': %v", orphan.name, err)
+		}
+		orphan.tags = &tags
+	}
+	return *orphan.tags
+}
+
+// --------------------------------------------------------------------------
+// renames the orphan to the episode's filename, and marks the episode downloaded
+func (fcs *fileCheckStatus) adoptOrphan(orphan *orphanFile) error {
+	var item = orphan.match
+	if orphan.name != item.Filename {
+		var dest = filepath.Join(fcs.feed.mp3Path, item.Filename)
+		if exists, err := podutils.FileExists(dest); err != nil {
+			return err
+		} else if exists {
+			return fmt.Errorf("episode's file '%v' already exists", item.Filename)
+		} else if err := podutils.Rename(filepath.Join(fcs.feed.mp3Path, orphan.name), dest); err != nil {
+			return err
+		}
+		fcs.fileExistsMap[orphan.name] = false
+	}
+	item.Downloaded, item.DownloadSize = true, orphan.size
+	fcs.fileExistsMap[item.Filename] = true
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// moves a file to the feed's .trash directory; a timestamp is added if the name's already there
+func (fcs *fileCheckStatus) trashFile(name string) error {
+	var trashPath = filepath.Join(fcs.feed.mp3Path, ".trash")
+	if err := podutils.MkdirAll(trashPath); err != nil {
+		return err
+	}
+	var dest = filepath.Join(trashPath, name)
+	if exists, err := podutils.FileExists(dest); err != nil {
+		return err
+	} else if exists {
+		dest = filepath.Join(trashPath, name+"."+config.TimestampStr)
+	}
+	return podutils.Rename(filepath.Join(fcs.feed.mp3Path, name), dest)
+}
@@ -0,0 +1,133 @@
+package pod
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopod/commandline"
+	"gopod/podconfig"
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+func TestCheckDownloads_orphans(t *testing.T) {
+
+	var (
+		oldConfig = config
+		oldDB     = db
+		date      = func(month int) time.Time { return time.Date(2021, time.Month(month), 5, 10, 0, 0, 0, time.UTC) }
+	)
+	defer func() {
+		db.Close()
+		config, db = oldConfig, oldDB
+	}()
+
+	// ep1 is downloaded; the rest aren't, with orphans matching ep2 (url filename), ep3 (size),
+	// ep4 (id3 title) and ep5 (modified time), plus one matching nothing
+	var setup = func(t *testing.T, action commandline.OrphanAction) *Feed {
+		config = &podconfig.Config{WorkspaceDir: t.TempDir(), TimestampStr: "test"}
+		config.OrphanAction = action
+		if db != nil && db != oldDB {
+			db.Close()
+		}
+		if pdb, err := NewDB(DBPath(config.WorkspaceDir)); err != nil {
+			t.Fatalf("error creating db: %v", err)
+		} else {
+			db = pdb
+		}
+
+		f, err := NewFeed(podconfig.FeedToml{Name: "foo cast", Shortname: "foo", Url: "https://foo.bar/foo"})
+		if err != nil {
+			t.Fatalf("error creating feed: %v", err)
+		}
+		testutils.AssertErr(t, false, f.LoadDBFeed(loadOptions{}))
+		f.XmlFeedData = &FeedXmlDBEntry{}
+		testutils.AssertErr(t, false, db.saveFeed(&f.FeedDBEntry))
+
+		var list = make([]*ItemDBEntry, 0)
+		for n := 1; n <= 5; n++ {
+			var item = generateItem(f.ID, true)
+			item.Filename, item.Downloaded, item.PubTimeStamp = fmt.Sprintf("ep%v.mp3", n), n == 1, date(n)
+			item.Url = fmt.Sprintf("https://foo.bar/orig%v.mp3", n)
+			item.XmlData.Enclosure.Url, item.XmlData.Title = item.Url, fmt.Sprintf("Episode %v", n)
+			if n == 3 {
+				item.XmlData.Enclosure.Length = 7
+			}
+			list = append(list, &item)
+		}
+		testutils.AssertErr(t, false, db.saveItems(list...))
+
+		var writeFile = func(name string, data []byte, modTime time.Time) {
+			var file = filepath.Join(f.mp3Path, name)
+			testutils.AssertErr(t, false, os.WriteFile(file, data, 0644))
+			if modTime.IsZero() == false {
+				testutils.AssertErr(t, false, os.Chtimes(file, modTime, modTime))
+			}
+		}
+		writeFile("ep1.mp3", []byte("episode one"), time.Time{})
+		writeFile("orig2.mp3", []byte("episode two"), time.Time{})
+		writeFile("three.mp3", []byte("episode"), time.Time{})
+		writeFile("four.mp3", append(testutils.GenerateId3(map[string]string{"TIT2": "Episode 4"}), "episode four"...), time.Time{})
+		writeFile("five.mp3", []byte("episode five"), date(5))
+		writeFile("random.mp3", []byte("random episode"), time.Time{})
+		writeFile("notes.txt", []byte("not audio"), time.Time{})
+		writeFile("ep6.mp3_temp123", []byte("partial"), time.Now().Add(-2*time.Hour))
+		writeFile("ep7.mp3_temp456", []byte("partial"), time.Time{})
+		return f
+	}
+
+	var state = func(t *testing.T, f *Feed) (downloaded map[string]bool, files []string) {
+		items, err := f.loadDBFeedItems(AllItems, loadOptions{})
+		testutils.AssertErr(t, false, err)
+		downloaded = make(map[string]bool)
+		for _, item := range items {
+			downloaded[item.Filename] = item.Downloaded
+		}
+		entries, err := os.ReadDir(f.mp3Path)
+		testutils.AssertErr(t, false, err)
+		for _, entry := range entries {
+			if entry.IsDir() == false {
+				files = append(files, entry.Name())
+			}
+		}
+		return
+	}
+	var exists = func(path string) bool {
+		e, _ := podutils.FileExists(path)
+		return e
+	}
+
+	t.Run("list", func(t *testing.T) {
+		var f = setup(t, commandline.OrphanList)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+
+		downloaded, files := state(t, f)
+		testutils.AssertEquals(t, map[string]bool{"ep1.mp3": true, "ep2.mp3": false, "ep3.mp3": false, "ep4.mp3": false, "ep5.mp3": false}, downloaded)
+		testutils.AssertEquals(t, 9, len(files))
+	})
+
+	t.Run("adopt", func(t *testing.T) {
+		var f = setup(t, commandline.OrphanAdopt)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+
+		downloaded, files := state(t, f)
+		testutils.AssertEquals(t, map[string]bool{"ep1.mp3": true, "ep2.mp3": true, "ep3.mp3": true, "ep4.mp3": true, "ep5.mp3": true}, downloaded)
+		testutils.AssertEquals(t, []string{"ep1.mp3", "ep2.mp3", "ep3.mp3", "ep4.mp3", "ep5.mp3", "ep7.mp3_temp456", "notes.txt", "random.mp3"}, files)
+	})
+
+	t.Run("trash", func(t *testing.T) {
+		var f = setup(t, commandline.OrphanTrash)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+
+		downloaded, files := state(t, f)
+		testutils.AssertEquals(t, false, downloaded["ep2.mp3"])
+		testutils.AssertEquals(t, []string{"ep1.mp3", "ep7.mp3_temp456", "five.mp3", "four.mp3", "notes.txt", "orig2.mp3", "three.mp3"}, files)
+		testutils.Assert(t, exists(filepath.Join(f.mp3Path, ".trash", "random.mp3")), "orphan not moved to trash")
+	})
+}
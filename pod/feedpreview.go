@@ -51,6 +51,33 @@ func (f *Feed) Preview() error {
 		}
 	}
 
+	itemList, err := f.genPreviewItems(itemPairs)
+	if err != nil {
+		return err
+	}
+
+	var fileout string
+
+	for idx, item := range itemList {
+		// output to screen, and also file
+		fmt.Printf("%3d: %v (%v)\n", idx+1, item.Filename, item.Url)
+
+		fileout += fmt.Sprintf("%v\n", item.Filename)
+	}
+
+	var previewFile = filepath.Join(config.WorkspaceDir, fmt.Sprintf("%v.preview.txt", f.Shortname))
+	if err := podutils.SaveToFile([]byte(fileout), previewFile); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// generates new items from parsed xml item pairs, based on the feed's current config;
+// returned list is ordered oldest to newest
+func (f *Feed) genPreviewItems(itemPairs []podutils.ItemPair) ([]*Item, error) {
+
 	var (
 		fileCollList = make(map[string]*Item, len(itemPairs))
 		collFunc     = func(filename string) bool {
@@ -61,6 +88,9 @@ func (f *Feed) Preview() error {
 		itemList  = make([]*Item, 0, len(itemPairs))
 	)
 
+	// list may be reversed below; don't modify the caller's list
+	itemPairs = slices.Clone(itemPairs)
+
 	if (f.EpisodeCount == 0) && f.CountStart != 0 {
 		f.log.Debugf("new feed (?); episode count == 0 and countStart == %v; setting episodeCount to countStart", f.CountStart)
 		itemCount = f.CountStart
@@ -71,7 +101,7 @@ func (f *Feed) Preview() error {
 	// list comes out newest (top of xml feed) to oldest.. reverse that,
 	// go oldest to newest, to maintain item count
 	// unless std chrono; then just reverse the reversal.. bah
-	if (f.StdChrono) {
+	if f.StdChrono {
 		slices.Reverse(itemPairs)
 	}
 	for i := len(itemPairs) - 1; i >= 0; i-- {
@@ -84,35 +114,18 @@ func (f *Feed) Preview() error {
 		if itemPairs[i].ItemData == nil {
 			err := errors.New("xml data is nil")
 			f.log.Error(err)
-			return err
+			return nil, err
 		} else if previewItem, err := createNewItemEntry(f.FeedToml, hash, xmldata, itemCount+1, collFunc); err != nil {
 			f.log.Errorf("error creating item: %v", err)
-			return err
+			return nil, err
 		} else {
 			// add the filename to collision list
 			fileCollList[previewItem.Filename] = previewItem
 
-			// f.log.Debugf("item: '%v'", previewItem)
-			// f.log.Debugf("\nOldurl: '%v'\nnewUrl: '%v'\n", previewItem.XmlData.Enclosure.Url, previewItem.Url)
-
 			itemList = append(itemList, previewItem)
 			itemCount++
 		}
 	}
 
-	var fileout string
-
-	for idx, item := range itemList {
-		// output to screen, and also file
-		fmt.Printf("%3d: %v (%v)\n", idx+1, item.Filename, item.Url)
-
-		fileout += fmt.Sprintf("%v\n", item.Filename)
-	}
-
-	var previewFile = filepath.Join(config.WorkspaceDir, fmt.Sprintf("%v.preview.txt", f.Shortname))
-	if err := podutils.SaveToFile([]byte(fileout), previewFile); err != nil {
-		return err
-	}
-
-	return nil
+	return itemList, nil
 }
@@ -0,0 +1,129 @@
+package pod
+
+import (
+	"fmt"
+	"slices"
+)
+
+// an item whose stored hash no longer matches the hash calculated with the current config
+type rehashItem struct {
+	item    *Item
+	newHash string
+	skipped string // why the item is left as is; empty if it's rehashed
+	finding *CheckFinding
+}
+
+// --------------------------------------------------------------------------
+// updates the hashes of the mismatched items.  An item whose new hash would collide with another
+// item's hash (in the feed once rehashed, or any other item in the db) is left as is; the rest are
+// updated in a single transaction.  Simulate only previews the changes
+func (fcs *fileCheckStatus) rehashItems(list []*rehashItem) error {
+
+	var log = fcs.feed.log
+	if len(list) == 0 {
+		log.Info("all hashes match; nothing to rehash")
+		return nil
+	}
+
+	if err := fcs.rehashCollisions(list); err != nil {
+		return err
+	}
+
+	var changes = make([]hashChange, 0, len(list))
+	for _, r := range list {
+		var lg = log.With("file", r.item.Filename)
+		if r.skipped != "" {
+			lg.Warnf("rehash collision; %v; left as is", r.skipped)
+			r.finding.Detail += fmt.Sprintf("; rehash collision, %v", r.skipped)
+			continue
+		}
+		lg.Infof("rehash: '%v' -> '%v'", r.item.Hash, r.newHash)
+		changes = append(changes, hashChange{ItemId: r.item.ID, OldHash: r.item.Hash, NewHash: r.newHash})
+	}
+
+	switch {
+	case len(changes) == 0:
+		log.Warn("no items rehashed; all new hashes collide")
+	case config.Simulate:
+		log.Infof("not rehashing due to simulate flag; %v items, %v collisions", len(changes), len(list)-len(changes))
+	default:
+		if err := db.rehashItems(fcs.feed.ID, changes); err != nil {
+			log.Errorf("failed rehashing; nothing changed: %v", err)
+			return err
+		}
+		for _, r := range list {
+			if r.skipped == "" {
+				r.item.Hash, r.finding.Fixed = r.newHash, true
+			}
+		}
+		log.Infof("%v items rehashed, %v collisions left as is", len(changes), len(list)-len(changes))
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// marks the items whose new hash collides.  Hashes held outside the feed's items (other feeds, or
+// deleted items) are checked first; then, within the feed, until no more collide, since an item left
+// as is keeps its old hash, which may be another item's new hash
+func (fcs *fileCheckStatus) rehashCollisions(list []*rehashItem) error {
+
+	var (
+		hashes  = make([]string, 0, len(list))
+		feedIds = make(map[uint]bool, len(fcs.itemList))
+	)
+	for _, r := range list {
+		hashes = append(hashes, r.newHash)
+	}
+	for _, item := range fcs.itemList {
+		feedIds[item.ID] = true
+	}
+
+	owners, err := db.loadHashOwners(hashes)
+	if err != nil {
+		return err
+	}
+	for _, r := range list {
+		if id, exists := owners[r.newHash]; exists && feedIds[id] == false {
+			r.skipped = fmt.Sprintf("hash '%v' is held by item %v outside the feed (or deleted)", r.newHash, id)
+		}
+	}
+
+	var byItem = make(map[*Item]*rehashItem, len(list))
+	for _, r := range list {
+		byItem[r.item] = r
+	}
+	for collided := true; collided; {
+		collided = false
+
+		var final = make(map[string][]*Item, len(fcs.itemList))
+		for _, item := range fcs.itemList {
+			var hash = item.Hash
+			if r, exists := byItem[item]; exists && r.skipped == "" {
+				hash = r.newHash
+			}
+			final[hash] = append(final[hash], item)
+		}
+		for hash, items := range final {
+			if len(items) < 2 {
+				continue
+			}
+			for _, item := range items {
+				if r, exists := byItem[item]; exists && r.skipped == "" {
+					var others = slices.DeleteFunc(slices.Clone(items), func(it *Item) bool { return it == item })
+					r.skipped = fmt.Sprintf("hash '%v' would also be held by %v", hash, itemFilenames(others))
+					collided = true
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+func itemFilenames(items []*Item) []string {
+	var names = make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Filename)
+	}
+	return names
+}
@@ -0,0 +1,108 @@
+package pod
+
+import (
+	"fmt"
+	"testing"
+
+	"gopod/podconfig"
+	"gopod/testutils"
+)
+
+func TestCheckDownloads_rehash(t *testing.T) {
+
+	var (
+		oldConfig = config
+		oldDB     = db
+		url       = func(n int) string { return fmt.Sprintf("https://foo.bar/ep%v.mp3", n) }
+		hash      = func(t *testing.T, n int) string {
+			h, err := calcHash(fmt.Sprintf("guid%v", n), url(n), "")
+			testutils.AssertErr(t, false, err)
+			return h
+		}
+	)
+	defer func() {
+		db.Close()
+		config, db = oldConfig, oldDB
+	}()
+
+	// ep1 matches; ep2 is stale; ep3 and ep4 rehash to the same hash; ep5 rehashes to a hash held
+	// by another feed's item; ep6 and ep7 swap hashes
+	var setup = func(t *testing.T, simulate bool) *Feed {
+		config = &podconfig.Config{WorkspaceDir: t.TempDir(), TimestampStr: "test"}
+		config.DoRehash, config.Simulate = true, simulate
+		if db != nil && db != oldDB {
+			db.Close()
+		}
+		if pdb, err := NewDB(DBPath(config.WorkspaceDir)); err != nil {
+			t.Fatalf("error creating db: %v", err)
+		} else {
+			db = pdb
+		}
+
+		var feeds = make([]*Feed, 0, 2)
+		for _, sn := range []string{"foo", "bar"} {
+			f, err := NewFeed(podconfig.FeedToml{Name: sn + " cast", Shortname: sn, Url: "https://foo.bar/" + sn})
+			if err != nil {
+				t.Fatalf("error creating feed: %v", err)
+			}
+			testutils.AssertErr(t, false, f.LoadDBFeed(loadOptions{}))
+			f.XmlFeedData = &FeedXmlDBEntry{}
+			testutils.AssertErr(t, false, db.saveFeed(&f.FeedDBEntry))
+			feeds = append(feeds, f)
+		}
+
+		var (
+			stored = map[int]string{1: hash(t, 1), 2: "stale2", 3: "stale3", 4: "stale4", 5: "stale5", 6: hash(t, 7), 7: hash(t, 6)}
+			list   = make([]*ItemDBEntry, 0)
+		)
+		for n := 1; n <= 7; n++ {
+			var item = generateItem(feeds[0].ID, true)
+			item.Filename, item.Hash = fmt.Sprintf("ep%v.mp3", n), stored[n]
+			item.XmlData.Guid, item.XmlData.Enclosure.Url = fmt.Sprintf("guid%v", n), url(n)
+			if n == 4 {
+				item.XmlData.Guid, item.XmlData.Enclosure.Url = "guid3", url(3)
+			}
+			list = append(list, &item)
+		}
+		var other = generateItem(feeds[1].ID, true)
+		other.Hash = hash(t, 5)
+		list = append(list, &other)
+		testutils.AssertErr(t, false, db.saveItems(list...))
+
+		testutils.AssertErr(t, false, db.saveFeedChanges([]*FeedChangeDBEntry{
+			{FeedId: feeds[0].ID, FeedChange: FeedChange{Kind: changeRemoved, ItemHash: "stale2", Title: "ep2"}}}))
+		return feeds[0]
+	}
+
+	var hashes = func(t *testing.T, f *Feed) map[string]string {
+		items, err := f.loadDBFeedItems(AllItems, loadOptions{})
+		testutils.AssertErr(t, false, err)
+		var byName = make(map[string]string)
+		for _, item := range items {
+			byName[item.Filename] = item.Hash
+		}
+		return byName
+	}
+
+	t.Run("simulate", func(t *testing.T) {
+		var f = setup(t, true)
+		var before = hashes(t, f)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+		testutils.AssertEquals(t, before, hashes(t, f))
+	})
+
+	t.Run("rehash", func(t *testing.T) {
+		var f = setup(t, false)
+		_, err := f.CheckDownloads()
+		testutils.AssertErr(t, false, err)
+		testutils.AssertEquals(t, map[string]string{
+			"ep1.mp3": hash(t, 1), "ep2.mp3": hash(t, 2), "ep3.mp3": "stale3", "ep4.mp3": "stale4",
+			"ep5.mp3": "stale5", "ep6.mp3": hash(t, 6), "ep7.mp3": hash(t, 7)}, hashes(t, f))
+
+		changes, err := db.loadLatestFeedChanges(f.ID)
+		testutils.AssertErr(t, false, err)
+		testutils.AssertEquals(t, 1, len(changes))
+		testutils.AssertEquals(t, hash(t, 2), changes[0].ItemHash)
+	})
+}
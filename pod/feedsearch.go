@@ -0,0 +1,167 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopod/podutils"
+
+	"github.com/araddon/dateparse"
+	"github.com/charmbracelet/lipgloss"
+	"gorm.io/gorm"
+)
+
+// results shown when limit isn't specified
+const defaultSearchLimit = 50
+
+type SearchResult struct {
+	Shortname string
+	Title     string
+	PubDate   time.Time
+	Path      string // empty if not on disk
+	Snippet   string
+
+	highlighted string // snippet including match markers
+}
+
+var (
+	// snippets come from description/show notes, which are usually html
+	htmlTagRegex = regexp.MustCompile(`<[^>]*>|<[^>]*$|^[^<]*>`)
+	matchStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#66ff66"))
+	stripMarkers = strings.NewReplacer(snippetStart, "", snippetEnd, "")
+)
+
+// --------------------------------------------------------------------------
+// full text search of items in the feed list, using the query and filters from the commandline
+func Search(feedlist []*Feed) ([]SearchResult, error) {
+
+	if config == nil {
+		return nil, errors.New("cannot search; config is nil")
+	} else if db == nil {
+		return nil, errors.New("cannot search; db is nil")
+	} else if strings.TrimSpace(config.SearchQuery) == "" {
+		return nil, errors.New("search query cannot be empty")
+	}
+
+	var (
+		opt     = searchOptions{limit: podutils.Tern(config.SearchLimit == 0, defaultSearchLimit, config.SearchLimit)}
+		feedMap = make(map[uint]*Feed, len(feedlist))
+		err     error
+	)
+	if opt.after, err = parseSearchDate(config.SearchAfter); err != nil {
+		return nil, fmt.Errorf("search after not recognized: %w", err)
+	} else if opt.before, err = parseSearchDate(config.SearchBefore); err != nil {
+		return nil, fmt.Errorf("search before not recognized: %w", err)
+	}
+
+	for _, f := range feedlist {
+		if err := f.LoadDBFeed(loadOptions{dontCreate: true}); err != nil {
+			var errDeleted *ErrorFeedDeleted
+			if errors.Is(err, gorm.ErrRecordNotFound) || errors.As(err, &errDeleted) {
+				// nothing to search
+				continue
+			}
+			return nil, err
+		}
+		feedMap[f.ID] = f
+		opt.feedIds = append(opt.feedIds, f.ID)
+	}
+	if len(feedMap) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	// episodes only in archive dbs are searched as well
+	catalog, err := openFeedCatalog(feedlist...)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening archive catalog: %w", err)
+	}
+	defer catalog.Close()
+
+	list, err := catalog.searchItems(config.SearchQuery, opt)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	var ret = make([]SearchResult, 0, len(list))
+	for _, r := range list {
+		var sr = SearchResult{
+			Shortname: r.Shortname,
+			Title:     r.Title,
+			PubDate:   r.PubTimeStamp,
+		}
+		sr.highlighted = cleanSnippet(r.Snippet)
+		sr.Snippet = stripMarkers.Replace(sr.highlighted)
+		if f, exists := feedMap[r.FeedId]; exists {
+			sr.Shortname = f.Shortname
+			if r.Archived {
+				sr.Path = filepath.Join(f.itemArchivePath(r.ArchiveDir, r.PubTimeStamp), r.Filename)
+			} else if r.Downloaded {
+				sr.Path = filepath.Join(f.mp3Path, r.Filename)
+			}
+		}
+		ret = append(ret, sr)
+	}
+
+	return ret, nil
+}
+
+// --------------------------------------------------------------------------
+// outputs search results, in the format from the commandline; matches are highlighted in table output
+func WriteSearch(w io.Writer, results []SearchResult) error {
+
+	var rpt = report{
+		headers: []string{"feed", "episode", "date", "path", "match"},
+		rows:    make([][]string, 0, len(results)),
+		records: make([][]string, 0, len(results)),
+		data:    results,
+	}
+
+	for _, sr := range results {
+		var date = podutils.Tern(sr.PubDate.IsZero(), "", sr.PubDate.Local().Format("2006-01-02"))
+		rpt.rows = append(rpt.rows, []string{sr.Shortname, sr.Title, date, sr.Path, highlightSnippet(sr.highlighted)})
+		rpt.records = append(rpt.records, []string{sr.Shortname, sr.Title, date, sr.Path, sr.Snippet})
+	}
+
+	return rpt.write(w, config.OutputFormat)
+}
+
+// --------------------------------------------------------------------------
+func parseSearchDate(str string) (time.Time, error) {
+	if str == "" {
+		return time.Time{}, nil
+	}
+	return dateparse.ParseLocal(str)
+}
+
+// --------------------------------------------------------------------------
+// removes html (including tags cut off by the snippet) and collapses whitespace
+func cleanSnippet(snippet string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTagRegex.ReplaceAllString(snippet, " "))), " ")
+}
+
+// --------------------------------------------------------------------------
+func highlightSnippet(snippet string) string {
+	var sb strings.Builder
+	for {
+		start := strings.Index(snippet, snippetStart)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(snippet[start:], snippetEnd)
+		if end < 0 {
+			break
+		}
+		end += start
+		sb.WriteString(snippet[:start])
+		sb.WriteString(matchStyle.Render(snippet[start+len(snippetStart) : end]))
+		snippet = snippet[end+len(snippetEnd):]
+	}
+	sb.WriteString(snippet)
+	return sb.String()
+}
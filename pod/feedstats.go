@@ -0,0 +1,317 @@
+package pod
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"gopod/podutils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// number of gaps shown in the library wide longest gaps
+	statsGapCount = 10
+	// feed is considered stopped if nothing is published in the longer of these; min time or
+	// multiple of its usual interval
+	statsStoppedMin        = 90 * 24 * time.Hour
+	statsStoppedMultiplier = 3
+
+	statsMonthLayout = "2006-01"
+	statsDateLayout  = "2006-01-02"
+	statsNoValue     = "-"
+)
+
+type LibraryStats struct {
+	Feeds            []FeedStats
+	DownloadsByMonth []MonthStats
+	LongestGaps      []EpisodeGap
+}
+
+type FeedStats struct {
+	Shortname          string
+	Episodes           int
+	Downloaded         int // includes archived
+	DownloadedBytes    uint64
+	AvgDurationSecs    int
+	AvgSizeBytes       uint64
+	FirstEpisode       time.Time
+	LastEpisode        time.Time
+	MedianIntervalDays float64
+	Stopped            bool
+	LongestGap         *EpisodeGap
+}
+
+type MonthStats struct {
+	Month     string
+	Downloads int
+	Bytes     uint64
+}
+
+type EpisodeGap struct {
+	Shortname string
+	From      time.Time
+	To        time.Time
+	Days      float64
+}
+
+// --------------------------------------------------------------------------
+// aggregate stats over all items of the feeds in the list, including items only found in the
+// per year archive dbs
+func Stats(feedlist []*Feed) (*LibraryStats, error) {
+
+	if config == nil {
+		return nil, errors.New("cannot get stats; config is nil")
+	} else if db == nil {
+		return nil, errors.New("cannot get stats; db is nil")
+	}
+
+	var (
+		ret = LibraryStats{
+			Feeds:            make([]FeedStats, 0, len(feedlist)),
+			DownloadsByMonth: make([]MonthStats, 0),
+			LongestGaps:      make([]EpisodeGap, 0),
+		}
+		monthMap = make(map[string]*MonthStats)
+		now      = time.Now()
+		reterr   error
+	)
+
+	for _, f := range feedlist {
+		var errDeleted *ErrorFeedDeleted
+
+		itemlist, err := f.loadStatsItems()
+		if errors.As(err, &errDeleted) {
+			f.log.Debug("feed is deleted; skipping stats")
+			continue
+		} else if err != nil {
+			reterr = errors.Join(reterr, fmt.Errorf("'%v': %w", f.Shortname, err))
+			continue
+		}
+
+		fs, gaps := genFeedStats(f.Shortname, itemlist, now)
+		ret.Feeds = append(ret.Feeds, fs)
+		ret.LongestGaps = append(ret.LongestGaps, gaps...)
+
+		for _, item := range itemlist {
+			if item.Downloaded || item.Archived {
+				var month = itemDownloadTime(item).Local().Format(statsMonthLayout)
+				ms, exists := monthMap[month]
+				if exists == false {
+					ms = &MonthStats{Month: month}
+					monthMap[month] = ms
+				}
+				ms.Downloads++
+				ms.Bytes += itemSize(item)
+			}
+		}
+	}
+
+	for _, ms := range monthMap {
+		ret.DownloadsByMonth = append(ret.DownloadsByMonth, *ms)
+	}
+	slices.SortFunc(ret.DownloadsByMonth, func(l, r MonthStats) int { return cmp.Compare(l.Month, r.Month) })
+
+	// longest first
+	slices.SortStableFunc(ret.LongestGaps, func(l, r EpisodeGap) int { return cmp.Compare(r.Days, l.Days) })
+	ret.LongestGaps = ret.LongestGaps[:min(len(ret.LongestGaps), statsGapCount)]
+
+	return &ret, reterr
+}
+
+// --------------------------------------------------------------------------
+// loads items (with xml) from the main db and the feed's archive dbs
+func (f *Feed) loadStatsItems() ([]*ItemDBEntry, error) {
+
+	var opt = loadOptions{dontCreate: true, includeXml: true, direction: cASC}
+
+	// hash is needed to find the feed; it may only exist in archives
+	f.generateHash()
+	if _, err := db.isFeedDeleted(f.Hash); err != nil {
+		return nil, err
+	}
+
+	catalog, err := openFeedCatalog(f)
+	if err != nil {
+		return nil, err
+	}
+	defer catalog.Close()
+
+	var entry = FeedDBEntry{Hash: f.Hash}
+	if err := catalog.loadFeed(&entry, opt); errors.Is(err, gorm.ErrRecordNotFound) {
+		return make([]*ItemDBEntry, 0), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return catalog.loadFeedItems(entry.ID, AllItems, opt)
+}
+
+// --------------------------------------------------------------------------
+// when the item was downloaded; for items downloaded before that was kept, when the item was added
+// to the db is the closest to it
+func itemDownloadTime(item *ItemDBEntry) time.Time {
+	if item.DownloadedAt.IsZero() {
+		return item.CreatedAt
+	}
+	return item.DownloadedAt
+}
+
+// --------------------------------------------------------------------------
+// returns stats for the feed, and the gaps between consecutive episodes
+func genFeedStats(shortname string, itemlist []*ItemDBEntry, now time.Time) (FeedStats, []EpisodeGap) {
+
+	var (
+		fs = FeedStats{Shortname: shortname, Episodes: len(itemlist)}
+
+		totalDuration time.Duration
+		durationCount int
+		totalSize     uint64
+		sizeCount     int
+		pubDates      = make([]time.Time, 0, len(itemlist))
+	)
+
+	for _, item := range itemlist {
+		if item.Downloaded || item.Archived {
+			fs.Downloaded++
+			fs.DownloadedBytes += itemSize(item)
+		}
+		if size := itemSize(item); size > 0 {
+			totalSize += size
+			sizeCount++
+		}
+		if item.XmlData != nil && item.XmlData.DurationStr != "" {
+			if dur, err := podutils.ParseDuration(item.XmlData.DurationStr); err == nil && dur > 0 {
+				totalDuration += dur
+				durationCount++
+			}
+		}
+		if item.PubTimeStamp.IsZero() == false {
+			pubDates = append(pubDates, item.PubTimeStamp)
+		}
+	}
+
+	if durationCount > 0 {
+		fs.AvgDurationSecs = int((totalDuration / time.Duration(durationCount)).Seconds())
+	}
+	if sizeCount > 0 {
+		fs.AvgSizeBytes = totalSize / uint64(sizeCount)
+	}
+	if len(pubDates) == 0 {
+		return fs, nil
+	}
+
+	slices.SortFunc(pubDates, func(l, r time.Time) int { return l.Compare(r) })
+	fs.FirstEpisode, fs.LastEpisode = pubDates[0], pubDates[len(pubDates)-1]
+
+	if len(pubDates) < 2 {
+		// no intervals
+		return fs, nil
+	}
+
+	var (
+		gaps      = make([]EpisodeGap, 0, len(pubDates)-1)
+		intervals = make([]time.Duration, 0, len(pubDates)-1)
+	)
+	for idx := 1; idx < len(pubDates); idx++ {
+		var interval = pubDates[idx].Sub(pubDates[idx-1])
+		intervals = append(intervals, interval)
+		gaps = append(gaps, EpisodeGap{
+			Shortname: shortname,
+			From:      pubDates[idx-1],
+			To:        pubDates[idx],
+			Days:      interval.Hours() / 24,
+		})
+	}
+
+	slices.Sort(intervals)
+	var median = intervals[len(intervals)/2]
+	if len(intervals)%2 == 0 {
+		median = (intervals[len(intervals)/2-1] + median) / 2
+	}
+	fs.MedianIntervalDays = median.Hours() / 24
+	fs.Stopped = now.Sub(fs.LastEpisode) > max(statsStoppedMin, median*statsStoppedMultiplier)
+
+	// longest gap for the feed; all gaps returned for library wide comparison
+	var longest = slices.MaxFunc(gaps, func(l, r EpisodeGap) int { return cmp.Compare(l.Days, r.Days) })
+	fs.LongestGap = &longest
+
+	return fs, gaps
+}
+
+// --------------------------------------------------------------------------
+func itemSize(item *ItemDBEntry) uint64 {
+	if item.XmlData == nil {
+		return 0
+	}
+	return uint64(item.XmlData.Enclosure.Length)
+}
+
+// --------------------------------------------------------------------------
+// outputs stats, in the format from the commandline
+func WriteStats(w io.Writer, stats *LibraryStats) error {
+
+	var (
+		feedRpt = report{
+			title: "Feeds",
+			headers: []string{"feed", "episodes", "downloaded", "downloaded size", "avg length",
+				"avg size", "first", "last", "cadence (days)", "longest gap (days)", "status"},
+		}
+		monthRpt = report{
+			title:   "Downloads per month",
+			headers: []string{"month", "downloads", "size"},
+		}
+		gapRpt = report{
+			title:   "Longest gaps between episodes",
+			headers: []string{"feed", "from", "to", "days"},
+		}
+		fmtDate = func(t time.Time) string {
+			return podutils.Tern(t.IsZero(), statsNoValue, t.Local().Format(statsDateLayout))
+		}
+		fmtDays = func(days float64) string { return strconv.FormatFloat(days, 'f', 1, 64) }
+	)
+
+	for _, fs := range stats.Feeds {
+		var (
+			length     = statsNoValue
+			cadence    = statsNoValue
+			gap        = statsNoValue
+			status     = podutils.Tern(fs.Stopped, "stopped", "active")
+			avgSize    = podutils.Tern(fs.AvgSizeBytes == 0, statsNoValue, podutils.FormatBytes(fs.AvgSizeBytes))
+			rawGap     string
+			rawCadence string
+		)
+		if fs.AvgDurationSecs > 0 {
+			length = (time.Duration(fs.AvgDurationSecs) * time.Second).String()
+		}
+		if fs.LongestGap != nil {
+			cadence, rawCadence = fmtDays(fs.MedianIntervalDays), fmtDays(fs.MedianIntervalDays)
+			gap, rawGap = fmtDays(fs.LongestGap.Days), fmtDays(fs.LongestGap.Days)
+		}
+		if fs.Episodes == 0 {
+			status = statsNoValue
+		}
+
+		feedRpt.rows = append(feedRpt.rows, []string{fs.Shortname, strconv.Itoa(fs.Episodes), strconv.Itoa(fs.Downloaded),
+			podutils.FormatBytes(fs.DownloadedBytes), length, avgSize, fmtDate(fs.FirstEpisode), fmtDate(fs.LastEpisode),
+			cadence, gap, status})
+		feedRpt.records = append(feedRpt.records, []string{fs.Shortname, strconv.Itoa(fs.Episodes), strconv.Itoa(fs.Downloaded),
+			strconv.FormatUint(fs.DownloadedBytes, 10), strconv.Itoa(fs.AvgDurationSecs), strconv.FormatUint(fs.AvgSizeBytes, 10),
+			podutils.Tern(fs.FirstEpisode.IsZero(), "", fs.FirstEpisode.Format(time.RFC3339)),
+			podutils.Tern(fs.LastEpisode.IsZero(), "", fs.LastEpisode.Format(time.RFC3339)),
+			rawCadence, rawGap, podutils.Tern(fs.Episodes == 0, "", status)})
+	}
+
+	for _, ms := range stats.DownloadsByMonth {
+		monthRpt.rows = append(monthRpt.rows, []string{ms.Month, strconv.Itoa(ms.Downloads), podutils.FormatBytes(ms.Bytes)})
+	}
+	for _, eg := range stats.LongestGaps {
+		gapRpt.rows = append(gapRpt.rows, []string{eg.Shortname, fmtDate(eg.From), fmtDate(eg.To), fmtDays(eg.Days)})
+	}
+
+	return writeReports(w, config.OutputFormat, stats, feedRpt, monthRpt, gapRpt)
+}
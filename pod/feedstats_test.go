@@ -0,0 +1,72 @@
+package pod
+
+import (
+	"gopod/testutils"
+	"testing"
+	"time"
+)
+
+func Test_genFeedStats(t *testing.T) {
+
+	var (
+		now  = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		day  = func(d int) time.Time { return now.AddDate(0, 0, d) }
+		item = func(pub time.Time, downloaded bool, length uint, duration string) *ItemDBEntry {
+			var i = ItemDBEntry{ItemData: ItemData{PubTimeStamp: pub, Downloaded: downloaded},
+				XmlData: &ItemXmlDBEntry{}}
+			i.XmlData.Enclosure.Length = length
+			i.XmlData.DurationStr = duration
+			return &i
+		}
+	)
+
+	type exp struct {
+		stats   FeedStats
+		numGaps int
+	}
+	tests := []struct {
+		name  string
+		items []*ItemDBEntry
+		e     exp
+	}{
+		{"no items", nil, exp{stats: FeedStats{Shortname: "foo"}}},
+		{"single item", []*ItemDBEntry{item(day(-1), true, 100, "1:00")},
+			exp{stats: FeedStats{Shortname: "foo", Episodes: 1, Downloaded: 1, DownloadedBytes: 100,
+				AvgDurationSecs: 60, AvgSizeBytes: 100, FirstEpisode: day(-1), LastEpisode: day(-1)}}},
+		{"weekly, active", []*ItemDBEntry{
+			// out of order on purpose; bad duration & missing length ignored in averages
+			item(day(-7), false, 300, "foobar"),
+			item(day(-21), true, 100, "1:00:00"),
+			item(day(-14), true, 0, "30:00"),
+			item(day(-1), false, 200, ""),
+		}, exp{stats: FeedStats{Shortname: "foo", Episodes: 4, Downloaded: 2, DownloadedBytes: 100,
+			AvgDurationSecs: 2700, AvgSizeBytes: 200, FirstEpisode: day(-21), LastEpisode: day(-1),
+			MedianIntervalDays: 7, LongestGap: &EpisodeGap{"foo", day(-21), day(-14), 7}},
+			numGaps: 3}},
+		{"stopped", []*ItemDBEntry{item(day(-200), false, 0, ""), item(day(-190), false, 0, ""),
+			item(day(-160), false, 0, "")},
+			exp{stats: FeedStats{Shortname: "foo", Episodes: 3, FirstEpisode: day(-200), LastEpisode: day(-160),
+				MedianIntervalDays: 20, Stopped: true, LongestGap: &EpisodeGap{"foo", day(-190), day(-160), 30}},
+				numGaps: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, gaps := genFeedStats("foo", tt.items, now)
+			testutils.AssertEquals(t, tt.e.stats, stats)
+			testutils.AssertEquals(t, tt.e.numGaps, len(gaps))
+		})
+	}
+}
+
+func Test_itemDownloadTime(t *testing.T) {
+	var (
+		added      = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		downloaded = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+		item       = ItemDBEntry{}
+	)
+	item.CreatedAt = added
+	// downloaded before the download time was kept
+	testutils.AssertEquals(t, added, itemDownloadTime(&item))
+	item.DownloadedAt = downloaded
+	testutils.AssertEquals(t, downloaded, itemDownloadTime(&item))
+}
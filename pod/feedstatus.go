@@ -0,0 +1,195 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gopod/podutils"
+
+	"gorm.io/gorm"
+)
+
+const statusErrorWidth = 40 // max length of error shown in table output
+
+type FeedStatus struct {
+	Shortname     string
+	Name          string
+	Url           string
+	InDB          bool
+	Deleted       bool // deleted in db, but still in config
+	EpisodeCount  int
+	Downloaded    int
+	NotDownloaded int
+	Archived      int
+	Removed       int // removed upstream; no longer in the feed xml
+	LastUpdated   time.Time
+	NewestPubDate time.Time
+	BytesOnDisk   uint64
+	LastError     string
+	LastChanged   time.Time    // when the feed xml last changed from the previous fetch
+	Changes       []FeedChange // changes found at last changed
+}
+
+// --------------------------------------------------------------------------
+// collects status for each feed in the list, from the db and the feed directory
+func Status(feedlist []*Feed) ([]FeedStatus, error) {
+
+	if config == nil {
+		return nil, errors.New("cannot get status; config is nil")
+	} else if db == nil {
+		return nil, errors.New("cannot get status; db is nil")
+	}
+
+	// episode counts include those only in archive dbs
+	catalog, err := openFeedCatalog(feedlist...)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening archive catalog: %w", err)
+	}
+	defer catalog.Close()
+
+	var (
+		ret    = make([]FeedStatus, 0, len(feedlist))
+		reterr error
+	)
+	for _, f := range feedlist {
+		if fs, err := f.status(catalog); err != nil {
+			reterr = errors.Join(reterr, fmt.Errorf("'%v': %w", f.Shortname, err))
+		} else {
+			ret = append(ret, *fs)
+		}
+	}
+
+	return ret, reterr
+}
+
+// --------------------------------------------------------------------------
+func (f *Feed) status(catalog *PodDB) (*FeedStatus, error) {
+
+	var fs = FeedStatus{
+		Shortname: f.Shortname,
+		Name:      f.Name,
+		Url:       f.Url,
+	}
+
+	if bytes, err := dirSize(f.mp3Path); err != nil {
+		return nil, fmt.Errorf("failed getting size on disk: %w", err)
+	} else {
+		fs.BytesOnDisk = bytes
+	}
+
+	// include deleted, so deleted feeds still in config are reported
+	var opt = loadOptions{dontCreate: true, includeDeleted: true}
+	if err := f.LoadDBFeed(opt); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// not updated yet; nothing more to report
+			return &fs, nil
+		}
+		return nil, err
+	}
+
+	fs.InDB = true
+	fs.Deleted = f.DeletedAt.Valid
+	fs.LastUpdated = f.LastUpdated
+	fs.LastError = f.LastError
+
+	if stats, err := catalog.loadFeedItemStats(f.ID); err != nil {
+		return nil, fmt.Errorf("failed loading item stats: %w", err)
+	} else {
+		fs.EpisodeCount = stats.Total
+		fs.Downloaded = stats.Downloaded
+		fs.NotDownloaded = stats.NotDownloaded
+		fs.Archived = stats.Archived
+		fs.Removed = stats.RemovedUpstream
+		fs.NewestPubDate = stats.NewestPubDate
+	}
+
+	if changes, err := db.loadLatestFeedChanges(f.ID); err != nil {
+		return nil, fmt.Errorf("failed loading feed changes: %w", err)
+	} else {
+		fs.Changes = make([]FeedChange, 0, len(changes))
+		for _, ch := range changes {
+			fs.LastChanged = ch.FetchedAt
+			fs.Changes = append(fs.Changes, ch.FeedChange)
+		}
+	}
+
+	return &fs, nil
+}
+
+// --------------------------------------------------------------------------
+// outputs status list, in the format from the commandline
+func WriteStatus(w io.Writer, statusList []FeedStatus) error {
+
+	var rpt = report{
+		headers: []string{"feed", "episodes", "downloaded", "not downloaded", "archived", "removed",
+			"last updated", "newest", "changed", "size", "status"},
+		rows:    make([][]string, 0, len(statusList)),
+		records: make([][]string, 0, len(statusList)),
+		data:    statusList,
+	}
+
+	var fmtTime = func(t time.Time, layout string) string {
+		return podutils.Tern(t.IsZero(), "", t.Local().Format(layout))
+	}
+
+	for _, fs := range statusList {
+		var state = fs.LastError
+		if fs.Deleted {
+			state = "deleted (still in config)"
+		} else if fs.InDB == false {
+			state = "not in db"
+		}
+
+		var (
+			counts = []string{strconv.Itoa(fs.EpisodeCount), strconv.Itoa(fs.Downloaded),
+				strconv.Itoa(fs.NotDownloaded), strconv.Itoa(fs.Archived), strconv.Itoa(fs.Removed)}
+			changed    = podutils.Tern(len(fs.Changes) > 0, fmt.Sprintf(" (%v)", len(fs.Changes)), "")
+			tableState = state
+		)
+		if r := []rune(tableState); len(r) > statusErrorWidth {
+			tableState = string(r[:statusErrorWidth-3]) + "..."
+		}
+
+		rpt.rows = append(rpt.rows, append(append([]string{fs.Shortname}, counts...),
+			fmtTime(fs.LastUpdated, "2006-01-02 15:04"),
+			fmtTime(fs.NewestPubDate, "2006-01-02"),
+			fmtTime(fs.LastChanged, "2006-01-02 15:04")+changed,
+			podutils.FormatBytes(fs.BytesOnDisk),
+			tableState))
+		rpt.records = append(rpt.records, append(append([]string{fs.Shortname}, counts...),
+			fmtTime(fs.LastUpdated, time.RFC3339),
+			fmtTime(fs.NewestPubDate, time.RFC3339),
+			fmtTime(fs.LastChanged, time.RFC3339),
+			strconv.FormatUint(fs.BytesOnDisk, 10),
+			state))
+	}
+
+	return rpt.write(w, config.OutputFormat)
+}
+
+// --------------------------------------------------------------------------
+// total size of all files under path; missing path is zero
+func dirSize(path string) (uint64, error) {
+	var total uint64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		} else if d.Type().IsRegular() {
+			if info, err := d.Info(); err != nil {
+				return err
+			} else {
+				total += uint64(info.Size())
+			}
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,327 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopod/podutils"
+
+	"gorm.io/gorm"
+)
+
+// --------------------------------------------------------------------------
+// moves archived items back to the download directory, along with their images, and removes them from
+// the archive dbs.  Restores every archived item, or those published in the year or the single item
+// from the commandline
+func Unarchive(f *Feed) error {
+	if config == nil {
+		return errors.New("cannot unarchive; config is nil")
+	} else if db == nil {
+		return errors.New("cannot unarchive; db is nil")
+	} else if config.UnarchiveYear != 0 && config.UnarchiveItem != "" {
+		return errors.New("cannot unarchive by both year and item")
+	}
+
+	var (
+		log     = f.log
+		options = loadOptions{
+			dontCreate:     true,
+			includeXml:     true,
+			includeDeleted: false,
+			direction:      cASC,
+		}
+		itemlist   []*Item
+		archiveMap = make(map[string]*archType, 0)
+		reterr     error
+	)
+
+	log.Info("running unarchive")
+
+	if err := f.LoadDBFeed(options); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("feed '%v' not found in database", f.Shortname)
+		}
+		return err
+	} else if il, err := f.loadDBFeedItems(AllItems, options); err != nil {
+		return fmt.Errorf("error loading items from db: %w", err)
+	} else {
+		itemlist = il
+	}
+
+	for _, item := range itemlist {
+		if item.Archived == false {
+			continue
+		} else if config.UnarchiveYear != 0 && item.PubTimeStamp.Year() != config.UnarchiveYear {
+			continue
+		} else if config.UnarchiveItem != "" && item.Hash != config.UnarchiveItem && item.Filename != config.UnarchiveItem {
+			continue
+		}
+
+		var path = f.itemArchivePath(item.ArchiveDir, item.PubTimeStamp)
+		arc, exists := archiveMap[path]
+		if exists == false {
+			var dir = filepath.Base(path)
+			arc = &archType{
+				feed:   f,
+				log:    f.log.With("dir", dir),
+				dir:    dir,
+				path:   path,
+				items:  make([]*Item, 0),
+				images: make(map[string]*ImageDBEntry, 0),
+			}
+			archiveMap[path] = arc
+		}
+		arc.items = append(arc.items, item)
+		if item.ImageKey != "" && item.ImageKey != f.ImageKey {
+			if img, exists := f.imageMap[item.ImageKey]; exists == false {
+				arc.log.Error("image with key doesn't exist in db", "key", item.ImageKey)
+			} else if img.Archived {
+				arc.images[item.ImageKey] = img
+			}
+		}
+	}
+
+	if len(archiveMap) == 0 {
+		if config.UnarchiveItem != "" {
+			return fmt.Errorf("archived item '%v' not found in feed '%v'", config.UnarchiveItem, f.Shortname)
+		}
+		log.Info("nothing found to unarchive")
+		return nil
+	}
+
+	for _, arc := range archiveMap {
+		if bundled, err := arc.bundledOnly(); err != nil {
+			reterr = errors.Join(reterr, err)
+			continue
+		} else if bundled != "" {
+			err := fmt.Errorf("archive '%v' only exists as bundle '%v'; extract it before unarchiving", arc.dir, filepath.Base(bundled))
+			log.Error(err)
+			reterr = errors.Join(reterr, err)
+			continue
+		}
+		log.Debug("unarchive step", "path", arc.path, "items", len(arc.items), "images", len(arc.images))
+		if err := arc.unarchiveDir(); err != nil {
+			reterr = errors.Join(reterr, err)
+		}
+	}
+
+	log.Info("unarchive complete")
+	return reterr
+}
+
+// --------------------------------------------------------------------------
+// moves the items and images back; whatever was moved is saved to the main db and removed from the
+// archive db, even if other items failed
+func (arc archType) unarchiveDir() error {
+	var (
+		reterr   error
+		restored = make([]*Item, 0, len(arc.items))
+		images   = make(map[string]*ImageDBEntry, len(arc.images))
+	)
+
+	if config.Simulate == false {
+		if err := podutils.MkdirAll(arc.feed.mp3Path); err != nil {
+			return fmt.Errorf("error creating download path: %w", err)
+		} else if len(arc.images) > 0 {
+			if err := podutils.MkdirAll(arc.feed.imgPath); err != nil {
+				return fmt.Errorf("error creating image path: %w", err)
+			}
+		}
+	}
+
+	for _, item := range arc.items {
+		if err := arc.unarchiveItem(item); err != nil {
+			arc.log.Error(err)
+			reterr = errors.Join(reterr, err)
+		} else {
+			restored = append(restored, item)
+		}
+	}
+
+	for key, img := range arc.images {
+		if err := arc.unarchiveImage(img); err != nil {
+			arc.log.Error(err)
+			reterr = errors.Join(reterr, err)
+		} else {
+			images[key] = img
+		}
+	}
+
+	if config.Simulate || len(restored) == 0 {
+		return reterr
+	}
+
+	// items and images together in the main db
+	err := db.WithTx(func(tx *PodDB) error {
+		if err := arc.feed.saveDBFeedItems(tx, restored...); err != nil {
+			return fmt.Errorf("error saving items: %w", err)
+		} else if len(images) > 0 {
+			if err := arc.feed.saveDBFeedImages(tx, images); err != nil {
+				return fmt.Errorf("error saving images: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		arc.log.Error(err)
+		return errors.Join(reterr, err)
+	}
+
+	if err := arc.removeFromArchiveDb(restored); err != nil {
+		arc.log.Error(err)
+		reterr = errors.Join(reterr, err)
+	}
+	return reterr
+}
+
+// --------------------------------------------------------------------------
+// bundle holding the archive, when the directory itself has been removed
+func (arc archType) bundledOnly() (string, error) {
+	if exists, err := podutils.FileExists(arc.path); err != nil || exists {
+		return "", err
+	}
+	for _, format := range bundleFormats {
+		var bundle = bundlePath(arc.path, format)
+		if exists, err := podutils.FileExists(bundle); err != nil {
+			return "", err
+		} else if exists {
+			return bundle, nil
+		}
+	}
+	return "", nil
+}
+
+// --------------------------------------------------------------------------
+func (arc archType) unarchiveItem(item *Item) error {
+	var (
+		log = arc.log
+		src = filepath.Join(arc.path, item.Filename)
+		dst = filepath.Join(arc.feed.mp3Path, item.Filename)
+	)
+
+	if config.Simulate {
+		log.Infof("not unarchiving due to simulate flag '%v'", item.Filename)
+		return nil
+	} else {
+		log.Infof("unarchiving '%v'", item.Filename)
+	}
+
+	srcExists, err := podutils.FileExists(src)
+	if err != nil {
+		return err
+	}
+	dstExists, err := podutils.FileExists(dst)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case srcExists && dstExists:
+		return fmt.Errorf("cannot unarchive '%v'; file already exists in download directory", item.Filename)
+	case srcExists:
+		if err := podutils.Rename(src, dst); err != nil {
+			return fmt.Errorf("error moving file: %w", err)
+		}
+	case dstExists:
+		log.Infof("'%v' already in download directory", item.Filename)
+	default:
+		// nothing to move back; update downloads it again
+		log.Warnf("'%v' missing from archive; marking as not downloaded", item.Filename)
+		item.Downloaded = false
+	}
+
+	item.Archived = false
+	item.ArchiveDir = ""
+	item.ArchiveRun = ""
+	return nil
+}
+
+// --------------------------------------------------------------------------
+func (arc archType) unarchiveImage(img *ImageDBEntry) error {
+	var (
+		log = arc.log
+		dst = filepath.Join(arc.feed.imgPath, img.Filename)
+	)
+
+	if config.Simulate {
+		log.Infof("not unarchiving due to simulate flag '%v'", img.Filename)
+		return nil
+	} else {
+		log.Infof("unarchiving '%v'", img.Filename)
+	}
+
+	if exists, err := podutils.FileExists(dst); err != nil {
+		return err
+	} else if exists {
+		img.Archived = false
+		return nil
+	}
+
+	// shared images are archived with the first directory they were needed in
+	var candidates = []string{filepath.Join(arc.path, ".img", img.Filename)}
+	if matches, err := filepath.Glob(filepath.Join(arc.feed.archivePath, "*", ".img", img.Filename)); err == nil {
+		candidates = append(candidates, matches...)
+	}
+	for _, src := range candidates {
+		if exists, err := podutils.FileExists(src); err != nil {
+			return err
+		} else if exists {
+			if err := podutils.Rename(src, dst); err != nil {
+				return fmt.Errorf("error moving image: %w", err)
+			}
+			img.Archived = false
+			return nil
+		}
+	}
+
+	log.Warn("archived image not found; clearing archived flag", "imgFilename", img.Filename)
+	img.Archived = false
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// removes restored items from the archive db; the db (and the archive directory, if nothing else is
+// in it) is removed once there are no items left
+func (arc archType) removeFromArchiveDb(items []*Item) error {
+	var dbfile = arc.dbPath()
+
+	if exists, err := podutils.FileExists(dbfile); err != nil {
+		return err
+	} else if exists == false {
+		arc.log.Warn("archive db not found", "db", dbfile)
+		return nil
+	}
+
+	var hashes = make([]string, 0, len(items))
+	for _, item := range items {
+		hashes = append(hashes, item.Hash)
+	}
+
+	dbarc, err := NewDB(dbfile)
+	if err != nil {
+		return err
+	}
+	remaining, err := dbarc.removeArchivedItems(hashes)
+	// closing checkpoints the wal, leaving a single db file in the archive
+	dbarc.Close()
+	if err != nil {
+		return fmt.Errorf("error updating archive db: %w", err)
+	}
+
+	if remaining > 0 {
+		arc.log.Infof("archive db updated; %v items remaining", remaining)
+		return nil
+	}
+
+	arc.log.Info("archive empty; removing archive db")
+	if err := os.Remove(dbfile); err != nil {
+		return fmt.Errorf("error removing archive db: %w", err)
+	}
+	// only removed if empty
+	for _, dir := range []string{filepath.Join(arc.path, ".db"), filepath.Join(arc.path, ".img"), arc.path} {
+		os.Remove(dir)
+	}
+	return nil
+}
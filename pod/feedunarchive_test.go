@@ -0,0 +1,124 @@
+package pod
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopod/podconfig"
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+func TestUnarchive(t *testing.T) {
+
+	var (
+		dir       = t.TempDir()
+		oldConfig = config
+		oldDB     = db
+		date      = func(year int) time.Time { return time.Date(year, 4, 1, 0, 0, 0, 0, time.UTC) }
+	)
+	defer func() {
+		db.Close()
+		config, db = oldConfig, oldDB
+	}()
+
+	config = &podconfig.Config{WorkspaceDir: dir, TimestampStr: "test"}
+	if pdb, err := NewDB(DBPath(dir)); err != nil {
+		t.Fatalf("error creating db: %v", err)
+	} else {
+		db = pdb
+	}
+
+	// feed as loaded by a command
+	var loadFeed = func() *Feed {
+		f, err := NewFeed(podconfig.FeedToml{Name: "foo cast", Shortname: "foo", Url: "https://foo.bar/foo"})
+		if err != nil {
+			t.Fatalf("error creating feed: %v", err)
+		} else if err := f.LoadDBFeed(loadOptions{}); err != nil {
+			t.Fatalf("error loading feed: %v", err)
+		}
+		return f
+	}
+	var f = loadFeed()
+	f.XmlFeedData = &FeedXmlDBEntry{}
+	testutils.AssertErr(t, false, db.saveFeed(&f.FeedDBEntry))
+
+	// downloaded items, two in 2020 sharing an image
+	var writeFile = func(path, name string) {
+		testutils.AssertErr(t, false, os.MkdirAll(path, 0755))
+		testutils.AssertErr(t, false, os.WriteFile(filepath.Join(path, name), []byte("0123456789"), 0644))
+	}
+	var img = &ImageDBEntry{FeedId: f.ID, Url: "https://foo.bar/img.jpg", Filename: "img.jpg"}
+	testutils.AssertErr(t, false, db.saveImages(img))
+	writeFile(f.imgPath, img.Filename)
+
+	var list = make([]*ItemDBEntry, 0)
+	for _, ti := range []struct {
+		name  string
+		year  int
+		image bool
+	}{{"ep1", 2020, true}, {"ep2", 2020, true}, {"ep3", 2021, false}, {"ep4", time.Now().Year(), false}} {
+		var item = generateItem(f.ID, true)
+		item.Filename, item.PubTimeStamp, item.Downloaded = ti.name+".mp3", date(ti.year), true
+		if ti.image {
+			item.ImageKey = img.Url
+		}
+		list = append(list, &item)
+		writeFile(f.mp3Path, item.Filename)
+	}
+	testutils.AssertErr(t, false, db.saveItems(list...))
+
+	var (
+		arc2020 = f.archiveYearPath(2020)
+		arc2021 = f.archiveYearPath(2021)
+		exists  = func(path string) bool {
+			e, _ := podutils.FileExists(path)
+			return e
+		}
+		archived = func() map[string]bool {
+			var ret = make(map[string]bool)
+			items, err := db.loadFeedItems(f.ID, AllItems, loadOptions{})
+			testutils.AssertErr(t, false, err)
+			for _, i := range items {
+				ret[i.Filename] = i.Archived
+			}
+			return ret
+		}
+	)
+
+	testutils.AssertErr(t, false, Archive(loadFeed()))
+	testutils.Assert(t, exists(filepath.Join(arc2020, "ep1.mp3")), "ep1 not archived")
+	testutils.Assert(t, exists(filepath.Join(arc2020, ".img", img.Filename)), "image not archived")
+	testutils.AssertEquals(t, map[string]bool{"ep1.mp3": true, "ep2.mp3": true, "ep3.mp3": true, "ep4.mp3": false}, archived())
+
+	// both at once not allowed
+	config.UnarchiveYear, config.UnarchiveItem = 2020, "ep3.mp3"
+	testutils.AssertErrContains(t, "cannot unarchive by both", Unarchive(loadFeed()))
+
+	// simulate changes nothing
+	config.UnarchiveItem, config.Simulate = "", true
+	testutils.AssertErr(t, false, Unarchive(loadFeed()))
+	testutils.Assert(t, exists(filepath.Join(arc2020, "ep1.mp3")), "simulate moved file")
+	config.Simulate = false
+
+	// single year; files, image and flags restored, archive db removed
+	testutils.AssertErr(t, false, Unarchive(loadFeed()))
+	for _, name := range []string{"ep1.mp3", "ep2.mp3"} {
+		testutils.Assert(t, exists(filepath.Join(f.mp3Path, name)), name+" not restored")
+	}
+	testutils.Assert(t, exists(filepath.Join(f.imgPath, img.Filename)), "image not restored")
+	testutils.Assert(t, exists(arc2020) == false, "empty archive dir not removed")
+	testutils.AssertEquals(t, map[string]bool{"ep1.mp3": false, "ep2.mp3": false, "ep3.mp3": true, "ep4.mp3": false}, archived())
+	testutils.AssertEquals(t, false, loadFeed().imageMap[img.Url].Archived)
+
+	// single item, by filename
+	config.UnarchiveYear, config.UnarchiveItem = 0, "ep3.mp3"
+	testutils.AssertErr(t, false, Unarchive(loadFeed()))
+	testutils.Assert(t, exists(filepath.Join(f.mp3Path, "ep3.mp3")), "ep3 not restored")
+	testutils.Assert(t, exists(arc2021) == false, "empty archive dir not removed")
+
+	config.UnarchiveItem = "ep3.mp3"
+	testutils.AssertErrContains(t, "archived item 'ep3.mp3' not found", Unarchive(loadFeed()))
+}
@@ -9,6 +9,7 @@ import (
 	"slices"
 	"time"
 
+	"gopod/commandline"
 	log "gopod/multilogger"
 	"gopod/podutils"
 
@@ -19,9 +20,12 @@ import (
 type DownloadResults struct {
 	currentLogger        log.Logger
 	Results              map[string][]string
+	Changes              map[string][]FeedChange // feed changes from the previous fetch, by shortname
 	TotalDownloaded      uint
 	TotalDownloadedBytes uint64
 	Errors               []error
+
+	source string // recorded in run history
 }
 
 func (dr *DownloadResults) addError(errs ...error) {
@@ -39,7 +43,12 @@ type feedUpdate struct {
 	feed       *Feed
 	newItems   []*Item
 	newXmlData *podutils.XChannelData
-	numDups    uint // number of dupiclates counted before skipping remaining items in xmlparse
+	completed  []*Item // downloaded, saved at the end of the update
+	modified   []*Item // already downloaded, with new xml revision or removed upstream changed; saved with new items
+	numDups    uint    // number of dupiclates counted before skipping remaining items in xmlparse
+
+	seen    []feedItemSnapshot // every item in the new feed xml, in feed order
+	changes []FeedChange       // from the previous fetch
 
 	hashCollList  map[string]*Item
 	fileCollList  map[string]*Item
@@ -48,12 +57,19 @@ type feedUpdate struct {
 }
 
 func UpdateFeeds(feeds ...*Feed) DownloadResults {
+	return updateFeeds(runSourceCli, feeds...)
+}
+
+// --------------------------------------------------------------------------
+func updateFeeds(source string, feeds ...*Feed) DownloadResults {
 
 	var dlRes = DownloadResults{
 		Results:              make(map[string][]string, len(feeds)),
+		Changes:              make(map[string][]FeedChange),
 		TotalDownloaded:      0,
 		TotalDownloadedBytes: 0,
 		Errors:               make([]error, 0),
+		source:               source,
 	}
 
 	for _, feed := range feeds {
@@ -74,6 +90,37 @@ func (f *Feed) update(results *DownloadResults) {
 	)
 	results.currentLogger = f.log
 
+	// record the outcome of this update for status and run history, using the errors and
+	// downloads added during this feed
+	var (
+		errStart   = len(results.Errors)
+		dlStart    = results.TotalDownloaded
+		bytesStart = results.TotalDownloadedBytes
+		run        = RunDBEntry{Command: commandline.Update.String(), Source: results.source, StartedAt: time.Now()}
+	)
+	defer func() {
+		var errs = results.Errors[errStart:]
+		run.Downloaded = int(results.TotalDownloaded - dlStart)
+		run.DownloadedBytes = results.TotalDownloadedBytes - bytesStart
+		run.Changes = len(fUpdate.changes)
+
+		// downloaded items (and their images), status and run history are committed together
+		err := db.WithTx(func(tx *PodDB) error {
+			if len(fUpdate.completed) > 0 {
+				if err := f.saveDBFeed(tx, nil, fUpdate.completed); err != nil {
+					return fmt.Errorf("failed saving downloaded items: %w", err)
+				}
+			}
+			if err := f.saveUpdateStatus(tx, errs); err != nil {
+				return fmt.Errorf("failed saving update status: %w", err)
+			}
+			return f.saveRun(tx, run, errs)
+		})
+		if err != nil {
+			f.log.Errorf("failed saving update: %v", err)
+		}
+	}()
+
 	// load feed and items
 	if itemlist, err := fUpdate.loadDB(); err != nil {
 		results.addError(fmt.Errorf("failed loading db: %w", err))
@@ -104,11 +151,20 @@ func (f *Feed) update(results *DownloadResults) {
 		f.log.Warnf("error processing image, continuing with feed processing: '%v'", err)
 	}
 
-	// before download save feed & items.. downloads will update saved feeds
-	if err := f.saveDBFeed(fUpdate.newXmlData, fUpdate.newItems); err != nil {
+	// before download save feed, items & changes.. downloads will update saved feeds
+	err := db.WithTx(func(tx *PodDB) error {
+		if err := f.saveDBFeed(tx, fUpdate.newXmlData, slices.Concat(fUpdate.newItems, fUpdate.modified)); err != nil {
+			return err
+		}
+		return f.saveChanges(tx, fUpdate.changes)
+	})
+	if err != nil {
 		results.addError(fmt.Errorf("saving db failed: %v", err))
 		return
 	}
+	if len(fUpdate.changes) > 0 {
+		results.Changes[f.Shortname] = fUpdate.changes
+	}
 
 	// process new entries
 	if success := fUpdate.downloadNewItems(results); success == false {
@@ -118,6 +174,48 @@ func (f *Feed) update(results *DownloadResults) {
 	f.log.Debugf("done processing feed")
 }
 
+// --------------------------------------------------------------------------
+// saves last updated (on success) and last error for the feed
+func (f *Feed) saveUpdateStatus(pdb *PodDB, errs []error) error {
+	if f.ID == 0 {
+		// feed never loaded; nothing to save against
+		return nil
+	} else if config.Simulate {
+		f.log.Debug("skipping saving update status due to sim flag")
+		return nil
+	}
+
+	if len(errs) == 0 {
+		f.LastUpdated = time.Now()
+		f.LastError = ""
+	} else {
+		f.LastError = errors.Join(errs...).Error()
+	}
+	return pdb.saveFeedStatus(&f.FeedDBEntry)
+}
+
+// --------------------------------------------------------------------------
+// adds the run to run history, with any errors encountered
+func (f *Feed) saveRun(pdb *PodDB, run RunDBEntry, errs []error) error {
+	if f.ID == 0 {
+		return nil
+	} else if config.Simulate {
+		f.log.Debug("skipping saving run history due to sim flag")
+		return nil
+	}
+
+	run.FeedId = f.ID
+	run.Shortname = f.Shortname
+	run.FinishedAt = time.Now()
+	if len(errs) > 0 {
+		run.Error = errors.Join(errs...).Error()
+	}
+	if err := pdb.saveRun(&run); err != nil {
+		return fmt.Errorf("failed saving run history: %w", err)
+	}
+	return nil
+}
+
 // --------------------------------------------------------------------------
 func (fup *feedUpdate) loadDB() ([]*Item, error) {
 	var (
@@ -240,6 +338,7 @@ func (fup *feedUpdate) loadNewFeed() error {
 	if err := fup.processNewItems(itemPairList); err != nil {
 		return err
 	}
+	fup.trackChanges()
 
 	return nil
 }
@@ -327,6 +426,10 @@ func (fup *feedUpdate) checkExistingHash(hash string, xmldata *podutils.XItemDat
 		if itemEntry.Downloaded == false {
 			fup.newItems = append(fup.newItems, itemEntry)
 			fup.feed.log.Infof("checkHash: item modified: %+v", itemEntry)
+		} else if itemEntry.XmlData.ID == 0 {
+			// not downloading again, but the new xml revision still needs saving
+			fup.addModified(itemEntry)
+			fup.feed.log.Infof("checkHash: item xml revised: %+v", itemEntry)
 		}
 	}
 
@@ -606,7 +709,6 @@ func (fup *feedUpdate) downloadNewItems(results *DownloadResults) bool {
 		// by default; any errors will set this to false
 		success       = true
 		downloadAfter time.Time
-		completed     = make([]*Item, 0, len(fup.newItems))
 	)
 
 	if config.DownloadAfter != "" {
@@ -635,7 +737,7 @@ func (fup *feedUpdate) downloadNewItems(results *DownloadResults) bool {
 			log.Debugf("pubtimestamp before downloadAfter; skipping and marking as downloaded")
 			item.Downloaded = true
 			item.Archived = true
-			completed = append(completed, item)
+			fup.completed = append(fup.completed, item)
 			continue
 		}
 
@@ -651,6 +753,10 @@ func (fup *feedUpdate) downloadNewItems(results *DownloadResults) bool {
 			if fileExists == false {
 				if item.Archived == true {
 					log.Info("skipping download due to archived flag")
+					var arcfile = filepath.Join(f.itemArchivePath(item.ArchiveDir, item.PubTimeStamp), item.Filename)
+					if exists, err := podutils.FileExists(arcfile); err == nil && exists == false {
+						log.Warnf("archived file missing from '%v'; use unarchive to restore (or download again)", arcfile)
+					}
 					continue
 				} else {
 					log.Warn("downloading item; archive flag not set")
@@ -664,7 +770,7 @@ func (fup *feedUpdate) downloadNewItems(results *DownloadResults) bool {
 				log.Info("file exists, and set downloaded flag set.. marking as downloaded")
 
 				item.Downloaded = true
-				completed = append(completed, item)
+				fup.completed = append(fup.completed, item)
 
 			} else {
 				log.Warnf("item downloaded '%v', archived: '%v', fileExists: '%v'", item.Downloaded, item.Archived, fileExists)
@@ -696,7 +802,7 @@ func (fup *feedUpdate) downloadNewItems(results *DownloadResults) bool {
 					// continuing; not erroring on image download
 				}
 
-				completed = append(completed, item)
+				fup.completed = append(fup.completed, item)
 				bytes = uint64(b)
 			}
 		}
@@ -709,9 +815,7 @@ func (fup *feedUpdate) downloadNewItems(results *DownloadResults) bool {
 		log.Infof("finished downloading file: %v", podfile)
 	}
 
-	// save items and images
-	f.saveDBFeed(nil, completed)
-
+	// items and images are saved at the end of the update, see update()
 	log.Info("all new downloads completed")
 	return success
 }
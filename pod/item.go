@@ -53,14 +53,25 @@ type ItemData struct {
 	Url          string
 	Guid         string
 	Downloaded   bool
-	CDFilename   string // content-disposition filename
+	DownloadSize int64     // bytes written on download; zero if downloaded before this was kept
+	DownloadedAt time.Time // zero if downloaded before this was kept
+	CDFilename   string    // content-disposition filename
 	PubTimeStamp time.Time
 	Archived     bool
+	ArchiveDir   string // directory under the feed's archive path; empty for items archived by year before this was kept
+	ArchiveRun   string // timestamp of the run that first archived the item
 	EpNum        int
+	// no longer in the feed xml; cleared if it returns
+	RemovedUpstream bool
+	// set thru the serve api by players
+	Listened bool
 }
 
+// one revision of an item's xml; the item's XmlId references the current revision, previous
+// revisions are retained for history
 type ItemXmlDBEntry struct {
 	PodDBModel
+	ItemId             uint `gorm:"index"`
 	podutils.XItemData `gorm:"embedded"`
 }
 
@@ -260,11 +271,7 @@ func (i *Item) updateFromEntry(
 		return err
 	}
 
-	// todo: rather than change already existing xml entry, create a new one.. will require db changes
-	// moving relationship to one to many, requiring ItemXmlDBEntry to retain reference to ItemDBEntry
-	// and be potentially "orphaned"
-
-	i.XmlData.XItemData = *xml
+	i.setXmlRevision(xml)
 	i.PubTimeStamp = xml.Pubdate
 	// episode count should not change
 
@@ -429,7 +436,7 @@ func (i *Item) updateXmlData(hash string, data *podutils.XItemData) error {
 		return err
 	}
 
-	i.XmlData.XItemData = *data
+	i.setXmlRevision(data)
 
 	// if the url changes, this would be a new hash..
 	// if the guid changes it would be a new hash..
@@ -437,6 +444,20 @@ func (i *Item) updateXmlData(hash string, data *podutils.XItemData) error {
 	return nil
 }
 
+// --------------------------------------------------------------------------
+// if the xml differs from the current revision, a new revision is created (inserted on save) and
+// becomes the current; the previous revision is kept.  Returns whether a new revision was created
+func (i *Item) setXmlRevision(data *podutils.XItemData) bool {
+	if i.XmlData != nil && len(diffItemXml(&i.XmlData.XItemData, data)) == 0 {
+		return false
+	}
+	if i.XmlData != nil {
+		log.Debugf("item xml changed; creating new revision (previous xml id: %v)", i.XmlData.ID)
+	}
+	i.XmlData = &ItemXmlDBEntry{ItemId: i.ID, XItemData: *data}
+	return true
+}
+
 // --------------------------------------------------------------------------
 func (i Item) createProgressBar() *progressbar.ProgressBar {
 	bar := progressbar.NewOptions64(int64(i.XmlData.Enclosure.Length), // set the default length to amount in enclosure
@@ -513,7 +534,7 @@ func (i *Item) Download(mp3path string) (int64, error) {
 		i.log.Errorf("failed to change modified time: %v", err)
 		// don't skip due to timestamp issue
 	}
-	i.Downloaded = true
+	i.Downloaded, i.DownloadSize, i.DownloadedAt = true, bytesWrote, time.Now()
 
 	return bytesWrote, nil
 }
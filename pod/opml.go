@@ -0,0 +1,141 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	log "gopod/multilogger"
+	"gopod/podconfig"
+	"gopod/podutils"
+)
+
+const opmlExportFilename = "gopod.opml"
+
+// --------------------------------------------------------------------------
+// imports feed subscriptions from the opml file given on the commandline, appending any new feeds
+// to the config file.  Feeds with urls already in the config are skipped; shortnames are
+// generated from the outline title.  Returns the list of feeds added
+func ImportOpml(existing []podconfig.FeedToml) ([]podconfig.FeedToml, error) {
+
+	if config == nil {
+		return nil, errors.New("cannot import opml; config is nil")
+	} else if config.OpmlFile == "" {
+		return nil, errors.New("opml file cannot be empty")
+	}
+
+	buf, err := os.ReadFile(config.OpmlFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading opml file: %w", err)
+	}
+	doc, err := podutils.ParseOpml(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing opml file: %w", err)
+	}
+
+	var (
+		added = make([]podconfig.FeedToml, 0)
+		// includes feeds added during this import, so duplicates within the opml are caught
+		known = slices.Clone(existing)
+	)
+
+	for _, outline := range doc.FeedOutlines() {
+		var (
+			url = strings.TrimSpace(outline.XmlUrl)
+			lg  = log.With("url", url)
+		)
+
+		if idx := slices.IndexFunc(known, func(ft podconfig.FeedToml) bool { return ft.Url == url }); idx >= 0 {
+			lg.With("shortname", podutils.Tern(known[idx].Shortname != "", known[idx].Shortname, known[idx].Name)).
+				Info("feed already exists in config; skipping")
+			continue
+		}
+
+		var toml = podconfig.FeedToml{
+			Name: strings.TrimSpace(podutils.Tern(outline.Title != "", outline.Title, outline.Text)),
+			Url:  url,
+		}
+		if toml.Name == "" {
+			toml.Name = url
+		}
+		toml.Shortname = suggestShortname(toml.Name, known)
+
+		if err := podconfig.ValidateFeedToml(toml, known); err != nil {
+			lg.Warnf("cannot import feed: %v", err)
+			continue
+		}
+
+		lg.With("shortname", toml.Shortname).Infof("importing feed '%v'", toml.Name)
+		added = append(added, toml)
+		known = append(known, toml)
+	}
+
+	if len(added) == 0 {
+		log.Info("no new feeds found in opml; config not modified")
+		return added, nil
+	} else if err := podconfig.AppendFeedToml(config.ConfigFile, added...); err != nil {
+		return nil, fmt.Errorf("failed appending feeds to config: %w", err)
+	}
+
+	log.Infof("%v feeds added to config '%v'", len(added), config.ConfigFile)
+	return added, nil
+}
+
+// --------------------------------------------------------------------------
+// exports all feeds in the list to a single opml file, using the channel title and link
+// from the db where available
+func exportToOpml(feedlist []*Feed, file string) error {
+
+	var (
+		outlines = make([]podutils.OpmlOutline, 0, len(feedlist))
+		opt      = loadOptions{
+			dontCreate:     true,
+			includeXml:     true,
+			includeDeleted: config.IncludeDeleted,
+		}
+	)
+
+	for _, f := range feedlist {
+		var outline = podutils.OpmlOutline{
+			Text:   f.Name,
+			Type:   "rss",
+			XmlUrl: f.Url,
+		}
+
+		if err := f.LoadDBFeed(opt); err != nil {
+			var errDeleted *ErrorFeedDeleted
+			if errors.As(err, &errDeleted) {
+				f.log.Debug("feed is deleted; skipping opml export")
+				continue
+			}
+			// feed may not be in the db yet; config values are enough
+			f.log.Debugf("feed not loaded from db, using config for opml: %v", err)
+		} else if f.XmlFeedData != nil {
+			if f.XmlFeedData.Title != "" {
+				outline.Title = f.XmlFeedData.Title
+			}
+			outline.HtmlUrl = f.XmlFeedData.Link
+		}
+		outlines = append(outlines, outline)
+	}
+
+	buf, err := podutils.GenerateOpml("gopod subscriptions", time.Now(), outlines)
+	if err != nil {
+		return err
+	} else if err := os.WriteFile(file, buf, 0644); err != nil {
+		return err
+	}
+
+	log.Infof("%v feeds exported to '%v'", len(outlines), file)
+	return nil
+}
+
+// --------------------------------------------------------------------------
+func opmlExportPath() string {
+	var expPath = podutils.Tern(config.ExportPath != "", config.ExportPath, config.WorkspaceDir)
+	return filepath.Join(expPath, opmlExportFilename)
+}
@@ -0,0 +1,60 @@
+package pod
+
+import (
+	"gopod/podconfig"
+	"gopod/testutils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportOpml(t *testing.T) {
+
+	var opmlData = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <body>
+    <outline text="existing" xmlUrl="https://foo.bar/existing.xml"/>
+    <outline text="folder">
+      <outline text="foo cast" title="Foo Cast" xmlUrl="https://foo.bar/foo.xml"/>
+      <outline text="The Bar Show Podcast" xmlUrl="https://foo.bar/bar.xml"/>
+      <outline text="dup" xmlUrl="https://foo.bar/foo.xml"/>
+    </outline>
+  </body>
+</opml>`
+
+	var existing = []podconfig.FeedToml{
+		{Name: "Foo Cast", Shortname: "foocast", Url: "https://foo.bar/existing.xml"},
+	}
+
+	var (
+		dir     = t.TempDir()
+		cfgFile = filepath.Join(dir, "config.toml")
+		opmlFil = filepath.Join(dir, "subs.opml")
+	)
+	testutils.AssertErr(t, false, os.WriteFile(cfgFile, []byte("# config\n"), 0644))
+	testutils.AssertErr(t, false, os.WriteFile(opmlFil, []byte(opmlData), 0644))
+
+	var oldConfig = config
+	defer func() { config = oldConfig }()
+	config = &podconfig.Config{ConfigFile: cfgFile}
+	config.OpmlFile = opmlFil
+
+	added, err := ImportOpml(existing)
+	if testutils.AssertErr(t, false, err) {
+		testutils.AssertEquals(t, []podconfig.FeedToml{
+			{Name: "Foo Cast", Shortname: "foocast2", Url: "https://foo.bar/foo.xml"},
+			{Name: "The Bar Show Podcast", Shortname: "tbsp", Url: "https://foo.bar/bar.xml"},
+		}, added)
+	}
+
+	// running again adds nothing
+	added, err = ImportOpml(append(existing, added...))
+	if testutils.AssertErr(t, false, err) {
+		testutils.AssertEquals(t, 0, len(added))
+	}
+
+	// missing file
+	config.OpmlFile = filepath.Join(dir, "missing.opml")
+	_, err = ImportOpml(existing)
+	testutils.AssertErrContains(t, "failed reading opml file", err)
+}
@@ -0,0 +1,98 @@
+package pod
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopod/commandline"
+	"gopod/podutils"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/mattn/go-isatty"
+)
+
+// report output, shared by reporting commands.  Table uses the formatted rows, csv the raw
+// records (both under the same headers); json encodes data directly
+type report struct {
+	title   string // table output only
+	headers []string
+	rows    [][]string
+	records [][]string
+	data    any
+}
+
+var (
+	headerStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#66ffff")).Padding(0, 1)
+	cellStyle   = lipgloss.NewStyle().Padding(0, 1)
+	borderStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#808080"))
+	titleStyle  = lipgloss.NewStyle().Bold(true)
+)
+
+// --------------------------------------------------------------------------
+// auto format resolves to table when writing to a terminal, json otherwise
+func resolveOutputFormat(w io.Writer, format commandline.OutputFormat) commandline.OutputFormat {
+	if format != commandline.OutputAuto {
+		return format
+	}
+	if file, ok := w.(*os.File); ok && (isatty.IsTerminal(file.Fd()) || isatty.IsCygwinTerminal(file.Fd())) {
+		return commandline.OutputTable
+	}
+	return commandline.OutputJson
+}
+
+// --------------------------------------------------------------------------
+func (r report) write(w io.Writer, format commandline.OutputFormat) error {
+	return writeReports(w, format, r.data, r)
+}
+
+// --------------------------------------------------------------------------
+// writes multiple reports; json encodes data once, table outputs each report under its title,
+// and csv (being a single table) outputs only the first report
+func writeReports(w io.Writer, format commandline.OutputFormat, data any, reports ...report) error {
+
+	switch resolveOutputFormat(w, format) {
+	case commandline.OutputTable:
+		for _, r := range reports {
+			if r.title != "" {
+				if _, err := fmt.Fprintf(w, "\n%v\n", titleStyle.Render(r.title)); err != nil {
+					return err
+				}
+			}
+			var t = table.New().
+				Border(lipgloss.RoundedBorder()).
+				BorderStyle(borderStyle).
+				Headers(r.headers...).
+				Rows(r.rows...).
+				StyleFunc(func(row, _ int) lipgloss.Style {
+					return podutils.Tern(row == table.HeaderRow, headerStyle, cellStyle)
+				})
+			if _, err := fmt.Fprintln(w, t.Render()); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case commandline.OutputJson:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		return enc.Encode(data)
+
+	case commandline.OutputCsv:
+		if len(reports) == 0 {
+			return nil
+		}
+		var cw = csv.NewWriter(w)
+		if err := cw.Write(reports[0].headers); err != nil {
+			return err
+		} else if err := cw.WriteAll(reports[0].records); err != nil {
+			return err
+		}
+		return cw.Error()
+	}
+
+	return fmt.Errorf("output format not handled: %v", format)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"time"
 
 	log "gopod/multilogger"
 	"gopod/podutils"
@@ -29,14 +30,16 @@ const ( // because constants should be capitalized, but I don't want to export t
 
 	// shortcut for count of all items
 	AllItems = -1
-
-	// current model for database
-	currentModel = 3
 )
 
 type PodDB struct {
 	path   string
 	config gorm.Config
+
+	// shared connection, opened in NewDB (or transaction, in WithTx)
+	db gormDBInterface
+	// reads span the archive dbs; see openCatalog
+	catalog bool
 }
 
 var defaultConfig = gorm.Config{
@@ -45,75 +48,185 @@ var defaultConfig = gorm.Config{
 	},
 }
 
+// connection settings; WAL allows reads while a write is in progress, busy timeout waits on a locked db
+// rather than failing, and transactions take the write lock up front so they can't deadlock on upgrade
+const (
+	dbConnParams     = "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate"
+	dbMaxOpenConns   = 4
+	dbConnMaxIdle    = 5 * time.Minute
+	inMemoryDbPath   = ":memory:"
+	inMemoryMaxConns = 1 // each connection to :memory: is a separate db
+)
+
 // --------------------------------------------------------------------------
+// location of the main database in the workspace
+func DBPath(workspaceDir string) string {
+	return filepath.Join(workspaceDir, ".db", "gopod.db")
+}
+
+// --------------------------------------------------------------------------
+// opens the db, creating it if needed.  Existing databases must be up to date with the migration
+// registry; pending migrations are applied separately (gopod db migrate), and databases from newer
+// versions of gopod are refused
 func NewDB(path string) (*PodDB, error) {
+	poddb, err := openDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if state, err := loadSchemaState(poddb.db); err != nil {
+		poddb.Close()
+		return nil, err
+	} else if len(state.pending) > 0 {
+		poddb.Close()
+		return nil, fmt.Errorf("database needs migration (%v pending); run 'gopod db migrate'", len(state.pending))
+	}
+
+	return poddb, nil
+}
+
+// --------------------------------------------------------------------------
+// opens the shared connection, and creates the tables for a new database; no schema checks
+func openDB(path string) (*PodDB, error) {
 	if path == "" {
 		return nil, errors.New("db path cannot be empty")
 	}
 
-	var poddb = PodDB{path: path, config: defaultConfig}
+	var (
+		poddb = PodDB{path: path, config: defaultConfig}
+		isNew bool
+		dsn   = path
+	)
 
 	// in-memory db only used for unit tests.. don't do these checks in those cases
-	if path != ":memory:" {
+	if path != inMemoryDbPath {
 		if exists, err := podutils.FileExists(path); err != nil {
 			return nil, err
 		} else if exists == false {
-			if err := poddb.createNewDb(path); err != nil {
+			log.Debug("db file not found; attempting to create new")
+			// if this is a new instance, make sure the db path exists; otherwise shit fails
+			if err := podutils.MkdirAll(filepath.Dir(path)); err != nil {
 				return nil, err
 			}
+			isNew = true
 		}
+		dsn += "?" + dbConnParams
 	}
 
-	if db, err := gImpl.Open(sqlite.Open(poddb.path), &poddb.config); err != nil {
+	if db, err := gImpl.Open(sqlite.Open(dsn), &poddb.config); err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	} else if sqldb, err := db.SqlDB(); err != nil {
 		return nil, fmt.Errorf("error opening db: %w", err)
-
 	} else {
-		var result = struct{ ID int }{}
-
-		if res := db.Raw("SELECT ID from poddb_model").Scan(&result); res.Error != nil {
-			// handle new database file; this will happen on that error
-			return nil, fmt.Errorf("error checking model version: %w", res.Error)
-
-		} else if result.ID != currentModel {
-			log.Warnf("database model '%v' doesn't match current model '%v'; attempting upgrade", result.ID, currentModel)
-			// future: if more work needs to be done converting the db, should return custom error and handle
-			// upgrade/migration in separate launch command.. but for now
-			if err := migrateDB(db, result.ID); err != nil {
-				return nil, fmt.Errorf("error migrating database: %w", err)
-			}
+		sqldb.SetMaxOpenConns(podutils.Tern(path == inMemoryDbPath, inMemoryMaxConns, dbMaxOpenConns))
+		sqldb.SetMaxIdleConns(podutils.Tern(path == inMemoryDbPath, inMemoryMaxConns, dbMaxOpenConns))
+		sqldb.SetConnMaxIdleTime(dbConnMaxIdle)
+		poddb.db = db
+	}
+
+	if isNew {
+		if err := poddb.createNewDb(); err != nil {
+			poddb.Close()
+			return nil, err
 		}
 	}
 
 	return &poddb, nil
 }
 
-// creates a new database at the specified path with associated tables
-func (pdb PodDB) createNewDb(path string) error {
-	log.Debug("db file not found; attempting to create new")
-
-	// todo: unit test this shit
-
-	// if this is a new instance, make sure the db path exists; otherwise shit fails
-	if err := podutils.MkdirAll(filepath.Dir(path)); err != nil {
-		return err
+// opens a database file read only and immutable; for files that aren't ours to change (backups,
+// exports), so no wal or shared memory files are left behind.  The file must exist
+func openImmutableDB(path string) (*PodDB, error) {
+	if exists, err := podutils.FileExists(path); err != nil {
+		return nil, err
+	} else if exists == false {
+		return nil, fmt.Errorf("'%v' not found", path)
 	}
 
-	if db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config); err != nil {
-		return fmt.Errorf("error opening db: %w", err)
-
+	var poddb = PodDB{path: path, config: defaultConfig}
+	if db, err := gImpl.Open(sqlite.Open("file:"+filepath.ToSlash(path)+"?mode=ro&immutable=1"), &poddb.config); err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
 	} else {
-		var sqlStr = "CREATE TABLE poddb_model (ID integer); INSERT INTO poddb_model (ID) VALUES (?)"
-		if res := db.Exec(sqlStr, currentModel); res.Error != nil {
+		poddb.db = db
+	}
+	return &poddb, nil
+}
+
+// creates the tables for a new database, applying (and recording) every migration in the registry
+func (pdb PodDB) createNewDb() error {
+	return pdb.WithTx(func(tx *PodDB) error {
+		var sqlStr = "CREATE TABLE " + legacyModelTable + " (ID integer); INSERT INTO " + legacyModelTable + " (ID) VALUES (?)"
+		if res := tx.db.Exec(sqlStr, latestVersion()); res.Error != nil {
 			return fmt.Errorf("error creating db version: %w", res.Error)
+		} else if err := tx.db.AutoMigrate(&MigrationDBEntry{}); err != nil {
+			return fmt.Errorf("error creating migrations table: %w", err)
 		}
 
-		// in the case of a new db, need to set up tables and such..
-		if err := db.AutoMigrate(&FeedDBEntry{}, &FeedXmlDBEntry{}, &ItemDBEntry{}, &ItemXmlDBEntry{}, &ImageDBEntry{}); err != nil {
-			return err
+		for _, m := range migrations {
+			if err := m.up(tx.db); err != nil {
+				return fmt.Errorf("migration %v failed: %w", m, err)
+			} else if res := tx.db.Save(m.entry(false)); res.Error != nil {
+				return fmt.Errorf("error recording migration: %w", res.Error)
+			}
 		}
+		return nil
+	})
+}
+
+// --------------------------------------------------------------------------
+// shared connection (or transaction); if not created through NewDB, opens a new connection each call
+func (pdb PodDB) open() (gormDBInterface, error) {
+	if pdb.db != nil {
+		return pdb.db, nil
 	}
+	return gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+}
 
-	return nil
+// --------------------------------------------------------------------------
+// runs fn in a single transaction; tx is a copy of the db bound to the transaction, and all db calls
+// in fn must go through it.  Commits if fn returns nil, otherwise everything is rolled back.  Nested
+// calls use savepoints
+func (pdb PodDB) WithTx(fn func(tx *PodDB) error) error {
+	if pdb.path == "" {
+		return errors.New("poddb is not initialized; call NewDB() first")
+	} else if fn == nil {
+		return errors.New("transaction function cannot be nil")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return fmt.Errorf("error opening db: %w", err)
+	}
+
+	return db.Transaction(func(gtx gormDBInterface) error {
+		var tx = pdb
+		tx.db = gtx
+		return fn(&tx)
+	})
+}
+
+// --------------------------------------------------------------------------
+// closes the shared connection; any further calls open a new connection per call
+func (pdb *PodDB) Close() error {
+	if pdb == nil || pdb.db == nil {
+		return nil
+	}
+
+	sqldb, err := pdb.db.SqlDB()
+	if err != nil {
+		return fmt.Errorf("error closing db: %w", err)
+	}
+	pdb.db = nil
+	return sqldb.Close()
+}
+
+// filters and paging for a feed's items; nil or zero is not filtered
+type itemPageOptions struct {
+	feedId               uint
+	downloaded, archived *bool
+	after, before        time.Time // publish date
+	limit                int       // zero or less for all items
+	offset               int
 }
 
 type loadOptions struct {
@@ -121,6 +234,8 @@ type loadOptions struct {
 	includeXml     bool
 	includeDeleted bool
 	direction      direction
+	// items from the feed's archive dbs as well (see poddb_catalog); read only
+	includeArchives bool
 }
 
 // --------------------------------------------------------------------------
@@ -131,7 +246,7 @@ func (pdb PodDB) isFeedDeleted(hash string) (bool, error) {
 		return false, errors.New("hash cannot be empty")
 	}
 
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return false, fmt.Errorf("error opening db: %w", err)
 	}
@@ -158,7 +273,7 @@ func (pdb PodDB) loadFeed(feedEntry *FeedDBEntry, opt loadOptions) error {
 		return errors.New("hash or ID has not been set")
 	}
 
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return fmt.Errorf("error opening db: %w", err)
 	}
@@ -199,7 +314,7 @@ func (pdb PodDB) loadDBFeedXml(xmlId uint) (*FeedXmlDBEntry, error) {
 		return nil, errors.New("xml ID cannot be zero")
 	}
 
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return nil, fmt.Errorf("error opening db: %w", err)
 	}
@@ -221,7 +336,7 @@ func (pdb PodDB) loadFeedItems(feedId uint, numItems int, opt loadOptions) ([]*I
 	} else if feedId == 0 {
 		return nil, errors.New("feed id cannot be zero")
 	}
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return nil, fmt.Errorf("error opening db: %w", err)
 	}
@@ -252,6 +367,90 @@ func (pdb PodDB) loadFeedItems(feedId uint, numItems int, opt loadOptions) ([]*I
 	return itemList, nil
 }
 
+// --------------------------------------------------------------------------
+// single item in the feed, by id; deleted items aren't found
+func (pdb PodDB) loadFeedItem(feedId, itemId uint, opt loadOptions) (*ItemDBEntry, error) {
+
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	} else if feedId == 0 {
+		return nil, errors.New("feed id cannot be zero")
+	} else if itemId == 0 {
+		return nil, errors.New("item id cannot be zero")
+	}
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	}
+
+	var tx = db.Where(&ItemDBEntry{PodDBModel: PodDBModel{ID: itemId}, FeedId: feedId})
+	if opt.includeXml {
+		tx = tx.Preload("XmlData")
+	}
+
+	var item ItemDBEntry
+	if res := tx.First(&item); res.Error != nil {
+		return nil, res.Error
+	}
+	return &item, nil
+}
+
+// --------------------------------------------------------------------------
+// page of the feed's items, newest first, along with the total count of items matching (for paging)
+func (pdb PodDB) loadFeedItemPage(opt itemPageOptions) ([]*ItemDBEntry, int64, error) {
+
+	if pdb.path == "" {
+		return nil, 0, errors.New("poddb is not initialized; call NewDB() first")
+	} else if opt.feedId == 0 {
+		return nil, 0, errors.New("feed id cannot be zero")
+	}
+	db, err := pdb.open()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error opening db: %w", err)
+	}
+
+	var where = func() gormDBInterface {
+		var tx = db.Model(&ItemDBEntry{}).Where("FeedId = ?", opt.feedId)
+		if opt.downloaded != nil {
+			tx = tx.Where("Downloaded = ?", *opt.downloaded)
+		}
+		if opt.archived != nil {
+			tx = tx.Where("Archived = ?", *opt.archived)
+		}
+		// compared as utc; see searchItems
+		if opt.after.IsZero() == false {
+			tx = tx.Where("julianday(PubTimeStamp) >= julianday(?)", opt.after)
+		}
+		if opt.before.IsZero() == false {
+			tx = tx.Where("julianday(PubTimeStamp) < julianday(?)", opt.before)
+		}
+		return tx
+	}
+
+	var (
+		total    int64
+		itemList = make([]*ItemDBEntry, 0)
+	)
+	if res := where().Count(&total); res.Error != nil {
+		return nil, 0, res.Error
+	}
+
+	var tx = where().Preload("XmlData").
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "PubTimeStamp"}, Desc: true})
+	if opt.limit > 0 {
+		tx = tx.Limit(opt.limit)
+	}
+	if opt.offset > 0 {
+		tx = tx.Offset(opt.offset)
+	}
+	if res := tx.Find(&itemList); res.Error != nil {
+		return nil, 0, res.Error
+	}
+	log.Debugf("rows found: %v (total: %v)", len(itemList), total)
+
+	return itemList, total, nil
+}
+
 // --------------------------------------------------------------------------
 func (pdb PodDB) loadItemXml(xmlId uint) (*ItemXmlDBEntry, error) {
 	if pdb.path == "" {
@@ -260,7 +459,7 @@ func (pdb PodDB) loadItemXml(xmlId uint) (*ItemXmlDBEntry, error) {
 		return nil, errors.New("xml id cannot be zero")
 	}
 
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return nil, fmt.Errorf("error opening db: %w", err)
 	}
@@ -291,7 +490,7 @@ func (pdb PodDB) saveFeed(feed *FeedDBEntry) error {
 	// 	log.Warn("xml feed id is zero; will insert new xml entry instead of replacing existing")
 	// }
 
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return fmt.Errorf("error opening db: %w", err)
 	}
@@ -326,7 +525,7 @@ func (pdb PodDB) saveItems(itemlist ...*ItemDBEntry) error {
 		}
 	}
 
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return fmt.Errorf("error opening db: %w", err)
 	}
@@ -345,7 +544,7 @@ func (pdb PodDB) saveImages(imglist ...*ImageDBEntry) error {
 		return errors.New("item entry list is empty")
 	}
 
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return fmt.Errorf("error opening db: %w", err)
 	}
@@ -356,69 +555,141 @@ func (pdb PodDB) saveImages(imglist ...*ImageDBEntry) error {
 }
 
 // --------------------------------------------------------------------------
-func (pdb PodDB) deleteFeed(feed *FeedDBEntry) error {
+// saves only the update status of the feed (last updated/last error), leaving everything else as is
+func (pdb PodDB) saveFeedStatus(feed *FeedDBEntry) error {
 	if pdb.path == "" {
 		return errors.New("poddb is not initialized; call NewDB() first")
 	} else if feed == nil {
 		return errors.New("feed cannot be nil")
 	} else if feed.ID == 0 {
-		// this hopefully will never happen; fail if it does
-		return errors.New("feed id cannot be zero; make sure it is loaded first")
+		return errors.New("feed id is zero; make sure feed is created/loaded first")
 	}
 
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return fmt.Errorf("error opening db: %w", err)
 	}
 
-	// if true {
-	// 	db = db.Debug()
-	// }
+	// map used so empty values (i.e. clearing the error) are saved
+	var res = db.Model(feed).Updates(map[string]any{
+		"LastUpdated": feed.LastUpdated,
+		"LastError":   feed.LastError,
+	})
+	log.Debugf("rows affected: %v", res.RowsAffected)
+	return res.Error
+}
 
-	// get all the items, for deletion
-	var itemlist = make([]*ItemDBEntry, 0)
-	if res := db.Where(&ItemDBEntry{FeedId: feed.ID}).Order("ID").Find(&itemlist); res.Error != nil {
-		return fmt.Errorf("error finding items: %w", res.Error)
-	} else if err := pdb.deleteItems(itemlist); err != nil {
-		return fmt.Errorf("error deleting items: %w", err)
+type itemStats struct {
+	Total           int
+	Downloaded      int
+	NotDownloaded   int
+	Archived        int
+	RemovedUpstream int
+	NewestPubDate   time.Time
+}
+
+// --------------------------------------------------------------------------
+// item counts for the feed, and most recent pubdate; deleted items are not included
+func (pdb PodDB) loadFeedItemStats(feedId uint) (*itemStats, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	} else if feedId == 0 {
+		return nil, errors.New("feed id cannot be zero")
 	}
 
-	// get all images for deletion
-	var imglist = make([]*ImageDBEntry, 0)
-	if res := db.Where(&ImageDBEntry{FeedId: feed.ID}).Order("ID").Find(&imglist); res.Error != nil {
-		return fmt.Errorf("error finding images: %w", res.Error)
-	} else if err := pdb.deleteImages(imglist); err != nil {
-		return fmt.Errorf("error deleting images: %w", err)
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
 	}
 
-	// delete feed xml
-	if feed.XmlId == 0 {
-		log.Warn("feed xml is zero; xml entry might not exist")
-	} else {
-		var xmlentry = podutils.Tern(feed.XmlFeedData == nil, &FeedXmlDBEntry{}, feed.XmlFeedData)
-		if res := db.Delete(xmlentry, feed.XmlId); res.Error != nil {
-			err := fmt.Errorf("failed deleting feed xml: %w", res.Error)
+	var (
+		stats  itemStats
+		sqlStr = "SELECT COUNT(*) AS Total, " +
+			"COALESCE(SUM(Downloaded), 0) AS Downloaded, " +
+			"COALESCE(SUM(NOT Downloaded AND NOT Archived), 0) AS NotDownloaded, " +
+			"COALESCE(SUM(Archived), 0) AS Archived, " +
+			"COALESCE(SUM(RemovedUpstream), 0) AS RemovedUpstream " +
+			"FROM ItemDBEntries WHERE FeedId = ? AND DeletedAt IS NULL"
+	)
+	if res := db.Raw(sqlStr, feedId).Scan(&stats); res.Error != nil {
+		return nil, res.Error
+	} else if stats.Total == 0 {
+		return &stats, nil
+	}
+
+	// aggregate loses the column type in sqlite, so query the newest item directly for pubdate
+	var newest ItemDBEntry
+	var res = db.Where(&ItemDBEntry{FeedId: feedId}).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "PubTimeStamp"}, Desc: true}).
+		First(&newest)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	stats.NewestPubDate = newest.PubTimeStamp
+
+	return &stats, nil
+}
+
+// --------------------------------------------------------------------------
+func (pdb PodDB) deleteFeed(feed *FeedDBEntry) error {
+	if pdb.path == "" {
+		return errors.New("poddb is not initialized; call NewDB() first")
+	} else if feed == nil {
+		return errors.New("feed cannot be nil")
+	} else if feed.ID == 0 {
+		// this hopefully will never happen; fail if it does
+		return errors.New("feed id cannot be zero; make sure it is loaded first")
+	}
+
+	// all or nothing; a failure part way through leaves the feed as it was
+	return pdb.WithTx(func(tx *PodDB) error {
+		var db = tx.db
+
+		// get all the items, for deletion
+		var itemlist = make([]*ItemDBEntry, 0)
+		if res := db.Where(&ItemDBEntry{FeedId: feed.ID}).Order("ID").Find(&itemlist); res.Error != nil {
+			return fmt.Errorf("error finding items: %w", res.Error)
+		} else if err := tx.deleteItems(itemlist); err != nil {
+			return fmt.Errorf("error deleting items: %w", err)
+		}
+
+		// get all images for deletion
+		var imglist = make([]*ImageDBEntry, 0)
+		if res := db.Where(&ImageDBEntry{FeedId: feed.ID}).Order("ID").Find(&imglist); res.Error != nil {
+			return fmt.Errorf("error finding images: %w", res.Error)
+		} else if err := tx.deleteImages(imglist); err != nil {
+			return fmt.Errorf("error deleting images: %w", err)
+		}
+
+		// delete feed xml
+		if feed.XmlId == 0 {
+			log.Warn("feed xml is zero; xml entry might not exist")
+		} else {
+			var xmlentry = podutils.Tern(feed.XmlFeedData == nil, &FeedXmlDBEntry{}, feed.XmlFeedData)
+			if res := db.Delete(xmlentry, feed.XmlId); res.Error != nil {
+				err := fmt.Errorf("failed deleting feed xml: %w", res.Error)
+				log.Error(err)
+				return err
+			} else if res.RowsAffected != 1 {
+				log.Warnf("xml delete; expected 1 row, got %v", res.RowsAffected)
+			} else {
+				log.Debugf("feed xml delete, rows: %v", res.RowsAffected)
+			}
+		}
+
+		// delete feed
+		if res := db.Delete(feed, feed.ID); res.Error != nil {
+			err := fmt.Errorf("failed deleting feed: %w", res.Error)
 			log.Error(err)
 			return err
 		} else if res.RowsAffected != 1 {
-			log.Warnf("xml delete; expected 1 row, got %v", res.RowsAffected)
+			log.Warnf("feed delete; expected 1 row, got %v", res.RowsAffected)
 		} else {
-			log.Debugf("feed xml delete, rows: %v", res.RowsAffected)
+			log.Debugf("feed delete, rows: %v", res.RowsAffected)
 		}
-	}
 
-	// delete feed
-	if res := db.Delete(feed, feed.ID); res.Error != nil {
-		err := fmt.Errorf("failed deleting feed: %w", res.Error)
-		log.Error(err)
-		return err
-	} else if res.RowsAffected != 1 {
-		log.Warnf("feed delete; expected 1 row, got %v", res.RowsAffected)
-	} else {
-		log.Debugf("feed delete, rows: %v", res.RowsAffected)
-	}
-
-	return nil
+		return nil
+	})
 }
 
 // --------------------------------------------------------------------------
@@ -449,7 +720,7 @@ func (pdb PodDB) deleteItems(list []*ItemDBEntry) error {
 		}
 	}
 
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return fmt.Errorf("error opening db: %w", err)
 	}
@@ -472,6 +743,15 @@ func (pdb PodDB) deleteItems(list []*ItemDBEntry) error {
 	}
 
 	for _, idchunk := range podutils.Chunk(itemIdList, 100) {
+		// previous xml revisions
+		if res := db.Where("ItemId IN ?", idchunk).Delete(&ItemXmlDBEntry{}); res.Error != nil {
+			err := fmt.Errorf("failed deleting item xml revisions: %w", res.Error)
+			log.Error(err)
+			return err
+		} else {
+			log.Debugf("xml revision delete, rows: %v", res.RowsAffected)
+		}
+
 		if res := db.Delete(&ItemDBEntry{}, idchunk); res.Error != nil {
 			err := fmt.Errorf("failed deleting item: %w", res.Error)
 			log.Error(err)
@@ -493,7 +773,7 @@ func (pdb PodDB) deleteItems(list []*ItemDBEntry) error {
 
 func (pdb PodDB) deleteImages(list []*ImageDBEntry) error {
 
-	db, err := gImpl.Open(sqlite.Open(pdb.path), &pdb.config)
+	db, err := pdb.open()
 	if err != nil {
 		return fmt.Errorf("error opening db: %w", err)
 	}
@@ -531,6 +811,17 @@ func (f *FeedDBEntry) AfterFind(tx *gorm.DB) error {
 	return nil
 }
 
+// --------------------------------------------------------------------------
+// links the current xml revision to its item; xml is saved before the item (belongs to), so for new
+// items the id isn't known until after
+func (i *ItemDBEntry) AfterSave(tx *gorm.DB) error {
+	if i.XmlData == nil || i.XmlData.ID == 0 || i.XmlData.ItemId == i.ID {
+		return nil
+	}
+	i.XmlData.ItemId = i.ID
+	return tx.Session(&gorm.Session{NewDB: true}).Model(i.XmlData).UpdateColumn("ItemId", i.ID).Error
+}
+
 // --------------------------------------------------------------------------
 func (f *FeedDBEntry) BeforeSave(tx *gorm.DB) error {
 	// log.With("feed", f.DBShortname).Debug("Before Save")
@@ -0,0 +1,187 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+
+	log "gopod/multilogger"
+
+	"gorm.io/gorm"
+)
+
+// --------------------------------------------------------------------------
+// removes items (by hash) from an archive db, along with their xml and any images no longer used by
+// the items left.  Returns the number of items left in the archive
+func (pdb PodDB) removeArchivedItems(hashes []string) (int64, error) {
+	if pdb.path == "" {
+		return 0, errors.New("poddb is not initialized; call NewDB() first")
+	} else if len(hashes) == 0 {
+		return 0, errors.New("hash list is empty")
+	}
+
+	var (
+		remaining int64
+		// ordered so rows referenced in subqueries are removed last
+		steps = []struct {
+			name  string
+			model any
+			where string
+			args  []any
+		}{
+			{"item xml", &ItemXmlDBEntry{},
+				"ID IN (SELECT XmlId FROM ItemDBEntries WHERE Hash IN ?) OR " +
+					"ItemId IN (SELECT ID FROM ItemDBEntries WHERE Hash IN ?)", []any{hashes, hashes}},
+			{"items", &ItemDBEntry{}, "Hash IN ?", []any{hashes}},
+			{"images", &ImageDBEntry{},
+				"Url NOT IN (SELECT ImageKey FROM ItemDBEntries WHERE ImageKey IS NOT NULL)", []any{}},
+		}
+	)
+
+	err := pdb.WithTx(func(tx *PodDB) error {
+		var db = tx.db
+
+		for _, step := range steps {
+			if res := db.Unscoped().Where(step.where, step.args...).Delete(step.model); res.Error != nil {
+				return fmt.Errorf("failed removing %v: %w", step.name, res.Error)
+			} else {
+				log.Debugf("%v removed, rows: %v", step.name, res.RowsAffected)
+			}
+		}
+
+		if res := db.Model(&ItemDBEntry{}).Count(&remaining); res.Error != nil {
+			return fmt.Errorf("failed counting items: %w", res.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return remaining, nil
+}
+
+// counts from merging a run's items into an archive db
+type archiveMergeCounts struct {
+	Added    int
+	Updated  int
+	Replaced int   // same hash under a different id; the old row and its xml are removed
+	Total    int64 // items in the archive after the merge
+}
+
+// --------------------------------------------------------------------------
+// merges the feed's items (and images) into an archive db, deduplicated by hash.  Items already in
+// the archive keep the run they were first archived in.  Items are saved with their main db ids, so an
+// id already used by a different item means the archive db is out of step with the main db
+func (pdb PodDB) mergeArchiveFeed(feed *FeedDBEntry) (*archiveMergeCounts, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	} else if feed == nil {
+		return nil, errors.New("feed cannot be nil")
+	} else if len(feed.ItemList) == 0 {
+		return nil, errors.New("item list is empty")
+	}
+
+	var (
+		counts archiveMergeCounts
+		hashes = make([]string, 0, len(feed.ItemList))
+		ids    = make([]uint, 0, len(feed.ItemList))
+	)
+	for _, item := range feed.ItemList {
+		hashes = append(hashes, item.Hash)
+		ids = append(ids, item.ID)
+	}
+
+	err := pdb.WithTx(func(tx *PodDB) error {
+		var (
+			db       = tx.db
+			existing = make([]*ItemDBEntry, 0)
+			byHash   = make(map[string]*ItemDBEntry)
+			stale    = make([]uint, 0)
+		)
+
+		if res := db.Unscoped().Where("Hash IN ?", hashes).Find(&existing); res.Error != nil {
+			return fmt.Errorf("failed loading archived items: %w", res.Error)
+		}
+		for _, ex := range existing {
+			byHash[ex.Hash] = ex
+		}
+
+		for _, item := range feed.ItemList {
+			ex, exists := byHash[item.Hash]
+			switch {
+			case exists == false:
+				counts.Added++
+			case ex.ID == item.ID:
+				counts.Updated++
+			default:
+				counts.Replaced++
+				stale = append(stale, ex.ID)
+			}
+			if exists && ex.ArchiveRun != "" {
+				item.ArchiveRun = ex.ArchiveRun
+			}
+		}
+
+		var conflicts int64
+		if res := db.Unscoped().Model(&ItemDBEntry{}).Where("ID IN ? AND Hash NOT IN ?", ids, hashes).Count(&conflicts); res.Error != nil {
+			return fmt.Errorf("failed checking item ids: %w", res.Error)
+		} else if conflicts > 0 {
+			return fmt.Errorf("%v archived items have ids used by other items; rebuild the archive db (use archive --rebuild-db)", conflicts)
+		}
+
+		if len(stale) > 0 {
+			if res := db.Unscoped().Where("ItemId IN ? OR ID IN (SELECT XmlId FROM ItemDBEntries WHERE ID IN ?)", stale, stale).
+				Delete(&ItemXmlDBEntry{}); res.Error != nil {
+				return fmt.Errorf("failed removing replaced item xml: %w", res.Error)
+			} else if res := db.Unscoped().Where("ID IN ?", stale).Delete(&ItemDBEntry{}); res.Error != nil {
+				return fmt.Errorf("failed removing replaced items: %w", res.Error)
+			}
+		}
+
+		// images are keyed by url
+		var (
+			urls   = make([]string, 0, len(feed.imageMap))
+			imgIds = make([]uint, 0, len(feed.imageMap))
+		)
+		for _, img := range feed.imageMap {
+			urls, imgIds = append(urls, img.Url), append(imgIds, img.ID)
+		}
+		if len(urls) > 0 {
+			if res := db.Unscoped().Where("Url IN ? AND ID NOT IN ?", urls, imgIds).Delete(&ImageDBEntry{}); res.Error != nil {
+				return fmt.Errorf("failed removing replaced images: %w", res.Error)
+			}
+		}
+
+		if res := db.Session(&gorm.Session{FullSaveAssociations: true}).Save(feed); res.Error != nil {
+			return fmt.Errorf("failed saving feed: %w", res.Error)
+		} else if res := db.Model(&ItemDBEntry{}).Count(&counts.Total); res.Error != nil {
+			return fmt.Errorf("failed counting items: %w", res.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("archive merge: %+v", counts)
+	return &counts, nil
+}
+
+// --------------------------------------------------------------------------
+// hashes of every item in an archive db
+func (pdb PodDB) loadArchivedHashes() ([]string, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	}
+
+	var hashes = make([]string, 0)
+	if res := db.Raw("SELECT Hash FROM ItemDBEntries WHERE DeletedAt IS NULL ORDER BY Hash").Scan(&hashes); res.Error != nil {
+		return nil, res.Error
+	}
+	return hashes, nil
+}
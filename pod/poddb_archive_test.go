@@ -0,0 +1,165 @@
+package pod
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+func TestPodDB_removeArchivedItems(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var (
+		deleteStack = []stackType{unscoped, where, delete}
+		defStack    = slices.Concat([]stackType{open, transaction}, deleteStack, deleteStack, deleteStack,
+			[]stackType{model, count})
+	)
+	// archive db; i1 and i2 share an image, i3 has its own
+	seedDeleted(t, gmock.mockdb.DB,
+		&ItemXmlDBEntry{},
+		&ItemXmlDBEntry{},
+		&ItemXmlDBEntry{},
+		&ItemXmlDBEntry{ItemId: 1}, // previous revision of i1
+		&ItemDBEntry{Hash: "i1", XmlId: 1, ImageKey: "img1"},
+		&ItemDBEntry{Hash: "i2", XmlId: 2, ImageKey: "img1"},
+		&ItemDBEntry{Hash: "i3", XmlId: 3, ImageKey: "img2"},
+		&ImageDBEntry{Url: "img1"},
+		&ImageDBEntry{Url: "img2"},
+	)
+
+	type args struct {
+		emptyPath bool
+		hashes    []string
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		remaining int64
+		images    []string
+		xml       int64
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty path", args{emptyPath: true, hashes: []string{"i1"}}, exp{errStr: "poddb is not initialized"}},
+		{"empty list", args{}, exp{errStr: "hash list is empty"}},
+		{"open error", args{openErr: true, hashes: []string{"i1"}}, exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"delete error", args{termErr: delete, hashes: []string{"i1"}},
+			exp{errStr: "delete:foobar", callStack: slices.Concat([]stackType{open, transaction}, deleteStack)}},
+		{"count error", args{termErr: count, hashes: []string{"i1"}},
+			exp{errStr: "count:foobar", callStack: defStack}},
+
+		// successive calls against the same data
+		{"shared image kept", args{hashes: []string{"i1", "i3"}},
+			exp{remaining: 1, images: []string{"img1"}, xml: 1, callStack: defStack}},
+		{"not found", args{hashes: []string{"foo"}},
+			exp{remaining: 1, images: []string{"img1"}, xml: 1, callStack: defStack}},
+		{"last item", args{hashes: []string{"i2"}},
+			exp{remaining: 0, images: []string{}, xml: 0, callStack: defStack}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			remaining, err := poddb.removeArchivedItems(tt.p.hashes)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			if err == nil {
+				testutils.AssertEquals(t, tt.e.remaining, remaining)
+
+				var images = make([]string, 0)
+				gmock.mockdb.DB.Model(&ImageDBEntry{}).Pluck("Url", &images)
+				testutils.AssertEquals(t, tt.e.images, images)
+
+				var xml int64
+				gmock.mockdb.DB.Model(&ItemXmlDBEntry{}).Count(&xml)
+				testutils.AssertEquals(t, tt.e.xml, xml)
+			}
+		})
+	}
+}
+
+func TestPodDB_mergeArchiveFeed(t *testing.T) {
+
+	pdb, err := NewDB(filepath.Join(t.TempDir(), "foo.db"))
+	if err != nil {
+		t.Fatalf("error creating db: %v", err)
+	}
+	defer pdb.Close()
+
+	var (
+		// items as loaded from the main db; ids already set
+		newItem = func(id uint, hash, run string) *ItemDBEntry {
+			var i = generateItem(1, true)
+			i.ID, i.Hash, i.ArchiveRun, i.XmlId, i.XmlData.ID = id, hash, run, id+100, id+100
+			return &i
+		}
+		newFeed = func(items ...*ItemDBEntry) *FeedDBEntry {
+			return &FeedDBEntry{PodDBModel: PodDBModel{ID: 1}, Hash: "foo", ItemList: items, XmlFeedData: &FeedXmlDBEntry{}}
+		}
+		runs = func() map[string]string {
+			var (
+				ret     = make(map[string]string)
+				entries = make([]*ItemDBEntry, 0)
+			)
+			testutils.AssertErr(t, false, pdb.db.Find(&entries).Error)
+			for _, e := range entries {
+				ret[e.Hash] = e.ArchiveRun
+			}
+			return ret
+		}
+	)
+
+	type exp struct {
+		counts *archiveMergeCounts
+		runs   map[string]string
+		errStr string
+	}
+	tests := []struct {
+		name string
+		feed *FeedDBEntry
+		e    exp
+	}{
+		{"empty", newFeed(), exp{errStr: "item list is empty"}},
+
+		// successive runs against the same archive
+		{"first run", newFeed(newItem(1, "i1", "run1"), newItem(2, "i2", "run1")),
+			exp{counts: &archiveMergeCounts{Added: 2, Total: 2}, runs: map[string]string{"i1": "run1", "i2": "run1"}}},
+		{"later run keeps first run", newFeed(newItem(2, "i2", "run2"), newItem(3, "i3", "run2")),
+			exp{counts: &archiveMergeCounts{Added: 1, Updated: 1, Total: 3}, runs: map[string]string{"i1": "run1", "i2": "run1", "i3": "run2"}}},
+		{"same hash new id", newFeed(newItem(4, "i1", "run3")),
+			exp{counts: &archiveMergeCounts{Replaced: 1, Total: 3}, runs: map[string]string{"i1": "run1", "i2": "run1", "i3": "run2"}}},
+		{"id used by other item", newFeed(newItem(2, "i4", "run4")),
+			exp{errStr: "have ids used by other items", runs: map[string]string{"i1": "run1", "i2": "run1", "i3": "run2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts, err := pdb.mergeArchiveFeed(tt.feed)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			testutils.AssertEquals(t, tt.e.counts, counts)
+			if tt.e.runs != nil {
+				testutils.AssertEquals(t, tt.e.runs, runs())
+			}
+		})
+	}
+
+	// replaced item's xml removed with it
+	var xml int64
+	testutils.AssertErr(t, false, pdb.db.Model(&ItemXmlDBEntry{}).Count(&xml).Error)
+	testutils.AssertEquals(t, int64(3), xml)
+}
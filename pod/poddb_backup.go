@@ -0,0 +1,241 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopod/inputoption"
+	log "gopod/multilogger"
+	"gopod/podutils"
+
+	"gorm.io/gorm"
+)
+
+// anything that can run a statement; gorm directly (in plugins) or the db interface
+type execer interface {
+	Exec(sql string, values ...any) *gorm.DB
+}
+
+// backs up the db just before the first write, then rotates previous backups.  Registered as a gorm
+// plugin, so every write (including those in transactions) is covered, and runs that don't write
+// don't leave a backup behind
+type lazyBackup struct {
+	path      string
+	timestamp string
+	retained  int // zero or less keeps every backup
+
+	db   *gorm.DB // connection pool the plugin is registered on
+	done atomic.Bool
+}
+
+// --------------------------------------------------------------------------
+// location of a backup of the db at path, as <name>.bak.<timestamp>.db alongside the original
+func backupFilename(path, timestamp string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".bak." + timestamp + ".db"
+}
+
+// --------------------------------------------------------------------------
+// writes a consistent, compacted copy of the db (including anything still in the wal) to file,
+// which must not already exist
+func vacuumInto(db execer, file string) error {
+	if res := db.Exec("VACUUM INTO ?", file); res.Error != nil {
+		return fmt.Errorf("error backing up db: %w", res.Error)
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// backs up the db before the first write made through it, keeping the most recent backups (zero
+// or less keeps all)
+func (pdb *PodDB) EnableBackup(timestamp string, retained int) error {
+	if pdb.path == "" {
+		return errors.New("poddb is not initialized; call NewDB() first")
+	} else if pdb.db == nil {
+		return errors.New("db is not open")
+	} else if timestamp == "" {
+		return errors.New("backup timestamp cannot be empty")
+	}
+	return pdb.db.Use(&lazyBackup{path: pdb.path, timestamp: timestamp, retained: retained})
+}
+
+// --------------------------------------------------------------------------
+func (lb *lazyBackup) Name() string {
+	return "gopod:lazybackup"
+}
+
+// --------------------------------------------------------------------------
+func (lb *lazyBackup) Initialize(db *gorm.DB) error {
+	lb.db = db
+	var cb = db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register(lb.Name(), lb.beforeWrite),
+		cb.Update().Before("gorm:update").Register(lb.Name(), lb.beforeWrite),
+		cb.Delete().Before("gorm:delete").Register(lb.Name(), lb.beforeWrite),
+		cb.Raw().Before("gorm:raw").Register(lb.Name(), lb.beforeWrite),
+	)
+}
+
+// --------------------------------------------------------------------------
+// on failure the write is cancelled, and the backup is tried again on the next write
+func (lb *lazyBackup) beforeWrite(tx *gorm.DB) {
+	if lb.done.CompareAndSwap(false, true) == false {
+		return
+	}
+
+	if file, err := lb.backup(); err != nil {
+		lb.done.Store(false)
+		tx.AddError(fmt.Errorf("database backup failed; not writing: %w", err))
+	} else {
+		log.Infof("database backed up to %v", file)
+	}
+}
+
+// --------------------------------------------------------------------------
+func (lb *lazyBackup) backup() (string, error) {
+	var file = backupFilename(lb.path, lb.timestamp)
+
+	// new session on the pool, rather than the statement's connection; the write may be in a
+	// transaction, which vacuum can't run in
+	if err := vacuumInto(lb.db.Session(&gorm.Session{NewDB: true}), file); err != nil {
+		return "", err
+	} else if stat, err := os.Stat(lb.path); err == nil {
+		// keep the modified time of the original
+		podutils.Chtimes(file, stat.ModTime(), stat.ModTime())
+	}
+
+	if lb.retained > 0 {
+		var pattern = filepath.Base(backupFilename(lb.path, "*"))
+		if err := podutils.RotateFiles(filepath.Dir(lb.path), pattern, uint(lb.retained)); err != nil {
+			log.Warnf("failed rotating db backups: %v", err)
+		}
+	}
+	return file, nil
+}
+
+// --------------------------------------------------------------------------
+// copies the db alongside the original (see backupFilename)
+func (pdb PodDB) backup() (string, error) {
+	db, err := pdb.open()
+	if err != nil {
+		return "", fmt.Errorf("error opening db: %w", err)
+	}
+
+	var (
+		ts   = podutils.Tern(config != nil && config.TimestampStr != "", config.TimestampStr, time.Now().Format(podutils.TimeFormatStr))
+		file = backupFilename(pdb.path, ts)
+	)
+	if err := vacuumInto(db, file); err != nil {
+		return "", err
+	} else if stat, err := os.Stat(pdb.path); err == nil {
+		// keep the modified time of the original
+		podutils.Chtimes(file, stat.ModTime(), stat.ModTime())
+	}
+	return file, nil
+}
+
+// --------------------------------------------------------------------------
+// checks the integrity of a database file, opened read only, and that its schema is one this version
+// of gopod can use (pending migrations are allowed).  Returns the schema state
+func verifyDBFile(path string) (*schemaState, error) {
+	// immutable; checks only what's in the file (which is all a restore copies)
+	pdb, err := openImmutableDB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer pdb.Close()
+	var gdb = pdb.db
+
+	var results = make([]string, 0)
+	if res := gdb.Raw("PRAGMA integrity_check").Scan(&results); res.Error != nil {
+		return nil, fmt.Errorf("integrity check failed: %w", res.Error)
+	} else if len(results) != 1 || results[0] != "ok" {
+		return nil, fmt.Errorf("integrity check failed: %v", strings.Join(results, "; "))
+	}
+
+	state, err := loadSchemaState(gdb)
+	if err != nil {
+		return nil, fmt.Errorf("not a usable gopod database: %w", err)
+	}
+	return state, nil
+}
+
+// --------------------------------------------------------------------------
+// replaces the main database with the backup from the commandline, after checking the backup.  The
+// current database is backed up first, so the restore can be undone
+func Restore() error {
+	if config == nil {
+		return errors.New("config is nil")
+	} else if config.RestoreFile == "" {
+		return errors.New("backup file cannot be empty")
+	}
+
+	var dbpath = DBPath(config.WorkspaceDir)
+	state, err := verifyDBFile(config.RestoreFile)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v: integrity ok, %v migration(s) applied, %v pending\n",
+		config.RestoreFile, len(state.applied), len(state.pending))
+
+	if yn, err := inputoption.RunYesNoSelection("Replace the current database with this backup?", inputoption.NO); err != nil {
+		log.Errorf("error in input selection; exiting: %v", err)
+		return err
+	} else if yn != inputoption.YES {
+		log.Info("not confirmed, exiting...")
+		return nil
+	}
+
+	if err := restoreDB(dbpath, config.RestoreFile); err != nil {
+		return err
+	}
+	fmt.Printf("%v restored from %v\n", dbpath, config.RestoreFile)
+	if len(state.pending) > 0 {
+		fmt.Println("backup is from an older version of gopod; run 'gopod db migrate' before using")
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// backs up the current db (if any), and copies the backup file in its place
+func restoreDB(dbpath, backupFile string) error {
+	if src, err := filepath.Abs(backupFile); err != nil {
+		return err
+	} else if dst, err := filepath.Abs(dbpath); err != nil {
+		return err
+	} else if src == dst {
+		return errors.New("cannot restore the database over itself")
+	}
+
+	if exists, err := podutils.FileExists(dbpath); err != nil {
+		return err
+	} else if exists {
+		pdb, err := openDB(dbpath)
+		if err != nil {
+			return fmt.Errorf("error opening current db: %w", err)
+		}
+		file, err := pdb.backup()
+		pdb.Close()
+		if err != nil {
+			return fmt.Errorf("backup of current db failed; not restoring: %w", err)
+		}
+		fmt.Printf("current database backed up to %v\n", file)
+	} else if err := podutils.MkdirAll(filepath.Dir(dbpath)); err != nil {
+		return err
+	}
+
+	// wal and shared memory belong to the replaced db; left behind they would be applied to the backup
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dbpath + suffix); err != nil && errors.Is(err, os.ErrNotExist) == false {
+			return fmt.Errorf("error removing %v: %w", dbpath+suffix, err)
+		}
+	}
+	if _, err := podutils.CopyFile(backupFile, dbpath); err != nil {
+		return fmt.Errorf("error copying backup: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package pod
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopod/podconfig"
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+func countChanges(t *testing.T, path string) int64 {
+	t.Helper()
+	pdb, err := openDB(path)
+	if err != nil {
+		t.Fatalf("error opening db: %v", err)
+	}
+	defer pdb.Close()
+
+	var count int64
+	if res := pdb.db.Model(&FeedChangeDBEntry{}).Count(&count); res.Error != nil {
+		t.Fatalf("error counting: %v", res.Error)
+	}
+	return count
+}
+
+func TestPodDB_EnableBackup(t *testing.T) {
+
+	var (
+		dir    = t.TempDir()
+		dbpath = DBPath(dir)
+	)
+
+	pdb, err := NewDB(dbpath)
+	testutils.AssertErr(t, false, err)
+	pdb.Close()
+
+	testutils.AssertErrContains(t, "poddb is not initialized", (&PodDB{}).EnableBackup("test", 1))
+
+	for i := 1; i <= 4; i++ {
+		var ts = fmt.Sprintf("t%v", i)
+		pdb, err := NewDB(dbpath)
+		testutils.AssertErr(t, false, err)
+		testutils.AssertErrContains(t, "timestamp cannot be empty", pdb.EnableBackup("", 2))
+		testutils.AssertErr(t, false, pdb.EnableBackup(ts, 2))
+
+		// reads don't back up
+		_, err = pdb.loadLatestFeedChanges(1)
+		testutils.AssertErr(t, false, err)
+		exists, _ := podutils.FileExists(backupFilename(dbpath, ts))
+		testutils.Assert(t, exists == false, "backup created before write")
+
+		// first write backs up the db as it was; later writes don't back up again
+		testutils.AssertErr(t, false, pdb.saveFeedChanges([]*FeedChangeDBEntry{{FeedId: 1}}))
+		testutils.AssertErr(t, false, pdb.WithTx(func(tx *PodDB) error {
+			return tx.saveFeedChanges([]*FeedChangeDBEntry{{FeedId: 1}})
+		}))
+		pdb.Close()
+
+		testutils.AssertEquals(t, int64((i-1)*2), countChanges(t, backupFilename(dbpath, ts)))
+		testutils.AssertEquals(t, int64(i*2), countChanges(t, dbpath))
+	}
+
+	// older backups rotated
+	matches, err := filepath.Glob(backupFilename(dbpath, "*"))
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, []string{backupFilename(dbpath, "t3"), backupFilename(dbpath, "t4")}, matches)
+}
+
+func Test_verifyDBFile(t *testing.T) {
+
+	var dir = t.TempDir()
+
+	type args struct {
+		// creates the file to verify
+		setup func(path string)
+	}
+	type exp struct {
+		pending int
+		errStr  string
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"not found", args{}, exp{errStr: "not found"}},
+		{"not a db", args{setup: func(path string) {
+			os.WriteFile(path, []byte("this is not a database, but is long enough to look like one"), 0644)
+		}}, exp{errStr: "integrity check failed"}},
+		{"newer schema", args{setup: func(path string) { createLegacyDb(t, path, 42) }},
+			exp{errStr: "not a usable gopod database"}},
+		{"pending migrations", args{setup: func(path string) { createLegacyDb(t, path, 5) }},
+			exp{pending: latestVersion() - 5}},
+		{"success", args{setup: func(path string) {
+			pdb, err := NewDB(path)
+			testutils.AssertErr(t, false, err)
+			pdb.Close()
+		}}, exp{}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path = filepath.Join(dir, fmt.Sprintf("test%v", i), "gopod.db")
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if tt.p.setup != nil {
+				tt.p.setup(path)
+			}
+
+			state, err := verifyDBFile(path)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			if err == nil {
+				testutils.AssertEquals(t, tt.e.pending, len(state.pending))
+			}
+		})
+	}
+}
+
+func Test_restoreDB(t *testing.T) {
+
+	var (
+		dir       = t.TempDir()
+		oldConfig = config
+		dbpath    = DBPath(dir)
+		backup    = filepath.Join(dir, "saved.db")
+	)
+	defer func() { config = oldConfig }()
+	config = &podconfig.Config{WorkspaceDir: dir, TimestampStr: "test"}
+
+	pdb, err := NewDB(dbpath)
+	testutils.AssertErr(t, false, err)
+	testutils.AssertErr(t, false, pdb.saveFeedChanges([]*FeedChangeDBEntry{{FeedId: 1}}))
+	testutils.AssertErr(t, false, vacuumInto(pdb.db, backup))
+	testutils.AssertErr(t, false, pdb.saveFeedChanges([]*FeedChangeDBEntry{{FeedId: 1}, {FeedId: 2}}))
+	pdb.Close()
+
+	testutils.AssertErrContains(t, "cannot restore the database over itself", restoreDB(dbpath, dbpath))
+
+	testutils.AssertErr(t, false, restoreDB(dbpath, backup))
+	testutils.AssertEquals(t, int64(1), countChanges(t, dbpath))
+
+	// db as it was before the restore
+	testutils.AssertEquals(t, int64(3), countChanges(t, backupFilename(dbpath, "test")))
+	exists, _ := podutils.FileExists(dbpath + "-wal")
+	testutils.Assert(t, exists == false, "wal of replaced db left behind")
+
+	// no current db; nothing to back up
+	var newpath = DBPath(filepath.Join(dir, "new"))
+	testutils.AssertErr(t, false, restoreDB(newpath, backup))
+	testutils.AssertEquals(t, int64(1), countChanges(t, newpath))
+}
@@ -0,0 +1,460 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	log "gopod/multilogger"
+	"gopod/podutils"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// catalog; a read only view over the main db and archive dbs, so the usual queries span both.  Sqlite
+// limits how many dbs can be attached at once, so archive dbs are copied into a catalog cache (next to
+// the main db) when first seen, and again only when they change.  A catalog connection attaches the
+// cache, and temp views named for the main tables union the main db with the cached rows of the archives
+// asked for; unqualified table names resolve to the temp schema first, so existing queries read thru the
+// views unchanged.
+//
+// The main db wins where an item (by hash), feed (by hash) or image (by url) is in both, and the first
+// archive cached where it's in more than one.  Cached rows are given ids from catalogIdBase up, so they
+// can't collide with main db ids; these ids are only valid until the archive db changes
+const (
+	catalogSchema  = "cat"
+	catalogSources = "CatalogSources"
+	catalogPrefix  = "Catalog"
+	// above any id the main db will reach
+	catalogIdBase int64 = 1 << 40
+)
+
+// tables spanned by the catalog, in the order the views are created; rows shown with a parent row
+// (xml) are created after it
+var catalogTables = []catalogTable{
+	{name: "FeedDBEntries", key: "Hash",
+		refs: map[string]string{"XmlId": "FeedXmlDBEntries"}},
+	{name: "FeedXmlDBEntries",
+		where: "EXISTS (SELECT 1 FROM temp." + catalogPrefix + "FeedDBEntries v WHERE v.XmlId = c.ID)"},
+	{name: "ItemDBEntries", key: "Hash",
+		refs: map[string]string{"XmlId": "ItemXmlDBEntries", "FeedId": "FeedDBEntries"}},
+	{name: "ItemXmlDBEntries",
+		where: "EXISTS (SELECT 1 FROM temp." + catalogPrefix + "ItemDBEntries v WHERE v.XmlId = c.ID) OR " +
+			"EXISTS (SELECT 1 FROM temp." + catalogPrefix + "ItemDBEntries v WHERE v.ID = c.ItemId)",
+		refs: map[string]string{"ItemId": "ItemDBEntries"}},
+	{name: "ImageDBEntries", key: "Url",
+		refs: map[string]string{"FeedId": "FeedDBEntries"}},
+}
+
+// cached feed id, mapped to the feed with the same hash in the main db, or the cached feed shown
+const catalogFeedId = "COALESCE(" +
+	"(SELECT m.ID FROM main.FeedDBEntries m JOIN " + catalogSchema + ".FeedDBEntries cf ON cf.Hash = m.Hash WHERE cf.ID = c.FeedId), " +
+	"(SELECT v.ID FROM temp." + catalogPrefix + "FeedDBEntries v JOIN " + catalogSchema + ".FeedDBEntries cf ON cf.Hash = v.Hash WHERE cf.ID = c.FeedId), " +
+	"c.FeedId)"
+
+type catalogTable struct {
+	name string
+	// the same row in the main db or another archive; cached rows are hidden by the main db's, and by
+	// those of the first archive cached
+	key string
+	// cached rows shown, for tables without a key
+	where string
+	// id columns referencing another table; offset along with that table's ids when cached
+	refs map[string]string
+}
+
+// archive db copied into the cache; size and mod time tell if it's changed since
+type catalogSource struct {
+	ID      int64  `gorm:"column:ID"`
+	File    string `gorm:"column:File"`
+	Size    int64  `gorm:"column:Size"`
+	ModTime int64  `gorm:"column:ModTime"`
+}
+
+// --------------------------------------------------------------------------
+// archive dbs for the feeds
+func archiveDbFiles(feeds ...*Feed) ([]string, error) {
+	var ret = make([]string, 0)
+	for _, f := range feeds {
+		if matches, err := filepath.Glob(filepath.Join(f.archivePath, "*", ".db", f.Shortname+".db")); err != nil {
+			return nil, err
+		} else {
+			ret = append(ret, matches...)
+		}
+	}
+	slices.Sort(ret)
+	return ret, nil
+}
+
+// --------------------------------------------------------------------------
+// cache of archive rows, kept alongside the main db
+func catalogCachePath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".catalog.db"
+}
+
+// --------------------------------------------------------------------------
+// catalog over the feeds' archive dbs
+func openFeedCatalog(feeds ...*Feed) (*PodDB, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	files, err := archiveDbFiles(feeds...)
+	if err != nil {
+		return nil, err
+	}
+	return db.openCatalog(files)
+}
+
+// --------------------------------------------------------------------------
+// opens a separate connection to the db, spanning the archive dbs; close when done.  Archive dbs that
+// can't be read, or aren't at the current schema version, are skipped
+func (pdb PodDB) openCatalog(archives []string) (*PodDB, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	}
+
+	var catalog = PodDB{path: pdb.path, config: pdb.config, catalog: true}
+	if gdb, err := gImpl.Open(sqlite.Open(pdb.path+"?"+dbConnParams), &catalog.config); err != nil {
+		return nil, fmt.Errorf("error opening catalog: %w", err)
+	} else if sqldb, err := gdb.SqlDB(); err != nil {
+		return nil, fmt.Errorf("error opening catalog: %w", err)
+	} else {
+		// attached dbs and temp views are per connection
+		sqldb.SetMaxOpenConns(1)
+		sqldb.SetMaxIdleConns(1)
+		catalog.db = gdb
+	}
+
+	if err := catalog.buildCatalog(archives); err != nil {
+		catalog.Close()
+		return nil, err
+	}
+	return &catalog, nil
+}
+
+// --------------------------------------------------------------------------
+func (pdb PodDB) buildCatalog(archives []string) error {
+	var db = pdb.db
+
+	columns := make(map[string][]tableColumn, len(catalogTables))
+	for _, table := range catalogTables {
+		cols, err := tableColumns(db, "main", table.name)
+		if err != nil {
+			return err
+		}
+		columns[table.name] = cols
+	}
+
+	var cachePath = catalogCachePath(pdb.path)
+	sources, err := refreshCatalogCache(cachePath, pdb.config, archives, columns)
+	if err != nil {
+		return err
+	}
+
+	if res := db.Exec("ATTACH DATABASE ? AS "+catalogSchema, cachePath); res.Error != nil {
+		return fmt.Errorf("error attaching catalog cache: %w", res.Error)
+	}
+
+	var ids = make([]string, 0, len(sources))
+	for _, id := range sources {
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	var inSources = podutils.Tern(len(ids) > 0, strings.Join(ids, ", "), "NULL")
+
+	for _, table := range catalogTables {
+		var (
+			names = make([]string, 0, len(columns[table.name]))
+			exprs = make([]string, 0, len(columns[table.name]))
+			shown = fmt.Sprintf("c.SourceId IN (%v)", inSources)
+		)
+		for _, c := range columns[table.name] {
+			names = append(names, c.Name)
+			exprs = append(exprs, podutils.Tern(c.Name == "FeedId", catalogFeedId, fmt.Sprintf(`c."%v"`, c.Name)))
+		}
+		if table.key != "" {
+			// only rows shadowed in the cache need checking against the archives asked for
+			shown += fmt.Sprintf(" AND c.%[1]v NOT IN (SELECT %[1]v FROM main.%[2]v WHERE %[1]v IS NOT NULL) "+
+				"AND (c.Shadowed = 0 OR NOT EXISTS (SELECT 1 FROM %[3]v.%[2]v c2 WHERE c2.%[1]v = c.%[1]v AND c2.ID < c.ID "+
+				"AND c2.SourceId IN (%[4]v)))",
+				table.key, table.name, catalogSchema, inSources)
+		} else {
+			shown += " AND (" + table.where + ")"
+		}
+
+		for _, sqlStr := range []string{
+			fmt.Sprintf("CREATE TEMP VIEW %v%v AS SELECT c.* FROM %v.%v c WHERE %v",
+				catalogPrefix, table.name, catalogSchema, table.name, shown),
+			fmt.Sprintf("CREATE TEMP VIEW %[1]v AS SELECT %[2]v FROM main.%[1]v UNION ALL SELECT %[3]v FROM temp.%[4]v%[1]v c",
+				table.name, quoteColumns(names), strings.Join(exprs, ", "), catalogPrefix),
+		} {
+			if res := db.Exec(sqlStr); res.Error != nil {
+				return fmt.Errorf("error creating catalog: %w", res.Error)
+			}
+		}
+	}
+
+	// nothing written thru the catalog
+	if res := db.Exec("PRAGMA query_only = 1"); res.Error != nil {
+		return fmt.Errorf("error creating catalog: %w", res.Error)
+	}
+	log.Debugf("catalog opened; %v of %v archive dbs", len(sources), len(archives))
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// copies archives into the cache that aren't there yet, or have changed since, and drops archives that
+// no longer exist.  Returns the cache source ids of the archives given
+func refreshCatalogCache(path string, config gorm.Config, archives []string, columns map[string][]tableColumn) ([]int64, error) {
+
+	var cache = PodDB{path: path, config: config}
+	if gdb, err := gImpl.Open(sqlite.Open(path+"?"+dbConnParams), &cache.config); err != nil {
+		return nil, fmt.Errorf("error opening catalog cache: %w", err)
+	} else if sqldb, err := gdb.SqlDB(); err != nil {
+		return nil, fmt.Errorf("error opening catalog cache: %w", err)
+	} else {
+		// archives are attached per connection
+		sqldb.SetMaxOpenConns(1)
+		sqldb.SetMaxIdleConns(1)
+		cache.db = gdb
+	}
+	defer cache.Close()
+
+	if err := cache.createCatalogCache(columns); err != nil {
+		return nil, err
+	}
+
+	var sources = make([]*catalogSource, 0)
+	if res := cache.db.Raw("SELECT ID, File, Size, ModTime FROM " + catalogSources).Scan(&sources); res.Error != nil {
+		return nil, fmt.Errorf("error loading catalog cache: %w", res.Error)
+	}
+	var (
+		ret     = make([]int64, 0, len(archives))
+		changed bool
+	)
+	for _, src := range sources {
+		if _, err := os.Stat(src.File); errors.Is(err, os.ErrNotExist) {
+			log.With("archive", src.File).Debug("archive db no longer exists; removed from catalog cache")
+			if err := cache.WithTx(func(tx *PodDB) error { return tx.dropCatalogSource(src.File) }); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+	}
+
+	for _, file := range archives {
+		var lg = log.With("archive", file)
+		stat, err := os.Stat(file)
+		if err != nil {
+			// a bad archive shouldn't hide the rest
+			lg.Warnf("archive db not included in catalog: %v", err)
+			continue
+		}
+
+		var idx = slices.IndexFunc(sources, func(src *catalogSource) bool { return src.File == file })
+		if idx >= 0 && sources[idx].Size == stat.Size() && sources[idx].ModTime == stat.ModTime().UnixNano() {
+			ret = append(ret, sources[idx].ID)
+			continue
+		}
+
+		var src = catalogSource{File: file, Size: stat.Size(), ModTime: stat.ModTime().UnixNano()}
+		if n, err := cache.cacheArchive(&src, columns); err != nil {
+			lg.Warnf("archive db not included in catalog: %v", err)
+		} else {
+			lg.Debugf("%v archived items added to catalog cache", n)
+			ret = append(ret, src.ID)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := cache.shadowCatalogRows(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// --------------------------------------------------------------------------
+// flags cached rows with the same key as an earlier one; done as archives change, so the catalog
+// views don't compare every row
+func (pdb PodDB) shadowCatalogRows() error {
+	return pdb.WithTx(func(tx *PodDB) error {
+		for _, table := range catalogTables {
+			if table.key == "" {
+				continue
+			}
+			var sqlStr = fmt.Sprintf("UPDATE %[1]v SET Shadowed = EXISTS (SELECT 1 FROM %[1]v c2 "+
+				"WHERE c2.%[2]v = %[1]v.%[2]v AND c2.ID < %[1]v.ID)", table.name, table.key)
+			if res := tx.db.Exec(sqlStr); res.Error != nil {
+				return fmt.Errorf("error updating catalog cache: %w", res.Error)
+			}
+		}
+		return nil
+	})
+}
+
+// --------------------------------------------------------------------------
+// creates the cache tables (columns as in the main db, and the archive they came from) with a search
+// index; recreated when the schema version changes
+func (pdb PodDB) createCatalogCache(columns map[string][]tableColumn) error {
+	var version int
+	if res := pdb.db.Raw("PRAGMA user_version").Scan(&version); res.Error != nil {
+		return fmt.Errorf("error checking catalog cache version: %w", res.Error)
+	} else if version == latestVersion() {
+		return nil
+	}
+
+	return pdb.WithTx(func(tx *PodDB) error {
+		var sqlStrs = []string{
+			"DROP TABLE IF EXISTS " + searchTable,
+			"DROP TABLE IF EXISTS " + catalogSources,
+			"CREATE TABLE " + catalogSources + " (ID integer PRIMARY KEY AUTOINCREMENT, File text UNIQUE, Size integer, ModTime integer)",
+		}
+		for _, table := range catalogTables {
+			var defs = make([]string, 0, len(columns[table.name])+1)
+			for _, c := range columns[table.name] {
+				// declared types kept, so the view's columns scan as the main table's do (eg datetimes)
+				defs = append(defs, fmt.Sprintf(`"%v" %v`, c.Name, c.Type)+podutils.Tern(c.Name == "ID", " PRIMARY KEY", ""))
+			}
+			// shadowed if an earlier cached row has the same key
+			defs = append(defs, "SourceId integer", "Shadowed numeric DEFAULT 0")
+
+			sqlStrs = append(sqlStrs,
+				"DROP TABLE IF EXISTS "+table.name,
+				fmt.Sprintf("CREATE TABLE %v (%v)", table.name, strings.Join(defs, ", ")),
+				fmt.Sprintf("CREATE INDEX idx_%[1]v_SourceId ON %[1]v(SourceId)", table.name))
+			if table.key != "" {
+				sqlStrs = append(sqlStrs, fmt.Sprintf("CREATE INDEX idx_%[1]v_%[2]v ON %[1]v(%[2]v, SourceId)", table.name, table.key))
+			}
+			for col := range table.refs {
+				sqlStrs = append(sqlStrs, fmt.Sprintf("CREATE INDEX idx_%[1]v_%[2]v ON %[1]v(%[2]v)", table.name, col))
+			}
+		}
+		for _, sqlStr := range sqlStrs {
+			if res := tx.db.Exec(sqlStr); res.Error != nil {
+				return fmt.Errorf("error creating catalog cache: %w", res.Error)
+			}
+		}
+
+		// same index (and triggers) as the main db, so cached xml is searchable
+		if err := createSearchIndex(tx.db); err != nil {
+			return err
+		} else if res := tx.db.Exec(fmt.Sprintf("PRAGMA user_version = %v", latestVersion())); res.Error != nil {
+			return fmt.Errorf("error setting catalog cache version: %w", res.Error)
+		}
+		return nil
+	})
+}
+
+// --------------------------------------------------------------------------
+// replaces the archive's rows in the cache; returns the number of items copied
+func (pdb PodDB) cacheArchive(src *catalogSource, columns map[string][]tableColumn) (int, error) {
+	var db = pdb.db
+
+	uri := "file:" + filepath.ToSlash(src.File) + "?mode=ro"
+	if res := db.Exec("ATTACH DATABASE ? AS arc", uri); res.Error != nil {
+		return 0, res.Error
+	}
+	defer db.Exec("DETACH DATABASE arc")
+
+	var version int
+	if res := db.Raw("SELECT COALESCE(MAX(Version), 0) FROM arc." + migrationTable).Scan(&version); res.Error != nil {
+		return 0, fmt.Errorf("error checking schema version: %w", res.Error)
+	} else if version != latestVersion() {
+		return 0, fmt.Errorf("schema version %v doesn't match %v (run 'gopod db migrate')", version, latestVersion())
+	}
+
+	var items int
+	err := pdb.WithTx(func(tx *PodDB) error {
+		if err := tx.dropCatalogSource(src.File); err != nil {
+			return err
+		}
+		var sqlStr = "INSERT INTO " + catalogSources + " (File, Size, ModTime) VALUES (?, ?, ?) RETURNING ID"
+		if res := tx.db.Raw(sqlStr, src.File, src.Size, src.ModTime).Scan(&src.ID); res.Error != nil {
+			return fmt.Errorf("error recording archive: %w", res.Error)
+		}
+
+		// every offset taken before copying, so remapped references match
+		var offsets = make(map[string]int64, len(catalogTables))
+		for _, table := range catalogTables {
+			var maxId int64
+			if res := tx.db.Raw("SELECT COALESCE(MAX(ID), 0) FROM " + table.name).Scan(&maxId); res.Error != nil {
+				return res.Error
+			}
+			offsets[table.name] = max(maxId, catalogIdBase)
+		}
+
+		for _, table := range catalogTables {
+			var (
+				cols  = columns[table.name]
+				names = make([]string, 0, len(cols))
+				exprs = make([]string, 0, len(cols))
+			)
+			for _, c := range cols {
+				names = append(names, c.Name)
+				if ref, exists := table.refs[c.Name]; exists {
+					exprs = append(exprs, fmt.Sprintf(`a."%v" + %v`, c.Name, offsets[ref]))
+				} else if c.Name == "ID" {
+					exprs = append(exprs, fmt.Sprintf(`a."%v" + %v`, c.Name, offsets[table.name]))
+				} else {
+					exprs = append(exprs, fmt.Sprintf(`a."%v"`, c.Name))
+				}
+			}
+			var sqlStr = fmt.Sprintf("INSERT INTO %v (%v, SourceId) SELECT %v, ? FROM arc.%v a",
+				table.name, quoteColumns(names), strings.Join(exprs, ", "), table.name)
+			res := tx.db.Exec(sqlStr, src.ID)
+			if res.Error != nil {
+				return fmt.Errorf("error copying %v: %w", table.name, res.Error)
+			} else if table.name == "ItemDBEntries" {
+				items = int(res.RowsAffected)
+			}
+		}
+		return nil
+	})
+	return items, err
+}
+
+// --------------------------------------------------------------------------
+// removes the archive's rows from the cache
+func (pdb PodDB) dropCatalogSource(file string) error {
+	for _, table := range catalogTables {
+		var sqlStr = fmt.Sprintf("DELETE FROM %v WHERE SourceId IN (SELECT ID FROM %v WHERE File = ?)", table.name, catalogSources)
+		if res := pdb.db.Exec(sqlStr, file); res.Error != nil {
+			return fmt.Errorf("error removing cached %v: %w", table.name, res.Error)
+		}
+	}
+	if res := pdb.db.Exec("DELETE FROM "+catalogSources+" WHERE File = ?", file); res.Error != nil {
+		return fmt.Errorf("error removing cached archive: %w", res.Error)
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+type tableColumn struct {
+	Name string `gorm:"column:name"`
+	Type string `gorm:"column:type"`
+}
+
+func tableColumns(db gormDBInterface, schema, table string) ([]tableColumn, error) {
+	var cols = make([]tableColumn, 0)
+	if res := db.Raw(fmt.Sprintf("PRAGMA %v.table_info(%v)", schema, table)).Scan(&cols); res.Error != nil {
+		return nil, fmt.Errorf("error reading columns for %v: %w", table, res.Error)
+	} else if len(cols) == 0 {
+		return nil, fmt.Errorf("table %v not found", table)
+	}
+	return cols, nil
+}
+
+// --------------------------------------------------------------------------
+func quoteColumns(cols []string) string {
+	var quoted = make([]string, 0, len(cols))
+	for _, col := range cols {
+		quoted = append(quoted, fmt.Sprintf(`"%v"`, col))
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,173 @@
+package pod
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gopod/testutils"
+)
+
+func TestPodDB_openCatalog(t *testing.T) {
+
+	var dir = t.TempDir()
+
+	var newDB = func(name string) *PodDB {
+		pdb, err := NewDB(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("error creating db: %v", err)
+		}
+		return pdb
+	}
+	// saves the feed with items; ids set are kept, as when archiving from the main db
+	var saveFeed = func(pdb *PodDB, id uint, hash string, items ...*ItemDBEntry) {
+		var feed = FeedDBEntry{PodDBModel: PodDBModel{ID: id}, Hash: hash, DBShortname: hash, XmlFeedData: &FeedXmlDBEntry{}}
+		testutils.AssertErr(t, false, pdb.saveFeed(&feed))
+		for _, item := range items {
+			item.FeedId = id
+		}
+		if len(items) > 0 {
+			testutils.AssertErr(t, false, pdb.saveItems(items...))
+		}
+	}
+	var newItem = func(id uint, hash, title string) *ItemDBEntry {
+		var i = generateItem(0, true)
+		i.ID, i.Hash, i.XmlId, i.XmlData.ID, i.XmlData.Title = id, hash, id, id, title
+		return &i
+	}
+
+	// main db; i1 is archived, i2 isn't
+	var main = newDB("gopod.db")
+	defer main.Close()
+	saveFeed(main, 1, "foo", newItem(1, "i1", "main one"), newItem(2, "i2", "main two"))
+
+	var archives = make([]string, 0)
+	// archive of foo; i1 is in both, i3 is only archived, with ids used by i2 in the main db
+	var arc = newDB("foo.2020.db")
+	saveFeed(arc, 1, "foo", newItem(1, "i1", "archived one"), newItem(2, "i3", "archived three"))
+	arc.Close()
+	archives = append(archives, arc.path)
+
+	// feed only in archives; more archives than sqlite can attach at once
+	for i := range 12 {
+		var arc = newDB(fmt.Sprintf("bar.%v.db", 2000+i))
+		saveFeed(arc, 5, "bar", newItem(uint(10+i), fmt.Sprintf("b%v", i), "bar episode"))
+		arc.Close()
+		archives = append(archives, arc.path)
+	}
+
+	// unreadable archive skipped
+	var corrupt = filepath.Join(dir, "corrupt.db")
+	testutils.AssertErr(t, false, os.WriteFile(corrupt, []byte("foobar"), 0644))
+	archives = append(archives, corrupt)
+
+	catalog, err := main.openCatalog(archives)
+	if err != nil {
+		t.Fatalf("error opening catalog: %v", err)
+	}
+	defer catalog.Close()
+
+	var opt = loadOptions{dontCreate: true, includeXml: true, direction: cASC}
+
+	// main db wins; archive only item given a new id, keeping its xml
+	items, err := catalog.loadFeedItems(1, AllItems, opt)
+	testutils.AssertErr(t, false, err)
+	var titles = make(map[string]string)
+	for _, item := range items {
+		titles[item.Hash] = item.XmlData.Title
+	}
+	testutils.AssertEquals(t, map[string]string{"i1": "main one", "i2": "main two", "i3": "archived three"}, titles)
+	var ids = make([]uint, 0)
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	slices.Sort(ids)
+	testutils.AssertEquals(t, 3, len(slices.Compact(ids)))
+
+	// feed only in archives
+	var bar = FeedDBEntry{Hash: "bar"}
+	testutils.AssertErr(t, false, catalog.loadFeed(&bar, opt))
+	testutils.Assert(t, bar.ID > 1, "archive only feed id not remapped")
+	items, err = catalog.loadFeedItems(bar.ID, AllItems, opt)
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, 12, len(items))
+
+	// search spans both
+	results, err := catalog.searchItems("archived", searchOptions{})
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, 1, len(results))
+	testutils.AssertEquals(t, "archived three", results[0].Title)
+
+	// main db unchanged, and not writable thru the catalog
+	items, err = main.loadFeedItems(1, AllItems, opt)
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, 2, len(items))
+	testutils.AssertErr(t, true, catalog.saveItems(newItem(99, "i99", "foo")))
+
+	// cache reused while archives are unchanged
+	var loadSources = func(pdb *PodDB) map[string]int64 {
+		var sources = make([]*catalogSource, 0)
+		testutils.AssertErr(t, false, pdb.db.Raw("SELECT ID, File FROM "+catalogSchema+"."+catalogSources).Scan(&sources).Error)
+		var ret = make(map[string]int64)
+		for _, src := range sources {
+			ret[filepath.Base(src.File)] = src.ID
+		}
+		return ret
+	}
+	var sources = loadSources(catalog)
+	testutils.AssertEquals(t, 13, len(sources))
+	var reopen = func() *PodDB {
+		c, err := main.openCatalog(archives)
+		if err != nil {
+			t.Fatalf("error opening catalog: %v", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	testutils.AssertEquals(t, sources, loadSources(reopen()))
+
+	// changed archive copied again, the rest kept
+	arc = newDB("foo.2020.db")
+	saveFeed(arc, 1, "foo", newItem(3, "i4", "archived four"))
+	arc.Close()
+	catalog = reopen()
+	var changed = loadSources(catalog)
+	testutils.Assert(t, changed["foo.2020.db"] != sources["foo.2020.db"], "changed archive not copied again")
+	testutils.AssertEquals(t, sources["bar.2000.db"], changed["bar.2000.db"])
+	items, err = catalog.loadFeedItems(1, AllItems, opt)
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, 4, len(items))
+
+	// removed archive dropped from the cache
+	testutils.AssertErr(t, false, os.Remove(archives[1]))
+	archives = slices.Delete(archives, 1, 2)
+	catalog = reopen()
+	testutils.AssertEquals(t, 12, len(loadSources(catalog)))
+	// the feed's id came from the removed archive
+	bar = FeedDBEntry{Hash: "bar"}
+	testutils.AssertErr(t, false, catalog.loadFeed(&bar, opt))
+	items, err = catalog.loadFeedItems(bar.ID, AllItems, opt)
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, 11, len(items))
+
+	// item saved to the main db later wins over the cached one
+	saveFeed(main, 1, "foo", newItem(3, "i3", "main three"))
+	catalog = reopen()
+	items, err = catalog.loadFeedItems(1, AllItems, opt)
+	testutils.AssertErr(t, false, err)
+	titles = make(map[string]string)
+	for _, item := range items {
+		titles[item.Hash] = item.XmlData.Title
+	}
+	testutils.AssertEquals(t, map[string]string{"i1": "main one", "i2": "main two", "i3": "main three", "i4": "archived four"}, titles)
+
+	// no archives; just the main db
+	empty, err := main.openCatalog(nil)
+	testutils.AssertErr(t, false, err)
+	defer empty.Close()
+	items, err = empty.loadFeedItems(1, AllItems, opt)
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, 3, len(items))
+}
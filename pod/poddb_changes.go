@@ -0,0 +1,58 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+
+	log "gopod/multilogger"
+)
+
+// --------------------------------------------------------------------------
+func (pdb PodDB) saveFeedChanges(changes []*FeedChangeDBEntry) error {
+	if pdb.path == "" {
+		return errors.New("poddb is not initialized; call NewDB() first")
+	} else if len(changes) == 0 {
+		return errors.New("change list is empty")
+	}
+	for _, ch := range changes {
+		if ch == nil {
+			return errors.New("change cannot be nil")
+		} else if ch.FeedId == 0 {
+			return errors.New("change feed id cannot be zero")
+		}
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return fmt.Errorf("error opening db: %w", err)
+	}
+
+	var res = db.Save(changes)
+	log.Debugf("rows affected: %v", res.RowsAffected)
+	return res.Error
+}
+
+// --------------------------------------------------------------------------
+// changes from the most recent fetch of the feed that had any, in the order found
+func (pdb PodDB) loadLatestFeedChanges(feedId uint) ([]*FeedChangeDBEntry, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	} else if feedId == 0 {
+		return nil, errors.New("feed id cannot be zero")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	}
+
+	var (
+		list  = make([]*FeedChangeDBEntry, 0)
+		where = "FeedId = ? AND FetchedAt = (SELECT MAX(FetchedAt) FROM FeedChangeDBEntries WHERE FeedId = ?)"
+	)
+	if res := db.Where(where, feedId, feedId).Order("ID").Find(&list); res.Error != nil {
+		return nil, res.Error
+	}
+	log.Debugf("changes found: %v", len(list))
+	return list, nil
+}
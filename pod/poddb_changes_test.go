@@ -0,0 +1,141 @@
+package pod
+
+import (
+	"gopod/podutils"
+	"gopod/testutils"
+	"testing"
+	"time"
+)
+
+func TestPodDB_saveFeedChanges(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var defStack = []stackType{open, save}
+	if err := gmock.mockdb.DB.AutoMigrate(&FeedChangeDBEntry{}); err != nil {
+		t.Fatalf("error in automigrate: %v", err)
+	}
+
+	type args struct {
+		emptyPath bool
+		changes   []*FeedChangeDBEntry
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty path", args{emptyPath: true, changes: []*FeedChangeDBEntry{{FeedId: 1}}},
+			exp{errStr: "poddb is not initialized"}},
+		{"empty list", args{}, exp{errStr: "change list is empty"}},
+		{"nil change", args{changes: []*FeedChangeDBEntry{nil}}, exp{errStr: "change cannot be nil"}},
+		{"feed id zero", args{changes: []*FeedChangeDBEntry{{}}}, exp{errStr: "change feed id cannot be zero"}},
+		{"open error", args{openErr: true, changes: []*FeedChangeDBEntry{{FeedId: 1}}},
+			exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"save error", args{termErr: save, changes: []*FeedChangeDBEntry{{FeedId: 1}}},
+			exp{errStr: "save:foobar", callStack: defStack}},
+
+		{"success", args{changes: []*FeedChangeDBEntry{
+			{FeedId: 1, FeedChange: FeedChange{Kind: changeChannel, Field: "Title", Old: "foo", New: "bar"}},
+			{FeedId: 1, FeedChange: FeedChange{Kind: changeRemoved, ItemHash: "foo1", Title: "ep1"}}}},
+			exp{callStack: defStack}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			err := poddb.saveFeedChanges(tt.p.changes)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			if err == nil {
+				for _, ch := range tt.p.changes {
+					var dbEntry FeedChangeDBEntry
+					res := gmock.mockdb.DB.First(&dbEntry, ch.ID)
+					testutils.AssertErr(t, false, res.Error)
+					testutils.AssertEquals(t, ch.FeedChange, dbEntry.FeedChange)
+				}
+			}
+		})
+	}
+}
+
+func TestPodDB_loadLatestFeedChanges(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var (
+		date     = time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+		defStack = []stackType{open, where, order, find}
+		changes  = []*FeedChangeDBEntry{
+			{FeedId: 1, FetchedAt: date, FeedChange: FeedChange{Kind: changeChannel, Field: "Title"}},
+			{FeedId: 1, FetchedAt: date.AddDate(0, 0, 1), FeedChange: FeedChange{Kind: changeRemoved, ItemHash: "a"}},
+			{FeedId: 1, FetchedAt: date.AddDate(0, 0, 1), FeedChange: FeedChange{Kind: changeReordered}},
+			{FeedId: 2, FetchedAt: date.AddDate(0, 0, 2), FeedChange: FeedChange{Kind: changeItem, Field: "Title"}},
+		}
+	)
+	if err := gmock.mockdb.DB.AutoMigrate(&FeedChangeDBEntry{}); err != nil {
+		t.Fatalf("error in automigrate: %v", err)
+	} else if res := gmock.mockdb.DB.Create(changes); res.Error != nil {
+		t.Fatalf("error in insert: %v", res.Error)
+	}
+
+	type args struct {
+		emptyPath bool
+		feedId    uint
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		kinds     []string
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty path", args{emptyPath: true, feedId: 1}, exp{errStr: "poddb is not initialized"}},
+		{"feed id zero", args{}, exp{errStr: "feed id cannot be zero"}},
+		{"open error", args{openErr: true, feedId: 1}, exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"find error", args{termErr: find, feedId: 1}, exp{errStr: "find:foobar", callStack: defStack}},
+
+		{"latest fetch only", args{feedId: 1}, exp{kinds: []string{changeRemoved, changeReordered}, callStack: defStack}},
+		{"other feed", args{feedId: 2}, exp{kinds: []string{changeItem}, callStack: defStack}},
+		{"no changes", args{feedId: 3}, exp{kinds: []string{}, callStack: defStack}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			list, err := poddb.loadLatestFeedChanges(tt.p.feedId)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			if err == nil {
+				var kinds = make([]string, 0, len(list))
+				for _, ch := range list {
+					kinds = append(kinds, ch.Kind)
+				}
+				testutils.AssertEquals(t, tt.e.kinds, kinds)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "gopod/multilogger"
+	"gopod/podutils"
+)
+
+// rows deleted within this window before the feed are considered deleted along with it; items
+// deleted separately before that (i.e. collision handling) stay deleted on undelete
+const undeleteWindow = 10 * time.Minute
+
+// rows affected by undelete/purge, per table
+type deletedCounts struct {
+	Feeds   int64
+	FeedXml int64
+	Items   int64
+	ItemXml int64
+	Images  int64
+	Runs    int64
+	Changes int64
+}
+
+func (dc deletedCounts) total() int64 {
+	return dc.Feeds + dc.FeedXml + dc.Items + dc.ItemXml + dc.Images + dc.Runs + dc.Changes
+}
+
+// --------------------------------------------------------------------------
+// all soft deleted feeds, oldest first
+func (pdb PodDB) loadDeletedFeeds() ([]*FeedDBEntry, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	}
+
+	var feedlist = make([]*FeedDBEntry, 0)
+	if res := db.Unscoped().Where("DeletedAt IS NOT NULL").Order("ID").Find(&feedlist); res.Error != nil {
+		return nil, res.Error
+	}
+	log.Debugf("deleted feeds found: %v", len(feedlist))
+	return feedlist, nil
+}
+
+// --------------------------------------------------------------------------
+// restores a soft deleted feed, along with its xml, and the items (and item xml) and images deleted
+// with it
+func (pdb PodDB) undeleteFeed(feed *FeedDBEntry) (*deletedCounts, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	} else if feed == nil {
+		return nil, errors.New("feed cannot be nil")
+	} else if feed.ID == 0 {
+		return nil, errors.New("feed id cannot be zero; make sure it is loaded first")
+	} else if feed.DeletedAt.Valid == false {
+		return nil, errors.New("feed is not deleted")
+	}
+
+	var counts deletedCounts
+	err := pdb.WithTx(func(tx *PodDB) error {
+		var (
+			db       = tx.db
+			since    = feed.DeletedAt.Time.Add(-undeleteWindow)
+			restore  = map[string]any{"DeletedAt": nil}
+			itemlist = make([]*ItemDBEntry, 0)
+			imglist  = make([]*ImageDBEntry, 0)
+		)
+
+		// timestamps are stored as text; filtering on deleted time is done here rather than in sql
+		if res := db.Unscoped().Where("FeedId = ? AND DeletedAt IS NOT NULL", feed.ID).Find(&itemlist); res.Error != nil {
+			return fmt.Errorf("error finding items: %w", res.Error)
+		} else if res := db.Unscoped().Where("FeedId = ? AND DeletedAt IS NOT NULL", feed.ID).Find(&imglist); res.Error != nil {
+			return fmt.Errorf("error finding images: %w", res.Error)
+		}
+
+		var itemIds, xmlIds, imgIds = make([]uint, 0), make([]uint, 0), make([]uint, 0)
+		for _, item := range itemlist {
+			if item.DeletedAt.Time.Before(since) == false {
+				itemIds = append(itemIds, item.ID)
+				if item.XmlId != 0 {
+					xmlIds = append(xmlIds, item.XmlId)
+				}
+			}
+		}
+		for _, img := range imglist {
+			if img.DeletedAt.Time.Before(since) == false {
+				imgIds = append(imgIds, img.ID)
+			}
+		}
+		log.Debugf("restoring items: %v (of %v deleted), images: %v (of %v deleted)",
+			len(itemIds), len(itemlist), len(imgIds), len(imglist))
+
+		for _, chunk := range podutils.Chunk(xmlIds, 100) {
+			var res = db.Unscoped().Model(&ItemXmlDBEntry{}).Where("ID IN ?", chunk).Updates(restore)
+			if res.Error != nil {
+				return fmt.Errorf("failed restoring item xml: %w", res.Error)
+			}
+			counts.ItemXml += res.RowsAffected
+		}
+		for _, chunk := range podutils.Chunk(itemIds, 100) {
+			var res = db.Unscoped().Model(&ItemDBEntry{}).Where("ID IN ?", chunk).Updates(restore)
+			if res.Error != nil {
+				return fmt.Errorf("failed restoring items: %w", res.Error)
+			}
+			counts.Items += res.RowsAffected
+
+			// previous xml revisions, deleted along with the item
+			res = db.Unscoped().Model(&ItemXmlDBEntry{}).Where("ItemId IN ? AND DeletedAt IS NOT NULL", chunk).Updates(restore)
+			if res.Error != nil {
+				return fmt.Errorf("failed restoring item xml revisions: %w", res.Error)
+			}
+			counts.ItemXml += res.RowsAffected
+		}
+		for _, chunk := range podutils.Chunk(imgIds, 100) {
+			var res = db.Unscoped().Model(&ImageDBEntry{}).Where("ID IN ?", chunk).Updates(restore)
+			if res.Error != nil {
+				return fmt.Errorf("failed restoring images: %w", res.Error)
+			}
+			counts.Images += res.RowsAffected
+		}
+
+		if feed.XmlId != 0 {
+			var res = db.Unscoped().Model(&FeedXmlDBEntry{}).Where("ID = ?", feed.XmlId).Updates(restore)
+			if res.Error != nil {
+				return fmt.Errorf("failed restoring feed xml: %w", res.Error)
+			}
+			counts.FeedXml = res.RowsAffected
+		}
+
+		var res = db.Unscoped().Model(&FeedDBEntry{}).Where("ID = ?", feed.ID).Updates(restore)
+		if res.Error != nil {
+			return fmt.Errorf("failed restoring feed: %w", res.Error)
+		}
+		counts.Feeds = res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	feed.DeletedAt.Valid = false
+
+	return &counts, nil
+}
+
+// --------------------------------------------------------------------------
+// permanently removes soft deleted rows, and run history and change logs for deleted feeds.  If feed ids are given,
+// only rows for those feeds are removed.  Dry run only counts the rows that would be removed
+func (pdb PodDB) purgeDeleted(feedIds []uint, dryRun bool) (*deletedCounts, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	}
+
+	var (
+		counts deletedCounts
+		// ordered so rows referenced in subqueries are removed last
+		steps = []struct {
+			name       string
+			model      any
+			count      *int64
+			where      string
+			feedFilter string
+		}{
+			{"item xml", &ItemXmlDBEntry{}, &counts.ItemXml, "DeletedAt IS NOT NULL",
+				"ID IN (SELECT XmlId FROM ItemDBEntries WHERE FeedId IN ?) OR " +
+					"ItemId IN (SELECT ID FROM ItemDBEntries WHERE FeedId IN ?)"},
+			{"items", &ItemDBEntry{}, &counts.Items, "DeletedAt IS NOT NULL", "FeedId IN ?"},
+			{"images", &ImageDBEntry{}, &counts.Images, "DeletedAt IS NOT NULL", "FeedId IN ?"},
+			{"feed xml", &FeedXmlDBEntry{}, &counts.FeedXml, "DeletedAt IS NOT NULL",
+				"ID IN (SELECT XmlId FROM FeedDBEntries WHERE ID IN ?)"},
+			{"runs", &RunDBEntry{}, &counts.Runs, "FeedId IN (SELECT ID FROM FeedDBEntries WHERE DeletedAt IS NOT NULL)",
+				"FeedId IN ?"},
+			{"changes", &FeedChangeDBEntry{}, &counts.Changes,
+				"FeedId IN (SELECT ID FROM FeedDBEntries WHERE DeletedAt IS NOT NULL)", "FeedId IN ?"},
+			{"feeds", &FeedDBEntry{}, &counts.Feeds, "DeletedAt IS NOT NULL", "ID IN ?"},
+		}
+	)
+
+	// all or nothing
+	err := pdb.WithTx(func(tx *PodDB) error {
+		var db = tx.db
+
+		for _, step := range steps {
+			var (
+				where = step.where
+				args  = make([]any, 0, 1)
+			)
+			if len(feedIds) > 0 {
+				where += " AND (" + step.feedFilter + ")"
+				for range strings.Count(step.feedFilter, "?") {
+					args = append(args, feedIds)
+				}
+			}
+
+			if res := db.Unscoped().Model(step.model).Where(where, args...).Count(step.count); res.Error != nil {
+				return fmt.Errorf("failed counting %v: %w", step.name, res.Error)
+			} else if dryRun || *step.count == 0 {
+				continue
+			}
+
+			if res := db.Unscoped().Where(where, args...).Delete(step.model); res.Error != nil {
+				return fmt.Errorf("failed purging %v: %w", step.name, res.Error)
+			} else {
+				log.Debugf("%v purged, rows: %v", step.name, res.RowsAffected)
+				*step.count = res.RowsAffected
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &counts, nil
+}
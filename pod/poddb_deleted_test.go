@@ -0,0 +1,281 @@
+package pod
+
+import (
+	"gopod/podutils"
+	"gopod/testutils"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrates tables and inserts entries (deleted or otherwise)
+func seedDeleted(t *testing.T, gdb *gorm.DB, entries ...any) {
+	t.Helper()
+	if err := gdb.AutoMigrate(&FeedDBEntry{}, &FeedXmlDBEntry{}, &ItemDBEntry{}, &ItemXmlDBEntry{},
+		&ImageDBEntry{}, &RunDBEntry{}, &FeedChangeDBEntry{}); err != nil {
+		t.Fatalf("error in automigrate: %v", err)
+	}
+	for _, e := range entries {
+		if res := gdb.Create(e); res.Error != nil {
+			t.Fatalf("error in insert: %v", res.Error)
+		}
+	}
+}
+
+func deletedAt(tm time.Time) PodDBModel {
+	return PodDBModel{DeletedAt: gorm.DeletedAt{Time: tm, Valid: true}}
+}
+
+func TestPodDB_loadDeletedFeeds(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var now = time.Now()
+	seedDeleted(t, gmock.mockdb.DB,
+		&FeedDBEntry{Hash: "foo", DBShortname: "foo", PodDBModel: deletedAt(now)},
+		&FeedDBEntry{Hash: "bar", DBShortname: "bar"},
+		&FeedDBEntry{Hash: "baz", DBShortname: "baz", PodDBModel: deletedAt(now)},
+	)
+
+	type args struct {
+		emptyPath bool
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		shortnames []string
+		errStr     string
+		callStack  []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty path", args{emptyPath: true}, exp{errStr: "poddb is not initialized"}},
+		{"open error", args{openErr: true}, exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"find error", args{termErr: find},
+			exp{errStr: "find:foobar", callStack: []stackType{open, unscoped, where, order, find}}},
+		{"success", args{},
+			exp{shortnames: []string{"foo", "baz"}, callStack: []stackType{open, unscoped, where, order, find}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			list, err := poddb.loadDeletedFeeds()
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			if err == nil {
+				var shortnames = make([]string, 0, len(list))
+				for _, fe := range list {
+					shortnames = append(shortnames, fe.DBShortname)
+				}
+				testutils.AssertEquals(t, tt.e.shortnames, shortnames)
+			}
+		})
+	}
+}
+
+func TestPodDB_undeleteFeed(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var (
+		now     = time.Now().Truncate(time.Second)
+		earlier = now.AddDate(0, 0, -2) // deleted before the feed, i.e. collision handling
+		feed    = FeedDBEntry{PodDBModel: PodDBModel{ID: 1, DeletedAt: deletedAt(now).DeletedAt},
+			Hash: "foo", XmlId: 1}
+		findStack    = []stackType{open, transaction, unscoped, where, find, unscoped, where, find}
+		restoreStack = []stackType{unscoped, model, where, updates}
+	)
+	seedDeleted(t, gmock.mockdb.DB,
+		&feed,
+		&FeedXmlDBEntry{PodDBModel: deletedAt(now)},
+		&ItemXmlDBEntry{PodDBModel: deletedAt(now)},
+		&ItemXmlDBEntry{PodDBModel: deletedAt(now)},
+		&ItemXmlDBEntry{PodDBModel: deletedAt(earlier)},
+		// previous revisions
+		&ItemXmlDBEntry{PodDBModel: deletedAt(now), ItemId: 1},
+		&ItemXmlDBEntry{PodDBModel: deletedAt(earlier), ItemId: 3},
+		&ItemDBEntry{PodDBModel: deletedAt(now.Add(-time.Second)), Hash: "i1", FeedId: 1, XmlId: 1},
+		&ItemDBEntry{PodDBModel: deletedAt(now.Add(-time.Second)), Hash: "i2", FeedId: 1, XmlId: 2},
+		&ItemDBEntry{PodDBModel: deletedAt(earlier), Hash: "i3", FeedId: 1, XmlId: 3},
+		&ImageDBEntry{PodDBModel: deletedAt(now), FeedId: 1},
+		&ImageDBEntry{PodDBModel: deletedAt(earlier), FeedId: 1},
+	)
+
+	type args struct {
+		emptyPath bool
+		feed      *FeedDBEntry
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		counts    deletedCounts
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty path", args{emptyPath: true, feed: &feed}, exp{errStr: "poddb is not initialized"}},
+		{"nil feed", args{}, exp{errStr: "feed cannot be nil"}},
+		{"zero id", args{feed: &FeedDBEntry{PodDBModel: deletedAt(now)}}, exp{errStr: "feed id cannot be zero"}},
+		{"not deleted", args{feed: &FeedDBEntry{PodDBModel: PodDBModel{ID: 1}}}, exp{errStr: "feed is not deleted"}},
+		{"open error", args{openErr: true, feed: &feed}, exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"find error", args{termErr: find, feed: &feed},
+			exp{errStr: "find:foobar", callStack: []stackType{open, transaction, unscoped, where, find}}},
+		{"updates error", args{termErr: updates, feed: &feed},
+			exp{errStr: "updates:foobar", callStack: slices.Concat(findStack, restoreStack)}},
+
+		{"success", args{feed: &feed},
+			exp{counts: deletedCounts{Feeds: 1, FeedXml: 1, Items: 2, ItemXml: 3, Images: 1},
+				callStack: slices.Concat(findStack, restoreStack, restoreStack, restoreStack, restoreStack, restoreStack, restoreStack)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			counts, err := poddb.undeleteFeed(tt.p.feed)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			if err == nil {
+				testutils.AssertEquals(t, tt.e.counts, *counts)
+				testutils.AssertEquals(t, false, tt.p.feed.DeletedAt.Valid)
+
+				// rows deleted before the feed stay deleted
+				var (
+					items  []*ItemDBEntry
+					images []*ImageDBEntry
+				)
+				gmock.mockdb.DB.Find(&items)
+				gmock.mockdb.DB.Find(&images)
+				testutils.AssertEquals(t, 2, len(items))
+				testutils.AssertEquals(t, 1, len(images))
+
+				var fe FeedDBEntry
+				res := gmock.mockdb.DB.Preload("XmlFeedData").First(&fe, 1)
+				testutils.AssertErr(t, false, res.Error)
+				testutils.Assert(t, fe.XmlFeedData != nil, "feed xml not restored")
+			}
+		})
+	}
+}
+
+func TestPodDB_purgeDeleted(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var (
+		now        = time.Now()
+		countStack = []stackType{unscoped, model, where, count}
+		purgeStack = []stackType{unscoped, model, where, count, unscoped, where, delete}
+	)
+	// feeds 1 and 2 deleted, 3 active
+	seedDeleted(t, gmock.mockdb.DB,
+		&FeedDBEntry{PodDBModel: deletedAt(now), Hash: "foo", XmlId: 1},
+		&FeedDBEntry{PodDBModel: deletedAt(now), Hash: "bar", XmlId: 2},
+		&FeedDBEntry{Hash: "baz", XmlId: 3},
+		&FeedXmlDBEntry{PodDBModel: deletedAt(now)},
+		&FeedXmlDBEntry{PodDBModel: deletedAt(now)},
+		&FeedXmlDBEntry{},
+		&ItemXmlDBEntry{PodDBModel: deletedAt(now)},
+		&ItemXmlDBEntry{PodDBModel: deletedAt(now)},
+		&ItemXmlDBEntry{PodDBModel: deletedAt(now)},
+		&ItemXmlDBEntry{},
+		&ItemXmlDBEntry{PodDBModel: deletedAt(now), ItemId: 3}, // previous revision of j1
+		&ItemDBEntry{PodDBModel: deletedAt(now), Hash: "i1", FeedId: 1, XmlId: 1},
+		&ItemDBEntry{PodDBModel: deletedAt(now), Hash: "i2", FeedId: 1, XmlId: 2},
+		&ItemDBEntry{PodDBModel: deletedAt(now), Hash: "j1", FeedId: 2, XmlId: 3},
+		&ItemDBEntry{Hash: "k1", FeedId: 3, XmlId: 4},
+		&ImageDBEntry{PodDBModel: deletedAt(now), FeedId: 1},
+		&ImageDBEntry{FeedId: 3},
+		&RunDBEntry{FeedId: 1},
+		&RunDBEntry{FeedId: 2},
+		&RunDBEntry{FeedId: 3},
+		&FeedChangeDBEntry{FeedId: 1},
+		&FeedChangeDBEntry{FeedId: 2},
+		&FeedChangeDBEntry{FeedId: 3},
+	)
+
+	type args struct {
+		emptyPath bool
+		feedIds   []uint
+		dryRun    bool
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		counts    deletedCounts
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty path", args{emptyPath: true}, exp{errStr: "poddb is not initialized"}},
+		{"open error", args{openErr: true}, exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"count error", args{termErr: count},
+			exp{errStr: "count:foobar", callStack: slices.Concat([]stackType{open, transaction}, countStack)}},
+		{"delete error", args{termErr: delete},
+			exp{errStr: "delete:foobar", callStack: slices.Concat([]stackType{open, transaction}, purgeStack)}},
+
+		// successive calls against the same data
+		{"dry run", args{dryRun: true},
+			exp{counts: deletedCounts{Feeds: 2, FeedXml: 2, Items: 3, ItemXml: 4, Images: 1, Runs: 2, Changes: 2},
+				callStack: slices.Concat([]stackType{open, transaction}, countStack, countStack, countStack, countStack, countStack, countStack, countStack)}},
+		{"single feed", args{feedIds: []uint{2}},
+			exp{counts: deletedCounts{Feeds: 1, FeedXml: 1, Items: 1, ItemXml: 2, Runs: 1, Changes: 1},
+				callStack: slices.Concat([]stackType{open, transaction}, purgeStack, purgeStack, countStack, purgeStack, purgeStack, purgeStack, purgeStack)}},
+		{"all", args{},
+			exp{counts: deletedCounts{Feeds: 1, FeedXml: 1, Items: 2, ItemXml: 2, Images: 1, Runs: 1, Changes: 1},
+				callStack: slices.Concat([]stackType{open, transaction}, purgeStack, purgeStack, purgeStack, purgeStack, purgeStack, purgeStack, purgeStack)}},
+		{"nothing left", args{},
+			exp{callStack: slices.Concat([]stackType{open, transaction}, countStack, countStack, countStack, countStack, countStack, countStack, countStack)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			counts, err := poddb.purgeDeleted(tt.p.feedIds, tt.p.dryRun)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			if err == nil {
+				testutils.AssertEquals(t, tt.e.counts, *counts)
+			}
+		})
+	}
+
+	// active rows untouched
+	for _, model := range []any{&FeedDBEntry{}, &FeedXmlDBEntry{}, &ItemDBEntry{}, &ItemXmlDBEntry{}, &ImageDBEntry{}, &RunDBEntry{},
+		&FeedChangeDBEntry{}} {
+		var total int64
+		gmock.mockdb.DB.Unscoped().Model(model).Count(&total)
+		testutils.AssertEquals(t, int64(1), total)
+	}
+}
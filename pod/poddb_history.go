@@ -0,0 +1,53 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+
+	log "gopod/multilogger"
+)
+
+// --------------------------------------------------------------------------
+// finds a single item in the feed by hash or filename
+func (pdb PodDB) loadItemByKey(feedId uint, key string) (*ItemDBEntry, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	} else if feedId == 0 {
+		return nil, errors.New("feed id cannot be zero")
+	} else if key == "" {
+		return nil, errors.New("item hash or filename cannot be empty")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	}
+
+	var item ItemDBEntry
+	if res := db.Where("FeedId = ? AND (Hash = ? OR Filename = ?)", feedId, key, key).First(&item); res.Error != nil {
+		return nil, res.Error
+	}
+	return &item, nil
+}
+
+// --------------------------------------------------------------------------
+// all xml revisions for the item, oldest first
+func (pdb PodDB) loadItemXmlRevisions(itemId uint) ([]*ItemXmlDBEntry, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	} else if itemId == 0 {
+		return nil, errors.New("item id cannot be zero")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	}
+
+	var list = make([]*ItemXmlDBEntry, 0)
+	if res := db.Where("ItemId = ?", itemId).Order("ID").Find(&list); res.Error != nil {
+		return nil, res.Error
+	}
+	log.Debugf("xml revisions found: %v", len(list))
+	return list, nil
+}
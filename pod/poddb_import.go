@@ -0,0 +1,227 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+
+	"gopod/commandline"
+	log "gopod/multilogger"
+	"gopod/podutils"
+
+	"gorm.io/gorm"
+)
+
+// rows imported from an export, per table; items and images already in the db are updated or
+// skipped, depending on the strategy
+type importCounts struct {
+	NewFeed       bool
+	FeedUpdated   bool
+	Added         int
+	Updated       int
+	Skipped       int
+	ImagesAdded   int
+	ImagesUpdated int
+	ImagesSkipped int
+}
+
+// --------------------------------------------------------------------------
+// every feed in an export db, with items (and their xml) and images; deleted rows included
+func (pdb PodDB) loadExportFeeds() ([]*FeedDBEntry, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	}
+
+	var feedlist = make([]*FeedDBEntry, 0)
+	if res := db.Unscoped().
+		Preload("XmlFeedData").
+		Preload("ImageList").
+		Preload("ItemList").
+		Preload("ItemList.XmlData").
+		Order("ID").
+		Find(&feedlist); res.Error != nil {
+		return nil, res.Error
+	}
+	return feedlist, nil
+}
+
+// --------------------------------------------------------------------------
+// whether the imported row replaces the one in the db
+func importReplaces(strategy commandline.ImportStrategy, existing, imported PodDBModel) bool {
+	switch strategy {
+	case commandline.ImportOverwrite:
+		return true
+	case commandline.ImportNewest:
+		return imported.UpdatedAt.After(existing.UpdatedAt)
+	default:
+		return false
+	}
+}
+
+// --------------------------------------------------------------------------
+// merges an exported feed into the db.  Feeds and items are matched by hash, images by url; ids from
+// the export are remapped, as they belong to the db exported from.  Items replaced keep their id, with
+// the imported xml saved as a new revision.  Dry run only counts what would be imported
+func (pdb PodDB) importFeed(feed *FeedDBEntry, strategy commandline.ImportStrategy, dryRun bool) (*importCounts, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	} else if feed == nil {
+		return nil, errors.New("feed cannot be nil")
+	} else if feed.Hash == "" {
+		return nil, errors.New("feed hash cannot be empty")
+	}
+
+	var counts importCounts
+	err := pdb.WithTx(func(tx *PodDB) error {
+		var (
+			db       = tx.db
+			existing FeedDBEntry
+			hashes   = make([]string, 0, len(feed.ItemList))
+			urls     = make([]string, 0, len(feed.ImageList))
+			// new rows and replaced rows saved separately, so new rows get their ids from the db
+			items  = [2][]*ItemDBEntry{}
+			images = [2][]*ImageDBEntry{}
+		)
+
+		if res := db.Unscoped().Where("Hash = ?", feed.Hash).Limit(1).Find(&existing); res.Error != nil {
+			return fmt.Errorf("failed loading feed: %w", res.Error)
+		} else if res.RowsAffected == 0 {
+			counts.NewFeed = true
+		} else if existing.DeletedAt.Valid {
+			return errors.New("feed is deleted in the database; undelete it first")
+		}
+
+		// feed row and its xml, without items and images (images are saved from imageMap, so that's cleared
+		// too); those are saved separately once remapped
+		var row = *feed
+		row.ItemList, row.ImageList, row.imageMap = nil, nil, nil
+		switch {
+		case counts.NewFeed:
+			row.ID, row.XmlId = 0, 0
+			if row.XmlFeedData != nil {
+				row.XmlFeedData.ID = 0
+			}
+		case importReplaces(strategy, existing.PodDBModel, feed.PodDBModel):
+			counts.FeedUpdated = true
+			row.ID, row.XmlId, row.CreatedAt = existing.ID, existing.XmlId, existing.CreatedAt
+			if row.XmlFeedData != nil {
+				row.XmlFeedData.ID = existing.XmlId
+			}
+		default:
+			row = existing
+		}
+		if dryRun == false && (counts.NewFeed || counts.FeedUpdated) {
+			if res := db.Session(&gorm.Session{FullSaveAssociations: true}).Save(&row); res.Error != nil {
+				return fmt.Errorf("failed saving feed: %w", res.Error)
+			}
+		}
+
+		for _, item := range feed.ItemList {
+			hashes = append(hashes, item.Hash)
+		}
+		for _, img := range feed.ImageList {
+			urls = append(urls, img.Url)
+		}
+
+		// item hashes are unique across feeds
+		var exItems = make([]*ItemDBEntry, 0)
+		if len(hashes) > 0 {
+			if res := db.Unscoped().Where("Hash IN ?", hashes).Find(&exItems); res.Error != nil {
+				return fmt.Errorf("failed loading items: %w", res.Error)
+			}
+		}
+		var byHash = make(map[string]*ItemDBEntry, len(exItems))
+		for _, ex := range exItems {
+			byHash[ex.Hash] = ex
+		}
+
+		for _, item := range feed.ItemList {
+			ex, exists := byHash[item.Hash]
+			switch {
+			case exists == false:
+				counts.Added++
+				item.ID, item.XmlId = 0, 0
+				if item.XmlData != nil {
+					item.XmlData.ID, item.XmlData.ItemId = 0, 0
+				}
+			case ex.FeedId != row.ID:
+				log.With("hash", item.Hash).Warn("episode belongs to a different feed in the database; skipped")
+				counts.Skipped++
+				continue
+			case importReplaces(strategy, ex.PodDBModel, item.PodDBModel) == false:
+				counts.Skipped++
+				continue
+			default:
+				counts.Updated++
+				item.ID, item.CreatedAt = ex.ID, ex.CreatedAt
+				if item.XmlData != nil {
+					// new revision; the previous is kept for history
+					item.XmlData.ID, item.XmlData.ItemId = 0, ex.ID
+				} else {
+					item.XmlId = ex.XmlId
+				}
+			}
+			item.FeedId = row.ID
+			idx := podutils.Tern(exists, 1, 0)
+			items[idx] = append(items[idx], item)
+		}
+
+		var exImages = make([]*ImageDBEntry, 0)
+		if len(urls) > 0 {
+			if res := db.Unscoped().Where("Url IN ?", urls).Find(&exImages); res.Error != nil {
+				return fmt.Errorf("failed loading images: %w", res.Error)
+			}
+		}
+		var byUrl = make(map[string]*ImageDBEntry, len(exImages))
+		for _, ex := range exImages {
+			byUrl[ex.Url] = ex
+		}
+
+		for _, img := range feed.ImageList {
+			ex, exists := byUrl[img.Url]
+			switch {
+			case exists == false:
+				counts.ImagesAdded++
+				img.ID = 0
+			case importReplaces(strategy, ex.PodDBModel, img.PodDBModel):
+				counts.ImagesUpdated++
+				img.ID, img.CreatedAt = ex.ID, ex.CreatedAt
+			default:
+				counts.ImagesSkipped++
+				continue
+			}
+			img.FeedId = row.ID
+			idx := podutils.Tern(exists, 1, 0)
+			images[idx] = append(images[idx], img)
+		}
+
+		if dryRun {
+			return nil
+		}
+		for _, list := range items {
+			if len(list) == 0 {
+				continue
+			} else if res := db.Session(&gorm.Session{FullSaveAssociations: true}).Save(list); res.Error != nil {
+				return fmt.Errorf("failed saving items: %w", res.Error)
+			}
+		}
+		for _, list := range images {
+			if len(list) == 0 {
+				continue
+			} else if res := db.Save(list); res.Error != nil {
+				return fmt.Errorf("failed saving images: %w", res.Error)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("import: %+v", counts)
+	return &counts, nil
+}
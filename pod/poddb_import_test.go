@@ -0,0 +1,252 @@
+package pod
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"gopod/commandline"
+	"gopod/podutils"
+	"gopod/testutils"
+
+	"github.com/glebarez/sqlite"
+)
+
+func TestPodDB_importFeed(t *testing.T) {
+
+	var (
+		old    = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		future = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+	)
+	var newItem = func(id uint, hash, title string, updated time.Time) *ItemDBEntry {
+		var i = generateItem(0, true)
+		i.ID, i.Hash, i.XmlId, i.XmlData.ID, i.XmlData.Title = id, hash, id, id, title
+		i.UpdatedAt = updated
+		return &i
+	}
+
+	// db: bar has b1; foo has i1 (updated long ago), i4 (updated after the export) and img1
+	var setup = func(t *testing.T) *PodDB {
+		pdb, err := NewDB(filepath.Join(t.TempDir(), "gopod.db"))
+		if err != nil {
+			t.Fatalf("error creating db: %v", err)
+		}
+		for _, fe := range []*FeedDBEntry{
+			{PodDBModel: PodDBModel{ID: 1}, Hash: "bar", XmlFeedData: &FeedXmlDBEntry{}},
+			{PodDBModel: PodDBModel{ID: 2}, Hash: "foo", XmlFeedData: &FeedXmlDBEntry{}},
+		} {
+			testutils.AssertErr(t, false, pdb.saveFeed(fe))
+		}
+		var items = []*ItemDBEntry{
+			newItem(1, "b1", "db bar one", old), newItem(2, "i1", "db one", old), newItem(3, "i4", "db four", old)}
+		items[0].FeedId, items[1].FeedId, items[2].FeedId = 1, 2, 2
+		testutils.AssertErr(t, false, pdb.saveItems(items...))
+		testutils.AssertErr(t, false, pdb.saveImages(&ImageDBEntry{FeedId: 2, Url: "img1", Filename: "db"}))
+
+		// timestamps are set on save
+		for _, sqlStr := range []string{
+			"UPDATE FeedDBEntries SET UpdatedAt = ?",
+			"UPDATE ItemDBEntries SET UpdatedAt = ? WHERE Hash = 'i1'",
+		} {
+			testutils.AssertErr(t, false, pdb.db.Exec(sqlStr, old).Error)
+		}
+		testutils.AssertErr(t, false, pdb.db.Exec("UPDATE ItemDBEntries SET UpdatedAt = ? WHERE Hash = 'i4'", future).Error)
+		return pdb
+	}
+
+	// export of foo from another db; ids overlap the db's
+	var export = func(hash string) *FeedDBEntry {
+		var now = time.Now()
+		return &FeedDBEntry{PodDBModel: PodDBModel{ID: 7, UpdatedAt: old}, Hash: hash, DBShortname: hash,
+			XmlFeedData: &FeedXmlDBEntry{PodDBModel: PodDBModel{ID: 7}},
+			ItemList: []*ItemDBEntry{
+				newItem(1, "i1", "export one", now), newItem(2, "i2", "export two", now), newItem(3, "i4", "export four", now)},
+			ImageList: []*ImageDBEntry{
+				{PodDBModel: PodDBModel{ID: 1, UpdatedAt: old}, Url: "img1", Filename: "export"},
+				{PodDBModel: PodDBModel{ID: 2, UpdatedAt: old}, Url: "img2", Filename: "export"}},
+		}
+	}
+
+	type exp struct {
+		counts *importCounts
+		titles map[string]string // foo's items
+		images map[string]string
+		errStr string
+	}
+	tests := []struct {
+		name     string
+		feed     *FeedDBEntry
+		strategy commandline.ImportStrategy
+		dryRun   bool
+		e        exp
+	}{
+		{"skip", export("foo"), commandline.ImportSkip, false, exp{
+			counts: &importCounts{Added: 1, Skipped: 2, ImagesAdded: 1, ImagesSkipped: 1},
+			titles: map[string]string{"i1": "db one", "i2": "export two", "i4": "db four"},
+			images: map[string]string{"img1": "db", "img2": "export"}}},
+		{"overwrite", export("foo"), commandline.ImportOverwrite, false, exp{
+			counts: &importCounts{FeedUpdated: true, Added: 1, Updated: 2, ImagesAdded: 1, ImagesUpdated: 1},
+			titles: map[string]string{"i1": "export one", "i2": "export two", "i4": "export four"},
+			images: map[string]string{"img1": "export", "img2": "export"}}},
+		{"keep newest", export("foo"), commandline.ImportNewest, false, exp{
+			counts: &importCounts{Added: 1, Updated: 1, Skipped: 1, ImagesAdded: 1, ImagesSkipped: 1},
+			titles: map[string]string{"i1": "export one", "i2": "export two", "i4": "db four"},
+			images: map[string]string{"img1": "db", "img2": "export"}}},
+		{"dry run", export("foo"), commandline.ImportOverwrite, true, exp{
+			counts: &importCounts{FeedUpdated: true, Added: 1, Updated: 2, ImagesAdded: 1, ImagesUpdated: 1},
+			titles: map[string]string{"i1": "db one", "i4": "db four"},
+			images: map[string]string{"img1": "db"}}},
+		{"episode in other feed", func() *FeedDBEntry {
+			var fe = export("foo")
+			fe.ItemList = append(fe.ItemList, newItem(4, "b1", "export bar one", time.Now()))
+			return fe
+		}(), commandline.ImportOverwrite, false, exp{
+			counts: &importCounts{FeedUpdated: true, Added: 1, Updated: 2, Skipped: 1, ImagesAdded: 1, ImagesUpdated: 1},
+			titles: map[string]string{"i1": "export one", "i2": "export two", "i4": "export four"},
+			images: map[string]string{"img1": "export", "img2": "export"}}},
+		{"no hash", &FeedDBEntry{}, commandline.ImportSkip, false, exp{errStr: "hash cannot be empty"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pdb = setup(t)
+			defer pdb.Close()
+
+			counts, err := pdb.importFeed(tt.feed, tt.strategy, tt.dryRun)
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			testutils.AssertEquals(t, tt.e.counts, counts)
+			if err != nil {
+				return
+			}
+
+			var opt = loadOptions{includeXml: true}
+			items, err := pdb.loadFeedItems(2, AllItems, opt)
+			testutils.AssertErr(t, false, err)
+			var (
+				titles = make(map[string]string)
+				ids    = []uint{1} // bar's item
+			)
+			for _, item := range items {
+				titles[item.Hash] = item.XmlData.Title
+				ids = append(ids, item.ID)
+			}
+			testutils.AssertEquals(t, tt.e.titles, titles)
+			slices.Sort(ids)
+			testutils.AssertEquals(t, len(ids), len(slices.Compact(ids)))
+
+			var (
+				images = make(map[string]string)
+				imgs   = make([]*ImageDBEntry, 0)
+			)
+			testutils.AssertErr(t, false, pdb.db.Where("FeedId = ?", 2).Find(&imgs).Error)
+			for _, img := range imgs {
+				images[img.Url] = img.Filename
+			}
+			testutils.AssertEquals(t, tt.e.images, images)
+
+			// bar untouched
+			bar, err := pdb.loadFeedItems(1, AllItems, opt)
+			testutils.AssertErr(t, false, err)
+			testutils.AssertEquals(t, 1, len(bar))
+			testutils.AssertEquals(t, "db bar one", bar[0].XmlData.Title)
+		})
+	}
+
+	t.Run("new feed", func(t *testing.T) {
+		var pdb = setup(t)
+		defer pdb.Close()
+
+		var fe = export("baz")
+		fe.ItemList = fe.ItemList[1:2] // i2 only
+		counts, err := pdb.importFeed(fe, commandline.ImportSkip, false)
+		testutils.AssertErr(t, false, err)
+		testutils.AssertEquals(t, &importCounts{NewFeed: true, Added: 1, ImagesSkipped: 1, ImagesAdded: 1}, counts)
+
+		var baz = FeedDBEntry{Hash: "baz"}
+		testutils.AssertErr(t, false, pdb.loadFeed(&baz, loadOptions{dontCreate: true, includeXml: true}))
+		testutils.Assert(t, baz.ID == 3, "new feed not given a new id")
+		testutils.Assert(t, baz.XmlFeedData != nil && baz.XmlFeedData.ID > 0, "feed xml not saved")
+		items, err := pdb.loadFeedItems(baz.ID, AllItems, loadOptions{})
+		testutils.AssertErr(t, false, err)
+		testutils.AssertEquals(t, 1, len(items))
+		testutils.AssertEquals(t, "i2", items[0].Hash)
+	})
+
+	t.Run("deleted feed", func(t *testing.T) {
+		var pdb = setup(t)
+		defer pdb.Close()
+
+		testutils.AssertErr(t, false, pdb.db.Exec("UPDATE FeedDBEntries SET DeletedAt = ? WHERE Hash = 'foo'", old).Error)
+		_, err := pdb.importFeed(export("foo"), commandline.ImportOverwrite, false)
+		testutils.AssertErrContains(t, "undelete it first", err)
+	})
+}
+
+func TestReadExport(t *testing.T) {
+
+	var (
+		dir  = t.TempDir()
+		feed = &FeedDBEntry{PodDBModel: PodDBModel{ID: 1}, Hash: "foo", DBShortname: "foo", XmlFeedData: &FeedXmlDBEntry{}}
+	)
+	for i, hash := range []string{"i1", "i2"} {
+		var item = generateItem(1, true)
+		item.ID, item.Hash, item.XmlId, item.XmlData.ID, item.XmlData.Title = uint(i+1), hash, uint(i+1), uint(i+1), hash+" title"
+		feed.ItemList = append(feed.ItemList, &item)
+	}
+
+	var (
+		jsonFile = filepath.Join(dir, "foo.json")
+		dbFile   = filepath.Join(dir, "foo.db")
+	)
+	testutils.AssertErr(t, false, exportToJson(feed, jsonFile))
+	testutils.AssertErr(t, false, exportToDb(feed, dbFile))
+	// as a copy made outside gopod might be; reading it shouldn't switch it to wal
+	if gdb, err := gImpl.Open(sqlite.Open(dbFile), &defaultConfig); err != nil {
+		t.Fatalf("error opening export: %v", err)
+	} else {
+		testutils.AssertErr(t, false, gdb.Exec("PRAGMA journal_mode = DELETE").Error)
+		if sqldb, err := gdb.SqlDB(); err == nil {
+			sqldb.Close()
+		}
+	}
+	testutils.AssertErr(t, false, os.WriteFile(filepath.Join(dir, "foo.txt"), []byte("foo"), 0644))
+
+	tests := []struct {
+		name   string
+		file   string
+		errStr string
+	}{
+		{"json", jsonFile, ""},
+		{"db", dbFile, ""},
+		{"missing", filepath.Join(dir, "bar.json"), "does not exist"},
+		{"missing db", filepath.Join(dir, "bar.db"), "does not exist"},
+		{"unknown type", filepath.Join(dir, "foo.txt"), "unrecognized export file type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, _ := os.ReadFile(tt.file)
+			feedlist, err := readExport(tt.file)
+			testutils.AssertErrContains(t, tt.errStr, err)
+
+			// the export is read as is; not created, changed, or left with wal files
+			after, _ := os.ReadFile(tt.file)
+			testutils.Assert(t, bytes.Equal(before, after), "export changed by reading it")
+			for _, suffix := range []string{"-wal", "-shm"} {
+				exists, _ := podutils.FileExists(tt.file + suffix)
+				testutils.Assert(t, exists == false, "file left behind: "+tt.file+suffix)
+			}
+			if err != nil {
+				return
+			}
+			testutils.AssertEquals(t, 1, len(feedlist))
+			testutils.AssertEquals(t, "foo", feedlist[0].Hash)
+			var titles = make(map[string]string)
+			for _, item := range feedlist[0].ItemList {
+				titles[item.Hash] = item.XmlData.Title
+			}
+			testutils.AssertEquals(t, map[string]string{"i1": "i1 title", "i2": "i2 title"}, titles)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package pod
 
 import (
+	"database/sql"
+
 	"gorm.io/gorm"
 )
 
@@ -28,6 +30,7 @@ type gormDBInterface interface {
 	Preload(query string, args ...any) gormDBInterface
 	Order(value any) gormDBInterface
 	Limit(limit int) gormDBInterface
+	Offset(offset int) gormDBInterface
 	Session(config *gorm.Session) gormDBInterface
 	Debug() gormDBInterface
 	Unscoped() gormDBInterface
@@ -40,10 +43,18 @@ type gormDBInterface interface {
 	First(dest any, conds ...any) *gorm.DB
 	Find(dest any, conds ...any) *gorm.DB
 	Save(value any) *gorm.DB
+	Updates(values any) *gorm.DB
 	Delete(value any, conds ...any) *gorm.DB
 	Count(*int64) *gorm.DB
 	Scan(dest any) *gorm.DB
 	Exec(sql string, values ...any) *gorm.DB
+
+	// transaction; fc is passed a db bound to the transaction, commits if fc returns nil
+	Transaction(fc func(tx gormDBInterface) error) error
+	// underlying connection pool, for settings and close
+	SqlDB() (*sql.DB, error)
+	// registers a plugin (callbacks) on the connection pool
+	Use(plugin gorm.Plugin) error
 }
 type gormDBImpl struct {
 	*gorm.DB
@@ -65,6 +76,9 @@ func (gdbi *gormDBImpl) Order(value any) gormDBInterface {
 func (gdbi *gormDBImpl) Limit(limit int) gormDBInterface {
 	return &gormDBImpl{gdbi.DB.Limit(limit)}
 }
+func (gdbi *gormDBImpl) Offset(offset int) gormDBInterface {
+	return &gormDBImpl{gdbi.DB.Offset(offset)}
+}
 func (gdbi *gormDBImpl) Session(config *gorm.Session) gormDBInterface {
 	return &gormDBImpl{gdbi.DB.Session(config)}
 }
@@ -94,6 +108,9 @@ func (gdbi *gormDBImpl) Find(dest any, conds ...any) *gorm.DB {
 func (gdbi *gormDBImpl) Save(value any) *gorm.DB {
 	return gdbi.DB.Save(value)
 }
+func (gdbi *gormDBImpl) Updates(values any) *gorm.DB {
+	return gdbi.DB.Updates(values)
+}
 func (gdbi *gormDBImpl) Delete(value any, conds ...any) *gorm.DB {
 	return gdbi.DB.Delete(value, conds...)
 }
@@ -106,3 +123,11 @@ func (gdbi *gormDBImpl) Scan(dest any) *gorm.DB {
 func (gdbi *gormDBImpl) Exec(sql string, values ...any) *gorm.DB {
 	return gdbi.DB.Exec(sql, values...)
 }
+func (gdbi *gormDBImpl) Transaction(fc func(tx gormDBInterface) error) error {
+	return gdbi.DB.Transaction(func(tx *gorm.DB) error {
+		return fc(&gormDBImpl{tx})
+	})
+}
+func (gdbi *gormDBImpl) SqlDB() (*sql.DB, error) {
+	return gdbi.DB.DB()
+}
@@ -1,51 +1,391 @@
 package pod
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
+
 	log "gopod/multilogger"
+	"gopod/podconfig"
+	"gopod/podutils"
+)
+
+// a single schema change.  Migrations are up only, applied in order, and recorded (with checksum) in
+// the migrations table; new migrations are only ever appended, never changed once released.  Each
+// carries its own ddl, frozen as of the version it was added; the model structs are never auto
+// migrated, so changing a struct means adding a migration
+type migration struct {
+	version int
+	name    string
+	sql     []string
+}
+
+// applied migrations
+type MigrationDBEntry struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+	Baseline  bool // recorded from the legacy model version, rather than applied
+}
+
+const (
+	migrationTable = "MigrationDBEntries"
+	// legacy single row version table; still set to the latest version so that binaries from before
+	// the migrations table refuse newer schemas
+	legacyModelTable = "poddb_model"
 )
 
-func migrateDB(db gormDBInterface, oldVersion int) error {
-	if (oldVersion < currentModel) == false {
-		return fmt.Errorf("unable to migrate; old version not less than current")
+// registry; versions 1 to 3 match the versions previously kept in poddb_model (currentModel only ever
+// reached 3).  Versions 4 and up were added with the registry, so no released legacy db has them
+var migrations = []migration{
+	{version: 1, name: "initial schema", sql: []string{
+		"CREATE TABLE FeedXmlDBEntries (ID integer PRIMARY KEY AUTOINCREMENT, CreatedAt datetime, UpdatedAt datetime, " +
+			"DeletedAt datetime, AtomLinkSelf_Type text, AtomLinkSelf_Href text, AtomLinkSelf_Title text, NewFeedUrl text, " +
+			"Title text, Subtitle text, PubDate datetime, LastBuildDate datetime, Link text, Image_Url text, Image_Title text, " +
+			"Image_Link text, ItunesImageUrl text, ItunesOwner_Name text, ItunesOwner_Email text, Author text, " +
+			"Copyright text, Description text, PodcastFunding_Url text, PodcastFunding_Text text, PersonList text)",
+		"CREATE INDEX idx_FeedXmlDBEntries_DeletedAt ON FeedXmlDBEntries(DeletedAt)",
+		"CREATE TABLE FeedDBEntries (ID integer PRIMARY KEY AUTOINCREMENT, CreatedAt datetime, UpdatedAt datetime, " +
+			"DeletedAt datetime, Hash text, DBShortname text, EpisodeCount integer, XmlId integer, " +
+			"CONSTRAINT fk_FeedDBEntries_XmlFeedData FOREIGN KEY (XmlId) REFERENCES FeedXmlDBEntries(ID))",
+		"CREATE INDEX idx_FeedDBEntries_DeletedAt ON FeedDBEntries(DeletedAt)",
+		"CREATE UNIQUE INDEX idx_FeedDBEntries_Hash ON FeedDBEntries(Hash)",
+		"CREATE TABLE ItemXmlDBEntries (ID integer PRIMARY KEY AUTOINCREMENT, CreatedAt datetime, UpdatedAt datetime, " +
+			"DeletedAt datetime, Title text, Pubdate datetime, SeasonStr text, EpisodeStr text, Guid text, Link text, " +
+			"Author text, ItunesAuthor text, Imageurl text, Description text, ItunesSummary text, ContentEncoded text, " +
+			"Enclosure_Length integer, Enclosure_TypeStr text, Enclosure_Url text, PersonList text)",
+		"CREATE INDEX idx_ItemXmlDBEntries_DeletedAt ON ItemXmlDBEntries(DeletedAt)",
+		"CREATE TABLE ItemDBEntries (ID integer PRIMARY KEY AUTOINCREMENT, CreatedAt datetime, UpdatedAt datetime, " +
+			"DeletedAt datetime, Hash text, FeedId integer, Filename text, FilenameXta text, Url text, Guid text, " +
+			"Downloaded numeric, CDFilename text, PubTimeStamp datetime, Archived numeric, EpNum integer, XmlId integer, " +
+			"CONSTRAINT fk_ItemDBEntries_XmlData FOREIGN KEY (XmlId) REFERENCES ItemXmlDBEntries(ID), " +
+			"CONSTRAINT fk_FeedDBEntries_ItemList FOREIGN KEY (FeedId) REFERENCES FeedDBEntries(ID))",
+		"CREATE INDEX idx_ItemDBEntries_DeletedAt ON ItemDBEntries(DeletedAt)",
+		"CREATE UNIQUE INDEX idx_ItemDBEntries_Hash ON ItemDBEntries(Hash)"}},
+	{version: 2, name: "feed and episode images", sql: []string{
+		"ALTER TABLE FeedDBEntries ADD COLUMN ImageKey text",
+		"ALTER TABLE ItemDBEntries ADD COLUMN ImageKey text",
+		"CREATE TABLE ImageDBEntries (ID integer PRIMARY KEY AUTOINCREMENT, CreatedAt datetime, UpdatedAt datetime, " +
+			"DeletedAt datetime, FeedId integer, Filename text, LastModified_Timestamp datetime, LastModified_ETag text, " +
+			"Url text, CONSTRAINT fk_FeedDBEntries_ImageList FOREIGN KEY (FeedId) REFERENCES FeedDBEntries(ID))",
+		"CREATE INDEX idx_ImageDBEntries_DeletedAt ON ImageDBEntries(DeletedAt)"}},
+	{version: 3, name: "image archive flag", sql: []string{
+		"ALTER TABLE ImageDBEntries ADD COLUMN Archived numeric"}},
+	{version: 4, name: "feed update status", sql: []string{
+		"ALTER TABLE FeedDBEntries ADD COLUMN LastUpdated datetime",
+		"ALTER TABLE FeedDBEntries ADD COLUMN LastError text"}},
+	{version: 5, name: "episode search index", sql: []string{
+		"CREATE VIRTUAL TABLE IF NOT EXISTS ItemSearch USING fts5(Title, Description, ItunesSummary, ContentEncoded, " +
+			"content='ItemXmlDBEntries', content_rowid='ID')",
+		"CREATE TRIGGER IF NOT EXISTS ItemSearch_ai AFTER INSERT ON ItemXmlDBEntries BEGIN " +
+			"INSERT INTO ItemSearch(rowid, Title, Description, ItunesSummary, ContentEncoded) " +
+			"VALUES (new.ID, new.Title, new.Description, new.ItunesSummary, new.ContentEncoded); END",
+		"CREATE TRIGGER IF NOT EXISTS ItemSearch_ad AFTER DELETE ON ItemXmlDBEntries BEGIN " +
+			"INSERT INTO ItemSearch(ItemSearch, rowid, Title, Description, ItunesSummary, ContentEncoded) " +
+			"VALUES ('delete', old.ID, old.Title, old.Description, old.ItunesSummary, old.ContentEncoded); END",
+		"CREATE TRIGGER IF NOT EXISTS ItemSearch_au AFTER UPDATE ON ItemXmlDBEntries BEGIN " +
+			"INSERT INTO ItemSearch(ItemSearch, rowid, Title, Description, ItunesSummary, ContentEncoded) " +
+			"VALUES ('delete', old.ID, old.Title, old.Description, old.ItunesSummary, old.ContentEncoded); " +
+			"INSERT INTO ItemSearch(rowid, Title, Description, ItunesSummary, ContentEncoded) " +
+			"VALUES (new.ID, new.Title, new.Description, new.ItunesSummary, new.ContentEncoded); END",
+		"INSERT INTO ItemSearch(ItemSearch) VALUES ('rebuild')"}},
+	{version: 6, name: "episode duration", sql: []string{
+		"ALTER TABLE ItemXmlDBEntries ADD COLUMN DurationStr text"}},
+	{version: 7, name: "run history", sql: []string{
+		"CREATE TABLE RunDBEntries (ID integer PRIMARY KEY AUTOINCREMENT, CreatedAt datetime, UpdatedAt datetime, " +
+			"DeletedAt datetime, FeedId integer, Shortname text, Command text, Source text, StartedAt datetime, " +
+			"FinishedAt datetime, Downloaded integer, DownloadedBytes integer, Error text)",
+		"CREATE INDEX idx_RunDBEntries_DeletedAt ON RunDBEntries(DeletedAt)",
+		"CREATE INDEX idx_RunDBEntries_FeedId ON RunDBEntries(FeedId)"}},
+	{version: 8, name: "item xml revisions", sql: []string{
+		"ALTER TABLE ItemXmlDBEntries ADD COLUMN ItemId integer",
+		"CREATE INDEX idx_ItemXmlDBEntries_ItemId ON ItemXmlDBEntries(ItemId)",
+		"UPDATE ItemXmlDBEntries SET ItemId = " +
+			"(SELECT i.ID FROM ItemDBEntries i WHERE i.XmlId = ItemXmlDBEntries.ID) " +
+			"WHERE ItemId IS NULL OR ItemId = 0"}},
+	{version: 9, name: "feed change tracking", sql: []string{
+		"ALTER TABLE FeedXmlDBEntries ADD COLUMN ItemList text",
+		"ALTER TABLE ItemDBEntries ADD COLUMN RemovedUpstream numeric",
+		"ALTER TABLE RunDBEntries ADD COLUMN Changes integer",
+		"CREATE TABLE FeedChangeDBEntries (ID integer PRIMARY KEY AUTOINCREMENT, CreatedAt datetime, " +
+			"UpdatedAt datetime, DeletedAt datetime, FeedId integer, FetchedAt datetime, Kind text, Field text, " +
+			"ItemHash text, Title text, Old text, New text)",
+		"CREATE INDEX idx_FeedChangeDBEntries_DeletedAt ON FeedChangeDBEntries(DeletedAt)",
+		"CREATE INDEX idx_FeedChangeDBEntries_FeedId ON FeedChangeDBEntries(FeedId)"}},
+	{version: 10, name: "archive policies", sql: []string{
+		"ALTER TABLE ItemDBEntries ADD COLUMN ArchiveDir text",
+		"ALTER TABLE ItemDBEntries ADD COLUMN Listened numeric"}},
+	{version: 11, name: "archive runs", sql: []string{
+		"ALTER TABLE ItemDBEntries ADD COLUMN ArchiveRun text"}},
+	{version: 12, name: "download size", sql: []string{
+		"ALTER TABLE ItemDBEntries ADD COLUMN DownloadSize integer"}},
+	{version: 13, name: "download time", sql: []string{
+		"ALTER TABLE ItemDBEntries ADD COLUMN DownloadedAt datetime"}},
+}
+
+// --------------------------------------------------------------------------
+func latestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// --------------------------------------------------------------------------
+// checksum of the migration's ddl; a mismatch against the recorded checksum means
+// the db was migrated by a different build
+func (m migration) checksum() string {
+	var h = sha256.New()
+	fmt.Fprintf(h, "%d|%s", m.version, m.name)
+	for _, sqlStr := range m.sql {
+		fmt.Fprintf(h, "|%s", sqlStr)
 	}
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	if oldVersion <= 1 { // v1 to v3 will include v2
-		if err := migrateV1toV2(db); err != nil {
-			return err
+// --------------------------------------------------------------------------
+func (m migration) up(db gormDBInterface) error {
+	for _, sqlStr := range m.sql {
+		if res := db.Exec(sqlStr); res.Error != nil {
+			return res.Error
 		}
-	} else if oldVersion == 2 {
-		if err := migrateV2toV3(db); err != nil {
-			return err
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+func (m migration) String() string {
+	return fmt.Sprintf("%v: %v", m.version, m.name)
+}
+
+// --------------------------------------------------------------------------
+type schemaState struct {
+	applied []*MigrationDBEntry
+	pending []migration
+	legacy  bool // no migrations table yet; applied is inferred from the legacy model version
+}
+
+// --------------------------------------------------------------------------
+// loads applied migrations, and verifies them against the registry.  Errors if the db has migrations
+// newer than this binary knows about, or if recorded migrations don't match the registry
+func loadSchemaState(db gormDBInterface) (*schemaState, error) {
+	var (
+		state  schemaState
+		tables int64
+	)
+	var sqlStr = "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if res := db.Raw(sqlStr, migrationTable).Scan(&tables); res.Error != nil {
+		return nil, fmt.Errorf("error checking migrations table: %w", res.Error)
+	}
+
+	if tables == 0 {
+		state.legacy = true
+		var result = struct{ ID int }{}
+		if res := db.Raw("SELECT ID from " + legacyModelTable).Scan(&result); res.Error != nil {
+			return nil, fmt.Errorf("error checking model version: %w", res.Error)
+		} else if result.ID > latestVersion() {
+			return nil, newerSchemaError(result.ID)
 		}
+		for _, m := range migrations {
+			if m.version <= result.ID {
+				state.applied = append(state.applied, m.entry(true))
+			}
+		}
+	} else if res := db.Order("Version").Find(&state.applied); res.Error != nil {
+		return nil, fmt.Errorf("error loading migrations: %w", res.Error)
 	}
-	// if oldVersion <= 3 {
-	// future upgrades
-	// }
 
-	// finally, make sure current model is set
-	var sqlStr = "UPDATE poddb_model SET (ID) = (?)"
-	if res := db.Exec(sqlStr, currentModel); res.Error != nil {
-		return fmt.Errorf("error setting db version: %w", res.Error)
+	var applied = make(map[int]bool, len(state.applied))
+	for _, entry := range state.applied {
+		var idx = slices.IndexFunc(migrations, func(m migration) bool { return m.version == entry.Version })
+		if entry.Version > latestVersion() {
+			return nil, newerSchemaError(entry.Version)
+		} else if idx < 0 {
+			return nil, fmt.Errorf("unknown migration %v (%v) recorded in database", entry.Version, entry.Name)
+		} else if m := migrations[idx]; m.name != entry.Name || m.checksum() != entry.Checksum {
+			return nil, fmt.Errorf("migration %v (%v) doesn't match this version of gopod (checksum mismatch); "+
+				"database was migrated by a different build", entry.Version, entry.Name)
+		}
+		applied[entry.Version] = true
+	}
+	for _, m := range migrations {
+		if applied[m.version] == false {
+			state.pending = append(state.pending, m)
+		}
 	}
 
-	return nil
+	return &state, nil
 }
 
-func migrateV1toV2(db gormDBInterface) error {
-	log.Info("upgrading from v1 to v2")
-	// v1 to v2 introduced image table, refs in feed and item
-	if err := db.AutoMigrate(&FeedDBEntry{}, &ItemDBEntry{}, &ImageDBEntry{}); err != nil {
+func newerSchemaError(version int) error {
+	return fmt.Errorf("database schema version %v is newer than this version of gopod supports (%v); "+
+		"upgrade gopod to use this database", version, latestVersion())
+}
+
+// --------------------------------------------------------------------------
+func (m migration) entry(baseline bool) *MigrationDBEntry {
+	return &MigrationDBEntry{
+		Version:   m.version,
+		Name:      m.name,
+		Checksum:  m.checksum(),
+		AppliedAt: time.Now(),
+		Baseline:  baseline,
+	}
+}
+
+// --------------------------------------------------------------------------
+// applies pending migrations, each in its own transaction along with its record.  Legacy databases
+// first get the migrations table, with the versions already applied recorded as the baseline.
+// Returns the migrations applied (or pending, on dry run)
+func (pdb PodDB) migrate(dryRun bool) ([]migration, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	}
+
+	state, err := loadSchemaState(db)
+	if err != nil {
+		return nil, err
+	} else if dryRun {
+		return state.pending, nil
+	}
+
+	if state.legacy {
+		err := pdb.WithTx(func(tx *PodDB) error {
+			if err := tx.db.AutoMigrate(&MigrationDBEntry{}); err != nil {
+				return fmt.Errorf("error creating migrations table: %w", err)
+			}
+			for _, entry := range state.applied {
+				if res := tx.db.Save(entry); res.Error != nil {
+					return fmt.Errorf("error recording baseline migration %v: %w", entry.Version, res.Error)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("migrations table created; baseline version %v", len(state.applied))
+	}
+
+	for _, m := range state.pending {
+		log.Infof("applying migration %v", m)
+		err := pdb.WithTx(func(tx *PodDB) error {
+			if err := m.up(tx.db); err != nil {
+				return err
+			} else if res := tx.db.Save(m.entry(false)); res.Error != nil {
+				return fmt.Errorf("error recording migration: %w", res.Error)
+			}
+			var sqlStr = "UPDATE " + legacyModelTable + " SET (ID) = (?)"
+			if res := tx.db.Exec(sqlStr, m.version); res.Error != nil {
+				return fmt.Errorf("error setting db version: %w", res.Error)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("migration %v failed: %w", m, err)
+		}
+	}
+
+	return state.pending, nil
+}
+
+// --------------------------------------------------------------------------
+// migrates the main database, and the feeds' archive databases (the same ones the catalog reads).
+// Each database with pending migrations is backed up first
+func Migrate(tomlList []podconfig.FeedToml) error {
+	if config == nil {
+		return errors.New("config is nil")
+	}
+
+	// the db can't be opened until it's migrated, so the feeds only get what's needed to find their
+	// archive dbs
+	var feeds = make([]*Feed, 0, len(tomlList))
+	for _, toml := range tomlList {
+		var f = Feed{FeedToml: toml}
+		if f.Shortname == "" {
+			f.Shortname = f.Name
+		}
+		f.archivePath = feedArchivePath(f.Shortname)
+		feeds = append(feeds, &f)
+	}
+
+	var dbfiles = []string{DBPath(config.WorkspaceDir)}
+	if arcfiles, err := archiveDbFiles(feeds...); err != nil {
 		return err
+	} else {
+		dbfiles = append(dbfiles, arcfiles...)
 	}
-	return nil
+	for _, f := range feeds {
+		if bundles, err := f.bundledOnlyArchives(); err != nil {
+			return err
+		} else if len(bundles) > 0 {
+			log.With("feed", f.Shortname).Warnf("archive dbs in %v bundles not migrated; extract them, then migrate again", len(bundles))
+		}
+	}
+
+	var reterr error
+	for _, dbfile := range dbfiles {
+		if err := migrateFile(dbfile); err != nil {
+			log.With("db", dbfile).Error(err)
+			reterr = errors.Join(reterr, fmt.Errorf("%v: %w", dbfile, err))
+		}
+	}
+	return reterr
 }
 
-func migrateV2toV3(db gormDBInterface) error {
-	log.Info("upgrading from v2 to v3")
-	// v2 to v3 introduced just archive flag for images
-	if err := db.AutoMigrate(&ImageDBEntry{}); err != nil {
+// --------------------------------------------------------------------------
+func migrateFile(dbfile string) error {
+	if exists, err := podutils.FileExists(dbfile); err != nil {
+		return err
+	} else if exists == false {
+		fmt.Printf("%v: not found; will be created on first use\n", dbfile)
+		return nil
+	}
+
+	pdb, err := openDB(dbfile)
+	if err != nil {
+		return err
+	}
+	defer pdb.Close()
+
+	state, err := loadSchemaState(pdb.db)
+	if err != nil {
+		return err
+	} else if len(state.pending) == 0 {
+		// nothing to apply, but legacy databases still get the migrations table recorded
+		if state.legacy && config.DryRun == false {
+			if _, err := pdb.migrate(false); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%v: up to date (version %v)\n", dbfile, latestVersion())
+		return nil
+	}
+	var pending = state.pending
+
+	fmt.Printf("%v: %v pending migration(s)\n", dbfile, len(pending))
+	for _, m := range pending {
+		fmt.Printf("  %v\n", m)
+	}
+	if config.DryRun {
+		return nil
+	}
+
+	if backup, err := pdb.backup(); err != nil {
+		return fmt.Errorf("backup failed; not migrating: %w", err)
+	} else {
+		fmt.Printf("  backed up to %v\n", backup)
+	}
+
+	if _, err := pdb.migrate(false); err != nil {
 		return err
 	}
+	fmt.Printf("  migrated to version %v\n", latestVersion())
 	return nil
 }
@@ -0,0 +1,255 @@
+package pod
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopod/podconfig"
+	"gopod/podutils"
+	"gopod/testutils"
+
+	"github.com/glebarez/sqlite"
+)
+
+// creates a db as a pre-registry binary would have; tables up to version, and poddb_model set
+func createLegacyDb(t *testing.T, path string, version int) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("error creating db dir: %v", err)
+	}
+	gdb, err := gImpl.Open(sqlite.Open(path), &defaultConfig)
+	if err != nil {
+		t.Fatalf("error opening db: %v", err)
+	}
+	defer func() {
+		if sqldb, err := gdb.SqlDB(); err == nil {
+			sqldb.Close()
+		}
+	}()
+
+	var sqlStr = "CREATE TABLE poddb_model (ID integer); INSERT INTO poddb_model (ID) VALUES (?)"
+	if res := gdb.Exec(sqlStr, version); res.Error != nil {
+		t.Fatalf("error creating version: %v", res.Error)
+	}
+	for _, m := range migrations[:min(version, len(migrations))] {
+		if err := m.up(gdb); err != nil {
+			t.Fatalf("error applying migration %v: %v", m, err)
+		}
+	}
+}
+
+func TestMigrations_Registry(t *testing.T) {
+	var checksums = make(map[string]bool)
+	for i, m := range migrations {
+		testutils.Assert(t, m.version == i+1, "migration versions must start at 1 and increase by 1")
+		testutils.Assert(t, m.name != "", "migration name cannot be empty")
+		testutils.Assert(t, len(m.sql) > 0, "migration must do something")
+		testutils.Assert(t, checksums[m.checksum()] == false, "duplicate migration checksum")
+		checksums[m.checksum()] = true
+	}
+	testutils.AssertEquals(t, migrations[len(migrations)-1].version, latestVersion())
+}
+
+// the migrations, applied in order, must give the columns the current models expect; a model change
+// without a migration fails here
+func TestMigrations_Models(t *testing.T) {
+	var (
+		dir    = t.TempDir()
+		models = []any{&FeedDBEntry{}, &FeedXmlDBEntry{}, &ItemDBEntry{}, &ItemXmlDBEntry{}, &ImageDBEntry{},
+			&RunDBEntry{}, &FeedChangeDBEntry{}}
+		columns = func(t *testing.T, path string, auto bool) map[string][]string {
+			gdb, err := gImpl.Open(sqlite.Open(path), &defaultConfig)
+			if err != nil {
+				t.Fatalf("error opening db: %v", err)
+			}
+			defer func() {
+				if sqldb, err := gdb.SqlDB(); err == nil {
+					sqldb.Close()
+				}
+			}()
+			if auto {
+				testutils.AssertErr(t, false, gdb.AutoMigrate(models...))
+			}
+			var tables []string
+			testutils.AssertErr(t, false, gdb.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name LIKE '%DBEntries' "+
+				"AND name != ? ORDER BY name", migrationTable).Scan(&tables).Error)
+			var cols = make(map[string][]string, len(tables))
+			for _, table := range tables {
+				var names []string
+				testutils.AssertErr(t, false, gdb.Raw("SELECT name FROM pragma_table_info(?) ORDER BY name", table).Scan(&names).Error)
+				cols[table] = names
+			}
+			return cols
+		}
+	)
+
+	pdb, err := NewDB(filepath.Join(dir, "migrated.db"))
+	testutils.AssertErr(t, false, err)
+	pdb.Close()
+
+	testutils.AssertEquals(t, columns(t, filepath.Join(dir, "auto.db"), true), columns(t, filepath.Join(dir, "migrated.db"), false))
+}
+
+func TestPodDB_migrate(t *testing.T) {
+
+	type args struct {
+		legacyVer int // zero for new db
+		dryRun    bool
+		// changes made to migrations table before migrating
+		setup string
+	}
+	type exp struct {
+		pending  int
+		errStr   string
+		baseline int // baseline records after migrate
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"new db", args{}, exp{}},
+		{"legacy current", args{legacyVer: latestVersion()}, exp{baseline: latestVersion()}},
+		{"legacy dry run", args{legacyVer: 4, dryRun: true}, exp{pending: latestVersion() - 4}},
+		{"legacy pending", args{legacyVer: 4}, exp{pending: latestVersion() - 4, baseline: 4}},
+		{"legacy newer", args{legacyVer: 42}, exp{errStr: "database schema version 42 is newer"}},
+		{"newer migration", args{setup: "INSERT INTO MigrationDBEntries (Version, Name) VALUES (99, 'future')"},
+			exp{errStr: "database schema version 99 is newer"}},
+		{"checksum mismatch", args{setup: "UPDATE MigrationDBEntries SET Checksum = 'foo' WHERE Version = 3"},
+			exp{errStr: "migration 3 (image archive flag) doesn't match this version of gopod"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path = filepath.Join(t.TempDir(), ".db", "gopod.db")
+			if tt.p.legacyVer > 0 {
+				createLegacyDb(t, path, tt.p.legacyVer)
+			}
+
+			pdb, err := openDB(path)
+			if err != nil {
+				t.Fatalf("error opening db: %v", err)
+			}
+			defer pdb.Close()
+			if tt.p.setup != "" {
+				if res := pdb.db.Exec(tt.p.setup); res.Error != nil {
+					t.Fatalf("error in setup: %v", res.Error)
+				}
+			}
+
+			got, err := pdb.migrate(tt.p.dryRun)
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			if err != nil {
+				return
+			}
+			testutils.AssertEquals(t, tt.e.pending, len(got))
+
+			// after a dry run, nothing should have changed
+			state, err := loadSchemaState(pdb.db)
+			testutils.AssertErr(t, false, err)
+			if tt.p.dryRun {
+				testutils.Assert(t, state.legacy, "dry run should not create migrations table")
+				testutils.AssertEquals(t, tt.e.pending, len(state.pending))
+				return
+			}
+			testutils.Assert(t, state.legacy == false, "expected migrations table")
+			testutils.AssertEquals(t, 0, len(state.pending))
+			testutils.AssertEquals(t, latestVersion(), len(state.applied))
+
+			var baseline int
+			for _, entry := range state.applied {
+				if entry.Baseline {
+					baseline++
+				}
+			}
+			testutils.AssertEquals(t, tt.e.baseline, baseline)
+
+			var legacy = struct{ ID int }{}
+			if res := pdb.db.Raw("SELECT ID from poddb_model").Scan(&legacy); res.Error != nil {
+				t.Fatalf("error reading legacy version: %v", res.Error)
+			}
+			testutils.AssertEquals(t, latestVersion(), legacy.ID)
+
+			// migrated db should open normally, and search index should be created
+			pdb.Close()
+			newdb, err := NewDB(path)
+			testutils.AssertErr(t, false, err)
+			defer newdb.Close()
+			_, err = newdb.searchItems("foo", searchOptions{})
+			testutils.AssertErr(t, false, err)
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+
+	var (
+		dir       = t.TempDir()
+		oldConfig = config
+		dbpath    = DBPath(dir)
+		arcpath   = filepath.Join(dir, "foo", ".arc", "2020", ".db", "foo.db")
+		// archive dir from a custom path template
+		custompath = filepath.Join(dir, "foo", ".arc", "foo-spring", ".db", "foo.db")
+		// feed not in the config; not the catalog's, so not migrated
+		otherpath = filepath.Join(dir, "baz", ".arc", "2020", ".db", "baz.db")
+		tomlList  = []podconfig.FeedToml{{Name: "foo cast", Shortname: "foo"}, {Name: "bar"}}
+	)
+	defer func() { config = oldConfig }()
+	config = &podconfig.Config{WorkspaceDir: dir, TimestampStr: "test"}
+
+	createLegacyDb(t, dbpath, 5)
+	createLegacyDb(t, arcpath, 6)
+	createLegacyDb(t, custompath, 6)
+	createLegacyDb(t, otherpath, 6)
+
+	// not migrated; refuses to open
+	_, err := NewDB(dbpath)
+	testutils.AssertErrContains(t, fmt.Sprintf("database needs migration (%v pending)", latestVersion()-5), err)
+
+	// dry run; no backup, nothing changed
+	config.DryRun = true
+	testutils.AssertErr(t, false, Migrate(tomlList))
+	for _, path := range []string{dbpath, arcpath} {
+		_, err := NewDB(path)
+		testutils.AssertErrContains(t, "database needs migration", err)
+		exists, _ := podutils.FileExists(backupFilename(path, "test"))
+		testutils.Assert(t, exists == false, "backup created on dry run")
+	}
+
+	config.DryRun = false
+	testutils.AssertErr(t, false, Migrate(tomlList))
+	for _, path := range []string{dbpath, arcpath, custompath} {
+		pdb, err := NewDB(path)
+		testutils.AssertErr(t, false, err)
+		pdb.Close()
+
+		var backup = backupFilename(path, "test")
+		exists, _ := podutils.FileExists(backup)
+		testutils.Assert(t, exists, "backup not found: "+backup)
+
+		// backup is the db before migrating
+		_, err = NewDB(backup)
+		testutils.AssertErrContains(t, "database needs migration", err)
+	}
+
+	_, err = NewDB(otherpath)
+	testutils.AssertErrContains(t, "database needs migration", err)
+
+	// already up to date; no further backups (the existing backup is skipped as an archive db)
+	testutils.AssertErr(t, false, Migrate(tomlList))
+
+	// legacy db at the latest version; migrations table is created without backup
+	var legacyPath = filepath.Join(dir, "bar", ".arc", "2021", ".db", "bar.db")
+	createLegacyDb(t, legacyPath, latestVersion())
+	testutils.AssertErr(t, false, Migrate(tomlList))
+	pdb, err := openDB(legacyPath)
+	testutils.AssertErr(t, false, err)
+	defer pdb.Close()
+	state, err := loadSchemaState(pdb.db)
+	testutils.AssertErr(t, false, err)
+	testutils.Assert(t, state.legacy == false, "expected migrations table")
+	exists, _ := podutils.FileExists(backupFilename(legacyPath, "test"))
+	testutils.Assert(t, exists == false, "backup created with nothing pending")
+}
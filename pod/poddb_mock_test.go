@@ -1,6 +1,7 @@
 package pod
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"slices"
@@ -101,6 +102,14 @@ func (mgdb *mockGormDB) Save(value any) *gorm.DB {
 		return mgdb.DB.Save(value)
 	}
 }
+func (mgdb *mockGormDB) Updates(values any) *gorm.DB {
+	appendCallstack(updates)
+	if slices.Contains(mgdb.termErr, updates) {
+		return &gorm.DB{Error: errors.New("updates:foobar")}
+	} else {
+		return mgdb.DB.Updates(values)
+	}
+}
 func (mgdb *mockGormDB) Delete(value any, conds ...any) *gorm.DB {
 	appendCallstack(delete)
 	if slices.Contains(mgdb.termErr, delete) {
@@ -134,6 +143,20 @@ func (mgdb *mockGormDB) Exec(sql string, values ...any) *gorm.DB {
 	}
 }
 
+func (mgdb *mockGormDB) Transaction(fc func(tx gormDBInterface) error) error {
+	appendCallstack(transaction)
+	if slices.Contains(mgdb.termErr, transaction) {
+		return errors.New("transaction:foobar")
+	}
+	return mgdb.DB.Transaction(func(tx *gorm.DB) error {
+		return fc(&mockGormDB{termErr: mgdb.termErr, DB: tx})
+	})
+}
+func (mgdb *mockGormDB) SqlDB() (*sql.DB, error) {
+	// not logging this in callstack; only used for settings and close
+	return mgdb.DB.DB()
+}
+
 // continuation method calls
 func (mgdb *mockGormDB) Where(query any, args ...any) gormDBInterface {
 	appendCallstack(where)
@@ -167,6 +190,14 @@ func (mgdb *mockGormDB) Limit(lim int) gormDBInterface {
 	}
 	return &newdb
 }
+func (mgdb *mockGormDB) Offset(off int) gormDBInterface {
+	appendCallstack(offset)
+	var newdb = mockGormDB{
+		termErr: mgdb.termErr,
+		DB:      mgdb.DB.Offset(off),
+	}
+	return &newdb
+}
 func (mgdb *mockGormDB) Session(config *gorm.Session) gormDBInterface {
 	appendCallstack(session)
 	var newdb = mockGormDB{
@@ -219,6 +250,7 @@ const (
 	preload     stackType = "db.preload"
 	order       stackType = "db.order"
 	limit       stackType = "db.limit"
+	offset      stackType = "db.offset"
 	session     stackType = "db.session"
 	unscoped    stackType = "db.unscoped"
 	count       stackType = "db.count"
@@ -230,9 +262,11 @@ const (
 	first         stackType = "db.first"
 	find          stackType = "db.find"
 	save          stackType = "db.save"
+	updates       stackType = "db.updates"
 	delete        stackType = "db.delete"
 	scan          stackType = "db.scan"
 	exec          stackType = "db.exec"
+	transaction   stackType = "db.transaction"
 )
 
 var callStack []stackType
@@ -0,0 +1,95 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+
+	log "gopod/multilogger"
+)
+
+// an item's hash recalculated with the current config
+type hashChange struct {
+	ItemId  uint
+	OldHash string
+	NewHash string
+}
+
+// --------------------------------------------------------------------------
+// ids of the items (in any feed, deleted or not) holding any of the hashes
+func (pdb PodDB) loadHashOwners(hashes []string) (map[string]uint, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	} else if len(hashes) == 0 {
+		return nil, errors.New("hash list is empty")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	}
+
+	var rows = make([]struct {
+		ID   uint
+		Hash string
+	}, 0)
+	// raw, so soft deleted items are included; the unique index covers them too
+	if res := db.Raw("SELECT ID, Hash FROM ItemDBEntries WHERE Hash IN ?", hashes).Scan(&rows); res.Error != nil {
+		return nil, res.Error
+	}
+
+	var owners = make(map[string]uint, len(rows))
+	for _, row := range rows {
+		owners[row.Hash] = row.ID
+	}
+	return owners, nil
+}
+
+// --------------------------------------------------------------------------
+// updates the item hashes in a single transaction, along with the feed's change history referencing
+// the old hashes.  Hashes are first moved aside, so items swapping or chaining hashes don't trip the
+// unique index
+func (pdb PodDB) rehashItems(feedId uint, changes []hashChange) error {
+	if pdb.path == "" {
+		return errors.New("poddb is not initialized; call NewDB() first")
+	} else if feedId == 0 {
+		return errors.New("feed id cannot be zero")
+	} else if len(changes) == 0 {
+		return errors.New("hash change list is empty")
+	}
+	for _, ch := range changes {
+		if ch.ItemId == 0 {
+			return errors.New("item id cannot be zero")
+		} else if ch.OldHash == "" || ch.NewHash == "" {
+			return fmt.Errorf("item %v hash cannot be empty", ch.ItemId)
+		}
+	}
+
+	return pdb.WithTx(func(tx *PodDB) error {
+		var db = tx.db
+
+		for _, ch := range changes {
+			var res = db.Exec("UPDATE ItemDBEntries SET Hash = ? WHERE ID = ? AND FeedId = ? AND Hash = ?",
+				"rehash."+ch.OldHash, ch.ItemId, feedId, ch.OldHash)
+			if res.Error != nil {
+				return fmt.Errorf("failed moving hash aside for item %v: %w", ch.ItemId, res.Error)
+			} else if res.RowsAffected != 1 {
+				return fmt.Errorf("item %v with hash '%v' not found in feed", ch.ItemId, ch.OldHash)
+			}
+			if res := db.Exec("UPDATE FeedChangeDBEntries SET ItemHash = ? WHERE FeedId = ? AND ItemHash = ?",
+				"rehash."+ch.OldHash, feedId, ch.OldHash); res.Error != nil {
+				return fmt.Errorf("failed moving change history aside for item %v: %w", ch.ItemId, res.Error)
+			}
+		}
+		for _, ch := range changes {
+			if res := db.Exec("UPDATE ItemDBEntries SET Hash = ? WHERE ID = ?", ch.NewHash, ch.ItemId); res.Error != nil {
+				return fmt.Errorf("failed updating hash for item %v: %w", ch.ItemId, res.Error)
+			}
+			if res := db.Exec("UPDATE FeedChangeDBEntries SET ItemHash = ? WHERE FeedId = ? AND ItemHash = ?",
+				ch.NewHash, feedId, "rehash."+ch.OldHash); res.Error != nil {
+				return fmt.Errorf("failed updating change history for item %v: %w", ch.ItemId, res.Error)
+			}
+		}
+		log.Debugf("items rehashed: %v", len(changes))
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package pod
+
+import (
+	"slices"
+	"testing"
+
+	"gopod/podutils"
+	"gopod/testutils"
+)
+
+func TestPodDB_rehashItems(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var (
+		swapped  = []hashChange{{1, "a", "b"}, {2, "b", "a"}}
+		defStack = slices.Concat([]stackType{open, transaction}, slices.Repeat([]stackType{exec}, 8))
+		// failing on the third update
+		failStack = slices.Concat([]stackType{open, transaction}, slices.Repeat([]stackType{exec}, 3))
+	)
+	// i1 and i2 in feed 1, i3 in feed 2; change history for i1
+	seedDeleted(t, gmock.mockdb.DB,
+		&ItemDBEntry{Hash: "a", FeedId: 1},
+		&ItemDBEntry{Hash: "b", FeedId: 1},
+		&ItemDBEntry{Hash: "c", FeedId: 2},
+		&FeedChangeDBEntry{FeedId: 1, FeedChange: FeedChange{Kind: changeRemoved, ItemHash: "a"}},
+	)
+
+	type args struct {
+		emptyPath bool
+		feedId    uint
+		changes   []hashChange
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		hashes    []string
+		history   string
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty path", args{emptyPath: true, feedId: 1, changes: swapped}, exp{errStr: "poddb is not initialized"}},
+		{"feed id zero", args{changes: swapped}, exp{errStr: "feed id cannot be zero"}},
+		{"empty list", args{feedId: 1}, exp{errStr: "hash change list is empty"}},
+		{"item id zero", args{feedId: 1, changes: []hashChange{{0, "a", "b"}}}, exp{errStr: "item id cannot be zero"}},
+		{"empty hash", args{feedId: 1, changes: []hashChange{{1, "a", ""}}}, exp{errStr: "hash cannot be empty"}},
+		{"open error", args{openErr: true, feedId: 1, changes: swapped},
+			exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"exec error", args{termErr: exec, feedId: 1, changes: swapped},
+			exp{errStr: "exec:foobar", callStack: []stackType{open, transaction, exec}}},
+
+		// rolled back; nothing changes
+		{"other feed", args{feedId: 1, changes: []hashChange{{1, "a", "d"}, {3, "c", "e"}}},
+			exp{errStr: "item 3 with hash 'c' not found", callStack: failStack}},
+		{"unique hash", args{feedId: 1, changes: []hashChange{{1, "a", "c"}}},
+			exp{errStr: "failed updating hash for item 1", callStack: failStack}},
+
+		{"swapped", args{feedId: 1, changes: swapped},
+			exp{hashes: []string{"b", "a", "c"}, history: "b", callStack: defStack}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			err := poddb.rehashItems(tt.p.feedId, tt.p.changes)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			var hashes = make([]string, 0)
+			gmock.mockdb.DB.Model(&ItemDBEntry{}).Order("ID").Pluck("Hash", &hashes)
+			var change FeedChangeDBEntry
+			gmock.mockdb.DB.First(&change)
+			if err == nil {
+				testutils.AssertEquals(t, tt.e.hashes, hashes)
+				testutils.AssertEquals(t, tt.e.history, change.ItemHash)
+			} else {
+				testutils.AssertEquals(t, []string{"a", "b", "c"}, hashes)
+				testutils.AssertEquals(t, "a", change.ItemHash)
+			}
+		})
+	}
+}
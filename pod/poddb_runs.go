@@ -0,0 +1,95 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "gopod/multilogger"
+
+	"gorm.io/gorm/clause"
+)
+
+// where a run was started from
+const (
+	runSourceCli = "cli"
+	runSourceApi = "api"
+)
+
+// history of runs against a feed; one entry per feed per run
+type RunDBEntry struct {
+	PodDBModel
+	FeedId          uint `gorm:"index"`
+	Shortname       string
+	Command         string
+	Source          string
+	StartedAt       time.Time
+	FinishedAt      time.Time
+	Downloaded      int
+	DownloadedBytes uint64
+	Changes         int    // feed changes found from the previous fetch
+	Error           string // empty on success
+}
+
+type runOptions struct {
+	feedId uint // zero for all feeds
+	limit  int  // zero or less for all runs
+	offset int
+}
+
+// --------------------------------------------------------------------------
+func (pdb PodDB) saveRun(run *RunDBEntry) error {
+	if pdb.path == "" {
+		return errors.New("poddb is not initialized; call NewDB() first")
+	} else if run == nil {
+		return errors.New("run cannot be nil")
+	} else if run.FeedId == 0 {
+		return errors.New("run feed id cannot be zero")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return fmt.Errorf("error opening db: %w", err)
+	}
+
+	var res = db.Save(run)
+	log.Debugf("rows affected: %v", res.RowsAffected)
+	return res.Error
+}
+
+// --------------------------------------------------------------------------
+// run history, most recent first, along with the total count of runs matching (for paging)
+func (pdb PodDB) loadRuns(opt runOptions) ([]*RunDBEntry, int64, error) {
+	if pdb.path == "" {
+		return nil, 0, errors.New("poddb is not initialized; call NewDB() first")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return nil, 0, fmt.Errorf("error opening db: %w", err)
+	}
+
+	var (
+		total   int64
+		runlist = make([]*RunDBEntry, 0)
+		where   = &RunDBEntry{FeedId: opt.feedId}
+	)
+	if res := db.Model(&RunDBEntry{}).Where(where).Count(&total); res.Error != nil {
+		return nil, 0, res.Error
+	}
+
+	var tx = db.Where(where).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "StartedAt"}, Desc: true})
+	if opt.limit > 0 {
+		tx = tx.Limit(opt.limit)
+	}
+	if opt.offset > 0 {
+		tx = tx.Offset(opt.offset)
+	}
+	if res := tx.Find(&runlist); res.Error != nil {
+		return nil, 0, res.Error
+	}
+	log.Debugf("rows found: %v (total: %v)", len(runlist), total)
+
+	return runlist, total, nil
+}
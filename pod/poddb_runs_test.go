@@ -0,0 +1,152 @@
+package pod
+
+import (
+	"gopod/podutils"
+	"gopod/testutils"
+	"testing"
+	"time"
+)
+
+func TestPodDB_saveRun(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var (
+		now      = time.Now().Truncate(time.Second)
+		defStack = []stackType{open, save}
+	)
+
+	if err := gmock.mockdb.DB.AutoMigrate(&RunDBEntry{}); err != nil {
+		t.Fatalf("error in automigrate: %v", err)
+	}
+
+	type args struct {
+		emptyPath bool
+		nilRun    bool
+		run       RunDBEntry
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty path", args{emptyPath: true, run: RunDBEntry{FeedId: 1}}, exp{errStr: "poddb is not initialized"}},
+		{"run nil", args{nilRun: true}, exp{errStr: "run cannot be nil"}},
+		{"feed id zero", args{run: RunDBEntry{}}, exp{errStr: "run feed id cannot be zero"}},
+		{"open error", args{openErr: true, run: RunDBEntry{FeedId: 1}},
+			exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"save error", args{termErr: save, run: RunDBEntry{FeedId: 1}},
+			exp{errStr: "save:foobar", callStack: defStack}},
+
+		{"success", args{run: RunDBEntry{FeedId: 1, Shortname: "foo", Command: "update", StartedAt: now,
+			FinishedAt: now.Add(time.Minute), Downloaded: 2, DownloadedBytes: 1234, Error: "foobar"}},
+			exp{callStack: defStack}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			err := poddb.saveRun(podutils.Tern(tt.p.nilRun, nil, &tt.p.run))
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			if err == nil {
+				var dbEntry RunDBEntry
+				res := gmock.mockdb.DB.Where(&RunDBEntry{PodDBModel: PodDBModel{ID: tt.p.run.ID}}).First(&dbEntry)
+				testutils.AssertErr(t, false, res.Error)
+				testutils.AssertEquals(t, tt.p.run.Shortname, dbEntry.Shortname)
+				testutils.AssertEquals(t, tt.p.run.Downloaded, dbEntry.Downloaded)
+				testutils.AssertEquals(t, tt.p.run.DownloadedBytes, dbEntry.DownloadedBytes)
+				testutils.AssertEquals(t, tt.p.run.Error, dbEntry.Error)
+				testutils.Assert(t, tt.p.run.StartedAt.Equal(dbEntry.StartedAt), "started at mismatch")
+			}
+		})
+	}
+}
+
+func TestPodDB_loadRuns(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var (
+		date     = time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+		runs     = make([]*RunDBEntry, 0)
+		defStack = []stackType{open, model, where, count, where, order}
+	)
+	// feed 1 has runs on days 0, 2, 4; feed 2 on days 1, 3
+	for day := range 5 {
+		runs = append(runs, &RunDBEntry{FeedId: uint(day%2 + 1), StartedAt: date.AddDate(0, 0, day)})
+	}
+
+	if err := gmock.mockdb.DB.AutoMigrate(&RunDBEntry{}); err != nil {
+		t.Fatalf("error in automigrate: %v", err)
+	} else if res := gmock.mockdb.DB.Create(runs); res.Error != nil {
+		t.Fatalf("error in insert: %v", res.Error)
+	}
+
+	type args struct {
+		emptyPath bool
+		opt       runOptions
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		days      []int
+		total     int64
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty path", args{emptyPath: true}, exp{errStr: "poddb is not initialized"}},
+		{"open error", args{openErr: true}, exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"count error", args{termErr: count},
+			exp{errStr: "count:foobar", callStack: []stackType{open, model, where, count}}},
+		{"find error", args{termErr: find},
+			exp{errStr: "find:foobar", callStack: append(defStack, find)}},
+
+		{"all runs", args{}, exp{days: []int{4, 3, 2, 1, 0}, total: 5, callStack: append(defStack, find)}},
+		{"feed runs", args{opt: runOptions{feedId: 1}},
+			exp{days: []int{4, 2, 0}, total: 3, callStack: append(defStack, find)}},
+		{"paged", args{opt: runOptions{limit: 2, offset: 1}},
+			exp{days: []int{3, 2}, total: 5, callStack: append(defStack, limit, offset, find)}},
+		{"no runs", args{opt: runOptions{feedId: 3}}, exp{days: []int{}, total: 0, callStack: append(defStack, find)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			list, total, err := poddb.loadRuns(tt.p.opt)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			if err == nil {
+				var days = make([]int, 0, len(list))
+				for _, run := range list {
+					days = append(days, int(run.StartedAt.Sub(date).Hours()/24))
+				}
+				testutils.AssertEquals(t, tt.e.days, days)
+				testutils.AssertEquals(t, tt.e.total, total)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package pod
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "gopod/multilogger"
+)
+
+// full text search over item xml metadata; external content fts5 table backed by ItemXmlDBEntries,
+// kept in sync with triggers so any save (or delete) of item xml updates the index
+const (
+	searchTable   = "ItemSearch"
+	searchColumns = "Title, Description, ItunesSummary, ContentEncoded"
+
+	// highlight markers for snippets; replaced on output
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+	snippetWords = 16
+)
+
+var searchIndexSql = []string{
+	"CREATE VIRTUAL TABLE IF NOT EXISTS " + searchTable + " USING fts5(" + searchColumns +
+		", content='ItemXmlDBEntries', content_rowid='ID')",
+
+	"CREATE TRIGGER IF NOT EXISTS " + searchTable + "_ai AFTER INSERT ON ItemXmlDBEntries BEGIN " +
+		"INSERT INTO " + searchTable + "(rowid, " + searchColumns + ") " +
+		"VALUES (new.ID, new.Title, new.Description, new.ItunesSummary, new.ContentEncoded); END",
+
+	"CREATE TRIGGER IF NOT EXISTS " + searchTable + "_ad AFTER DELETE ON ItemXmlDBEntries BEGIN " +
+		"INSERT INTO " + searchTable + "(" + searchTable + ", rowid, " + searchColumns + ") " +
+		"VALUES ('delete', old.ID, old.Title, old.Description, old.ItunesSummary, old.ContentEncoded); END",
+
+	"CREATE TRIGGER IF NOT EXISTS " + searchTable + "_au AFTER UPDATE ON ItemXmlDBEntries BEGIN " +
+		"INSERT INTO " + searchTable + "(" + searchTable + ", rowid, " + searchColumns + ") " +
+		"VALUES ('delete', old.ID, old.Title, old.Description, old.ItunesSummary, old.ContentEncoded); " +
+		"INSERT INTO " + searchTable + "(rowid, " + searchColumns + ") " +
+		"VALUES (new.ID, new.Title, new.Description, new.ItunesSummary, new.ContentEncoded); END",
+}
+
+// rebuilds the index from existing item xml
+var searchRebuildSql = fmt.Sprintf("INSERT INTO %[1]v(%[1]v) VALUES ('rebuild')", searchTable)
+
+type searchOptions struct {
+	feedIds []uint // empty for all feeds
+	after   time.Time
+	before  time.Time
+	limit   int // zero or less for all results
+}
+
+type searchResult struct {
+	FeedId       uint
+	ItemId       uint
+	Shortname    string
+	Title        string
+	PubTimeStamp time.Time
+	Filename     string
+	Downloaded   bool
+	Archived     bool
+	ArchiveDir   string
+	Snippet      string
+}
+
+// --------------------------------------------------------------------------
+// creates the search table and triggers (if they don't exist), and (re)builds the index
+// from existing item xml
+func createSearchIndex(db gormDBInterface) error {
+	for _, sqlStr := range searchIndexSql {
+		if res := db.Exec(sqlStr); res.Error != nil {
+			return fmt.Errorf("error creating search index: %w", res.Error)
+		}
+	}
+	if res := db.Exec(searchRebuildSql); res.Error != nil {
+		return fmt.Errorf("error building search index: %w", res.Error)
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// full text search over item title, description and show notes; query uses fts5 syntax.
+// Results are ordered by relevance; deleted items/feeds are not included
+func (pdb PodDB) searchItems(query string, opt searchOptions) ([]*searchResult, error) {
+	if pdb.path == "" {
+		return nil, errors.New("poddb is not initialized; call NewDB() first")
+	} else if strings.TrimSpace(query) == "" {
+		return nil, errors.New("search query cannot be empty")
+	}
+
+	db, err := pdb.open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening db: %w", err)
+	}
+
+	// matches in the db's index; in a catalog, the archive cache has its own (ids don't overlap)
+	var (
+		matchStr = fmt.Sprintf("SELECT rowid, rank, snippet(%[1]v, -1, ?, ?, '...', %[2]v) AS Snippet "+
+			"FROM %%v.%[1]v WHERE %[1]v MATCH ?", searchTable, snippetWords)
+		matches = fmt.Sprintf(matchStr, "main")
+		args    = []any{snippetStart, snippetEnd, query}
+	)
+	if pdb.catalog {
+		matches += " UNION ALL " + fmt.Sprintf(matchStr, catalogSchema)
+		args = append(args, snippetStart, snippetEnd, query)
+	}
+
+	var sqlStr = "SELECT i.FeedId, i.ID AS ItemId, f.DBShortname AS Shortname, x.Title, i.PubTimeStamp, " +
+		"i.Filename, i.Downloaded, i.Archived, i.ArchiveDir, s.Snippet " +
+		"FROM (" + matches + ") s " +
+		"JOIN ItemXmlDBEntries x ON x.ID = s.rowid " +
+		"JOIN ItemDBEntries i ON i.XmlId = x.ID " +
+		"JOIN FeedDBEntries f ON f.ID = i.FeedId " +
+		"WHERE i.DeletedAt IS NULL AND f.DeletedAt IS NULL "
+	if len(opt.feedIds) > 0 {
+		sqlStr += "AND i.FeedId IN ? "
+		args = append(args, opt.feedIds)
+	}
+	// timestamps are stored as text with the offset they were saved with; julianday compares them
+	// (and the bound times, written the same way) as utc
+	if opt.after.IsZero() == false {
+		sqlStr += "AND julianday(i.PubTimeStamp) >= julianday(?) "
+		args = append(args, opt.after)
+	}
+	if opt.before.IsZero() == false {
+		sqlStr += "AND julianday(i.PubTimeStamp) < julianday(?) "
+		args = append(args, opt.before)
+	}
+	sqlStr += "ORDER BY s.rank"
+	if opt.limit > 0 {
+		sqlStr += " LIMIT ?"
+		args = append(args, opt.limit)
+	}
+
+	var ret = make([]*searchResult, 0)
+	if res := db.Raw(sqlStr, args...).Scan(&ret); res.Error != nil {
+		return nil, res.Error
+	}
+	log.Debugf("search rows found: %v", len(ret))
+
+	return ret, nil
+}
@@ -0,0 +1,137 @@
+package pod
+
+import (
+	"fmt"
+	"gopod/podutils"
+	"gopod/testutils"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPodDB_searchItems(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var (
+		f1, f2   = generateFeed(false), generateFeed(false)
+		i1, i2   = generateItem(0, true), generateItem(0, true)
+		i3, i4   = generateItem(0, true), generateItem(0, true)
+		date     = time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+		defStack = []stackType{open, raw, scan}
+	)
+
+	f1.DBShortname, f2.DBShortname = "one", "two"
+	i1.XmlData.Title, i1.PubTimeStamp = "foo episode", date
+	i2.XmlData.Description, i2.PubTimeStamp = "<p>talking about foo and bar</p>", date.AddDate(0, 1, 0)
+	i3.XmlData.ContentEncoded, i3.PubTimeStamp = "show notes: bar only", date.AddDate(0, 2, 0)
+	i4.XmlData.ItunesSummary, i4.PubTimeStamp = "foo, deleted", date
+	f1.ItemList = []*ItemDBEntry{&i1, &i2, &i4}
+	f2.ItemList = []*ItemDBEntry{&i3}
+
+	if err := gmock.mockdb.DB.AutoMigrate(&FeedDBEntry{}, &ItemDBEntry{}, &ItemXmlDBEntry{}); err != nil {
+		t.Fatalf("error in automigrate: %v", err)
+	} else if err := createSearchIndex(gmock.mockdb); err != nil {
+		t.Fatalf("error creating search index: %v", err)
+	} else if res := gmock.mockdb.DB.Create([]*FeedDBEntry{&f1, &f2}); res.Error != nil {
+		t.Fatalf("error in insert: %v", res.Error)
+	} else if res := gmock.mockdb.DB.Delete(&i4); res.Error != nil {
+		t.Fatalf("error in delete: %v", res.Error)
+	}
+	// update after insert, to make sure index is kept in sync
+	i3.XmlData.Title = "updated bar title"
+	if res := gmock.mockdb.DB.Save(i3.XmlData); res.Error != nil {
+		t.Fatalf("error in update: %v", res.Error)
+	}
+
+	type args struct {
+		emptyPath bool
+		query     string
+		opt       searchOptions
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		titles    []string
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		// error tests
+		{"empty path", args{emptyPath: true, query: "foo"}, exp{errStr: "poddb is not initialized"}},
+		{"empty query", args{query: " "}, exp{errStr: "search query cannot be empty"}},
+		{"open error", args{openErr: true, query: "foo"},
+			exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"scan error", args{termErr: scan, query: "foo"},
+			exp{errStr: "scan:foobar", callStack: defStack}},
+		{"bad query syntax", args{query: "foo AND"}, exp{errStr: "syntax error", callStack: defStack}},
+
+		// success tests; deleted items are not included
+		{"title and description", args{query: "foo"},
+			exp{titles: []string{"foo episode", i2.XmlData.Title}, callStack: defStack}},
+		{"updated entry", args{query: "updated"},
+			exp{titles: []string{"updated bar title"}, callStack: defStack}},
+		{"no matches", args{query: "foobar"}, exp{titles: []string{}, callStack: defStack}},
+		{"feed filter", args{query: "bar", opt: searchOptions{feedIds: []uint{f2.ID}}},
+			exp{titles: []string{"updated bar title"}, callStack: defStack}},
+		{"date after", args{query: "foo", opt: searchOptions{after: date.AddDate(0, 0, 1)}},
+			exp{titles: []string{i2.XmlData.Title}, callStack: defStack}},
+		{"date before", args{query: "foo OR bar", opt: searchOptions{before: date.AddDate(0, 2, 0)}},
+			exp{titles: []string{"foo episode", i2.XmlData.Title}, callStack: defStack}},
+		// same instant as the day before in utc; compared as utc, not as text
+		{"date after, other timezone",
+			args{query: "foo", opt: searchOptions{after: date.Add(-time.Hour).In(time.FixedZone("", 6*3600))}},
+			exp{titles: []string{"foo episode", i2.XmlData.Title}, callStack: defStack}},
+		{"limit", args{query: "bar", opt: searchOptions{limit: 1}},
+			exp{titles: []string{"updated bar title"}, callStack: defStack}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			list, err := poddb.searchItems(tt.p.query, tt.p.opt)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+			if tt.e.titles != nil {
+				var titles = make([]string, 0, len(list))
+				for _, r := range list {
+					titles = append(titles, r.Title)
+				}
+				// relevance order isn't under test
+				slices.Sort(tt.e.titles)
+				slices.Sort(titles)
+				testutils.AssertEquals(t, tt.e.titles, titles)
+			}
+			for _, r := range list {
+				testutils.Assert(t, r.Snippet != "", fmt.Sprintf("expected snippet for '%v'", r.Title))
+			}
+		})
+	}
+}
+
+func Test_cleanSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"plain", "foo bar", "foo bar"},
+		{"tags", "<p>foo <b>\x02bar\x03</b></p>", "foo \x02bar\x03"},
+		{"cut off tags", `ref="foo">some text <a hr`, "some text"},
+		{"entities", "foo &amp; bar", "foo & bar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.AssertEquals(t, tt.want, cleanSnippet(tt.snippet))
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"gopod/podutils"
 	"gopod/testutils"
 	"math/rand"
+	"path/filepath"
 	"slices"
 	"testing"
 	"time"
@@ -46,15 +47,18 @@ func TestNewDB(t *testing.T) {
 		// 	arg{mock: mockGorm{mockdb: &mockGormDB{}}, termErr: []stackType{exec, scan}, createVer: -1},
 		// 	exp{dbNil: true, createVerCalled: true, errStr: "error finding db version",
 		// 		callStack: []stackType{open, raw, scan, exec}}},
-		{"model version mismatch", arg{mock: mockGorm{mockdb: &mockGormDB{}}, createVer: 42},
-			exp{dbNil: true, errStr: "old version not less than current", callStack: []stackType{open, raw, scan}}},
+		{"newer model version", arg{mock: mockGorm{mockdb: &mockGormDB{}}, createVer: 42},
+			exp{dbNil: true, errStr: "database schema version 42 is newer than this version of gopod supports",
+				callStack: []stackType{open, raw, scan, raw, scan}}},
+		{"migrations pending", arg{mock: mockGorm{mockdb: &mockGormDB{}}, createVer: 5},
+			exp{dbNil: true, errStr: fmt.Sprintf("database needs migration (%v pending)", latestVersion()-5), callStack: []stackType{open, raw, scan, raw, scan}}},
 
 		// todo: create version table, new unit test on createNewDb()
 		// {"success, create version table", arg{mock: mockGorm{mockdb: &mockGormDB{}}, createVer: -1},
 		// 	exp{createVerCalled: true, callStack: []stackType{open, raw, scan, exec}}},
 
 		{"success, matching model versions", arg{mock: mockGorm{mockdb: &mockGormDB{}}},
-			exp{callStack: []stackType{open, raw, scan}}},
+			exp{callStack: []stackType{open, raw, scan, raw, scan}}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -70,7 +74,7 @@ func TestNewDB(t *testing.T) {
 			if tt.p.createVer >= 0 {
 				var createVer = tt.p.createVer
 				if createVer == 0 {
-					createVer = currentModel
+					createVer = latestVersion()
 				}
 				// create version
 				if res := gmock.mockdb.DB.
@@ -95,6 +99,100 @@ func TestNewDB(t *testing.T) {
 	}
 }
 
+func TestPodDB_WithTx(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	if err := gmock.mockdb.DB.AutoMigrate(&RunDBEntry{}); err != nil {
+		t.Fatalf("error in automigrate: %v", err)
+	}
+
+	type args struct {
+		emptyPath bool
+		nilFn     bool
+		fnErr     bool
+		nested    bool
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		saved     int64 // runs in db after the call
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		{"empty path", args{emptyPath: true}, exp{errStr: "poddb is not initialized"}},
+		{"nil fn", args{nilFn: true}, exp{errStr: "transaction function cannot be nil"}},
+		{"open error", args{openErr: true}, exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"transaction error", args{termErr: transaction},
+			exp{errStr: "transaction:foobar", callStack: []stackType{open, transaction}}},
+		{"fn error rolls back", args{fnErr: true},
+			exp{errStr: "fn:foobar", callStack: []stackType{open, transaction, save}}},
+
+		{"commit", args{}, exp{saved: 1, callStack: []stackType{open, transaction, save}}},
+		// inner transaction uses the outer, without opening
+		{"nested commit", args{nested: true}, exp{saved: 2, callStack: []stackType{open, transaction, transaction, save}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			var fn = func(tx *PodDB) error {
+				if err := tx.saveRun(&RunDBEntry{FeedId: 1}); err != nil {
+					return err
+				} else if tt.p.fnErr {
+					return errors.New("fn:foobar")
+				}
+				return nil
+			}
+			if tt.p.nested {
+				var inner = fn
+				fn = func(tx *PodDB) error { return tx.WithTx(inner) }
+			}
+
+			err := poddb.WithTx(podutils.Tern(tt.p.nilFn, nil, fn))
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			var total int64
+			gmock.mockdb.DB.Model(&RunDBEntry{}).Count(&total)
+			testutils.AssertEquals(t, tt.e.saved, total)
+		})
+	}
+}
+
+func TestPodDB_Close(t *testing.T) {
+
+	poddb, err := NewDB(filepath.Join(t.TempDir(), "gopod.db"))
+	if err != nil {
+		t.Fatalf("error creating db: %v", err)
+	}
+
+	var mode string
+	if res := poddb.db.Raw("PRAGMA journal_mode").Scan(&mode); res.Error != nil {
+		t.Fatalf("error checking journal mode: %v", res.Error)
+	}
+	testutils.AssertEquals(t, "wal", mode)
+
+	testutils.AssertErr(t, false, poddb.Close())
+	testutils.Assert(t, poddb.db == nil, "connection not cleared on close")
+	// already closed
+	testutils.AssertErr(t, false, poddb.Close())
+
+	// still usable, opening per call
+	_, err = poddb.isFeedDeleted("foo")
+	testutils.AssertErr(t, false, err)
+}
+
 func TestPodDB_IsFeedDeleted(t *testing.T) {
 
 	var gmock, teardown = setupGormMock(t, nil, true)
@@ -804,15 +902,180 @@ func TestPodDB_saveItems(t *testing.T) {
 	}
 }
 
+func TestPodDB_saveFeedStatus(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var (
+		of1      = generateFeed(false)
+		now      = time.Now().Truncate(time.Second)
+		defStack = []stackType{open, model, updates}
+	)
+	of1.LastError = "previous error"
+
+	if err := gmock.mockdb.DB.AutoMigrate(&FeedDBEntry{}); err != nil {
+		t.Fatalf("error in automigrate: %v", err)
+	} else if res := gmock.mockdb.DB.Create(&of1); res.Error != nil {
+		t.Fatalf("error in insert: %v", res.Error)
+	}
+
+	type args struct {
+		emptyPath bool
+		nilFeed   bool
+		feed      FeedDBEntry
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		lastUpdated time.Time
+		lastError   string
+		errStr      string
+		callStack   []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		// error tests, no db changes
+		{"empty path", args{emptyPath: true, feed: of1}, exp{errStr: "poddb is not initialized"}},
+		{"feed nil", args{nilFeed: true}, exp{errStr: "feed cannot be nil"}},
+		{"feed id zero", args{feed: FeedDBEntry{}}, exp{errStr: "feed id is zero"}},
+		{"open error", args{openErr: true, feed: of1},
+			exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"updates error", args{termErr: updates, feed: of1},
+			exp{errStr: "updates:foobar", callStack: defStack}},
+
+		// success tests
+		{"set error", args{feed: FeedDBEntry{PodDBModel: of1.PodDBModel, LastError: "foobar"}},
+			exp{lastError: "foobar", callStack: defStack}},
+		{"clear error", args{feed: FeedDBEntry{PodDBModel: of1.PodDBModel, LastUpdated: now}},
+			exp{lastUpdated: now, callStack: defStack}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			err := poddb.saveFeedStatus(podutils.Tern(tt.p.nilFeed, nil, &tt.p.feed))
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+
+			if err == nil {
+				var dbEntry FeedDBEntry
+				res := gmock.mockdb.DB.Where(&FeedDBEntry{PodDBModel: PodDBModel{ID: of1.ID}}).First(&dbEntry)
+				testutils.AssertErr(t, false, res.Error)
+				testutils.AssertEquals(t, of1.Hash, dbEntry.Hash)
+				testutils.AssertEquals(t, tt.e.lastError, dbEntry.LastError)
+				testutils.Assert(t, tt.e.lastUpdated.Equal(dbEntry.LastUpdated),
+					fmt.Sprintf("expected last updated %v, got %v", tt.e.lastUpdated, dbEntry.LastUpdated))
+			}
+		})
+	}
+}
+
+func TestPodDB_loadFeedItemStats(t *testing.T) {
+
+	gmock, teardown := setupGormMock(t, nil, true)
+	defer teardown(t, gmock)
+
+	var (
+		f1, f2   = generateFeed(false), generateFeed(false)
+		newest   = time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+		defStack = []stackType{open, raw, scan, where, order, first}
+	)
+
+	if err := gmock.mockdb.DB.AutoMigrate(&FeedDBEntry{}, &ItemDBEntry{}); err != nil {
+		t.Fatalf("error in automigrate: %v", err)
+	} else if res := gmock.mockdb.DB.Create([]*FeedDBEntry{&f1, &f2}); res.Error != nil {
+		t.Fatalf("error in insert: %v", res.Error)
+	}
+
+	var items = make([]*ItemDBEntry, 0)
+	for idx, state := range []struct{ dl, arc, rem bool }{{true, false, false}, {true, false, true}, {false, false, false},
+		{true, true, true}, {false, false, true}} {
+		var item = generateItem(f1.ID, false)
+		item.Downloaded, item.Archived, item.RemovedUpstream = state.dl, state.arc, state.rem
+		item.PubTimeStamp = newest.AddDate(0, 0, -idx)
+		items = append(items, &item)
+	}
+	if res := gmock.mockdb.DB.Create(items); res.Error != nil {
+		t.Fatalf("error in insert: %v", res.Error)
+	} else if res := gmock.mockdb.DB.Delete(items[len(items)-1]); res.Error != nil {
+		t.Fatalf("error in delete: %v", res.Error)
+	}
+
+	type args struct {
+		emptyPath bool
+		feedId    uint
+		openErr   bool
+		termErr   stackType
+	}
+	type exp struct {
+		stats     *itemStats
+		errStr    string
+		callStack []stackType
+	}
+	tests := []struct {
+		name string
+		p    args
+		e    exp
+	}{
+		// error tests
+		{"empty path", args{emptyPath: true, feedId: f1.ID}, exp{errStr: "poddb is not initialized"}},
+		{"feed id zero", args{}, exp{errStr: "feed id cannot be zero"}},
+		{"open error", args{openErr: true, feedId: f1.ID},
+			exp{errStr: "error opening db", callStack: []stackType{open}}},
+		{"scan error", args{termErr: scan, feedId: f1.ID},
+			exp{errStr: "scan:foobar", callStack: []stackType{open, raw, scan}}},
+		{"first error", args{termErr: first, feedId: f1.ID},
+			exp{errStr: "first:foobar", callStack: defStack}},
+
+		// success tests; deleted item not included
+		{"feed with items", args{feedId: f1.ID},
+			exp{stats: &itemStats{Total: 4, Downloaded: 3, NotDownloaded: 1, Archived: 1, RemovedUpstream: 2, NewestPubDate: newest},
+				callStack: defStack}},
+		{"feed without items", args{feedId: f2.ID},
+			exp{stats: &itemStats{}, callStack: []stackType{open, raw, scan}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetCallStack()
+			var poddb = PodDB{path: podutils.Tern(tt.p.emptyPath, "", inMemoryPath)}
+			gmock.openErr = tt.p.openErr
+			gmock.mockdb.termErr = []stackType{tt.p.termErr}
+
+			stats, err := poddb.loadFeedItemStats(tt.p.feedId)
+
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			compareCallstack(t, tt.e.callStack)
+			if tt.e.stats != nil && stats != nil {
+				testutils.Assert(t, tt.e.stats.NewestPubDate.Equal(stats.NewestPubDate),
+					fmt.Sprintf("expected newest %v, got %v", tt.e.stats.NewestPubDate, stats.NewestPubDate))
+				stats.NewestPubDate = tt.e.stats.NewestPubDate
+			}
+			testutils.AssertEquals(t, tt.e.stats, stats)
+		})
+	}
+}
+
 func TestPodDB_deleteFeed(t *testing.T) {
 
 	var defCallStack, noItemCallStack = []stackType{}, []stackType{}
-	// item finding
-	defCallStack = append(defCallStack, open, where, order, find)
-	noItemCallStack = append(noItemCallStack, open, where, order, find)
+	// item finding, in transaction
+	defCallStack = append(defCallStack, open, transaction, where, order, find)
+	noItemCallStack = append(noItemCallStack, open, transaction, where, order, find)
+
+	// item deletion (xml, xml revisions & item) (chunks will be 1)
+	defCallStack = append(defCallStack, delete, where, delete, delete)
 
-	// item deletion (xml & item) (chunks will be 1)
-	defCallStack = append(defCallStack, open, delete, delete)
+	// image finding (no images, so no delete)
+	defCallStack = append(defCallStack, where, order, find)
+	noItemCallStack = append(noItemCallStack, where, order, find)
 
 	// feed xml & feed
 	defCallStack = append(defCallStack, delete, delete)
@@ -844,7 +1107,7 @@ func TestPodDB_deleteFeed(t *testing.T) {
 		{"open error", args{openErr: true},
 			exp{errStr: "error opening db", expDelIndex: -1, callStack: []stackType{open}}},
 		{"delete error", args{termErr: delete},
-			exp{errStr: "delete:foobar", expDelIndex: -1, callStack: []stackType{open, where, order, find, open, delete}}},
+			exp{errStr: "delete:foobar", expDelIndex: -1, callStack: []stackType{open, transaction, where, order, find, delete}}},
 
 		// list errors
 		{"nil feed", args{nilfeed: true},
@@ -884,7 +1147,7 @@ func TestPodDB_deleteFeed(t *testing.T) {
 
 			// insert shit, full assoc
 			if err := gmock.mockdb.DB.AutoMigrate(&FeedDBEntry{}, &FeedXmlDBEntry{},
-				&ItemDBEntry{}, &ItemXmlDBEntry{}); err != nil {
+				&ItemDBEntry{}, &ItemXmlDBEntry{}, &ImageDBEntry{}); err != nil {
 				t.Fatalf("error in automigrate: %v", err)
 			} else if res := gmock.mockdb.DB. /*Debug().*/
 								Session(&gorm.Session{FullSaveAssociations: true}).
@@ -990,7 +1253,7 @@ func TestPodDB_deleteItems(t *testing.T) {
 		item3, item4 = generateItem(1, true), generateItem(1, true)
 
 		missingId    = item1
-		defCallStack = []stackType{open, delete, delete}
+		defCallStack = []stackType{open, delete, where, delete, delete}
 	)
 
 	missingId.ID = 0
@@ -1026,7 +1289,7 @@ func TestPodDB_deleteItems(t *testing.T) {
 		// list errors
 		{"missing id", args{missingId: true, delIndex: []int{1}}, exp{errStr: "item missing ID"}},
 		{"delete non-existant item", args{notInserted: true, delIndex: []int{}},
-			exp{errStr: "", callStack: []stackType{open, delete, delete}}}, // will only warn in logs
+			exp{errStr: "", callStack: []stackType{open, delete, where, delete, delete}}}, // will only warn in logs
 
 		// success tests
 		{"delete empty list", args{delIndex: []int{}}, exp{expDelIndex: []int{}}},
@@ -0,0 +1,477 @@
+package pod
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html/template"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "gopod/multilogger"
+	"gopod/podutils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultServeListen = ":8080"
+	// episodes included in the all feeds new episodes feed
+	newEpisodeCount      = 100
+	serveShutdownTimeout = 10 * time.Second
+	serveRealm           = "gopod"
+)
+
+// routes; feeds are /feed/<shortname>.xml, episodes /media/<shortname>/<item id>/<filename>
+const (
+	routeFeed  = "/feed/"
+	routeNew   = "/new.xml"
+	routeMedia = "/media/"
+)
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><title>gopod</title></head><body>
+<h1>gopod</h1>
+<ul>
+<li><a href="{{.New}}">new episodes (all feeds)</a></li>
+{{range .Feeds}}<li><a href="{{.Url}}">{{.Name}}</a></li>
+{{end}}</ul>
+</body></html>
+`))
+
+type server struct {
+	feeds    map[string]*Feed // by shortname; replaced when updated thru the api
+	user     string
+	password string
+
+	mu       sync.RWMutex
+	updating sync.WaitGroup // updates started thru the api
+	active   string         // shortname of the running update, if any
+
+	// main and archive dbs, for episodes only in archives; nil to read the main db only
+	catalog *PodDB
+}
+
+// downloaded episode, with its file on disk
+type serveItem struct {
+	feed *Feed
+	item *ItemDBEntry
+	path string
+	size int64
+}
+
+// --------------------------------------------------------------------------
+// serves downloaded episodes (including archived) from the feed list as rss feeds, until the
+// context is canceled.  Feeds not in the db, or deleted, are not served
+func Serve(ctx context.Context, feedlist []*Feed) error {
+
+	if config == nil {
+		return errors.New("cannot serve feeds; config is nil")
+	} else if db == nil {
+		return errors.New("cannot serve feeds; db is nil")
+	} else if (config.ServeUser == "") != (config.ServePassword == "") {
+		return errors.New("both serveuser and servepassword must be set in config for basic auth")
+	}
+
+	var s = server{
+		feeds:    make(map[string]*Feed, len(feedlist)),
+		user:     config.ServeUser,
+		password: config.ServePassword,
+	}
+
+	for _, f := range feedlist {
+		if err := f.LoadDBFeed(loadOptions{dontCreate: true, includeXml: true}); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) || isFeedDeletedErr(err) {
+				f.log.Info("feed not in db, or deleted; not serving")
+				continue
+			}
+			return err
+		}
+		s.feeds[f.Shortname] = f
+	}
+	if len(s.feeds) == 0 {
+		return errors.New("no feeds to serve")
+	}
+
+	// archives opened once; restart the server to pick up later archive runs
+	if catalog, err := openFeedCatalog(slices.Collect(maps.Values(s.feeds))...); err != nil {
+		return fmt.Errorf("failed opening archive catalog: %w", err)
+	} else {
+		s.catalog = catalog
+		defer catalog.Close()
+	}
+
+	var (
+		listen = podutils.Tern(config.ServeListen == "", defaultServeListen, config.ServeListen)
+		srv    = http.Server{Addr: listen, Handler: s.handler()}
+		errch  = make(chan error, 1)
+	)
+
+	go func() { errch <- srv.ListenAndServe() }()
+
+	log.Infof("serving %v feeds on %v (basic auth: %v)", len(s.feeds), listen, s.user != "")
+
+	select {
+	case err := <-errch:
+		return err
+	case <-ctx.Done():
+		log.Info("shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		var err = srv.Shutdown(shutdownCtx)
+		// let any running update finish, rather than leaving partial downloads
+		s.updating.Wait()
+		return err
+	}
+}
+
+// --------------------------------------------------------------------------
+func (s *server) handler() http.Handler {
+	var mux = http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET "+routeNew, s.handleNew)
+	mux.HandleFunc("GET "+routeFeed+"{file}", s.handleFeed)
+	mux.HandleFunc("GET "+routeMedia+"{shortname}/{id}/{filename}", s.handleMedia)
+	s.addApiRoutes(mux)
+
+	return s.withAuth(mux)
+}
+
+// --------------------------------------------------------------------------
+func (s *server) withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("%v %v %v (range: '%v')", r.RemoteAddr, r.Method, r.URL.Path, r.Header.Get("Range"))
+
+		if s.user != "" {
+			user, pass, ok := r.BasicAuth()
+			if ok == false ||
+				subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(pass), []byte(s.password)) != 1 {
+
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%v"`, serveRealm))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// --------------------------------------------------------------------------
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	type link struct{ Name, Url string }
+
+	var data = struct {
+		New   string
+		Feeds []link
+	}{New: routeNew}
+
+	for _, f := range s.sortedFeeds() {
+		data.Feeds = append(data.Feeds, link{
+			Name: podutils.Tern(f.Name != "", f.Name, f.Shortname),
+			Url:  feedRoute(f.Shortname),
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, data); err != nil {
+		log.Errorf("failed writing index: %v", err)
+	}
+}
+
+// --------------------------------------------------------------------------
+func (s *server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	f, exists := s.feed(strings.TrimSuffix(r.PathValue("file"), ".xml"))
+	if exists == false {
+		http.NotFound(w, r)
+		return
+	}
+
+	itemlist, err := s.feedItems(f)
+	if isFeedDeletedErr(err) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		f.log.Errorf("failed loading items: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	var channel = podutils.RssChannel{
+		Title:       f.Name,
+		Description: f.Name,
+	}
+	if xml := f.XmlFeedData; xml != nil {
+		channel.Title = podutils.Tern(xml.Title != "", xml.Title, f.Name)
+		channel.Link = xml.Link
+		channel.Description = podutils.Tern(xml.Description != "", xml.Description, channel.Title)
+		channel.ItunesAuthor = xml.Author
+		if xml.ItunesImageUrl != "" {
+			channel.ItunesImage = &podutils.RssHref{Href: xml.ItunesImageUrl}
+		}
+		if xml.Image.Url != "" {
+			channel.Image = &podutils.RssImage{Url: xml.Image.Url, Title: channel.Title, Link: channel.Link}
+		}
+	}
+
+	s.writeRss(w, r, channel, itemlist, false)
+}
+
+// --------------------------------------------------------------------------
+// most recent episodes across all feeds
+func (s *server) handleNew(w http.ResponseWriter, r *http.Request) {
+	var itemlist = make([]serveItem, 0)
+
+	for _, f := range s.sortedFeeds() {
+		list, err := s.feedItems(f)
+		if isFeedDeletedErr(err) {
+			continue
+		} else if err != nil {
+			f.log.Errorf("failed loading items: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		itemlist = append(itemlist, list...)
+	}
+
+	slices.SortStableFunc(itemlist, func(l, r serveItem) int {
+		return r.item.PubTimeStamp.Compare(l.item.PubTimeStamp)
+	})
+	itemlist = itemlist[:min(len(itemlist), newEpisodeCount)]
+
+	var channel = podutils.RssChannel{
+		Title:       "gopod - new episodes",
+		Description: "most recent episodes from all feeds",
+	}
+	s.writeRss(w, r, channel, itemlist, true)
+}
+
+// --------------------------------------------------------------------------
+func (s *server) handleMedia(w http.ResponseWriter, r *http.Request) {
+	f, exists := s.feed(r.PathValue("shortname"))
+	if exists == false {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// only the one item is loaded and its file checked; the feed may be deleted while serving
+	if _, err := db.isFeedDeleted(f.Hash); isFeedDeletedErr(err) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		f.log.Errorf("failed checking deleted: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	item, err := s.readDB().loadFeedItem(f.ID, uint(id), loadOptions{includeXml: true})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		f.log.Errorf("failed loading item: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	si, exists := f.serveItem(item)
+	if exists == false {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(si.path)
+	if err != nil {
+		f.log.Errorf("failed opening file: %v", err)
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		f.log.Errorf("failed stat on file: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", itemMimeType(si))
+	// handles range requests
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), file)
+}
+
+// --------------------------------------------------------------------------
+// downloaded (or archived) items for the feed, newest first; items whose file is missing are skipped.
+// Returns ErrorFeedDeleted if the feed was deleted after the server started
+func (s *server) feedItems(f *Feed) ([]serveItem, error) {
+
+	if _, err := db.isFeedDeleted(f.Hash); err != nil {
+		return nil, err
+	}
+
+	list, err := s.readDB().loadFeedItems(f.ID, AllItems, loadOptions{includeXml: true, direction: cDESC})
+	if err != nil {
+		return nil, err
+	}
+
+	var ret = make([]serveItem, 0, len(list))
+	for _, item := range list {
+		if si, exists := f.serveItem(item); exists {
+			ret = append(ret, si)
+		}
+	}
+	return ret, nil
+}
+
+// --------------------------------------------------------------------------
+// the item with its file, if it's downloaded (or archived) and the file exists
+func (f *Feed) serveItem(item *ItemDBEntry) (serveItem, bool) {
+	if item.Downloaded == false && item.Archived == false {
+		return serveItem{}, false
+	}
+	var path = filepath.Join(f.mp3Path, item.Filename)
+	if item.Archived {
+		path = filepath.Join(f.itemArchivePath(item.ArchiveDir, item.PubTimeStamp), item.Filename)
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		f.log.With("file", path).Debugf("skipping item; file not found: %v", err)
+		return serveItem{}, false
+	}
+	return serveItem{feed: f, item: item, path: path, size: stat.Size()}, true
+}
+
+// --------------------------------------------------------------------------
+// prefixTitle adds the feed shortname to each episode title, for feeds mixing episodes from all feeds
+func (s *server) writeRss(w http.ResponseWriter, r *http.Request, channel podutils.RssChannel,
+	itemlist []serveItem, prefixTitle bool) {
+
+	var base = baseUrl(r)
+
+	channel.Items = make([]podutils.RssItem, 0, len(itemlist))
+	for _, si := range itemlist {
+		var rssItem = genRssItem(base, si)
+		if prefixTitle {
+			rssItem.Title = fmt.Sprintf("[%v] %v", si.feed.Shortname, rssItem.Title)
+		}
+		channel.Items = append(channel.Items, rssItem)
+	}
+	if len(itemlist) > 0 {
+		channel.LastBuildDate = podutils.RssDate(itemlist[0].item.PubTimeStamp)
+	}
+
+	buf, err := podutils.GenerateRss(channel)
+	if err != nil {
+		log.Errorf("failed generating rss: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write(buf)
+}
+
+// --------------------------------------------------------------------------
+// db episodes are read from; the catalog when open
+func (s *server) readDB() *PodDB {
+	return podutils.Tern(s.catalog != nil, s.catalog, db)
+}
+
+// --------------------------------------------------------------------------
+func (s *server) feed(shortname string) (*Feed, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, exists := s.feeds[shortname]
+	return f, exists
+}
+
+// --------------------------------------------------------------------------
+func (s *server) sortedFeeds() []*Feed {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list = make([]*Feed, 0, len(s.feeds))
+	for _, f := range s.feeds {
+		list = append(list, f)
+	}
+	slices.SortFunc(list, func(l, r *Feed) int { return cmp.Compare(l.Shortname, r.Shortname) })
+	return list
+}
+
+// --------------------------------------------------------------------------
+func genRssItem(base string, si serveItem) podutils.RssItem {
+	var (
+		item = si.item
+		ret  = podutils.RssItem{
+			Title:   item.Filename,
+			Guid:    &podutils.RssGuid{Value: item.Guid},
+			PubDate: podutils.RssDate(item.PubTimeStamp),
+			Enclosure: podutils.RssEnclosure{
+				Url:    base + mediaRoute(si.feed.Shortname, item.ID, item.Filename),
+				Length: si.size,
+				Type:   itemMimeType(si),
+			},
+		}
+	)
+	if xml := item.XmlData; xml != nil {
+		ret.Title = podutils.Tern(xml.Title != "", xml.Title, item.Filename)
+		ret.Link = xml.Link
+		ret.Description = podutils.Tern(xml.Description != "", xml.Description, xml.ItunesSummary)
+		ret.ItunesDuration = xml.DurationStr
+		ret.ItunesEpisode = xml.EpisodeStr
+		ret.ItunesSeason = xml.SeasonStr
+		if xml.Imageurl != "" {
+			ret.ItunesImage = &podutils.RssHref{Href: xml.Imageurl}
+		}
+	}
+	return ret
+}
+
+// --------------------------------------------------------------------------
+// enclosure type from the original feed, otherwise from file extension
+func itemMimeType(si serveItem) string {
+	if si.item.XmlData != nil && si.item.XmlData.Enclosure.TypeStr != "" {
+		return si.item.XmlData.Enclosure.TypeStr
+	} else if mt := mime.TypeByExtension(filepath.Ext(si.path)); mt != "" {
+		return mt
+	}
+	return "audio/mpeg"
+}
+
+// --------------------------------------------------------------------------
+// scheme and host the request was made to, so enclosure urls work from wherever the client is
+func baseUrl(r *http.Request) string {
+	var scheme = podutils.Tern(r.TLS != nil, "https", "http")
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// --------------------------------------------------------------------------
+func feedRoute(shortname string) string {
+	return routeFeed + url.PathEscape(shortname) + ".xml"
+}
+
+// --------------------------------------------------------------------------
+func mediaRoute(shortname string, id uint, filename string) string {
+	return fmt.Sprintf("%v%v/%v/%v", routeMedia, url.PathEscape(shortname), id, url.PathEscape(filename))
+}
+
+// --------------------------------------------------------------------------
+func isFeedDeletedErr(err error) bool {
+	var errDeleted *ErrorFeedDeleted
+	return errors.As(err, &errDeleted)
+}
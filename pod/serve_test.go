@@ -0,0 +1,244 @@
+package pod
+
+import (
+	"gopod/podconfig"
+	"gopod/podutils"
+	"gopod/testutils"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// accepts everything when parsing served rss; hash is the guid
+type serveTestProcess struct{}
+
+func (serveTestProcess) SkipParsingItem(string) (bool, bool)         { return false, false }
+func (serveTestProcess) CancelOnPubDate(time.Time) bool              { return false }
+func (serveTestProcess) CancelOnBuildDate(time.Time) bool            { return false }
+func (serveTestProcess) CalcItemHash(guid, _ string) (string, error) { return guid, nil }
+
+var serveTestDate = time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+
+// sets up a db in a temp workspace, with feeds foo and bar, and del (deleted); returns a test server
+// (with basic auth user/pass) for the handler, and teardown
+func setupServeTest(t *testing.T) (*server, *httptest.Server, func()) {
+
+	var (
+		dir       = t.TempDir()
+		oldConfig = config
+		oldDB     = db
+		date      = serveTestDate
+	)
+
+	config = &podconfig.Config{WorkspaceDir: dir, TimestampStr: "test"}
+	if pdb, err := NewDB(filepath.Join(dir, ".db", "gopod.db")); err != nil {
+		t.Fatalf("error creating db: %v", err)
+	} else {
+		db = pdb
+	}
+
+	// creates feed in db, with items; files are created for downloaded items unless missing is set
+	type testItem struct {
+		title      string
+		pubdate    time.Time
+		downloaded bool
+		archived   bool
+		missing    bool
+	}
+	var genFeed = func(shortname string, items ...testItem) *Feed {
+		f, err := NewFeed(podconfig.FeedToml{Name: shortname + " cast", Shortname: shortname, Url: "https://foo.bar/" + shortname})
+		if err != nil {
+			t.Fatalf("error creating feed: %v", err)
+		} else if err := f.LoadDBFeed(loadOptions{}); err != nil {
+			t.Fatalf("error loading feed: %v", err)
+		}
+		f.XmlFeedData = &FeedXmlDBEntry{}
+		f.XmlFeedData.Title = shortname + " title"
+		if err := db.saveFeed(&f.FeedDBEntry); err != nil {
+			t.Fatalf("error saving feed: %v", err)
+		}
+
+		var list = make([]*ItemDBEntry, 0, len(items))
+		for _, ti := range items {
+			var item = generateItem(f.ID, true)
+			item.XmlData.Title, item.XmlData.DurationStr = ti.title, "30:00"
+			item.Filename, item.PubTimeStamp = ti.title+".mp3", ti.pubdate
+			item.Downloaded, item.Archived = ti.downloaded, ti.archived
+			list = append(list, &item)
+
+			var path = podutils.Tern(ti.archived, f.archiveYearPath(ti.pubdate.Year()), f.mp3Path)
+			if (ti.downloaded || ti.archived) && ti.missing == false {
+				testutils.AssertErr(t, false, os.MkdirAll(path, 0755))
+				testutils.AssertErr(t, false, os.WriteFile(filepath.Join(path, item.Filename), []byte("0123456789"), 0644))
+			}
+		}
+		if err := db.saveItems(list...); err != nil {
+			t.Fatalf("error saving items: %v", err)
+		}
+		return f
+	}
+
+	var (
+		foo = genFeed("foo",
+			testItem{title: "foo1", pubdate: date.AddDate(-1, 0, 0), archived: true},
+			testItem{title: "foo2", pubdate: date, downloaded: true},
+			testItem{title: "foo3", pubdate: date.AddDate(0, 0, 2)},
+			testItem{title: "foo4", pubdate: date.AddDate(0, 0, 3), downloaded: true, missing: true},
+		)
+		bar = genFeed("bar",
+			testItem{title: "bar1", pubdate: date.AddDate(0, 0, 1), downloaded: true},
+		)
+		del = genFeed("del",
+			testItem{title: "del1", pubdate: date.AddDate(0, 0, 4), downloaded: true},
+		)
+	)
+	if err := db.deleteFeed(&del.FeedDBEntry); err != nil {
+		t.Fatalf("error deleting feed: %v", err)
+	}
+
+	var s = &server{
+		feeds:    map[string]*Feed{"foo": foo, "bar": bar, "del": del},
+		user:     "user",
+		password: "pass",
+	}
+	var ts = httptest.NewServer(s.handler())
+
+	return s, ts, func() {
+		ts.Close()
+		config, db = oldConfig, oldDB
+	}
+}
+
+// --------------------------------------------------------------------------
+func serveTestRequest(t *testing.T, ts *httptest.Server, method, path string, body io.Reader,
+	auth bool, hdr map[string]string) (*http.Response, []byte) {
+
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, body)
+	if err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+	if auth {
+		req.SetBasicAuth("user", "pass")
+	}
+	for k, v := range hdr {
+		req.Header.Set(k, v)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("error in request: %v", err)
+	}
+	defer resp.Body.Close()
+	ret, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("error reading body: %v", err)
+	}
+	return resp, ret
+}
+
+func TestServer_handler(t *testing.T) {
+
+	s, ts, teardown := setupServeTest(t)
+	defer teardown()
+
+	var (
+		foo = s.feeds["foo"]
+		get = func(path string, auth bool, hdr map[string]string) (*http.Response, []byte) {
+			return serveTestRequest(t, ts, http.MethodGet, path, nil, auth, hdr)
+		}
+	)
+
+	// parses rss, returning item titles and enclosure urls
+	var parse = func(body []byte) ([]string, []string) {
+		_, items, err := podutils.ParseXml(body, serveTestProcess{})
+		if err != nil {
+			t.Fatalf("error parsing rss: %v", err)
+		}
+		var titles, urls []string
+		for _, pair := range items {
+			titles = append(titles, pair.ItemData.Title)
+			urls = append(urls, pair.ItemData.Enclosure.Url)
+		}
+		return titles, urls
+	}
+
+	t.Run("auth required", func(t *testing.T) {
+		resp, _ := get(feedRoute("foo"), false, nil)
+		testutils.AssertEquals(t, http.StatusUnauthorized, resp.StatusCode)
+		testutils.Assert(t, resp.Header.Get("WWW-Authenticate") != "", "expected authenticate header")
+	})
+
+	t.Run("index", func(t *testing.T) {
+		resp, body := get("/", true, nil)
+		testutils.AssertEquals(t, http.StatusOK, resp.StatusCode)
+		testutils.Assert(t, strings.Contains(string(body), feedRoute("bar")), "expected feed link in index")
+	})
+
+	t.Run("feed", func(t *testing.T) {
+		resp, body := get(feedRoute("foo"), true, nil)
+		testutils.AssertEquals(t, http.StatusOK, resp.StatusCode)
+		titles, urls := parse(body)
+		// not downloaded and missing files are excluded; archived included
+		testutils.AssertEquals(t, []string{"foo2", "foo1"}, titles)
+		for _, u := range urls {
+			testutils.Assert(t, strings.HasPrefix(u, ts.URL+routeMedia+"foo/"), "unexpected enclosure url: "+u)
+		}
+	})
+
+	t.Run("deleted feed", func(t *testing.T) {
+		resp, _ := get(feedRoute("del"), true, nil)
+		testutils.AssertEquals(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("unknown feed", func(t *testing.T) {
+		resp, _ := get(feedRoute("missing"), true, nil)
+		testutils.AssertEquals(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("new episodes", func(t *testing.T) {
+		resp, body := get(routeNew, true, nil)
+		testutils.AssertEquals(t, http.StatusOK, resp.StatusCode)
+		titles, _ := parse(body)
+		testutils.AssertEquals(t, []string{"[bar] bar1", "[foo] foo2", "[foo] foo1"}, titles)
+	})
+
+	t.Run("media range", func(t *testing.T) {
+		_, body := get(feedRoute("foo"), true, nil)
+		_, urls := parse(body)
+		if len(urls) != 2 {
+			t.Fatalf("expected 2 enclosures, got %v", len(urls))
+		}
+		for _, u := range urls {
+			resp, data := get(u[len(ts.URL):], true, map[string]string{"Range": "bytes=2-5"})
+			testutils.AssertEquals(t, http.StatusPartialContent, resp.StatusCode)
+			testutils.AssertEquals(t, "2345", string(data))
+		}
+	})
+
+	t.Run("media not downloaded", func(t *testing.T) {
+		items, err := db.loadFeedItems(foo.ID, AllItems, loadOptions{})
+		if err != nil {
+			t.Fatalf("error loading items: %v", err)
+		}
+		var idx = slices.IndexFunc(items, func(i *ItemDBEntry) bool { return i.Filename == "foo3.mp3" })
+		resp, _ := get(mediaRoute("foo", items[idx].ID, items[idx].Filename), true, nil)
+		testutils.AssertEquals(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("media not in feed", func(t *testing.T) {
+		items, err := db.loadFeedItems(s.feeds["bar"].ID, AllItems, loadOptions{})
+		if err != nil {
+			t.Fatalf("error loading items: %v", err)
+		}
+		resp, _ := get(mediaRoute("foo", items[0].ID, items[0].Filename), true, nil)
+		testutils.AssertEquals(t, http.StatusNotFound, resp.StatusCode)
+		resp, _ = get(mediaRoute("bar", items[0].ID, items[0].Filename), true, nil)
+		testutils.AssertEquals(t, http.StatusOK, resp.StatusCode)
+	})
+}
@@ -0,0 +1,471 @@
+package pod
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	log "gopod/multilogger"
+	"gopod/podutils"
+
+	"gorm.io/gorm"
+)
+
+// json api, served along side the rss feeds.  Versioned by path; breaking changes go in a new version
+const (
+	routeApi = "/api/v1"
+
+	apiDefaultLimit = 50
+	apiMaxLimit     = 500
+)
+
+// single page of a list; total is the count before paging
+type apiPage[T any] struct {
+	Total  int
+	Offset int
+	Limit  int
+	Items  []T
+}
+
+type apiItem struct {
+	ID         uint
+	Hash       string
+	Guid       string
+	Title      string
+	Filename   string
+	Url        string
+	PubDate    time.Time
+	EpNum      int
+	Duration   string
+	Downloaded bool
+	Archived   bool
+	Listened   bool
+	Path       string // empty if not downloaded or archived
+	MediaUrl   string // empty if file is not on disk
+}
+
+// fields that can be changed on an item; nil is left as is
+type apiItemPatch struct {
+	Downloaded *bool
+	Archived   *bool
+	Listened   *bool
+}
+
+type apiRun struct {
+	ID              uint
+	Shortname       string
+	Command         string
+	Source          string
+	StartedAt       time.Time
+	FinishedAt      time.Time
+	Downloaded      int
+	DownloadedBytes uint64
+	Changes         int
+	Error           string
+}
+
+type apiUpdate struct {
+	Shortname string
+	Started   time.Time
+}
+
+type apiError struct {
+	Error string
+}
+
+// --------------------------------------------------------------------------
+func (s *server) addApiRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+routeApi+"/feeds", s.apiListFeeds)
+	mux.HandleFunc("GET "+routeApi+"/feeds/{shortname}", s.apiGetFeed)
+	mux.HandleFunc("GET "+routeApi+"/feeds/{shortname}/items", s.apiListItems)
+	mux.HandleFunc("GET "+routeApi+"/feeds/{shortname}/items/{id}", s.apiGetItem)
+	mux.HandleFunc("PATCH "+routeApi+"/feeds/{shortname}/items/{id}", s.apiPatchItem)
+	mux.HandleFunc("POST "+routeApi+"/feeds/{shortname}/update", s.apiUpdateFeed)
+	mux.HandleFunc("GET "+routeApi+"/feeds/{shortname}/runs", s.apiListRuns)
+	mux.HandleFunc("GET "+routeApi+"/runs", s.apiListRuns)
+}
+
+// --------------------------------------------------------------------------
+// feed status for all feeds served, ordered by shortname
+func (s *server) apiListFeeds(w http.ResponseWriter, r *http.Request) {
+	var list = make([]FeedStatus, 0)
+	for _, f := range s.sortedFeeds() {
+		fs, err := s.apiFeedStatus(f)
+		if err != nil {
+			f.log.Errorf("failed getting status: %v", err)
+			writeApiError(w, http.StatusInternalServerError, "failed getting status for '%v'", f.Shortname)
+			return
+		}
+		list = append(list, *fs)
+	}
+	writeJson(w, http.StatusOK, list)
+}
+
+// --------------------------------------------------------------------------
+func (s *server) apiGetFeed(w http.ResponseWriter, r *http.Request) {
+	f, exists := s.feed(r.PathValue("shortname"))
+	if exists == false {
+		writeApiError(w, http.StatusNotFound, "feed '%v' not found", r.PathValue("shortname"))
+		return
+	}
+	fs, err := s.apiFeedStatus(f)
+	if err != nil {
+		f.log.Errorf("failed getting status: %v", err)
+		writeApiError(w, http.StatusInternalServerError, "failed getting status for '%v'", f.Shortname)
+		return
+	}
+	writeJson(w, http.StatusOK, fs)
+}
+
+// --------------------------------------------------------------------------
+// items for the feed, newest first.  Filters: downloaded, archived (true/false), after, before
+// (publish date); paging with limit and offset
+func (s *server) apiListItems(w http.ResponseWriter, r *http.Request) {
+	f, ok := s.apiLoadFeed(w, r)
+	if ok == false {
+		return
+	}
+
+	var (
+		query = r.URL.Query()
+		opt   = itemPageOptions{feedId: f.ID}
+		err   error
+	)
+	if opt.downloaded, err = parseBoolParam(query.Get("downloaded")); err != nil {
+		writeApiError(w, http.StatusBadRequest, "downloaded not recognized: %v", err)
+		return
+	} else if opt.archived, err = parseBoolParam(query.Get("archived")); err != nil {
+		writeApiError(w, http.StatusBadRequest, "archived not recognized: %v", err)
+		return
+	} else if opt.after, err = parseSearchDate(query.Get("after")); err != nil {
+		writeApiError(w, http.StatusBadRequest, "after not recognized: %v", err)
+		return
+	} else if opt.before, err = parseSearchDate(query.Get("before")); err != nil {
+		writeApiError(w, http.StatusBadRequest, "before not recognized: %v", err)
+		return
+	}
+	if opt.limit, opt.offset, err = parsePaging(r); err != nil {
+		writeApiError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	itemlist, total, err := s.readDB().loadFeedItemPage(opt)
+	if err != nil {
+		f.log.Errorf("failed loading items: %v", err)
+		writeApiError(w, http.StatusInternalServerError, "failed loading items")
+		return
+	}
+
+	var page = apiPage[apiItem]{Total: int(total), Offset: opt.offset, Limit: opt.limit, Items: make([]apiItem, 0, len(itemlist))}
+	for _, item := range itemlist {
+		page.Items = append(page.Items, genApiItem(r, f, item))
+	}
+	writeJson(w, http.StatusOK, page)
+}
+
+// --------------------------------------------------------------------------
+func (s *server) apiGetItem(w http.ResponseWriter, r *http.Request) {
+	f, item, ok := s.apiLoadItem(w, r)
+	if ok {
+		writeJson(w, http.StatusOK, genApiItem(r, f, item))
+	}
+}
+
+// --------------------------------------------------------------------------
+// marks the item downloaded, archived and/or listened; only the db is changed, files are not touched.
+// Items only in an archive db are read only
+func (s *server) apiPatchItem(w http.ResponseWriter, r *http.Request) {
+	f, item, ok := s.apiLoadItem(w, r)
+	if ok == false {
+		return
+	}
+	if s.catalog != nil {
+		// catalog ids of archive only items aren't ids in the main db
+		mainItem, err := db.loadFeedItem(f.ID, item.ID, loadOptions{includeXml: true})
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && mainItem.Hash != item.Hash) {
+			writeApiError(w, http.StatusConflict, "item %v is only in an archive db and can't be changed", item.ID)
+			return
+		} else if err != nil {
+			f.log.Errorf("failed loading item: %v", err)
+			writeApiError(w, http.StatusInternalServerError, "failed loading item")
+			return
+		}
+		item = mainItem
+	}
+
+	var (
+		patch apiItemPatch
+		dec   = json.NewDecoder(r.Body)
+	)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		writeApiError(w, http.StatusBadRequest, "invalid body: %v", err)
+		return
+	}
+	if patch.Downloaded != nil {
+		item.Downloaded = *patch.Downloaded
+	}
+	if patch.Archived != nil {
+		item.Archived = *patch.Archived
+	}
+	if patch.Listened != nil {
+		item.Listened = *patch.Listened
+	}
+
+	if err := db.saveItems(item); err != nil {
+		f.log.Errorf("failed saving item: %v", err)
+		writeApiError(w, http.StatusInternalServerError, "failed saving item")
+		return
+	}
+	f.log.With("item", item.Filename).Infof("item updated thru api; downloaded: %v, archived: %v, listened: %v",
+		item.Downloaded, item.Archived, item.Listened)
+
+	writeJson(w, http.StatusOK, genApiItem(r, f, item))
+}
+
+// --------------------------------------------------------------------------
+// starts an update of the feed in the background; only one update runs at a time.
+// Progress is available thru run history once finished
+func (s *server) apiUpdateFeed(w http.ResponseWriter, r *http.Request) {
+	f, exists := s.feed(r.PathValue("shortname"))
+	if exists == false {
+		writeApiError(w, http.StatusNotFound, "feed '%v' not found", r.PathValue("shortname"))
+		return
+	}
+
+	s.mu.Lock()
+	if s.active != "" {
+		var active = s.active
+		s.mu.Unlock()
+		writeApiError(w, http.StatusConflict, "update already running for '%v'", active)
+		return
+	}
+	s.active = f.Shortname
+	s.updating.Add(1)
+	s.mu.Unlock()
+
+	var ret = apiUpdate{Shortname: f.Shortname, Started: time.Now()}
+
+	go func() {
+		defer s.updating.Done()
+		defer func() {
+			s.mu.Lock()
+			s.active = ""
+			s.mu.Unlock()
+		}()
+
+		// fresh feed for the update, so requests being served don't see it mid change
+		nf, err := NewFeed(f.FeedToml)
+		if err != nil {
+			f.log.Errorf("failed creating feed for update: %v", err)
+			return
+		}
+		nf.log.Info("running update thru api")
+		var res = updateFeeds(runSourceApi, nf)
+		for _, err := range res.Errors {
+			nf.log.Errorf("update error: %v", err)
+		}
+		nf.log.Infof("update finished; downloaded %v files", res.TotalDownloaded)
+
+		if nf.ID > 0 {
+			s.mu.Lock()
+			s.feeds[nf.Shortname] = nf
+			s.mu.Unlock()
+		}
+	}()
+
+	w.Header().Set("Location", fmt.Sprintf("%v/feeds/%v/runs", routeApi, f.Shortname))
+	writeJson(w, http.StatusAccepted, ret)
+}
+
+// --------------------------------------------------------------------------
+// run history, most recent first; for a single feed if shortname is in the path
+func (s *server) apiListRuns(w http.ResponseWriter, r *http.Request) {
+	var opt runOptions
+	if shortname := r.PathValue("shortname"); shortname != "" {
+		f, exists := s.feed(shortname)
+		if exists == false {
+			writeApiError(w, http.StatusNotFound, "feed '%v' not found", shortname)
+			return
+		}
+		opt.feedId = f.ID
+	}
+
+	var err error
+	if opt.limit, opt.offset, err = parsePaging(r); err != nil {
+		writeApiError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	runlist, total, err := db.loadRuns(opt)
+	if err != nil {
+		log.Errorf("failed loading runs: %v", err)
+		writeApiError(w, http.StatusInternalServerError, "failed loading runs")
+		return
+	}
+
+	var page = apiPage[apiRun]{Total: int(total), Offset: opt.offset, Limit: opt.limit, Items: make([]apiRun, 0, len(runlist))}
+	for _, run := range runlist {
+		page.Items = append(page.Items, apiRun{
+			ID:              run.ID,
+			Shortname:       run.Shortname,
+			Command:         run.Command,
+			Source:          run.Source,
+			StartedAt:       run.StartedAt,
+			FinishedAt:      run.FinishedAt,
+			Downloaded:      run.Downloaded,
+			DownloadedBytes: run.DownloadedBytes,
+			Changes:         run.Changes,
+			Error:           run.Error,
+		})
+	}
+	writeJson(w, http.StatusOK, page)
+}
+
+// --------------------------------------------------------------------------
+// feed in the path, if it's served and not deleted; writes the error response on failure
+func (s *server) apiLoadFeed(w http.ResponseWriter, r *http.Request) (*Feed, bool) {
+	f, exists := s.feed(r.PathValue("shortname"))
+	if exists == false {
+		writeApiError(w, http.StatusNotFound, "feed '%v' not found", r.PathValue("shortname"))
+		return nil, false
+	}
+
+	if _, err := db.isFeedDeleted(f.Hash); isFeedDeletedErr(err) {
+		writeApiError(w, http.StatusNotFound, "feed '%v' is deleted", f.Shortname)
+		return nil, false
+	} else if err != nil {
+		f.log.Errorf("failed checking deleted: %v", err)
+		writeApiError(w, http.StatusInternalServerError, "failed loading feed")
+		return nil, false
+	}
+	return f, true
+}
+
+// --------------------------------------------------------------------------
+// only the item in the path is loaded, from the same db the rss feeds are served from
+func (s *server) apiLoadItem(w http.ResponseWriter, r *http.Request) (*Feed, *ItemDBEntry, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil || id == 0 {
+		writeApiError(w, http.StatusBadRequest, "item id '%v' not recognized", r.PathValue("id"))
+		return nil, nil, false
+	}
+
+	f, ok := s.apiLoadFeed(w, r)
+	if ok == false {
+		return nil, nil, false
+	}
+
+	item, err := s.readDB().loadFeedItem(f.ID, uint(id), loadOptions{includeXml: true})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeApiError(w, http.StatusNotFound, "item %v not found in feed '%v'", id, f.Shortname)
+		return nil, nil, false
+	} else if err != nil {
+		f.log.Errorf("failed loading item: %v", err)
+		writeApiError(w, http.StatusInternalServerError, "failed loading item")
+		return nil, nil, false
+	}
+	return f, item, true
+}
+
+// --------------------------------------------------------------------------
+// status, checking deleted against the db as the feed may be deleted while serving
+func (s *server) apiFeedStatus(f *Feed) (*FeedStatus, error) {
+	fs, err := f.status(s.readDB())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.isFeedDeleted(f.Hash); isFeedDeletedErr(err) {
+		fs.Deleted = true
+	} else if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// --------------------------------------------------------------------------
+func genApiItem(r *http.Request, f *Feed, item *ItemDBEntry) apiItem {
+	var ret = apiItem{
+		ID:         item.ID,
+		Hash:       item.Hash,
+		Guid:       item.Guid,
+		Title:      item.Filename,
+		Filename:   item.Filename,
+		Url:        item.Url,
+		PubDate:    item.PubTimeStamp,
+		EpNum:      item.EpNum,
+		Downloaded: item.Downloaded,
+		Archived:   item.Archived,
+		Listened:   item.Listened,
+	}
+	if item.XmlData != nil {
+		ret.Title = podutils.Tern(item.XmlData.Title != "", item.XmlData.Title, item.Filename)
+		ret.Duration = item.XmlData.DurationStr
+	}
+
+	if item.Archived {
+		ret.Path = filepath.Join(f.itemArchivePath(item.ArchiveDir, item.PubTimeStamp), item.Filename)
+	} else if item.Downloaded {
+		ret.Path = filepath.Join(f.mp3Path, item.Filename)
+	}
+	if ret.Path != "" {
+		if _, err := os.Stat(ret.Path); err == nil {
+			ret.MediaUrl = baseUrl(r) + mediaRoute(f.Shortname, item.ID, item.Filename)
+		}
+	}
+	return ret
+}
+
+// --------------------------------------------------------------------------
+// empty is nil (not filtered)
+func parseBoolParam(str string) (*bool, error) {
+	if str == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(str)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// --------------------------------------------------------------------------
+func parsePaging(r *http.Request) (limit, offset int, err error) {
+	var query = r.URL.Query()
+
+	limit = apiDefaultLimit
+	if str := query.Get("limit"); str != "" {
+		if limit, err = strconv.Atoi(str); err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("limit '%v' not recognized", str)
+		}
+		limit = min(limit, apiMaxLimit)
+	}
+	if str := query.Get("offset"); str != "" {
+		if offset, err = strconv.Atoi(str); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset '%v' not recognized", str)
+		}
+	}
+	return limit, offset, nil
+}
+
+// --------------------------------------------------------------------------
+func writeJson(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	var enc = json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		log.Errorf("failed writing json response: %v", err)
+	}
+}
+
+// --------------------------------------------------------------------------
+func writeApiError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJson(w, status, apiError{Error: fmt.Sprintf(format, args...)})
+}
@@ -0,0 +1,205 @@
+package pod
+
+import (
+	"encoding/json"
+	"gopod/testutils"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestServer_api(t *testing.T) {
+
+	s, ts, teardown := setupServeTest(t)
+	defer teardown()
+
+	var (
+		foo, bar = s.feeds["foo"], s.feeds["bar"]
+		// decodes json response body into ret
+		request = func(method, path, body string, expStatus int, ret any) {
+			t.Helper()
+			resp, data := serveTestRequest(t, ts, method, routeApi+path, strings.NewReader(body), true, nil)
+			testutils.AssertEquals(t, expStatus, resp.StatusCode)
+			testutils.AssertEquals(t, "application/json", resp.Header.Get("Content-Type"))
+			if ret != nil {
+				testutils.AssertErr(t, false, json.Unmarshal(data, ret))
+			}
+		}
+		titles = func(page apiPage[apiItem]) []string {
+			var ret = make([]string, 0, len(page.Items))
+			for _, item := range page.Items {
+				ret = append(ret, item.Title)
+			}
+			return ret
+		}
+	)
+
+	t.Run("auth required", func(t *testing.T) {
+		resp, _ := serveTestRequest(t, ts, http.MethodGet, routeApi+"/feeds", nil, false, nil)
+		testutils.AssertEquals(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("feeds", func(t *testing.T) {
+		var list []FeedStatus
+		request(http.MethodGet, "/feeds", "", http.StatusOK, &list)
+		if testutils.AssertEquals(t, 3, len(list)); len(list) == 3 {
+			testutils.AssertEquals(t, []string{"bar", "del", "foo"},
+				[]string{list[0].Shortname, list[1].Shortname, list[2].Shortname})
+			testutils.AssertEquals(t, true, list[1].Deleted)
+			testutils.AssertEquals(t, 4, list[2].EpisodeCount)
+		}
+
+		var fs FeedStatus
+		request(http.MethodGet, "/feeds/foo", "", http.StatusOK, &fs)
+		testutils.AssertEquals(t, "foo", fs.Shortname)
+
+		var apiErr apiError
+		request(http.MethodGet, "/feeds/missing", "", http.StatusNotFound, &apiErr)
+		testutils.Assert(t, strings.Contains(apiErr.Error, "not found"), "unexpected error: "+apiErr.Error)
+	})
+
+	t.Run("items", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			query  string
+			status int
+			titles []string
+			total  int
+		}{
+			{"all", "", http.StatusOK, []string{"foo4", "foo3", "foo2", "foo1"}, 4},
+			{"downloaded", "?downloaded=true", http.StatusOK, []string{"foo4", "foo2"}, 2},
+			{"archived", "?archived=1", http.StatusOK, []string{"foo1"}, 1},
+			{"date range", "?after=2023-04-01&before=2023-04-04", http.StatusOK, []string{"foo3", "foo2"}, 2},
+			{"paged", "?limit=2&offset=1", http.StatusOK, []string{"foo3", "foo2"}, 4},
+			{"past end", "?offset=10", http.StatusOK, []string{}, 4},
+			{"bad filter", "?downloaded=foo", http.StatusBadRequest, nil, 0},
+			{"bad limit", "?limit=0", http.StatusBadRequest, nil, 0},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var page apiPage[apiItem]
+				request(http.MethodGet, "/feeds/foo/items"+tt.query, "", tt.status, &page)
+				if tt.status == http.StatusOK {
+					testutils.AssertEquals(t, tt.titles, titles(page))
+					testutils.AssertEquals(t, tt.total, page.Total)
+				}
+			})
+		}
+
+		// media url only for files on disk
+		var page apiPage[apiItem]
+		request(http.MethodGet, "/feeds/foo/items?downloaded=true", "", http.StatusOK, &page)
+		if len(page.Items) == 2 {
+			testutils.AssertEquals(t, "", page.Items[0].MediaUrl)
+			testutils.Assert(t, strings.HasPrefix(page.Items[1].MediaUrl, ts.URL+routeMedia+"foo/"),
+				"unexpected media url: "+page.Items[1].MediaUrl)
+		}
+
+		request(http.MethodGet, "/feeds/del/items", "", http.StatusNotFound, nil)
+	})
+
+	t.Run("patch item", func(t *testing.T) {
+		var page apiPage[apiItem]
+		request(http.MethodGet, "/feeds/foo/items?downloaded=false&archived=false", "", http.StatusOK, &page)
+		if testutils.AssertEquals(t, []string{"foo3"}, titles(page)); len(page.Items) != 1 {
+			return
+		}
+		var path = "/feeds/foo/items/" + strconv.FormatUint(uint64(page.Items[0].ID), 10)
+
+		request(http.MethodPatch, path, `{"Downloaded": true, "foo": 1}`, http.StatusBadRequest, nil)
+		request(http.MethodPatch, "/feeds/foo/items/999999", `{"Downloaded": true}`, http.StatusNotFound, nil)
+
+		var item apiItem
+		request(http.MethodPatch, path, `{"Downloaded": true}`, http.StatusOK, &item)
+		testutils.AssertEquals(t, true, item.Downloaded)
+		testutils.AssertEquals(t, false, item.Archived)
+		testutils.AssertEquals(t, false, item.Listened)
+
+		request(http.MethodPatch, path, `{"Listened": true}`, http.StatusOK, &item)
+		testutils.AssertEquals(t, true, item.Listened)
+
+		// persisted
+		item = apiItem{}
+		request(http.MethodGet, path, "", http.StatusOK, &item)
+		testutils.AssertEquals(t, true, item.Downloaded)
+		testutils.AssertEquals(t, true, item.Listened)
+	})
+
+	t.Run("runs", func(t *testing.T) {
+		for _, run := range []*RunDBEntry{
+			{FeedId: foo.ID, Shortname: "foo", Command: "update", StartedAt: serveTestDate},
+			{FeedId: bar.ID, Shortname: "bar", Command: "update", StartedAt: serveTestDate.AddDate(0, 0, 1)},
+			{FeedId: foo.ID, Shortname: "foo", Command: "update", StartedAt: serveTestDate.AddDate(0, 0, 2), Error: "foobar"},
+		} {
+			if err := db.saveRun(run); err != nil {
+				t.Fatalf("error saving run: %v", err)
+			}
+		}
+
+		var page apiPage[apiRun]
+		request(http.MethodGet, "/runs", "", http.StatusOK, &page)
+		testutils.AssertEquals(t, 3, page.Total)
+
+		page = apiPage[apiRun]{}
+		request(http.MethodGet, "/feeds/foo/runs?limit=1", "", http.StatusOK, &page)
+		testutils.AssertEquals(t, 2, page.Total)
+		if testutils.AssertEquals(t, 1, len(page.Items)); len(page.Items) == 1 {
+			testutils.AssertEquals(t, "foobar", page.Items[0].Error)
+		}
+	})
+
+	// served from the catalog; items only in an archive db are listed and loaded, but can't be changed
+	t.Run("archive only item", func(t *testing.T) {
+		arc, err := NewDB(filepath.Join(t.TempDir(), "foo.db"))
+		if err != nil {
+			t.Fatalf("error creating archive db: %v", err)
+		}
+		var feed = FeedDBEntry{PodDBModel: PodDBModel{ID: foo.ID}, Hash: foo.Hash, DBShortname: "foo", XmlFeedData: &FeedXmlDBEntry{}}
+		testutils.AssertErr(t, false, arc.saveFeed(&feed))
+		var item = generateItem(foo.ID, true)
+		item.XmlData.Title, item.Filename, item.Archived = "foo0", "foo0.mp3", true
+		item.PubTimeStamp = serveTestDate.AddDate(-2, 0, 0)
+		testutils.AssertErr(t, false, arc.saveItems(&item))
+		arc.Close()
+
+		catalog, err := db.openCatalog([]string{arc.path})
+		if err != nil {
+			t.Fatalf("error opening catalog: %v", err)
+		}
+		s.catalog = catalog
+		defer func() {
+			s.catalog = nil
+			catalog.Close()
+		}()
+
+		var page apiPage[apiItem]
+		request(http.MethodGet, "/feeds/foo/items?archived=true", "", http.StatusOK, &page)
+		if testutils.AssertEquals(t, []string{"foo1", "foo0"}, titles(page)); len(page.Items) != 2 {
+			return
+		}
+		var path = "/feeds/foo/items/" + strconv.FormatUint(uint64(page.Items[1].ID), 10)
+
+		var got apiItem
+		request(http.MethodGet, path, "", http.StatusOK, &got)
+		testutils.AssertEquals(t, "foo0", got.Title)
+		request(http.MethodPatch, path, `{"Listened": true}`, http.StatusConflict, nil)
+
+		// main db items are still changed thru the catalog
+		path = "/feeds/foo/items/" + strconv.FormatUint(uint64(page.Items[0].ID), 10)
+		request(http.MethodPatch, path, `{"Listened": true}`, http.StatusOK, &got)
+		testutils.AssertEquals(t, true, got.Listened)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		request(http.MethodPost, "/feeds/missing/update", "", http.StatusNotFound, nil)
+
+		// only one update at a time
+		s.mu.Lock()
+		s.active = "bar"
+		s.mu.Unlock()
+		defer func() { s.active = "" }()
+		request(http.MethodPost, "/feeds/foo/update", "", http.StatusConflict, nil)
+	})
+}
@@ -0,0 +1,121 @@
+package podconfig
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// archive policy; which items the archive command moves, and which directory (under the feed's
+// .arc directory) they are moved to.  Set globally in [config.archive], and per feed in
+// [feed.archive]; any value set on the feed overrides the global value
+type ArchivePolicy struct {
+	By   string `toml:"by,omitempty"`   // year (default), month, season, days or episodes
+	Age  int    `toml:"age,omitempty"`  // days or episodes; older than this many days, or beyond this many most recent episodes
+	Only string `toml:"only,omitempty"` // downloaded or listened; empty for every item
+	Path string `toml:"path,omitempty"` // directory name template; see ArchivePathVars
+}
+
+// archive by values; year, month and season archive items published before the current period
+const (
+	ArchiveByYear     = "year"
+	ArchiveByMonth    = "month"
+	ArchiveBySeason   = "season"
+	ArchiveByDays     = "days"
+	ArchiveByEpisodes = "episodes"
+)
+
+// archive only values
+const (
+	ArchiveOnlyDownloaded = "downloaded"
+	ArchiveOnlyListened   = "listened"
+)
+
+// variables available in the archive path template
+var ArchivePathVars = []string{"{shortname}", "{year}", "{month}", "{season}"}
+
+var pathVarRegex = regexp.MustCompile(`\{[^{}]*\}`)
+
+// --------------------------------------------------------------------------
+// policy with the feed's values (if any) replacing the global values
+func (p ArchivePolicy) Merge(feed *ArchivePolicy) ArchivePolicy {
+	if feed == nil {
+		return p
+	}
+	if feed.By != "" {
+		p.By = feed.By
+		// age only makes sense with the by it was set for
+		p.Age = feed.Age
+	} else if feed.Age != 0 {
+		p.Age = feed.Age
+	}
+	if feed.Only != "" {
+		p.Only = feed.Only
+	}
+	if feed.Path != "" {
+		p.Path = feed.Path
+	}
+	return p
+}
+
+// --------------------------------------------------------------------------
+// archive by, with the default applied
+func (p ArchivePolicy) ByOrDefault() string {
+	if p.By == "" {
+		return ArchiveByYear
+	}
+	return strings.ToLower(p.By)
+}
+
+// --------------------------------------------------------------------------
+// path template, or the default for the policy's archive by
+func (p ArchivePolicy) PathOrDefault() string {
+	if p.Path != "" {
+		return p.Path
+	}
+	switch p.ByOrDefault() {
+	case ArchiveByMonth:
+		return "{shortname}.{year}-{month}"
+	case ArchiveBySeason:
+		return "{shortname}.{season}"
+	default:
+		return "{shortname}.{year}"
+	}
+}
+
+// --------------------------------------------------------------------------
+func (p ArchivePolicy) Validate() error {
+	switch p.ByOrDefault() {
+	case ArchiveByYear, ArchiveByMonth, ArchiveBySeason:
+		if p.Age != 0 {
+			return fmt.Errorf("age is not used when archiving by %v", p.ByOrDefault())
+		}
+	case ArchiveByDays, ArchiveByEpisodes:
+		if p.Age <= 0 {
+			return fmt.Errorf("age must be greater than zero when archiving by %v", p.ByOrDefault())
+		}
+	default:
+		return fmt.Errorf("unrecognized archive by '%v' (use year, month, season, days or episodes)", p.By)
+	}
+
+	if p.Only != "" && strings.EqualFold(p.Only, ArchiveOnlyDownloaded) == false &&
+		strings.EqualFold(p.Only, ArchiveOnlyListened) == false {
+		return fmt.Errorf("unrecognized archive only '%v' (use downloaded or listened)", p.Only)
+	}
+
+	// a single directory under the feed's archive directory; archive dbs are found one level down
+	var path = p.PathOrDefault()
+	if strings.ContainsAny(path, `/\`) {
+		return errors.New("archive path cannot contain path separators")
+	} else if path == "." || path == ".." {
+		return fmt.Errorf("archive path cannot be '%v'", path)
+	}
+	for _, v := range pathVarRegex.FindAllString(path, -1) {
+		if slices.Contains(ArchivePathVars, v) == false {
+			return fmt.Errorf("unrecognized archive path variable '%v' (use %v)", v, strings.Join(ArchivePathVars, ", "))
+		}
+	}
+	return nil
+}
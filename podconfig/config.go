@@ -7,6 +7,7 @@ import (
 	"gopod/podutils"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pelletier/go-toml/v2"
@@ -14,32 +15,38 @@ import (
 
 // --------------------------------------------------------------------------
 type Config struct {
-	LogFilesRetained int `toml:"logfilesretained"`
-	MaxDupChecks     int `toml:"dupcheckmax"`
-	XmlFilesRetained int `toml:"xmlfilesretained"`
-	WorkspaceDir     string
-	Timestamp        time.Time
-	TimestampStr     string
+	LogFilesRetained  int           `toml:"logfilesretained"`
+	MaxDupChecks      int           `toml:"dupcheckmax"`
+	XmlFilesRetained  int           `toml:"xmlfilesretained"`
+	DbBackupsRetained int           `toml:"dbbackupsretained"` // with --backup-db; zero or less keeps all
+	ServeUser         string        `toml:"serveuser"`         // basic auth for serve; empty to disable
+	ServePassword     string        `toml:"servepassword"`     // basic auth for serve
+	Archive           ArchivePolicy `toml:"archive"`
+	WorkspaceDir      string
+	ConfigFile        string
+	Timestamp         time.Time
+	TimestampStr      string
 	// add in commandline options explicitly
 	commandline.CommandLineOptions
 }
 
 // --------------------------------------------------------------------------
 type FeedToml struct {
-	Name              string  `toml:"name"`
-	Shortname         string  `toml:"shortname"`
-	Url               string  `toml:"url"`
-	FilenameParse     string  `toml:"filenameParse,omitempty"`
-	Regex             string  `toml:"regex,omitempty"`
-	UrlParse          string  `toml:"urlParse,omitempty"`
-	CleanRep          *string `toml:"cleanReplacement,omitempty"`
-	EpisodePad        int     `toml:"episodePad,omitempty"`
-	CountStart        int     `toml:"countStart,omitempty"`
-	DupFilenameBypass string  `toml:"dupFilenameBypass,omitempty"`
-	StdChrono         bool    `toml:"stdChrono"`
-	ImageCompare      string  `toml:"imageCompare"`
-	AlwaysForce       bool    `toml:"alwaysForce"`
-	RetainQueryStr    bool    `toml:"retainQuerystring"`
+	Name              string         `toml:"name"`
+	Shortname         string         `toml:"shortname"`
+	Url               string         `toml:"url"`
+	FilenameParse     string         `toml:"filenameParse,omitempty"`
+	Regex             string         `toml:"regex,omitempty"`
+	UrlParse          string         `toml:"urlParse,omitempty"`
+	CleanRep          *string        `toml:"cleanReplacement,omitempty"`
+	EpisodePad        int            `toml:"episodePad,omitempty"`
+	CountStart        int            `toml:"countStart,omitempty"`
+	DupFilenameBypass string         `toml:"dupFilenameBypass,omitempty"`
+	StdChrono         bool           `toml:"stdChrono"`
+	ImageCompare      string         `toml:"imageCompare"`
+	AlwaysForce       bool           `toml:"alwaysForce"`
+	RetainQueryStr    bool           `toml:"retainQuerystring"`
+	Archive           *ArchivePolicy `toml:"archive,omitempty"` // overrides [config.archive]
 }
 
 // --------------------------------------------------------------------------
@@ -53,10 +60,12 @@ func LoadToml(filename string, timestamp time.Time) (*Config, []FeedToml, error)
 	tomldoc.Config.Timestamp = timestamp
 	tomldoc.Config.TimestampStr = timestamp.Format(podutils.TimeFormatStr)
 	tomldoc.Config.WorkspaceDir = filepath.Dir(filename)
+	tomldoc.Config.ConfigFile = filename
 
 	// defaults, if not defined in config
 	tomldoc.Config.MaxDupChecks = 3
 	tomldoc.Config.XmlFilesRetained = 4
+	tomldoc.Config.DbBackupsRetained = 5
 
 	file, err := os.Open(filename)
 	if err != nil {
@@ -75,10 +84,22 @@ func LoadToml(filename string, timestamp time.Time) (*Config, []FeedToml, error)
 		return nil, nil, fmt.Errorf("toml.Decode failed: %w", err)
 	}
 
+	if err := tomldoc.Config.Archive.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid archive config: %w", err)
+	}
+	for _, feed := range tomldoc.Feedlist {
+		if feed.Archive == nil {
+			continue
+		} else if err := tomldoc.Config.Archive.Merge(feed.Archive).Validate(); err != nil {
+			return nil, nil, fmt.Errorf("invalid archive config for feed '%v': %w", feed.Shortname, err)
+		}
+	}
+
 	return &tomldoc.Config, tomldoc.Feedlist, nil
 
 }
 
+// --------------------------------------------------------------------------
 func ExportToml(feed FeedToml, file string) error {
 
 	// match import config, without the config section
@@ -102,3 +123,70 @@ func ExportToml(feed FeedToml, file string) error {
 
 	return nil
 }
+
+// --------------------------------------------------------------------------
+// appends feed entries to the end of the given config file, as new [[feed]] blocks;
+// existing contents (including comments) are left untouched
+func AppendFeedToml(file string, feeds ...FeedToml) error {
+
+	type exportDoc struct {
+		Feedlist []FeedToml `toml:"feed"`
+	}
+
+	if len(feeds) == 0 {
+		return errors.New("no feeds to append")
+	}
+
+	var exportData = exportDoc{Feedlist: feeds}
+
+	buf, err := toml.Marshal(exportData)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := out.Write(append([]byte("\n"), buf...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// validates a feed entry against the existing feed list; name, shortname and url are required,
+// and both shortname and url must be unique.  The shortname names the feed's directories, so must be
+// a single path segment
+func ValidateFeedToml(feed FeedToml, existing []FeedToml) error {
+	if feed.Name == "" {
+		return errors.New("feed name cannot be empty")
+	} else if feed.Shortname == "" {
+		return errors.New("feed shortname cannot be empty")
+	} else if ValidShortname(feed.Shortname) == false {
+		return fmt.Errorf("feed shortname '%v' cannot be used as a directory name", feed.Shortname)
+	} else if feed.Url == "" {
+		return errors.New("feed url cannot be empty")
+	}
+
+	for _, ex := range existing {
+		var exShortname = ex.Shortname
+		if exShortname == "" {
+			exShortname = ex.Name
+		}
+		if strings.EqualFold(exShortname, feed.Shortname) {
+			return fmt.Errorf("shortname '%v' already exists in config", feed.Shortname)
+		} else if ex.Url == feed.Url {
+			return fmt.Errorf("url '%v' already exists in config (shortname '%v')", feed.Url, exShortname)
+		}
+	}
+	return nil
+}
+
+// --------------------------------------------------------------------------
+// shortname is usable as a directory in the workspace; a single path segment, not . or ..
+func ValidShortname(sn string) bool {
+	return sn != "" && sn != "." && sn != ".." && filepath.Base(sn) == sn && strings.ContainsAny(sn, `/\`) == false
+}
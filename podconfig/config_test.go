@@ -0,0 +1,39 @@
+package podconfig
+
+import (
+	"gopod/testutils"
+	"testing"
+)
+
+func TestValidateFeedToml(t *testing.T) {
+
+	var existing = []FeedToml{
+		{Name: "This Week in Tech", Shortname: "twit", Url: "https://foo.bar/twit"},
+		{Name: "darknet", Url: "https://foo.bar/darknet"},
+	}
+
+	tests := []struct {
+		name   string
+		feed   FeedToml
+		errStr string
+	}{
+		{"valid", FeedToml{Name: "foo", Shortname: "foo", Url: "https://foo.bar/foo"}, ""},
+		{"no name", FeedToml{Shortname: "foo", Url: "https://foo.bar/foo"}, "feed name cannot be empty"},
+		{"no shortname", FeedToml{Name: "foo", Url: "https://foo.bar/foo"}, "feed shortname cannot be empty"},
+		{"no url", FeedToml{Name: "foo", Shortname: "foo"}, "feed url cannot be empty"},
+		{"shortname parent", FeedToml{Name: "foo", Shortname: "../x", Url: "https://foo.bar/foo"}, "cannot be used as a directory name"},
+		{"shortname dotdot", FeedToml{Name: "foo", Shortname: "..", Url: "https://foo.bar/foo"}, "cannot be used as a directory name"},
+		{"shortname dot", FeedToml{Name: "foo", Shortname: ".", Url: "https://foo.bar/foo"}, "cannot be used as a directory name"},
+		{"shortname subdir", FeedToml{Name: "foo", Shortname: "a/b", Url: "https://foo.bar/foo"}, "cannot be used as a directory name"},
+		{"shortname backslash", FeedToml{Name: "foo", Shortname: `a\b`, Url: "https://foo.bar/foo"}, "cannot be used as a directory name"},
+		{"shortname absolute", FeedToml{Name: "foo", Shortname: "/tmp", Url: "https://foo.bar/foo"}, "cannot be used as a directory name"},
+		{"shortname exists", FeedToml{Name: "foo", Shortname: "TWIT", Url: "https://foo.bar/foo"}, "shortname 'TWIT' already exists"},
+		{"shortname exists on name", FeedToml{Name: "foo", Shortname: "darknet", Url: "https://foo.bar/foo"}, "shortname 'darknet' already exists"},
+		{"url exists", FeedToml{Name: "foo", Shortname: "foo", Url: "https://foo.bar/twit"}, "already exists in config (shortname 'twit')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.AssertErrContains(t, tt.errStr, ValidateFeedToml(tt.feed, existing))
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package podutils
+
+import (
+	"bytes"
+)
+
+// --------------------------------------------------------------------------
+// whether the start of a file looks like audio; recognizes id3 tagged and raw mpeg (mp3, adts aac),
+// mp4/m4a, ogg, flac and wav.  Doesn't validate beyond the header
+func IsAudioHeader(head []byte) bool {
+	switch {
+	case bytes.HasPrefix(head, []byte("ID3")),
+		bytes.HasPrefix(head, []byte("OggS")),
+		bytes.HasPrefix(head, []byte("fLaC")):
+		return true
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return true
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		return true
+	case len(head) >= 2 && head[0] == 0xff && head[1]&0xe0 == 0xe0:
+		// mpeg frame sync (11 bits); adts aac is a 12 bit sync
+		return true
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package podutils
+
+import (
+	"testing"
+
+	"gopod/testutils"
+)
+
+func TestIsAudioHeader(t *testing.T) {
+
+	tests := []struct {
+		name string
+		head []byte
+		want bool
+	}{
+		{"id3", []byte("ID3\x04\x00\x00"), true},
+		{"mpeg frame", []byte{0xff, 0xfb, 0x90, 0x64}, true},
+		{"adts aac", []byte{0xff, 0xf1, 0x50, 0x80}, true},
+		{"m4a", []byte("\x00\x00\x00\x20ftypM4A \x00\x00"), true},
+		{"ogg", []byte("OggS\x00\x02"), true},
+		{"flac", []byte("fLaC\x00\x00"), true},
+		{"wav", []byte("RIFF\x24\x08\x00\x00WAVEfmt "), true},
+		{"html", []byte("<!DOCTYPE html><html>"), false},
+		{"riff, not wave", []byte("RIFF\x24\x08\x00\x00AVI LIST"), false},
+		{"zeros", make([]byte, 16), false},
+		{"empty", []byte{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutils.AssertEquals(t, tt.want, IsAudioHeader(tt.head))
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package podutils
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// tags read from an ID3v2 header; zero values if not in the tag
+type Id3Tags struct {
+	Title string
+	Date  time.Time // recording date; only set when the tag has a full date
+}
+
+var ErrNoId3 = errors.New("no id3v2 tag")
+
+// --------------------------------------------------------------------------
+// reads title and date from a file's ID3v2 (2.2 thru 2.4) tag.  Only the text frames needed are
+// decoded; unsynchronised tags aren't supported
+func ReadId3(file string) (Id3Tags, error) {
+
+	var tags Id3Tags
+
+	in, err := os.Open(file)
+	if err != nil {
+		return tags, err
+	}
+	defer in.Close()
+
+	var header [10]byte
+	if _, err := io.ReadFull(in, header[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return tags, ErrNoId3
+		}
+		return tags, err
+	} else if string(header[:3]) != "ID3" {
+		return tags, ErrNoId3
+	}
+
+	var (
+		version = header[3]
+		flags   = header[5]
+		size    = syncsafe(header[6:10])
+		body    = make([]byte, size)
+	)
+	if version < 2 || version > 4 {
+		return tags, errors.New("unsupported id3v2 version")
+	} else if _, err := io.ReadFull(in, body); err != nil {
+		return tags, err
+	}
+
+	// extended header; size excludes itself in 2.3, includes it (and is syncsafe) in 2.4
+	if flags&0x40 != 0 && version > 2 && len(body) >= 4 {
+		var extSize = int(binary.BigEndian.Uint32(body[:4])) + 4
+		if version == 4 {
+			extSize = int(syncsafe(body[:4]))
+		}
+		if extSize > len(body) {
+			return tags, errors.New("id3 extended header too large")
+		}
+		body = body[extSize:]
+	}
+
+	var (
+		idLen, headLen = 4, 10
+		frames         = make(map[string]string)
+	)
+	if version == 2 {
+		idLen, headLen = 3, 6
+	}
+	for len(body) >= headLen && body[0] != 0 {
+		var (
+			id        = string(body[:idLen])
+			frameSize int
+		)
+		switch version {
+		case 2:
+			frameSize = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(body[4:8]))
+		default:
+			frameSize = int(syncsafe(body[4:8]))
+		}
+		if frameSize > len(body)-headLen {
+			break
+		}
+		if strings.HasPrefix(id, "T") {
+			frames[id] = decodeId3Text(body[headLen : headLen+frameSize])
+		}
+		body = body[headLen+frameSize:]
+	}
+
+	tags.Title = Tern(version == 2, frames["TT2"], frames["TIT2"])
+	switch version {
+	case 4:
+		tags.Date = parseId3Date(frames["TDRC"])
+	case 3:
+		tags.Date = parseId3Date(frames["TYER"], frames["TDAT"])
+	case 2:
+		tags.Date = parseId3Date(frames["TYE"], frames["TDA"])
+	}
+	return tags, nil
+}
+
+// --------------------------------------------------------------------------
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+// --------------------------------------------------------------------------
+// text frame content; first byte is the encoding
+func decodeId3Text(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	var (
+		enc  = data[0]
+		text = data[1:]
+		str  string
+	)
+	switch enc {
+	case 1, 2: // utf-16 with bom, utf-16be
+		var order binary.ByteOrder = binary.BigEndian
+		if enc == 1 && len(text) >= 2 {
+			if text[0] == 0xff && text[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			text = text[2:]
+		}
+		var units = make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			units = append(units, order.Uint16(text[i:]))
+		}
+		str = string(utf16.Decode(units))
+	case 3: // utf-8
+		str = string(text)
+	default: // iso-8859-1
+		var runes = make([]rune, 0, len(text))
+		for _, b := range text {
+			runes = append(runes, rune(b))
+		}
+		str = string(runes)
+	}
+	// multiple values are null separated; first is used
+	str, _, _ = strings.Cut(str, "\x00")
+	return strings.TrimSpace(str)
+}
+
+// --------------------------------------------------------------------------
+// 2.4 dates are iso 8601 (yyyy-MM-ddTHH:mm:ss, truncated to any precision); earlier versions have
+// the year and DDMM in separate frames
+func parseId3Date(year string, ddmm ...string) time.Time {
+	if len(ddmm) > 0 {
+		var dm = ddmm[0]
+		if len(year) != 4 || len(dm) != 4 {
+			return time.Time{}
+		}
+		year = year + "-" + dm[2:] + "-" + dm[:2]
+	}
+	if len(year) < len(time.DateOnly) {
+		return time.Time{}
+	}
+	date, err := time.Parse(time.DateOnly, year[:len(time.DateOnly)])
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
@@ -0,0 +1,69 @@
+package podutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopod/testutils"
+)
+
+func TestReadId3(t *testing.T) {
+
+	var (
+		dir   = t.TempDir()
+		audio = []byte{0xff, 0xfb, 0x90, 0x00}
+		date  = time.Date(2023, 3, 6, 0, 0, 0, 0, time.UTC)
+	)
+
+	// 2.3 tag, utf-16 title with bom, date split over year and DDMM
+	var v23 = func() []byte {
+		var (
+			body  []byte
+			frame = func(id string, data []byte) {
+				var size = len(data)
+				body = append(body, id...)
+				body = append(body, byte(size>>24), byte(size>>16), byte(size>>8), byte(size), 0, 0)
+				body = append(body, data...)
+			}
+		)
+		frame("TIT2", []byte{1, 0xff, 0xfe, 'F', 0, 'o', 0, 'o', 0})
+		frame("TYER", []byte("\x002023"))
+		frame("TDAT", []byte("\x000603"))
+		body = append(body, make([]byte, 16)...) // padding
+		var size = len(body)
+		return append([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, byte(size >> 7), byte(size & 0x7f)}, body...)
+	}
+
+	type exp struct {
+		tags   Id3Tags
+		errStr string
+	}
+	tests := []struct {
+		name string
+		data []byte
+		e    exp
+	}{
+		{"v2.4", testutils.GenerateId3(map[string]string{"TIT2": "Episode one", "TDRC": "2023-03-06T10:00:00"}),
+			exp{tags: Id3Tags{Title: "Episode one", Date: date}}},
+		{"v2.4, year only", testutils.GenerateId3(map[string]string{"TIT2": "Episode one", "TDRC": "2023"}),
+			exp{tags: Id3Tags{Title: "Episode one"}}},
+		{"v2.3", v23(), exp{tags: Id3Tags{Title: "Foo", Date: date}}},
+		{"no tag", audio, exp{errStr: "no id3v2 tag"}},
+		{"empty", []byte{}, exp{errStr: "no id3v2 tag"}},
+		{"truncated", testutils.GenerateId3(map[string]string{"TIT2": "Episode one"})[:12], exp{errStr: "EOF"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var file = filepath.Join(dir, tt.name+".mp3")
+			testutils.AssertErr(t, false, os.WriteFile(file, append(tt.data, audio...), 0644))
+
+			tags, err := ReadId3(file)
+			testutils.AssertErrContains(t, tt.e.errStr, err)
+			if err == nil {
+				testutils.AssertEquals(t, tt.e.tags, tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package podutils
+
+import (
+	"encoding/xml"
+	"errors"
+	"time"
+)
+
+// --------------------------------------------------------------------------
+type Opml struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    OpmlHead `xml:"head"`
+	Body    OpmlBody `xml:"body"`
+}
+
+type OpmlHead struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type OpmlBody struct {
+	Outlines []OpmlOutline `xml:"outline"`
+}
+
+type OpmlOutline struct {
+	Text    string `xml:"text,attr"`
+	Title   string `xml:"title,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	XmlUrl  string `xml:"xmlUrl,attr,omitempty"`
+	HtmlUrl string `xml:"htmlUrl,attr,omitempty"`
+	// categories/folders nest outlines
+	Outlines []OpmlOutline `xml:"outline,omitempty"`
+}
+
+// --------------------------------------------------------------------------
+func ParseOpml(data []byte) (*Opml, error) {
+	if len(data) == 0 {
+		return nil, errors.New("opml data is empty")
+	}
+
+	var doc Opml
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// --------------------------------------------------------------------------
+// returns all outlines that reference a feed (has xmlUrl), flattening any nested categories
+func (o Opml) FeedOutlines() []OpmlOutline {
+	var (
+		ret  = make([]OpmlOutline, 0)
+		walk func([]OpmlOutline)
+	)
+	walk = func(list []OpmlOutline) {
+		for _, outline := range list {
+			if outline.XmlUrl != "" {
+				ret = append(ret, outline)
+			}
+			walk(outline.Outlines)
+		}
+	}
+	walk(o.Body.Outlines)
+	return ret
+}
+
+// --------------------------------------------------------------------------
+// generates an opml 2.0 document, including xml header
+func GenerateOpml(title string, created time.Time, outlines []OpmlOutline) ([]byte, error) {
+	var doc = Opml{
+		Version: "2.0",
+		Head:    OpmlHead{Title: title},
+		Body:    OpmlBody{Outlines: outlines},
+	}
+	if created.IsZero() == false {
+		doc.Head.DateCreated = created.Format(time.RFC1123Z)
+	}
+
+	buf, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(buf, '\n')...), nil
+}
@@ -0,0 +1,73 @@
+package podutils
+
+import (
+	"gopod/testutils"
+	"testing"
+	"time"
+)
+
+func TestParseOpml(t *testing.T) {
+
+	var nested = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>subs</title></head>
+  <body>
+    <outline text="foo" title="Foo Cast" type="rss" xmlUrl="https://foo.bar/foo.xml" htmlUrl="https://foo.bar"/>
+    <outline text="category">
+      <outline text="bar" type="rss" xmlUrl="https://foo.bar/bar.xml"/>
+      <outline text="not a feed"/>
+    </outline>
+  </body>
+</opml>`
+
+	type exp struct {
+		title    string
+		outlines []OpmlOutline
+		errStr   string
+	}
+	tests := []struct {
+		name  string
+		input string
+		e     exp
+	}{
+		{"empty", "", exp{errStr: "opml data is empty"}},
+		{"not xml", "foobar", exp{errStr: "EOF"}},
+		{"no outlines", `<opml version="2.0"><head/><body/></opml>`, exp{outlines: []OpmlOutline{}}},
+		{"nested outlines", nested, exp{title: "subs", outlines: []OpmlOutline{
+			{Text: "foo", Title: "Foo Cast", Type: "rss", XmlUrl: "https://foo.bar/foo.xml", HtmlUrl: "https://foo.bar"},
+			{Text: "bar", Type: "rss", XmlUrl: "https://foo.bar/bar.xml"},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseOpml([]byte(tt.input))
+			if testutils.AssertErrContains(t, tt.e.errStr, err) {
+				testutils.AssertEquals(t, tt.e.title, doc.Head.Title)
+				testutils.AssertEquals(t, tt.e.outlines, doc.FeedOutlines())
+			}
+		})
+	}
+}
+
+func TestGenerateOpml(t *testing.T) {
+
+	var (
+		created  = time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+		outlines = []OpmlOutline{
+			{Text: "foo", Title: "Foo Cast", Type: "rss", XmlUrl: "https://foo.bar/foo.xml?a=1&b=2"},
+			{Text: "bar", Type: "rss", XmlUrl: "https://foo.bar/bar.xml", HtmlUrl: "https://foo.bar"},
+		}
+	)
+
+	buf, err := GenerateOpml("gopod", created, outlines)
+	testutils.AssertErr(t, false, err)
+
+	// round trip
+	doc, err := ParseOpml(buf)
+	if testutils.AssertErr(t, false, err) {
+		testutils.AssertEquals(t, "2.0", doc.Version)
+		testutils.AssertEquals(t, "gopod", doc.Head.Title)
+		testutils.AssertEquals(t, created.Format(time.RFC1123Z), doc.Head.DateCreated)
+		testutils.AssertEquals(t, outlines, doc.FeedOutlines())
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const TimeFormatStr = "20060102_150405"
@@ -68,3 +71,39 @@ func FormatBytes(b uint64) string {
 	}
 	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
 }
+
+// --------------------------------------------------------------------------
+// parses itunes:duration; either seconds, or [[HH:]MM:]SS (fractional seconds allowed)
+func ParseDuration(str string) (time.Duration, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return 0, fmt.Errorf("duration is empty")
+	}
+
+	var parts = strings.Split(str, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("duration '%v' not recognized", str)
+	}
+
+	var total float64
+	for idx, part := range parts {
+		var (
+			val float64
+			err error
+		)
+		// only the seconds (last) part can be fractional
+		if idx == len(parts)-1 {
+			val, err = strconv.ParseFloat(part, 64)
+		} else {
+			var v int
+			v, err = strconv.Atoi(part)
+			val = float64(v)
+		}
+		if err != nil || val < 0 {
+			return 0, fmt.Errorf("duration '%v' not recognized", str)
+		}
+		total = total*60 + val
+	}
+
+	return time.Duration(total * float64(time.Second)), nil
+}
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/go-test/deep"
 )
@@ -131,3 +132,29 @@ func TestChunk(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		str    string
+		want   time.Duration
+		errStr string
+	}{
+		{"empty", "  ", 0, "duration is empty"},
+		{"not a number", "foo", 0, "not recognized"},
+		{"too many parts", "1:2:3:4", 0, "not recognized"},
+		{"negative", "-5", 0, "not recognized"},
+		{"fractional minutes", "1.5:00", 0, "not recognized"},
+		{"seconds", "3725", 3725 * time.Second, ""},
+		{"fractional seconds", "90.5", 90*time.Second + 500*time.Millisecond, ""},
+		{"minutes seconds", "62:05", 62*time.Minute + 5*time.Second, ""},
+		{"hours minutes seconds", "01:02:05", time.Hour + 2*time.Minute + 5*time.Second, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDuration(tt.str)
+			testutils.AssertErrContains(t, tt.errStr, err)
+			testutils.AssertEquals(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package podutils
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+const (
+	itunesNamespace  = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	contentNamespace = "http://purl.org/rss/1.0/modules/content/"
+)
+
+// --------------------------------------------------------------------------
+type Rss struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	ItunesNs  string     `xml:"xmlns:itunes,attr"`
+	ContentNs string     `xml:"xmlns:content,attr,omitempty"` // only when items have content:encoded
+	Channel   RssChannel `xml:"channel"`
+}
+
+type RssChannel struct {
+	Title          string    `xml:"title"`
+	Link           string    `xml:"link,omitempty"`
+	Description    string    `xml:"description"`
+	Copyright      string    `xml:"copyright,omitempty"`
+	PubDate        string    `xml:"pubDate,omitempty"`
+	LastBuildDate  string    `xml:"lastBuildDate,omitempty"`
+	Image          *RssImage `xml:"image,omitempty"`
+	ItunesImage    *RssHref  `xml:"itunes:image,omitempty"`
+	ItunesAuthor   string    `xml:"itunes:author,omitempty"`
+	ItunesSubtitle string    `xml:"itunes:subtitle,omitempty"`
+	ItunesOwner    *RssOwner `xml:"itunes:owner,omitempty"`
+	NewFeedUrl     string    `xml:"itunes:new-feed-url,omitempty"`
+	Items          []RssItem `xml:"item"`
+}
+
+type RssImage struct {
+	Url   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type RssOwner struct {
+	Name  string `xml:"itunes:name,omitempty"`
+	Email string `xml:"itunes:email,omitempty"`
+}
+
+type RssHref struct {
+	Href string `xml:"href,attr"`
+}
+
+type RssItem struct {
+	Title          string       `xml:"title"`
+	Link           string       `xml:"link,omitempty"`
+	Description    string       `xml:"description,omitempty"`
+	ContentEncoded string       `xml:"content:encoded,omitempty"`
+	Author         string       `xml:"author,omitempty"`
+	Guid           *RssGuid     `xml:"guid,omitempty"`
+	PubDate        string       `xml:"pubDate,omitempty"`
+	Enclosure      RssEnclosure `xml:"enclosure"`
+	ItunesDuration string       `xml:"itunes:duration,omitempty"`
+	ItunesEpisode  string       `xml:"itunes:episode,omitempty"`
+	ItunesSeason   string       `xml:"itunes:season,omitempty"`
+	ItunesImage    *RssHref     `xml:"itunes:image,omitempty"`
+	ItunesAuthor   string       `xml:"itunes:author,omitempty"`
+	ItunesSummary  string       `xml:"itunes:summary,omitempty"`
+}
+
+type RssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type RssEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// --------------------------------------------------------------------------
+// formats timestamp for rss dates (RFC 822, with 4 digit year); zero time is empty
+func RssDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC1123Z)
+}
+
+// --------------------------------------------------------------------------
+// generates an rss 2.0 document (with itunes namespace), including xml header
+func GenerateRss(channel RssChannel) ([]byte, error) {
+	var doc = Rss{
+		Version:  "2.0",
+		ItunesNs: itunesNamespace,
+		Channel:  channel,
+	}
+	for _, item := range channel.Items {
+		if item.ContentEncoded != "" {
+			doc.ContentNs = contentNamespace
+			break
+		}
+	}
+
+	buf, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(buf, '\n')...), nil
+}
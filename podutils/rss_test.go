@@ -0,0 +1,102 @@
+package podutils
+
+import (
+	"gopod/testutils"
+	"testing"
+	"time"
+)
+
+// accepts everything; hash is the guid
+type rssTestProcess struct{}
+
+func (rssTestProcess) SkipParsingItem(string) (bool, bool)         { return false, false }
+func (rssTestProcess) CancelOnPubDate(time.Time) bool              { return false }
+func (rssTestProcess) CancelOnBuildDate(time.Time) bool            { return false }
+func (rssTestProcess) CalcItemHash(guid, _ string) (string, error) { return guid, nil }
+
+func TestGenerateRss(t *testing.T) {
+
+	var (
+		pubdate = time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+		channel = RssChannel{
+			Title:       "Foo Cast",
+			Link:        "https://foo.bar",
+			Description: "foo & bar",
+			ItunesImage: &RssHref{Href: "https://foo.bar/img.jpg"},
+			Copyright:   "(c) foo",
+			ItunesOwner: &RssOwner{Name: "foo", Email: "foo@foo.bar"},
+			Items: []RssItem{{
+				Title:          "episode <1>",
+				Guid:           &RssGuid{Value: "guid-1"},
+				PubDate:        RssDate(pubdate),
+				Enclosure:      RssEnclosure{Url: "http://localhost:8080/media/foo/1/ep1.mp3", Length: 1234, Type: "audio/mpeg"},
+				ItunesDuration: "1:02:03",
+				ItunesEpisode:  "1",
+				ContentEncoded: "<p>show notes</p>",
+				ItunesSummary:  "summary",
+			}},
+		}
+	)
+
+	buf, err := GenerateRss(channel)
+	testutils.AssertErr(t, false, err)
+
+	// round trip thru the feed parser
+	feedData, items, err := ParseXml(buf, rssTestProcess{})
+	if testutils.AssertErr(t, false, err) {
+		testutils.AssertEquals(t, "Foo Cast", feedData.Title)
+		testutils.AssertEquals(t, "foo & bar", feedData.Description)
+		testutils.AssertEquals(t, "https://foo.bar/img.jpg", feedData.ItunesImageUrl)
+		testutils.AssertEquals(t, "(c) foo", feedData.Copyright)
+		testutils.AssertEquals(t, "foo@foo.bar", feedData.ItunesOwner.Email)
+		if testutils.AssertEquals(t, 1, len(items)); len(items) == 1 {
+			var item = items[0].ItemData
+			testutils.AssertEquals(t, "guid-1", items[0].Hash)
+			testutils.AssertEquals(t, "episode <1>", item.Title)
+			testutils.AssertEquals(t, pubdate, item.Pubdate.UTC())
+			testutils.AssertEquals(t, "1:02:03", item.DurationStr)
+			testutils.AssertEquals(t, "1", item.EpisodeStr)
+			testutils.AssertEquals(t, "<p>show notes</p>", item.ContentEncoded)
+			testutils.AssertEquals(t, "summary", item.ItunesSummary)
+			testutils.AssertEquals(t, uint(1234), item.Enclosure.Length)
+			testutils.AssertEquals(t, "audio/mpeg", item.Enclosure.TypeStr)
+			testutils.AssertEquals(t, "http://localhost:8080/media/foo/1/ep1.mp3", item.Enclosure.Url)
+		}
+	}
+}
+
+// skips every item, cancelling the rest after the first; tracks every item seen
+type trackTestProcess struct {
+	rssTestProcess
+	tracked []string
+}
+
+func (*trackTestProcess) SkipParsingItem(string) (bool, bool) { return true, true }
+func (tp *trackTestProcess) TrackItem(hash string, guid string, item *XItemData) {
+	if item == nil {
+		// after the cancel; not parsed
+		tp.tracked = append(tp.tracked, hash+":"+guid)
+		return
+	}
+	tp.tracked = append(tp.tracked, hash+":"+item.Title)
+}
+
+func TestParseXml_trackItems(t *testing.T) {
+
+	var channel = RssChannel{Title: "Foo Cast", Link: "https://foo.bar"}
+	for _, guid := range []string{"guid-3", "guid-2", "guid-1"} {
+		channel.Items = append(channel.Items, RssItem{
+			Title:     "episode " + guid,
+			Guid:      &RssGuid{Value: guid},
+			Enclosure: RssEnclosure{Url: "https://foo.bar/" + guid + ".mp3", Type: "audio/mpeg"},
+		})
+	}
+	buf, err := GenerateRss(channel)
+	testutils.AssertErr(t, false, err)
+
+	var tp trackTestProcess
+	_, items, err := ParseXml(buf, &tp)
+	testutils.AssertErr(t, false, err)
+	testutils.AssertEquals(t, 0, len(items))
+	testutils.AssertEquals(t, []string{"guid-3:episode guid-3", "guid-2:guid-2", "guid-1:guid-1"}, tp.tracked)
+}
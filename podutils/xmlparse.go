@@ -39,6 +39,7 @@ type XItemData struct {
 	Pubdate        time.Time
 	SeasonStr      string
 	EpisodeStr     string
+	DurationStr    string
 	Guid           string
 	Link           string
 	Author         string
@@ -87,6 +88,13 @@ type FeedProcess interface {
 	CalcItemHash(guid string, url string) (string, error)
 }
 
+// optional for FeedProcess; if implemented, every item in the feed is passed in feed order, including
+// items skipped and items after remaining items are cancelled.  Items after remaining items are
+// cancelled aren't parsed; only their hash and guid are passed, with itemData nil
+type FeedItemTracker interface {
+	TrackItem(hash string, guid string, itemData *XItemData)
+}
+
 type ParseCanceledError struct {
 	cancelReason string
 }
@@ -190,23 +198,40 @@ func ParseXml(xmldata []byte, fp FeedProcess) (feedData *XChannelData, newItems
 
 		case strings.EqualFold(elem.FullTag(), "item"):
 
-			if skipRemaining == false {
-				// check to see if hash exists
-				hash, e := calcHash(elem, fp)
-				if e != nil {
-					log.Errorf("error in calculating hash; skipping item entry: %v", e)
-					continue
+			tracker, tracking := fp.(FeedItemTracker)
+			if skipRemaining && tracking == false {
+				continue
+			}
+
+			// check to see if hash exists
+			hash, guid, e := calcHash(elem, fp)
+			if e != nil {
+				log.Errorf("error in calculating hash; skipping item entry: %v", e)
+				continue
+			} else if skipRemaining {
+				// only tracking; nothing else is needed from the item
+				tracker.TrackItem(hash, guid, nil)
+				continue
+			}
+			var skipitem bool
+			skipitem, skipRemaining = fp.SkipParsingItem(hash)
+
+			if skipitem == false {
+				// not skipping xItemData; automatically add to new xItemData set
+				xItemData, e := parseItemEntry(elem)
+				if e == nil {
+					var newPair = ItemPair{Hash: hash, ItemData: &xItemData}
+					newItems = append(newItems, newPair)
+				} else {
+					log.Warnf("parse failed; not adding item {'%v' (%v)}: %v", xItemData.Title, hash, e)
 				}
-				var skipitem = false
-				if skipitem, skipRemaining = fp.SkipParsingItem(hash); skipitem == false {
-					// not skipping xItemData; automatically add to new xItemData set
-					if xItemData, e := parseItemEntry(elem); e == nil {
-						var newPair = ItemPair{Hash: hash, ItemData: &xItemData}
-						newItems = append(newItems, newPair)
-					} else {
-						log.Warnf("parse failed; not adding item {'%v' (%v)}: %v", xItemData.Title, hash, e)
-					}
+				if tracking {
+					tracker.TrackItem(hash, guid, &xItemData)
 				}
+			} else if tracking {
+				// still in the feed; parse errors don't matter for tracking
+				xItemData, _ := parseItemEntry(elem)
+				tracker.TrackItem(hash, guid, &xItemData)
 			}
 
 		default:
@@ -234,7 +259,8 @@ func getAttributeText(elem *etree.Element, attr string) string {
 }
 
 // --------------------------------------------------------------------------
-func calcHash(elem *etree.Element, fp FeedProcess) (string, error) {
+// returns the hash, and the guid it was calculated from
+func calcHash(elem *etree.Element, fp FeedProcess) (string, string, error) {
 	// first, get the guid/urlstr, check to see if it exists
 	var (
 		guid   string
@@ -253,7 +279,8 @@ func calcHash(elem *etree.Element, fp FeedProcess) (string, error) {
 	// by moving the calcHash up to feed, it will handle urlparse factoring as well
 	// by doing so, just with the guid and parsed url we can recreate the hash
 
-	return fp.CalcItemHash(guid, urlstr)
+	hash, err := fp.CalcItemHash(guid, urlstr)
+	return hash, guid, err
 }
 
 // --------------------------------------------------------------------------
@@ -315,6 +342,8 @@ func parseItemEntry(elem *etree.Element) (item XItemData, err error) {
 			item.SeasonStr = child.Text()
 		case strings.EqualFold(child.FullTag(), "itunes:episode"):
 			item.EpisodeStr = child.Text()
+		case strings.EqualFold(child.FullTag(), "itunes:duration"):
+			item.DurationStr = strings.TrimSpace(child.Text())
 		case strings.EqualFold(child.FullTag(), "enclosure"):
 			if lenStr := child.SelectAttr("length"); lenStr != nil {
 				if lenStr.Value == "" {
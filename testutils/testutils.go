@@ -159,3 +159,27 @@ func AssertDiffFunc[T comparable](tb testing.TB, wantList, gotList []T, comp fun
 	Assert(tb, len(missing) == 0, fmt.Sprintf("Missing types in wantList: %v", missing))
 	Assert(tb, len(extra) == 0, fmt.Sprintf("Extra types in gotList: %v", extra))
 }
+
+// builds an ID3v2.4 tag with utf-8 text frames (i.e. TIT2, TDRC), to prefix test audio files with
+func GenerateId3(frames map[string]string) []byte {
+	var (
+		body     []byte
+		ids      = make([]string, 0, len(frames))
+		syncsafe = func(n int) []byte {
+			return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+		}
+	)
+	for id := range frames {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		var text = append([]byte{3}, frames[id]...)
+		body = append(body, id...)
+		body = append(body, syncsafe(len(text))...)
+		body = append(body, 0, 0)
+		body = append(body, text...)
+	}
+	var tag = append([]byte{'I', 'D', '3', 4, 0, 0}, syncsafe(len(body))...)
+	return append(tag, body...)
+}